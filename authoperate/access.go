@@ -0,0 +1,107 @@
+package authoperate
+
+import (
+	"sort"
+)
+
+// 能够访问某个路由方法的用户
+type RouteAccessUser struct {
+	UserId   string   `json:"userId"`
+	Name     string   `json:"name"`
+	Roles    []string `json:"roles"`    //权限来源的角色
+	IsAdmin  bool     `json:"isAdmin"`  //通过超管角色获得，不需要判断数据权限
+	DataAuth bool     `json:"dataAuth"` //访问时还需要signKey的数据权限
+}
+
+type AccessRoute struct {
+	Uri     string   `json:"uri"`
+	Methods []string `json:"methods"`
+}
+
+// 能够访问某个signKey下数据的用户，以及能通过哪些路由访问
+type SignAccessUser struct {
+	UserId  string        `json:"userId"`
+	Name    string        `json:"name"`
+	Via     string        `json:"via"` //owner表示signKey的创建者，grant表示被授权，admin表示超管角色
+	Routers []AccessRoute `json:"routers"`
+}
+
+// 哪些用户拥有uri+method的路由权限
+func (ps *PolicyState) RouteAccess(uri, method string) []RouteAccessUser {
+	users := []RouteAccessUser{}
+
+	for _, userId := range ps.UserIds() {
+		isAdmin, roleAuth, existDataAuth := ps.RoleAuth(uri, method, userId)
+		if !roleAuth {
+			continue
+		}
+
+		roles := []string{}
+		for _, rp := range ps.UserRoutePermissions(userId) {
+			if rp.Uri == uri && rp.Method == method {
+				roles = rp.Roles
+				break
+			}
+		}
+
+		users = append(users, RouteAccessUser{
+			UserId:   userId,
+			Name:     ps.UserName(userId),
+			Roles:    roles,
+			IsAdmin:  isAdmin,
+			DataAuth: existDataAuth,
+		})
+	}
+
+	return users
+}
+
+// 哪些用户能够访问signKey下的数据，只返回同时拥有角色权限的路由和方法
+func (ps *PolicyState) SignKeyAccess(signKey string) []SignAccessUser {
+	users := []SignAccessUser{}
+
+	for _, userId := range ps.UserIds() {
+		via := ""
+		routes := map[string]map[string]struct{}{}
+		for _, sp := range ps.UserSignPermissions(userId) {
+			if sp.SignKey != signKey && sp.SignKey != AnySignKey {
+				continue
+			}
+			// 超管同时是创建者或被授权时，以真实的来源为准
+			if via == "" || via == SignViaAdmin {
+				via = sp.Via
+			}
+			if _, ok := routes[sp.Uri]; !ok {
+				routes[sp.Uri] = make(map[string]struct{})
+			}
+			routes[sp.Uri][sp.Method] = struct{}{}
+		}
+
+		if len(routes) == 0 {
+			continue
+		}
+
+		routers := []AccessRoute{}
+		for uri, ms := range routes {
+			methods := []string{}
+			for method := range ms {
+				methods = append(methods, method)
+			}
+			sort.Strings(methods)
+			routers = append(routers, AccessRoute{
+				Uri:     uri,
+				Methods: methods,
+			})
+		}
+		sort.Slice(routers, func(i, j int) bool { return routers[i].Uri < routers[j].Uri })
+
+		users = append(users, SignAccessUser{
+			UserId:  userId,
+			Name:    ps.UserName(userId),
+			Via:     via,
+			Routers: routers,
+		})
+	}
+
+	return users
+}
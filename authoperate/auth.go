@@ -1,6 +1,7 @@
 package authoperate
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
@@ -15,6 +16,11 @@ type Authorization struct {
 	dataBaseName string
 
 	mongoFactory *mongo.MongoFactory
+
+	pinyin PinyinFunc // 为nil时搜索不匹配拼音
+
+	txnSupported bool // 部署支持多文档事务时，多文档修改在事务中执行
+	txnSessions  txnSessionPool
 }
 
 const (
@@ -24,11 +30,19 @@ const (
 	signCollName   = "TC_OREO_SIGN"
 	userCollName   = "TC_OREO_USER"
 
-	SignKeyLimit       = 50
-	splitString        = "_/oreo/_"
-	superAdminRoleType = 1
+	SignKeyLimit = 50
+	splitString  = "_/oreo/_"
+
+	// 超管角色的类型，超管拥有全部路由权限和所有signKey的数据权限
+	SuperAdminRoleType = 1
 )
 
+// 写入时携带的版本号与数据库中的不一致，说明数据已被他人修改
+var ErrVersionConflict = errors.New("version conflict, the document has been modified by others")
+
+// 查询单个文档时文档不存在
+var ErrNotFound = errors.New("not found")
+
 var groupIndex mgo.Index = mgo.Index{
 	Key:    []string{"groupName"},
 	Unique: true,
@@ -56,6 +70,12 @@ func NewAuthorization(groupName, db string, mf *mongo.MongoFactory) (*Authorizat
 		return nil, err
 	}
 
+	if err := auth.initVersion(); err != nil {
+		return nil, err
+	}
+
+	auth.initTxnSupport()
+
 	return auth, nil
 }
 
@@ -75,6 +95,71 @@ func (auth *Authorization) methodString2Num(method string) int {
 	return val
 }
 
+// 每次更新都会将文档的版本号加1，version大于0时要求数据库中的版本号与之一致，否则返回ErrVersionConflict
+func versionUpdate(coll *mgo.Collection, query, update bson.M, version int64) error {
+	inc, ok := update["$inc"].(bson.M)
+	if !ok {
+		inc = bson.M{}
+		update["$inc"] = inc
+	}
+	inc["version"] = 1
+
+	if version > 0 {
+		query["version"] = version
+	}
+
+	err := coll.Update(query, update)
+	if err == mgo.ErrNotFound && version > 0 {
+		delete(query, "version")
+		if n, cerr := coll.Find(query).Count(); cerr == nil && n > 0 {
+			return ErrVersionConflict
+		}
+	}
+
+	return err
+}
+
+// 为加入版本号之前写入的文档补上版本号1，避免ETag为0时客户端回传If-Match: 0关闭版本校验
+func (auth *Authorization) initVersion() error {
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return err
+	}
+	defer auth.mongoFactory.Put(session)
+	db := session.DB(auth.dataBaseName)
+
+	q := bson.M{
+		"groupName": auth.groupName,
+		"version":   bson.M{"$exists": false},
+	}
+
+	for _, collName := range []string{routerCollName, roleCollName, userCollName, signCollName} {
+		if _, err := db.C(collName).UpdateAll(q, bson.M{"$set": bson.M{"version": 1}}); err != nil {
+			return fmt.Errorf("init %s version exception %s", collName, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (auth *Authorization) initTxnSupport() {
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return
+	}
+	defer auth.mongoFactory.Put(session)
+
+	auth.txnSupported = detectTxnSupport(session)
+}
+
+// 从未修改过的文档没有version字段，查询时需要特殊处理
+func versionMatch(version int64) interface{} {
+	if version > 0 {
+		return version
+	}
+	return bson.M{"$exists": false}
+}
+
 func (auth *Authorization) initGroup() error {
 	session, err := auth.mongoFactory.Get()
 	if err != nil {
@@ -208,9 +293,37 @@ func (auth *Authorization) initCollIndex() error {
 		return err
 	}
 
+	if err := auth.mongoFactory.CreateIndex(auth.dataBaseName, userCollName, userPinyinIndex); err != nil {
+		return err
+	}
+
+	if err := auth.mongoFactory.CreateIndex(auth.dataBaseName, routerCollName, routerPinyinIndex); err != nil {
+		return err
+	}
+
 	if err := auth.mongoFactory.CreateIndex(auth.dataBaseName, groupCollName, groupIndex); err != nil {
 		return err
 	}
 
+	if err := auth.mongoFactory.CreateIndex(auth.dataBaseName, eventCollName, eventIndex); err != nil {
+		return err
+	}
+
+	if err := auth.mongoFactory.CreateIndex(auth.dataBaseName, eventCollName, eventExpireIndex); err != nil {
+		return err
+	}
+
+	if err := auth.mongoFactory.CreateIndex(auth.dataBaseName, scopeCollName, scopeIndex); err != nil {
+		return err
+	}
+
+	if err := auth.mongoFactory.CreateIndex(auth.dataBaseName, snapshotCollName, snapshotIndex); err != nil {
+		return err
+	}
+
+	if err := auth.mongoFactory.CreateIndex(auth.dataBaseName, snapshotItemCollName, snapshotItemIndex); err != nil {
+		return err
+	}
+
 	return nil
 }
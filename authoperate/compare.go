@@ -0,0 +1,146 @@
+package authoperate
+
+import (
+	"fmt"
+	"sort"
+)
+
+// 他人授权给用户的signKey，不包括用户自己创建的signKey
+type SignGrant struct {
+	SignKey string        `json:"signKey"`
+	Routers []AccessRoute `json:"routers"`
+}
+
+// 两个用户权限的差异，Only开头的是UserId独有的，OtherOnly开头的是OtherUserId独有的
+type UserAccessDiff struct {
+	UserId              string            `json:"userId"`
+	OtherUserId         string            `json:"otherUserId"`
+	OnlyRoles           []string          `json:"onlyRoles"`
+	OtherOnlyRoles      []string          `json:"otherOnlyRoles"`
+	OnlyRouters         []RoutePermission `json:"onlyRouters"`
+	OtherOnlyRouters    []RoutePermission `json:"otherOnlyRouters"`
+	OnlySignGrants      []SignGrant       `json:"onlySignGrants"`
+	OtherOnlySignGrants []SignGrant       `json:"otherOnlySignGrants"`
+}
+
+// 用户被授权的signKey和路由方法，key为signKey，value为uri对应的方法整型值之和
+func (ps *PolicyState) UserSignGrants(userId string) map[string]map[string]int {
+	ps.index()
+
+	grants := make(map[string]map[string]int)
+	for _, i := range ps.userSigns[userId] {
+		sign := ps.Signs[i]
+		if ps.signOwner[sign.SignKey] == userId {
+			continue
+		}
+		if _, ok := grants[sign.SignKey]; !ok {
+			grants[sign.SignKey] = make(map[string]int)
+		}
+		for uri, mv := range sign.VerifyDataUri {
+			grants[sign.SignKey][uri] |= mv
+		}
+	}
+
+	return grants
+}
+
+func (ps *PolicyState) CompareUsers(userId, otherUserId string) UserAccessDiff {
+	diff := UserAccessDiff{
+		UserId:      userId,
+		OtherUserId: otherUserId,
+	}
+
+	roles := ps.UserRoleNames(userId)
+	otherRoles := ps.UserRoleNames(otherUserId)
+	diff.OnlyRoles = stringsExclude(roles, otherRoles)
+	diff.OtherOnlyRoles = stringsExclude(otherRoles, roles)
+
+	routers := ps.UserRoutePermissions(userId)
+	otherRouters := ps.UserRoutePermissions(otherUserId)
+	diff.OnlyRouters = routePermissionsExclude(routers, otherRouters)
+	diff.OtherOnlyRouters = routePermissionsExclude(otherRouters, routers)
+
+	grants := ps.UserSignGrants(userId)
+	otherGrants := ps.UserSignGrants(otherUserId)
+	diff.OnlySignGrants = ps.signGrantsExclude(grants, otherGrants)
+	diff.OtherOnlySignGrants = ps.signGrantsExclude(otherGrants, grants)
+
+	return diff
+}
+
+// 返回src中有而dest中没有的路由方法，key为signKey，value为uri对应的方法整型值之和
+func SignGrantsMissing(src, dest map[string]map[string]int) map[string]map[string]int {
+	missing := make(map[string]map[string]int)
+	for signKey, uris := range src {
+		for uri, mv := range uris {
+			lack := mv &^ dest[signKey][uri]
+			if lack == 0 {
+				continue
+			}
+			if _, ok := missing[signKey]; !ok {
+				missing[signKey] = make(map[string]int)
+			}
+			missing[signKey][uri] = lack
+		}
+	}
+	return missing
+}
+
+func (ps *PolicyState) signGrantsExclude(src, dest map[string]map[string]int) []SignGrant {
+	missing := SignGrantsMissing(src, dest)
+
+	grants := []SignGrant{}
+	for signKey, uris := range missing {
+		routers := []AccessRoute{}
+		for uri, mv := range uris {
+			methods := []string{}
+			for _, m := range ps.auth.MethodValueToMethods(mv) {
+				methods = append(methods, ps.auth.NumStringToMethod(m))
+			}
+			routers = append(routers, AccessRoute{
+				Uri:     uri,
+				Methods: methods,
+			})
+		}
+		sort.Slice(routers, func(i, j int) bool { return routers[i].Uri < routers[j].Uri })
+
+		grants = append(grants, SignGrant{
+			SignKey: signKey,
+			Routers: routers,
+		})
+	}
+
+	sort.Slice(grants, func(i, j int) bool { return grants[i].SignKey < grants[j].SignKey })
+
+	return grants
+}
+
+func stringsExclude(src, dest []string) []string {
+	set := make(map[string]struct{})
+	for _, s := range dest {
+		set[s] = struct{}{}
+	}
+
+	res := []string{}
+	for _, s := range src {
+		if _, ok := set[s]; !ok {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+func routePermissionsExclude(src, dest []RoutePermission) []RoutePermission {
+	set := make(map[string]struct{})
+	for _, rp := range dest {
+		set[fmt.Sprintf("%s%s", rp.Uri, rp.Method)] = struct{}{}
+	}
+
+	res := []RoutePermission{}
+	for _, rp := range src {
+		if _, ok := set[fmt.Sprintf("%s%s", rp.Uri, rp.Method)]; !ok {
+			res = append(res, rp)
+		}
+	}
+	return res
+}
@@ -0,0 +1,180 @@
+package authoperate
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+const (
+	eventCollName = "TC_OREO_EVENT"
+
+	// 事件保留时长，超过后由mongo的TTL索引自动清除
+	eventExpire = 7 * 24 * time.Hour
+
+	// 所有用户都需要关心的事件，例如路由的数据权限变更
+	EventAllUsers = "*"
+
+	// 序号先通过$inc分配再写入事件，并发发布时序号大的事件可能先写入，
+	// 缺失的序号超过该时长仍未写入时视为发布失败，查询时跳过
+	eventGapWait = 10 * time.Second
+)
+
+// 权限变更事件的类型
+const (
+	EventRoleGrant   = "role_grant"   // 用户被加入角色
+	EventRoleRevoke  = "role_revoke"  // 用户被移出角色
+	EventRoleUpdate  = "role_update"  // 用户所在角色的路由和方法被修改
+	EventSignGrant   = "sign_grant"   // signKey授权给用户或授权的路由和方法增加
+	EventSignRevoke  = "sign_revoke"  // signKey的授权被收回或授权的路由和方法减少
+	EventRouteUpdate = "route_update" // 路由被删除或数据权限启停
+	EventDefaultRole = "default_role" // 默认角色变更，新用户加入的角色改变
+)
+
+var eventIndex mgo.Index = mgo.Index{
+	Key:    []string{"groupName", "seq"},
+	Unique: true,
+	Name:   "groupName_seq",
+}
+
+var eventExpireIndex mgo.Index = mgo.Index{
+	Key:         []string{"createTime"},
+	ExpireAfter: eventExpire,
+	Name:        "createTime",
+}
+
+type PermissionEvent struct {
+	Seq        int64     `json:"seq" bson:"seq"` //组内单调递增，用于SSE的断线重连
+	GroupName  string    `json:"-" bson:"groupName"`
+	Type       string    `json:"type" bson:"type"`
+	UserIds    []string  `json:"-" bson:"userIds"`
+	RoleName   string    `json:"roleName,omitempty" bson:"roleName,omitempty"`
+	SignKey    string    `json:"signKey,omitempty" bson:"signKey,omitempty"`
+	Uri        string    `json:"uri,omitempty" bson:"uri,omitempty"`
+	CreateTime time.Time `json:"createTime" bson:"createTime"`
+}
+
+func (auth *Authorization) eventNextSeq(session *mgo.Session) (int64, error) {
+	coll := session.DB(auth.dataBaseName).C(groupCollName)
+
+	change := mgo.Change{
+		Update:    bson.M{"$inc": bson.M{"eventSeq": 1}},
+		ReturnNew: true,
+	}
+
+	doc := struct {
+		EventSeq int64 `bson:"eventSeq"`
+	}{}
+
+	if _, err := coll.Find(bson.M{"groupName": auth.groupName}).Apply(change, &doc); err != nil {
+		return 0, fmt.Errorf("event seq exception %s", err.Error())
+	}
+
+	return doc.EventSeq, nil
+}
+
+// 记录一条权限变更事件，userIds为受影响的用户，EventAllUsers表示所有用户
+func (auth *Authorization) EventPublish(event PermissionEvent) error {
+	if len(event.UserIds) == 0 {
+		return nil
+	}
+
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return err
+	}
+	defer auth.mongoFactory.Put(session)
+
+	seq, err := auth.eventNextSeq(session)
+	if err != nil {
+		return err
+	}
+
+	event.Seq = seq
+	event.GroupName = auth.groupName
+	event.CreateTime = time.Now()
+
+	coll := session.DB(auth.dataBaseName).C(eventCollName)
+	if err := coll.Insert(event); err != nil {
+		return fmt.Errorf("publish event exception %s", err.Error())
+	}
+
+	return nil
+}
+
+type eventSeqTime struct {
+	Seq        int64     `bson:"seq"`
+	CreateTime time.Time `bson:"createTime"`
+}
+
+// 从cursor开始只推进到连续的序号，序号之间有缺失时停在缺失之前，
+// 除非缺失之后的事件已经写入超过eventGapWait
+func eventSafeSeq(cursor int64, seqs []eventSeqTime, now time.Time) int64 {
+	for _, s := range seqs {
+		if s.Seq != cursor+1 && now.Sub(s.CreateTime) < eventGapWait {
+			break
+		}
+		cursor = s.Seq
+	}
+	return cursor
+}
+
+// 查询userId在seq之后的权限变更事件，返回事件和下一次查询的起点。
+// 起点只会推进到组内连续写入的序号，避免并发发布时跳过还未写入的事件
+func (auth *Authorization) EventQuery(userId string, seq int64, limit int) ([]PermissionEvent, int64, error) {
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return nil, seq, err
+	}
+	defer auth.mongoFactory.Put(session)
+	coll := session.DB(auth.dataBaseName).C(eventCollName)
+
+	seqs := []eventSeqTime{}
+	err = coll.Find(bson.M{
+		"groupName": auth.groupName,
+		"seq":       bson.M{"$gt": seq},
+	}).Sort("seq").Limit(limit).Select(bson.M{"seq": 1, "createTime": 1}).All(&seqs)
+	if err != nil {
+		return nil, seq, fmt.Errorf("query event exception %s", err.Error())
+	}
+
+	next := eventSafeSeq(seq, seqs, time.Now())
+	if next == seq {
+		return []PermissionEvent{}, seq, nil
+	}
+
+	q := bson.M{
+		"groupName": auth.groupName,
+		"seq":       bson.M{"$gt": seq, "$lte": next},
+		"userIds":   bson.M{"$in": []string{userId, EventAllUsers}},
+	}
+
+	events := []PermissionEvent{}
+	if err := coll.Find(q).Sort("seq").All(&events); err != nil {
+		return nil, seq, fmt.Errorf("query event exception %s", err.Error())
+	}
+
+	return events, next, nil
+}
+
+// 查询组内最新的事件序号，SSE连接未带Last-Event-ID时从此处开始推送
+func (auth *Authorization) EventLastSeq() (int64, error) {
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return 0, err
+	}
+	defer auth.mongoFactory.Put(session)
+	coll := session.DB(auth.dataBaseName).C(groupCollName)
+
+	doc := struct {
+		EventSeq int64 `bson:"eventSeq"`
+	}{}
+
+	if err := coll.Find(bson.M{"groupName": auth.groupName}).Select(bson.M{"eventSeq": 1}).One(&doc); err != nil {
+		return 0, fmt.Errorf("query event seq exception %s", err.Error())
+	}
+
+	return doc.EventSeq, nil
+}
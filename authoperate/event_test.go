@@ -0,0 +1,32 @@
+package authoperate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventSafeSeq(t *testing.T) {
+	now := time.Now()
+	fresh := now.Add(-time.Second)
+	stale := now.Add(-2 * eventGapWait)
+
+	cases := []struct {
+		name   string
+		cursor int64
+		seqs   []eventSeqTime
+		want   int64
+	}{
+		{"empty", 5, nil, 5},
+		{"contiguous", 5, []eventSeqTime{{6, fresh}, {7, fresh}, {8, fresh}}, 8},
+		{"gap at start", 5, []eventSeqTime{{7, fresh}, {8, fresh}}, 5},
+		{"gap in middle", 5, []eventSeqTime{{6, fresh}, {8, fresh}, {9, fresh}}, 6},
+		{"stale gap skipped", 5, []eventSeqTime{{6, fresh}, {8, stale}, {9, fresh}}, 9},
+		{"stale then fresh gap", 5, []eventSeqTime{{7, stale}, {9, fresh}}, 7},
+	}
+
+	for _, c := range cases {
+		if got := eventSafeSeq(c.cursor, c.seqs, now); got != c.want {
+			t.Errorf("%s: eventSafeSeq = %d, want %d", c.name, got, c.want)
+		}
+	}
+}
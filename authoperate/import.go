@@ -0,0 +1,62 @@
+package authoperate
+
+import (
+	"fmt"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+// 创建或更新用户并写入指定的signKey，用于导入策略时保留原来的signKey，
+// 已存在的signKey只更新描述，被其他用户创建的signKey返回错误，不会加入默认角色
+func (auth *Authorization) UserUpsertSignKeys(userId, name string, signKeys map[string]string) error {
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return err
+	}
+	defer auth.mongoFactory.Put(session)
+	coll := session.DB(auth.dataBaseName).C(userCollName)
+
+	if len(signKeys) > SignKeyLimit {
+		return fmt.Errorf("sign key length limit %d", SignKeyLimit)
+	}
+
+	for signKey := range signKeys {
+		owner := UserInfo{}
+		err := coll.Find(bson.M{
+			"groupName":                        auth.groupName,
+			"userId":                           bson.M{"$ne": userId},
+			fmt.Sprintf("signKey.%s", signKey): bson.M{"$exists": true},
+		}).Select(bson.M{"userId": 1}).One(&owner)
+		if err == nil {
+			return fmt.Errorf("signKey %s is owned by %s", signKey, owner.UserId)
+		}
+		if err != mgo.ErrNotFound {
+			return fmt.Errorf("query signKey owner exception %s", err.Error())
+		}
+	}
+
+	set := bson.M{}
+	if name != "" {
+		set["name"] = name
+		set["pinyin"] = auth.pinyinOf(name)
+	}
+	for signKey, desc := range signKeys {
+		set[fmt.Sprintf("signKey.%s", signKey)] = desc
+	}
+
+	update := bson.M{"$inc": bson.M{"version": 1}}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(signKeys) == 0 {
+		update["$setOnInsert"] = bson.M{"signKey": map[string]string{}}
+	}
+
+	query := bson.M{"groupName": auth.groupName, "userId": userId}
+	if _, err := coll.Upsert(query, update); err != nil {
+		return fmt.Errorf("upsert user exception %s", err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,493 @@
+package authoperate
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 500
+)
+
+// 列表查询的分页、过滤和排序条件，未使用的过滤条件会被忽略
+type ListOptions struct {
+	Cursor    string // 上一页返回的NextCursor，为空表示第一页
+	Limit     int    // 每页数量，默认50，最大500
+	Prefix    string // 用户为userId或name的前缀，角色为roleName的前缀，路由为uri的前缀，signKey为signKey或创建者的前缀
+	RoleName  string // 只返回属于该角色的用户
+	Tag       string // 只返回带有该标签的角色
+	DataAuth  bool   // 只返回开启了数据权限的路由
+	Sort      string // 排序字段，-前缀表示倒序，用户支持userId和name，路由支持uri和desc，角色支持roleName和desc，signKey支持signKey、userId和desc
+	WithTotal bool   // 是否返回符合过滤条件的总数，为false时Total为-1
+}
+
+type UserPage struct {
+	Users      []UserDetail `json:"users"`
+	NextCursor string       `json:"nextCursor"` //为空表示没有下一页
+	Total      int          `json:"total"`
+}
+
+type RoutePage struct {
+	Routes     []RouteListView `json:"routes"`
+	NextCursor string          `json:"nextCursor"`
+	Total      int             `json:"total"`
+}
+
+type RolePage struct {
+	Roles      []RoleListView `json:"roles"`
+	NextCursor string         `json:"nextCursor"`
+	Total      int            `json:"total"`
+}
+
+type SignOwner struct {
+	SignKey string `json:"signKey"`
+	UserId  string `json:"userId"`
+	Desc    string `json:"desc"`
+}
+
+type SignPage struct {
+	Signs      []SignOwner `json:"signs"`
+	NextCursor string      `json:"nextCursor"`
+	Total      int         `json:"total"`
+}
+
+// 游标记录上一页最后一条的排序字段值和唯一键，排序字段不唯一时用唯一键区分，
+// 同时记录排序方向，游标只能用于相同的排序字段和方向
+type pageCursor struct {
+	Sort string `json:"s"`
+	Desc bool   `json:"d,omitempty"`
+	V    string `json:"v"`
+	K    string `json:"k"`
+}
+
+func (opts ListOptions) limit() int {
+	if opts.Limit <= 0 {
+		return DefaultPageLimit
+	}
+	if opts.Limit > MaxPageLimit {
+		return MaxPageLimit
+	}
+	return opts.Limit
+}
+
+// 解析排序字段，只允许allowed中的字段，第一个为默认值
+func (opts ListOptions) sortField(allowed ...string) (string, bool, error) {
+	field := strings.TrimSpace(opts.Sort)
+	desc := strings.HasPrefix(field, "-")
+	field = strings.TrimPrefix(field, "-")
+	if field == "" {
+		return allowed[0], desc, nil
+	}
+
+	for _, a := range allowed {
+		if a == field {
+			return field, desc, nil
+		}
+	}
+	return "", false, fmt.Errorf("unsupported sort field %s, must be one of %s", field, strings.Join(allowed, ","))
+}
+
+func (opts ListOptions) cursor(sortField string, desc bool) (*pageCursor, error) {
+	if opts.Cursor == "" {
+		return nil, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	cur := &pageCursor{}
+	if err := json.Unmarshal(b, cur); err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	if cur.Sort != sortField || cur.Desc != desc {
+		return nil, fmt.Errorf("cursor does not match the sort order, the cursor is for %s", cur.sortString())
+	}
+	return cur, nil
+}
+
+func (cur *pageCursor) sortString() string {
+	if cur.Desc {
+		return "-" + cur.Sort
+	}
+	return cur.Sort
+}
+
+func encodeCursor(sortField string, desc bool, v, k string) string {
+	b, _ := json.Marshal(pageCursor{Sort: sortField, Desc: desc, V: v, K: k})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// 按前缀匹配，用户输入会被转义
+func prefixRegex(prefix string) bson.RegEx {
+	return bson.RegEx{Pattern: "^" + regexp.QuoteMeta(prefix)}
+}
+
+// 游标之后的数据，field为排序字段，key为唯一键
+func afterCursor(field, key string, desc bool, cur *pageCursor) bson.M {
+	op := "$gt"
+	if desc {
+		op = "$lt"
+	}
+
+	if field == key {
+		return bson.M{key: bson.M{op: cur.K}}
+	}
+
+	return bson.M{"$or": []bson.M{
+		{field: bson.M{op: cur.V}},
+		{field: cur.V, key: bson.M{op: cur.K}},
+	}}
+}
+
+func sortKeys(field, key string, desc bool) []string {
+	keys := []string{field}
+	if field != key {
+		keys = append(keys, key)
+	}
+	if desc {
+		for i := range keys {
+			keys[i] = "-" + keys[i]
+		}
+	}
+	return keys
+}
+
+// 执行分页查询，多查一条用于判断是否有下一页，WithTotal为false时总数返回-1
+func pageFind(coll *mgo.Collection, q bson.M, opts ListOptions, field, key string, desc bool, result interface{}) (int, error) {
+	cur, err := opts.cursor(field, desc)
+	if err != nil {
+		return -1, err
+	}
+
+	total := -1
+	if opts.WithTotal {
+		if total, err = coll.Find(q).Count(); err != nil {
+			return -1, err
+		}
+	}
+
+	find := q
+	if cur != nil {
+		find = bson.M{"$and": []bson.M{q, afterCursor(field, key, desc, cur)}}
+	}
+
+	limit := opts.limit()
+	if err := coll.Find(find).Sort(sortKeys(field, key, desc)...).Limit(limit + 1).All(result); err != nil {
+		return -1, err
+	}
+
+	return total, nil
+}
+
+// 分页查询用户，按userId或name排序
+func (auth *Authorization) UserPageList(opts ListOptions) (UserPage, error) {
+	page := UserPage{Users: []UserDetail{}, Total: -1}
+
+	field, desc, err := opts.sortField("userId", "name")
+	if err != nil {
+		return page, err
+	}
+
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return page, err
+	}
+	defer auth.mongoFactory.Put(session)
+	coll := session.DB(auth.dataBaseName).C(userCollName)
+
+	q := bson.M{"groupName": auth.groupName}
+	if opts.Prefix != "" {
+		q["$or"] = []bson.M{
+			{"userId": prefixRegex(opts.Prefix)},
+			{"name": prefixRegex(opts.Prefix)},
+		}
+	}
+	if opts.RoleName != "" {
+		userIds, err := auth.RoleUserIds(opts.RoleName)
+		if err != nil {
+			return page, err
+		}
+		q["userId"] = bson.M{"$in": userIds}
+	}
+
+	users := []UserInfo{}
+	total, err := pageFind(coll, q, opts, field, "userId", desc, &users)
+	if err != nil {
+		return page, fmt.Errorf("query user page exception %s", err.Error())
+	}
+	page.Total = total
+
+	if len(users) > opts.limit() {
+		users = users[:opts.limit()]
+		last := users[len(users)-1]
+		v := last.UserId
+		if field == "name" {
+			v = last.Name
+		}
+		page.NextCursor = encodeCursor(field, desc, v, last.UserId)
+	}
+
+	for _, user := range users {
+		page.Users = append(page.Users, UserDetail{UserId: user.UserId, Name: user.Name})
+	}
+
+	return page, nil
+}
+
+// 分页查询路由，按uri或desc排序，DataAuth为true时只返回开启了数据权限的方法
+func (auth *Authorization) RoutePageList(opts ListOptions) (RoutePage, error) {
+	page := RoutePage{Routes: []RouteListView{}, Total: -1}
+
+	field, desc, err := opts.sortField("uri", "desc")
+	if err != nil {
+		return page, err
+	}
+
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return page, err
+	}
+	defer auth.mongoFactory.Put(session)
+	coll := session.DB(auth.dataBaseName).C(routerCollName)
+
+	q := bson.M{"groupName": auth.groupName}
+	if opts.Prefix != "" {
+		q["uri"] = prefixRegex(strings.ToLower(opts.Prefix))
+	}
+	if opts.DataAuth {
+		or := []bson.M{}
+		for _, num := range []int{1, 2, 4, 8} {
+			or = append(or, bson.M{fmt.Sprintf("methodMap.%d.enable", num): true})
+		}
+		q["$or"] = or
+	}
+
+	routers := []RouterInfo{}
+	total, err := pageFind(coll, q, opts, field, "uri", desc, &routers)
+	if err != nil {
+		return page, fmt.Errorf("query route page exception %s", err.Error())
+	}
+	page.Total = total
+
+	if len(routers) > opts.limit() {
+		routers = routers[:opts.limit()]
+		last := routers[len(routers)-1]
+		v := last.Uri
+		if field == "desc" {
+			v = last.Desc
+		}
+		page.NextCursor = encodeCursor(field, desc, v, last.Uri)
+	}
+
+	for _, router := range routers {
+		page.Routes = append(page.Routes, auth.routeView(router, opts.DataAuth))
+	}
+
+	return page, nil
+}
+
+// enableOnly为true时只包含开启了数据权限的方法，方法按名称排序
+func (auth *Authorization) routeView(router RouterInfo, enableOnly bool) RouteListView {
+	methods := []RouteMethod{}
+	for m, v := range router.MethodMap {
+		if enableOnly && !v.Enable {
+			continue
+		}
+		methods = append(methods, RouteMethod{
+			Method: auth.NumStringToMethod(m),
+			Desc:   v.MethodDesc,
+			Enable: v.Enable,
+		})
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Method < methods[j].Method })
+
+	return RouteListView{
+		Uri:     router.Uri,
+		Desc:    router.Desc,
+		Methods: methods,
+		Version: router.Version,
+	}
+}
+
+// 分页查询角色，按roleName或desc排序
+func (auth *Authorization) RolePageList(opts ListOptions) (RolePage, error) {
+	page := RolePage{Roles: []RoleListView{}, Total: -1}
+
+	field, desc, err := opts.sortField("roleName", "desc")
+	if err != nil {
+		return page, err
+	}
+
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return page, err
+	}
+	defer auth.mongoFactory.Put(session)
+	coll := session.DB(auth.dataBaseName).C(roleCollName)
+
+	q := bson.M{"groupName": auth.groupName}
+	if opts.Prefix != "" {
+		q["roleName"] = prefixRegex(opts.Prefix)
+	}
+	if opts.Tag != "" {
+		q["tags"] = opts.Tag
+	}
+
+	roles := []RoleInfo{}
+	total, err := pageFind(coll, q, opts, field, "roleName", desc, &roles)
+	if err != nil {
+		return page, fmt.Errorf("query role page exception %s", err.Error())
+	}
+	page.Total = total
+
+	if len(roles) > opts.limit() {
+		roles = roles[:opts.limit()]
+		last := roles[len(roles)-1]
+		v := last.RoleName
+		if field == "desc" {
+			v = last.Desc
+		}
+		page.NextCursor = encodeCursor(field, desc, v, last.RoleName)
+	}
+
+	if len(roles) == 0 {
+		return page, nil
+	}
+
+	// 只查询这一页角色中的路由和用户
+	uris := []string{}
+	userIds := []string{}
+	for _, role := range roles {
+		for _, addr := range role.Address {
+			uris = append(uris, addr.Uri)
+		}
+		userIds = append(userIds, role.UserIds...)
+	}
+
+	routerInfos := []RouterInfo{}
+	err = session.DB(auth.dataBaseName).C(routerCollName).
+		Find(bson.M{"groupName": auth.groupName, "uri": bson.M{"$in": uris}}).All(&routerInfos)
+	if err != nil {
+		return page, fmt.Errorf("query role page exception %s", err.Error())
+	}
+
+	users := []UserInfo{}
+	err = session.DB(auth.dataBaseName).C(userCollName).
+		Find(bson.M{"groupName": auth.groupName, "userId": bson.M{"$in": userIds}}).
+		Select(bson.M{"userId": 1, "name": 1}).All(&users)
+	if err != nil {
+		return page, fmt.Errorf("query role page exception %s", err.Error())
+	}
+
+	for _, role := range roles {
+		page.Roles = append(page.Roles, RoleListView{
+			RoleName:  role.RoleName,
+			Desc:      role.Desc,
+			IsDefault: role.IsDefault,
+			Type:      role.Type,
+			Routers:   auth.routerDetailReqAddr(routerInfos, role.Address),
+			Users:     auth.userDetail(users, role.UserIds),
+			Version:   role.Version,
+			Tags:      role.Tags,
+		})
+	}
+
+	return page, nil
+}
+
+// 分页查询所有用户创建的signKey，按signKey、userId或desc排序，
+// signKey存储在用户文档的map中，无法在数据库中分页，只能全部读取后在内存中分页
+func (auth *Authorization) SignPageList(opts ListOptions) (SignPage, error) {
+	page := SignPage{Signs: []SignOwner{}, Total: -1}
+
+	field, desc, err := opts.sortField("signKey", "userId", "desc")
+	if err != nil {
+		return page, err
+	}
+
+	cur, err := opts.cursor(field, desc)
+	if err != nil {
+		return page, err
+	}
+
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return page, err
+	}
+	defer auth.mongoFactory.Put(session)
+	coll := session.DB(auth.dataBaseName).C(userCollName)
+
+	users := []UserInfo{}
+	err = coll.Find(bson.M{"groupName": auth.groupName}).Select(bson.M{"userId": 1, "signKey": 1}).All(&users)
+	if err != nil {
+		return page, fmt.Errorf("query sign page exception %s", err.Error())
+	}
+
+	signs := []SignOwner{}
+	for _, user := range users {
+		for signKey, signDesc := range user.SignKey {
+			if opts.Prefix != "" && !strings.HasPrefix(signKey, opts.Prefix) && !strings.HasPrefix(user.UserId, opts.Prefix) {
+				continue
+			}
+			signs = append(signs, SignOwner{SignKey: signKey, UserId: user.UserId, Desc: signDesc})
+		}
+	}
+
+	if opts.WithTotal {
+		page.Total = len(signs)
+	}
+
+	page.Signs, page.NextCursor = pageSigns(signs, field, desc, cur, opts.limit())
+	return page, nil
+}
+
+func signSortValue(sign SignOwner, field string) string {
+	switch field {
+	case "userId":
+		return sign.UserId
+	case "desc":
+		return sign.Desc
+	}
+	return sign.SignKey
+}
+
+// 在内存中按排序字段和signKey排序，返回游标之后的一页和下一页的游标
+func pageSigns(signs []SignOwner, field string, desc bool, cur *pageCursor, limit int) ([]SignOwner, string) {
+	// a是否排在b之前
+	before := func(av, ak, bv, bk string) bool {
+		if av != bv {
+			return (av < bv) != desc
+		}
+		return ak != bk && (ak < bk) != desc
+	}
+
+	sort.Slice(signs, func(i, j int) bool {
+		return before(signSortValue(signs[i], field), signs[i].SignKey, signSortValue(signs[j], field), signs[j].SignKey)
+	})
+
+	if cur != nil {
+		i := sort.Search(len(signs), func(i int) bool {
+			return before(cur.V, cur.K, signSortValue(signs[i], field), signs[i].SignKey)
+		})
+		signs = signs[i:]
+	}
+
+	next := ""
+	if len(signs) > limit {
+		signs = signs[:limit]
+		last := signs[len(signs)-1]
+		next = encodeCursor(field, desc, signSortValue(last, field), last.SignKey)
+	}
+
+	return append([]SignOwner{}, signs...), next
+}
@@ -0,0 +1,169 @@
+package authoperate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+func TestListSortField(t *testing.T) {
+	cases := []struct {
+		name  string
+		sort  string
+		field string
+		desc  bool
+		ok    bool
+	}{
+		{"default", "", "uri", false, true},
+		{"default desc", "-", "uri", true, true},
+		{"asc", "desc", "desc", false, true},
+		{"desc", " -desc ", "desc", true, true},
+		{"unsupported", "version", "", false, false},
+	}
+
+	for _, c := range cases {
+		field, desc, err := ListOptions{Sort: c.sort}.sortField("uri", "desc")
+		if c.ok != (err == nil) {
+			t.Errorf("%s: sortField error = %v, want ok %t", c.name, err, c.ok)
+			continue
+		}
+		if field != c.field || desc != c.desc {
+			t.Errorf("%s: sortField = %s, %t, want %s, %t", c.name, field, desc, c.field, c.desc)
+		}
+	}
+}
+
+func TestListCursor(t *testing.T) {
+	cases := []struct {
+		name   string
+		cursor string
+		field  string
+		desc   bool
+		err    string
+	}{
+		{"empty", "", "uri", false, ""},
+		{"same order", encodeCursor("uri", false, "/a", "/a"), "uri", false, ""},
+		{"same desc order", encodeCursor("desc", true, "x", "/a"), "desc", true, ""},
+		{"direction mismatch", encodeCursor("uri", false, "/a", "/a"), "uri", true, "cursor is for uri"},
+		{"desc direction mismatch", encodeCursor("uri", true, "/a", "/a"), "uri", false, "cursor is for -uri"},
+		{"field mismatch", encodeCursor("desc", false, "x", "/a"), "uri", false, "cursor is for desc"},
+		{"not base64", "!!", "uri", false, "invalid cursor"},
+		{"not json", "bm90IGpzb24", "uri", false, "invalid cursor"},
+	}
+
+	for _, c := range cases {
+		cur, err := ListOptions{Cursor: c.cursor}.cursor(c.field, c.desc)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: cursor error = %v, want %q", c.name, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+			continue
+		}
+		if c.cursor == "" {
+			if cur != nil {
+				t.Errorf("%s: cursor = %+v, want nil", c.name, cur)
+			}
+			continue
+		}
+		if cur == nil || cur.Sort != c.field || cur.Desc != c.desc {
+			t.Errorf("%s: cursor = %+v, want %s desc %t", c.name, cur, c.field, c.desc)
+		}
+	}
+}
+
+func TestAfterCursorAndSortKeys(t *testing.T) {
+	cur := &pageCursor{V: "v", K: "k"}
+
+	cases := []struct {
+		name  string
+		field string
+		key   string
+		desc  bool
+		after bson.M
+		keys  []string
+	}{
+		{"key asc", "uri", "uri", false, bson.M{"uri": bson.M{"$gt": "k"}}, []string{"uri"}},
+		{"key desc", "uri", "uri", true, bson.M{"uri": bson.M{"$lt": "k"}}, []string{"-uri"}},
+		{"field asc", "desc", "uri", false, bson.M{"$or": []bson.M{
+			{"desc": bson.M{"$gt": "v"}},
+			{"desc": "v", "uri": bson.M{"$gt": "k"}},
+		}}, []string{"desc", "uri"}},
+		{"field desc", "desc", "uri", true, bson.M{"$or": []bson.M{
+			{"desc": bson.M{"$lt": "v"}},
+			{"desc": "v", "uri": bson.M{"$lt": "k"}},
+		}}, []string{"-desc", "-uri"}},
+	}
+
+	for _, c := range cases {
+		if got := afterCursor(c.field, c.key, c.desc, cur); !reflect.DeepEqual(got, c.after) {
+			t.Errorf("%s: afterCursor = %v, want %v", c.name, got, c.after)
+		}
+		if got := sortKeys(c.field, c.key, c.desc); !reflect.DeepEqual(got, c.keys) {
+			t.Errorf("%s: sortKeys = %v, want %v", c.name, got, c.keys)
+		}
+	}
+}
+
+func TestPageSigns(t *testing.T) {
+	signs := []SignOwner{
+		{SignKey: "s3", UserId: "u1", Desc: "b"},
+		{SignKey: "s1", UserId: "u2", Desc: "a"},
+		{SignKey: "s4", UserId: "u1", Desc: "a"},
+		{SignKey: "s2", UserId: "u3", Desc: "c"},
+	}
+
+	keys := func(page []SignOwner) []string {
+		ks := []string{}
+		for _, s := range page {
+			ks = append(ks, s.SignKey)
+		}
+		return ks
+	}
+
+	// 按limit依次翻页，返回每一页的signKey
+	pages := func(field string, desc bool, limit int) [][]string {
+		result := [][]string{}
+		var cur *pageCursor
+		for i := 0; i < len(signs)+1; i++ {
+			page, next := pageSigns(append([]SignOwner{}, signs...), field, desc, cur, limit)
+			result = append(result, keys(page))
+			if next == "" {
+				return result
+			}
+
+			var err error
+			if cur, err = (ListOptions{Cursor: next}).cursor(field, desc); err != nil {
+				t.Fatalf("%s: next cursor %v", field, err)
+			}
+		}
+		t.Fatalf("%s: paging does not end", field)
+		return nil
+	}
+
+	cases := []struct {
+		name  string
+		field string
+		desc  bool
+		limit int
+		want  [][]string
+	}{
+		{"signKey", "signKey", false, 2, [][]string{{"s1", "s2"}, {"s3", "s4"}}},
+		{"signKey desc", "signKey", true, 3, [][]string{{"s4", "s3", "s2"}, {"s1"}}},
+		{"userId ties", "userId", false, 2, [][]string{{"s3", "s4"}, {"s1", "s2"}}},
+		{"desc ties", "desc", false, 1, [][]string{{"s1"}, {"s4"}, {"s3"}, {"s2"}}},
+		{"desc ties desc", "desc", true, 2, [][]string{{"s2", "s3"}, {"s4", "s1"}}},
+		{"one page", "signKey", false, 10, [][]string{{"s1", "s2", "s3", "s4"}}},
+	}
+
+	for _, c := range cases {
+		if got := pages(c.field, c.desc, c.limit); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: pages = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
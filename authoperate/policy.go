@@ -0,0 +1,485 @@
+package authoperate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+// 组内所有的路由、角色、用户和sign授权，用于在内存中计算有效权限，
+// 计算规则与QueryRoleAuth和QuerySignAuth保持一致
+type PolicyState struct {
+	Routers []RouterInfo
+	Roles   []RoleInfo
+	Users   []UserInfo
+	Signs   []SignInfo
+
+	auth        *Authorization
+	routerIndex map[string]int
+	userRoles   map[string][]int
+	signOwner   map[string]string
+	userSigns   map[string][]int
+}
+
+// 某个用户对某个路由方法的权限
+type RoutePermission struct {
+	Uri      string   `json:"uri"`
+	Method   string   `json:"method"`
+	Roles    []string `json:"roles"`    //权限来源的角色
+	IsAdmin  bool     `json:"isAdmin"`  //通过超管角色获得，不需要判断数据权限
+	DataAuth bool     `json:"dataAuth"` //是否需要数据权限
+}
+
+// 某个用户在某个signKey下对某个路由方法的数据权限
+type SignPermission struct {
+	SignKey string `json:"signKey"`
+	Uri     string `json:"uri"`
+	Method  string `json:"method"`
+	Via     string `json:"via"` //owner表示signKey是自己创建的，grant表示他人授权，admin表示超管角色
+}
+
+const (
+	SignViaOwner = "owner"
+	SignViaGrant = "grant"
+	SignViaAdmin = "admin"
+
+	// 超管角色不判断数据权限，对所有signKey都有权限
+	AnySignKey = "*"
+)
+
+func (auth *Authorization) PolicyStateLoad() (*PolicyState, error) {
+	routers, err := auth.RouterGetInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer auth.mongoFactory.Put(session)
+
+	q := bson.M{
+		"groupName": auth.groupName,
+	}
+
+	roles := []RoleInfo{}
+	if err := session.DB(auth.dataBaseName).C(roleCollName).Find(q).All(&roles); err != nil {
+		return nil, fmt.Errorf("query role info exception %s", err.Error())
+	}
+
+	users := []UserInfo{}
+	if err := session.DB(auth.dataBaseName).C(userCollName).Find(q).All(&users); err != nil {
+		return nil, fmt.Errorf("query users exception %s", err.Error())
+	}
+
+	signs := []SignInfo{}
+	if err := session.DB(auth.dataBaseName).C(signCollName).Find(q).All(&signs); err != nil {
+		return nil, fmt.Errorf("query sign exception %s", err.Error())
+	}
+
+	return &PolicyState{
+		Routers: routers,
+		Roles:   roles,
+		Users:   users,
+		Signs:   signs,
+		auth:    auth,
+	}, nil
+}
+
+func (ps *PolicyState) Clone() *PolicyState {
+	clone := &PolicyState{
+		Routers: make([]RouterInfo, 0, len(ps.Routers)),
+		Roles:   make([]RoleInfo, 0, len(ps.Roles)),
+		Users:   make([]UserInfo, 0, len(ps.Users)),
+		Signs:   make([]SignInfo, 0, len(ps.Signs)),
+		auth:    ps.auth,
+	}
+
+	for _, router := range ps.Routers {
+		mm := make(map[string]VerifyData, len(router.MethodMap))
+		for k, v := range router.MethodMap {
+			mm[k] = v
+		}
+		router.MethodMap = mm
+		clone.Routers = append(clone.Routers, router)
+	}
+
+	for _, role := range ps.Roles {
+		rm := make(map[string]bool, len(role.RouterMap))
+		for k, v := range role.RouterMap {
+			rm[k] = v
+		}
+		role.RouterMap = rm
+		role.UserIds = append([]string{}, role.UserIds...)
+		role.Address = append([]Address{}, role.Address...)
+		clone.Roles = append(clone.Roles, role)
+	}
+
+	for _, user := range ps.Users {
+		sk := make(map[string]string, len(user.SignKey))
+		for k, v := range user.SignKey {
+			sk[k] = v
+		}
+		user.SignKey = sk
+		clone.Users = append(clone.Users, user)
+	}
+
+	for _, sign := range ps.Signs {
+		vdu := make(map[string]int, len(sign.VerifyDataUri))
+		for k, v := range sign.VerifyDataUri {
+			vdu[k] = v
+		}
+		sign.VerifyDataUri = vdu
+		clone.Signs = append(clone.Signs, sign)
+	}
+
+	return clone
+}
+
+// 数据有变动后需要重建索引
+func (ps *PolicyState) reindex() {
+	ps.routerIndex = nil
+}
+
+func (ps *PolicyState) index() {
+	if ps.routerIndex != nil {
+		return
+	}
+
+	ps.routerIndex = make(map[string]int, len(ps.Routers))
+	for i, router := range ps.Routers {
+		ps.routerIndex[router.Uri] = i
+	}
+
+	ps.userRoles = make(map[string][]int)
+	for i, role := range ps.Roles {
+		for _, userId := range role.UserIds {
+			ps.userRoles[userId] = append(ps.userRoles[userId], i)
+		}
+	}
+
+	ps.signOwner = make(map[string]string)
+	for _, user := range ps.Users {
+		for signKey := range user.SignKey {
+			ps.signOwner[signKey] = user.UserId
+		}
+	}
+
+	ps.userSigns = make(map[string][]int)
+	for i, sign := range ps.Signs {
+		ps.userSigns[sign.UserId] = append(ps.userSigns[sign.UserId], i)
+	}
+}
+
+func routerMapKey(num, uri string) string {
+	return fmt.Sprintf("%s%s%s", num, splitString, uri)
+}
+
+func splitRouterMapKey(key string) (string, string) {
+	kv := strings.SplitN(key, splitString, 2)
+	if len(kv) != 2 {
+		return "", key
+	}
+	return kv[0], kv[1]
+}
+
+// 路由表中是否存在该uri+method，已被删除的路由即使还残留在角色中也不会被匹配到
+func (ps *PolicyState) routeExist(uri, num string) (VerifyData, bool) {
+	ps.index()
+
+	i, ok := ps.routerIndex[uri]
+	if !ok {
+		return VerifyData{}, false
+	}
+
+	vd, ok := ps.Routers[i].MethodMap[num]
+	return vd, ok
+}
+
+// 所有出现过的用户，包括只存在于角色中的用户
+func (ps *PolicyState) UserIds() []string {
+	ps.index()
+
+	set := make(map[string]struct{})
+	userIds := []string{}
+	for _, user := range ps.Users {
+		if _, ok := set[user.UserId]; !ok {
+			set[user.UserId] = struct{}{}
+			userIds = append(userIds, user.UserId)
+		}
+	}
+	for userId := range ps.userRoles {
+		if _, ok := set[userId]; !ok {
+			set[userId] = struct{}{}
+			userIds = append(userIds, userId)
+		}
+	}
+
+	sort.Strings(userIds)
+	return userIds
+}
+
+func (ps *PolicyState) UserName(userId string) string {
+	for _, user := range ps.Users {
+		if user.UserId == userId {
+			return user.Name
+		}
+	}
+	return ""
+}
+
+func (ps *PolicyState) UserRoleNames(userId string) []string {
+	ps.index()
+
+	roleNames := []string{}
+	for _, i := range ps.userRoles[userId] {
+		roleNames = append(roleNames, ps.Roles[i].RoleName)
+	}
+	sort.Strings(roleNames)
+	return roleNames
+}
+
+func (ps *PolicyState) SignKeyOwner(signKey string) string {
+	ps.index()
+	return ps.signOwner[signKey]
+}
+
+// 与QueryRoleAuth一致，返回是否超管、是否有角色权限、是否需要判断数据权限，
+// 是否需要判断数据权限以最后一个拥有该路由的角色为准
+func (ps *PolicyState) RoleAuth(uri, method, userId string) (bool, bool, bool) {
+	num, err := ps.auth.MethodToNumString(method)
+	if err != nil {
+		return false, false, false
+	}
+
+	if _, ok := ps.routeExist(uri, num); !ok {
+		return false, false, false
+	}
+
+	key := routerMapKey(num, uri)
+	roleAuth, existDataAuth := false, false
+	for _, i := range ps.userRoles[userId] {
+		role := ps.Roles[i]
+		enable, ok := role.RouterMap[key]
+		if !ok {
+			continue
+		}
+		if role.Type == SuperAdminRoleType {
+			return true, true, false
+		}
+		roleAuth = true
+		existDataAuth = enable
+	}
+
+	return false, roleAuth, existDataAuth
+}
+
+// 与QuerySignAuth一致，signKey的创建者默认拥有数据权限
+func (ps *PolicyState) SignAuth(signKey, uri, method, userId string) bool {
+	num, err := ps.auth.MethodToNumString(method)
+	if err != nil {
+		return false
+	}
+
+	ps.index()
+
+	if ps.signOwner[signKey] == userId && userId != "" {
+		return true
+	}
+
+	n := ps.auth.NumStringToNum(num)
+	for _, i := range ps.userSigns[userId] {
+		sign := ps.Signs[i]
+		if sign.SignKey == signKey && sign.VerifyDataUri[uri]&n == n {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 与Oreo.CheckUserAuth一致，uri需要是已经匹配过的路由模板
+func (ps *PolicyState) CheckAuth(uri, method, userId, signKey string) (bool, bool, string) {
+	isAdmin, roleAuth, existDataAuth := ps.RoleAuth(uri, method, userId)
+
+	if !roleAuth {
+		return isAdmin, false, fmt.Sprintf("[%s]没有路由[%s %s]的角色权限", userId, method, uri)
+	}
+
+	if !existDataAuth {
+		return isAdmin, true, ""
+	}
+
+	if !ps.SignAuth(signKey, uri, method, userId) {
+		return isAdmin, false, fmt.Sprintf("[%s %s]没有[%s %s]数据权限", userId, signKey, method, uri)
+	}
+
+	return isAdmin, true, ""
+}
+
+// 用户拥有的所有路由权限，同一个路由方法可能来源于多个角色
+func (ps *PolicyState) UserRoutePermissions(userId string) []RoutePermission {
+	ps.index()
+
+	perms := map[string]*RoutePermission{}
+	for _, i := range ps.userRoles[userId] {
+		role := ps.Roles[i]
+		for key, enable := range role.RouterMap {
+			num, uri := splitRouterMapKey(key)
+			if _, ok := ps.routeExist(uri, num); !ok {
+				continue
+			}
+
+			p, ok := perms[key]
+			if !ok {
+				p = &RoutePermission{
+					Uri:    uri,
+					Method: ps.auth.NumStringToMethod(num),
+					Roles:  []string{},
+				}
+				perms[key] = p
+			}
+			p.Roles = append(p.Roles, role.RoleName)
+			if role.Type == SuperAdminRoleType {
+				p.IsAdmin = true
+			} else {
+				p.DataAuth = p.DataAuth || enable
+			}
+		}
+	}
+
+	permissions := []RoutePermission{}
+	for _, p := range perms {
+		if p.IsAdmin {
+			p.DataAuth = false
+		}
+		sort.Strings(p.Roles)
+		permissions = append(permissions, *p)
+	}
+
+	sort.Slice(permissions, func(i, j int) bool {
+		if permissions[i].Uri == permissions[j].Uri {
+			return permissions[i].Method < permissions[j].Method
+		}
+		return permissions[i].Uri < permissions[j].Uri
+	})
+
+	return permissions
+}
+
+// 用户在各个signKey下真正能用上的数据权限，即需要同时拥有该路由方法的角色权限
+func (ps *PolicyState) UserSignPermissions(userId string) []SignPermission {
+	ps.index()
+
+	ownKeys := []string{}
+	for _, user := range ps.Users {
+		if user.UserId == userId {
+			for signKey := range user.SignKey {
+				ownKeys = append(ownKeys, signKey)
+			}
+		}
+	}
+	sort.Strings(ownKeys)
+
+	permissions := []SignPermission{}
+	for _, rp := range ps.UserRoutePermissions(userId) {
+		if rp.IsAdmin {
+			permissions = append(permissions, SignPermission{
+				SignKey: AnySignKey,
+				Uri:     rp.Uri,
+				Method:  rp.Method,
+				Via:     SignViaAdmin,
+			})
+			continue
+		}
+
+		if !rp.DataAuth {
+			continue
+		}
+
+		for _, signKey := range ownKeys {
+			permissions = append(permissions, SignPermission{
+				SignKey: signKey,
+				Uri:     rp.Uri,
+				Method:  rp.Method,
+				Via:     SignViaOwner,
+			})
+		}
+
+		num, _ := ps.auth.MethodToNumString(rp.Method)
+		n := ps.auth.NumStringToNum(num)
+		for _, i := range ps.userSigns[userId] {
+			sign := ps.Signs[i]
+			if ps.signOwner[sign.SignKey] == userId {
+				continue
+			}
+			if sign.VerifyDataUri[rp.Uri]&n == n {
+				permissions = append(permissions, SignPermission{
+					SignKey: sign.SignKey,
+					Uri:     rp.Uri,
+					Method:  rp.Method,
+					Via:     SignViaGrant,
+				})
+			}
+		}
+	}
+
+	return permissions
+}
+
+// 逐个用户加载权限数据并回调，state中只包含该用户的数据和全部的路由与角色，
+// 用于导出大量用户的权限时避免一次性将所有用户的权限放在内存中
+func (auth *Authorization) PolicyStateEachUser(fn func(state *PolicyState, userId string) error) error {
+	routers, err := auth.RouterGetInfo()
+	if err != nil {
+		return err
+	}
+
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return err
+	}
+	defer auth.mongoFactory.Put(session)
+
+	roles := []RoleInfo{}
+	if err := session.DB(auth.dataBaseName).C(roleCollName).Find(bson.M{"groupName": auth.groupName}).All(&roles); err != nil {
+		return fmt.Errorf("query role info exception %s", err.Error())
+	}
+
+	signColl := session.DB(auth.dataBaseName).C(signCollName)
+
+	iter := session.DB(auth.dataBaseName).C(userCollName).Find(bson.M{"groupName": auth.groupName}).Sort("userId").Iter()
+
+	user := UserInfo{}
+	for iter.Next(&user) {
+		signs := []SignInfo{}
+		if err := signColl.Find(bson.M{"groupName": auth.groupName, "userId": user.UserId}).All(&signs); err != nil {
+			iter.Close()
+			return fmt.Errorf("query sign exception %s", err.Error())
+		}
+
+		state := &PolicyState{
+			Routers: routers,
+			Roles:   roles,
+			Users:   []UserInfo{user},
+			Signs:   signs,
+			auth:    auth,
+		}
+
+		if err := fn(state, user.UserId); err != nil {
+			iter.Close()
+			return err
+		}
+
+		user = UserInfo{}
+	}
+
+	if err := iter.Close(); err != nil {
+		return fmt.Errorf("query users exception %s", err.Error())
+	}
+
+	return nil
+}
@@ -3,6 +3,7 @@ package authoperate
 import (
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/globalsign/mgo"
 	"github.com/globalsign/mgo/bson"
@@ -22,7 +23,9 @@ type RoleInfo struct {
 	UserIds   []string        `json:"userIds" bson:"userIds"`
 	RouterMap map[string]bool `json:"routerMap" bson:"routerMap"` //key  1_/oreo/_uri, 每个method单独存储
 	Address   []Address       `json:"address" bson:"address"`
-	Type      int             `json:"type" bson:"type"` //角色的类型
+	Type      int             `json:"type" bson:"type"`                 //角色的类型
+	Version   int64           `json:"version" bson:"version,omitempty"` //每次修改加1，用于乐观锁
+	Tags      []string        `json:"tags" bson:"tags,omitempty"`       //角色的标签，用于委托管理
 }
 
 type UpsertRoleInfo struct {
@@ -31,6 +34,7 @@ type UpsertRoleInfo struct {
 	Desc      string    `json:"desc"`
 	IsDefault bool      `json:"isDefault"`
 	AddrList  []Address `json:"addrList"`
+	Version   int64     `json:"version"` //大于0时要求与角色当前的版本号一致
 }
 
 type Address struct {
@@ -59,9 +63,30 @@ type RoleListView struct {
 	Type      int             `json:"type"`
 	Users     []UserDetail    `json:"users"`
 	Routers   []RoleRouteInfo `json:"routers"`
+	Version   int64           `json:"version"`
+	Tags      []string        `json:"tags"`
 }
 
-func (auth *Authorization) RoleUpdateTypeDesc(roleName, roleDesc string, typ int) error {
+// 超管角色不能带有标签，否则带有该标签的role_user管理范围可以把用户加入超管角色
+func checkRoleTags(typ int, tags []string) error {
+	if typ == SuperAdminRoleType && len(tags) > 0 {
+		return fmt.Errorf("superadmin role can not have tags %s", strings.Join(tags, ","))
+	}
+	return nil
+}
+
+// 查询角色的类型和标签，角色不存在时返回空的RoleInfo
+func (auth *Authorization) roleTypeTags(coll *mgo.Collection, roleName string) (RoleInfo, error) {
+	role := RoleInfo{}
+	err := coll.Find(bson.M{"groupName": auth.groupName, "roleName": roleName}).Select(bson.M{"type": 1, "tags": 1}).One(&role)
+	if err != nil && err != mgo.ErrNotFound {
+		return role, fmt.Errorf("query role tags exception %s", err.Error())
+	}
+	return role, nil
+}
+
+// version大于0时要求与角色当前的版本号一致，否则返回ErrVersionConflict
+func (auth *Authorization) RoleUpdateTypeDesc(roleName, roleDesc string, typ int, version int64) error {
 	session, err := auth.mongoFactory.Get()
 	if err != nil {
 		return err
@@ -69,7 +94,74 @@ func (auth *Authorization) RoleUpdateTypeDesc(roleName, roleDesc string, typ int
 	defer auth.mongoFactory.Put(session)
 	coll := session.DB(auth.dataBaseName).C(roleCollName)
 
-	return coll.Update(bson.M{"groupName": auth.groupName, "roleName": roleName}, bson.M{"$set": bson.M{"type": typ, "desc": roleDesc}})
+	role, err := auth.roleTypeTags(coll, roleName)
+	if err != nil {
+		return err
+	}
+	if err := checkRoleTags(typ, role.Tags); err != nil {
+		return err
+	}
+
+	return versionUpdate(coll, bson.M{"groupName": auth.groupName, "roleName": roleName}, bson.M{"$set": bson.M{"type": typ, "desc": roleDesc}}, version)
+}
+
+// 设置角色的标签，委托管理时按标签划分角色
+func (auth *Authorization) RoleSetTags(roleName string, tags []string, version int64) error {
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return err
+	}
+	defer auth.mongoFactory.Put(session)
+	coll := session.DB(auth.dataBaseName).C(roleCollName)
+
+	uniq := []string{}
+	seen := make(map[string]struct{})
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if _, ok := seen[tag]; ok || tag == "" {
+			continue
+		}
+		seen[tag] = struct{}{}
+		uniq = append(uniq, tag)
+	}
+
+	role, err := auth.roleTypeTags(coll, roleName)
+	if err != nil {
+		return err
+	}
+	if err := checkRoleTags(role.Type, uniq); err != nil {
+		return err
+	}
+
+	query := bson.M{"groupName": auth.groupName, "roleName": roleName}
+	if err := versionUpdate(coll, query, bson.M{"$set": bson.M{"tags": uniq}}, version); err != nil {
+		if err == ErrVersionConflict {
+			return err
+		}
+		return fmt.Errorf("set role tags exception %s", err.Error())
+	}
+
+	return nil
+}
+
+func (auth *Authorization) RoleUserIds(roleName string) ([]string, error) {
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer auth.mongoFactory.Put(session)
+	coll := session.DB(auth.dataBaseName).C(roleCollName)
+
+	role := RoleInfo{}
+	err = coll.Find(bson.M{"groupName": auth.groupName, "roleName": roleName}).Select(bson.M{"userIds": 1}).One(&role)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("query role users exception %s", err.Error())
+	}
+
+	return role.UserIds, nil
 }
 
 func (auth *Authorization) RoleEnableDataAuthRouteByUserId(userId string) ([]string, error) {
@@ -114,6 +206,16 @@ func (auth *Authorization) RoleUpsert(info UpsertRoleInfo) error {
 	defer auth.mongoFactory.Put(session)
 	coll := session.DB(auth.dataBaseName).C(roleCollName)
 
+	if info.Type == SuperAdminRoleType {
+		role, err := auth.roleTypeTags(coll, info.RoleName)
+		if err != nil {
+			return err
+		}
+		if err := checkRoleTags(info.Type, role.Tags); err != nil {
+			return err
+		}
+	}
+
 	routerMap, err := auth.routerMapByReqAddr(info.AddrList)
 	if err != nil {
 		return err
@@ -129,11 +231,11 @@ func (auth *Authorization) RoleUpsert(info UpsertRoleInfo) error {
 	}
 
 	//如果是超管角色不能自动设为默认角色
-	if info.Type == superAdminRoleType {
+	if info.Type == SuperAdminRoleType {
 		doc["isDefault"] = false
 	} else {
 		// 如果非超管外没有其他角色，那么该角色则设定为默认角色
-		if count, err := coll.Find(bson.M{"type": bson.M{"$ne": superAdminRoleType}}).Count(); err != nil {
+		if count, err := coll.Find(bson.M{"type": bson.M{"$ne": SuperAdminRoleType}}).Count(); err != nil {
 			return fmt.Errorf("calc count err %s", err.Error())
 		} else {
 			if count <= 0 {
@@ -151,6 +253,18 @@ func (auth *Authorization) RoleUpsert(info UpsertRoleInfo) error {
 		"$set": doc,
 	}
 
+	// 指定了版本号说明是修改已存在的角色，不能再新建
+	if info.Version > 0 {
+		if err := versionUpdate(coll, query, update, info.Version); err != nil {
+			if err == ErrVersionConflict {
+				return err
+			}
+			return fmt.Errorf("role upsert exception %s", err.Error())
+		}
+		return nil
+	}
+
+	update["$inc"] = bson.M{"version": 1}
 	if _, err := coll.Upsert(query, update); err != nil {
 		return fmt.Errorf("role upsert exception %s", err.Error())
 	}
@@ -158,6 +272,161 @@ func (auth *Authorization) RoleUpsert(info UpsertRoleInfo) error {
 	return nil
 }
 
+// 追加的uri必须已存在于路由表中，methodValue必须由1、2、4、8组成
+func checkAppendAddr(routerInfo []RouterInfo, urlMethod map[string]int) error {
+	uris := make(map[string]struct{}, len(routerInfo))
+	for _, router := range routerInfo {
+		uris[router.Uri] = struct{}{}
+	}
+
+	for uri, methodValue := range urlMethod {
+		if _, ok := uris[uri]; !ok {
+			return fmt.Errorf("route %s does not exist", uri)
+		}
+		if methodValue <= 0 || methodValue&^15 != 0 {
+			return fmt.Errorf("route %s invalid methodValue %d, must be a combination of 1, 2, 4 and 8", uri, methodValue)
+		}
+	}
+
+	return nil
+}
+
+// 为角色追加路由和方法，每个uri单独做原子更新，不会覆盖他人对该角色同时做的修改，
+// 写入前校验所有的uri和methodValue，任意一个不合法时不做任何修改
+func (auth *Authorization) RoleAppendAddr(roleName string, urlMethod map[string]int) error {
+	routerInfo, err := auth.RouterGetInfo()
+	if err != nil {
+		return err
+	}
+	if err := checkAppendAddr(routerInfo, urlMethod); err != nil {
+		return err
+	}
+
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return err
+	}
+	defer auth.mongoFactory.Put(session)
+	coll := session.DB(auth.dataBaseName).C(roleCollName)
+
+	for uri, methodValue := range urlMethod {
+		routerMap, err := auth.routerMapByReqAddr([]Address{{Uri: uri, MethodValue: methodValue}})
+		if err != nil {
+			return err
+		}
+
+		set := bson.M{}
+		for key, enable := range routerMap {
+			set[fmt.Sprintf("routerMap.%s", key)] = enable
+		}
+
+		// 角色中已存在该uri时合并方法，否则追加该uri，两次都未更新成功说明有并发的追加，再重试一次合并
+		merged := false
+		for i := 0; i < 2; i++ {
+			q := bson.M{
+				"groupName":   auth.groupName,
+				"roleName":    roleName,
+				"address.uri": uri,
+			}
+			u := bson.M{
+				"$bit": bson.M{"address.$.methodValue": bson.M{"or": methodValue}},
+				"$inc": bson.M{"version": 1},
+			}
+			if len(set) > 0 {
+				u["$set"] = set
+			}
+
+			err = coll.Update(q, u)
+			if err == nil {
+				merged = true
+				break
+			}
+			if err != mgo.ErrNotFound {
+				return fmt.Errorf("role append route exception %s", err.Error())
+			}
+
+			q = bson.M{
+				"groupName":   auth.groupName,
+				"roleName":    roleName,
+				"address.uri": bson.M{"$ne": uri},
+			}
+			u = bson.M{
+				"$push": bson.M{"address": Address{Uri: uri, MethodValue: methodValue}},
+				"$inc":  bson.M{"version": 1},
+			}
+			if len(set) > 0 {
+				u["$set"] = set
+			}
+
+			err = coll.Update(q, u)
+			if err == nil {
+				merged = true
+				break
+			}
+			if err != mgo.ErrNotFound {
+				return fmt.Errorf("role append route exception %s", err.Error())
+			}
+		}
+
+		if !merged {
+			return fmt.Errorf("role %s not found", roleName)
+		}
+	}
+
+	return nil
+}
+
+// 删除角色中的路由和方法，方法全部删除后该uri也会从角色中删除
+func (auth *Authorization) RoleRemoveAddr(roleName string, urlMethod map[string]int) error {
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return err
+	}
+	defer auth.mongoFactory.Put(session)
+	coll := session.DB(auth.dataBaseName).C(roleCollName)
+
+	for uri, methodValue := range urlMethod {
+		unset := bson.M{}
+		for _, m := range auth.MethodValueToMethods(methodValue) {
+			unset[fmt.Sprintf("routerMap.%s%s%s", m, splitString, uri)] = 1
+		}
+
+		q := bson.M{
+			"groupName":   auth.groupName,
+			"roleName":    roleName,
+			"address.uri": uri,
+		}
+		u := bson.M{
+			"$bit": bson.M{"address.$.methodValue": bson.M{"and": 15 &^ methodValue}},
+			"$inc": bson.M{"version": 1},
+		}
+		if len(unset) > 0 {
+			u["$unset"] = unset
+		}
+
+		if err := coll.Update(q, u); err != nil {
+			if err == mgo.ErrNotFound {
+				continue
+			}
+			return fmt.Errorf("role remove route exception %s", err.Error())
+		}
+
+		q = bson.M{
+			"groupName": auth.groupName,
+			"roleName":  roleName,
+		}
+		u = bson.M{
+			"$pull": bson.M{"address": bson.M{"uri": uri, "methodValue": 0}},
+		}
+
+		if err := coll.Update(q, u); err != nil {
+			return fmt.Errorf("role remove route exception %s", err.Error())
+		}
+	}
+
+	return nil
+}
+
 func (auth *Authorization) RoleRemove(roleName string) error {
 	session, err := auth.mongoFactory.Get()
 	if err != nil {
@@ -172,11 +441,17 @@ func (auth *Authorization) RoleRemove(roleName string) error {
 		"groupName": auth.groupName,
 	}
 
+	role := RoleInfo{}
+	if err := coll.Find(query).Select(bson.M{"tags": 1}).One(&role); err != nil {
+		return fmt.Errorf("role remove exception %s", err.Error())
+	}
+
 	if err := coll.Remove(query); err != nil {
 		return fmt.Errorf("role remove exception %s", err.Error())
 	}
 
-	return nil
+	// 角色的标签不再被其他角色使用时，收回这些标签的委托管理范围
+	return auth.scopePruneRoleTags(session.DB(auth.dataBaseName), role.Tags)
 }
 
 func (auth *Authorization) RoleRouteDiff(roleName string) ([]RouteListView, error) {
@@ -278,13 +553,15 @@ func (auth *Authorization) RoleInfoList(roleName string) ([]RoleListView, error)
 			Type:      role.Type,
 			Routers:   routers,
 			Users:     users,
+			Version:   role.Version,
+			Tags:      role.Tags,
 		})
 	}
 
 	return roleListView, nil
 }
 
-func (auth *Authorization) RoleAddUser(roleName string, userIds []string) error {
+func (auth *Authorization) RoleAddUser(roleName string, userIds []string, version int64) error {
 	session, err := auth.mongoFactory.Get()
 	if err != nil {
 		return err
@@ -306,14 +583,17 @@ func (auth *Authorization) RoleAddUser(roleName string, userIds []string) error
 		},
 	}
 
-	if err := coll.Update(query, update); err != nil {
+	if err := versionUpdate(coll, query, update, version); err != nil {
+		if err == ErrVersionConflict {
+			return err
+		}
 		return fmt.Errorf("add user exception %s", err.Error())
 	}
 
 	return nil
 }
 
-func (auth *Authorization) RoleRemoveUser(roleName string, userIds []string) error {
+func (auth *Authorization) RoleRemoveUser(roleName string, userIds []string, version int64) error {
 	session, err := auth.mongoFactory.Get()
 	if err != nil {
 		return err
@@ -335,13 +615,17 @@ func (auth *Authorization) RoleRemoveUser(roleName string, userIds []string) err
 		},
 	}
 
-	if err := coll.Update(query, update); err != nil {
+	if err := versionUpdate(coll, query, update, version); err != nil {
+		if err == ErrVersionConflict {
+			return err
+		}
 		return fmt.Errorf("remove user exception %s", err.Error())
 	}
 
 	return nil
 }
 
+// 取消原默认角色后设置新的默认角色，设置失败时会恢复原默认角色
 func (auth *Authorization) RoleSetDefault(roleName string) error {
 	session, err := auth.mongoFactory.Get()
 	if err != nil {
@@ -350,38 +634,49 @@ func (auth *Authorization) RoleSetDefault(roleName string) error {
 	defer auth.mongoFactory.Put(session)
 
 	coll := session.DB(auth.dataBaseName).C(roleCollName)
+	w := auth.newTxnWriter(session.DB(auth.dataBaseName))
 
-	query := bson.M{
-		"isDefault": true,
-		"groupName": auth.groupName,
+	// 记录原默认角色，用于补偿
+	defaultRoles := []RoleInfo{}
+	err = coll.Find(bson.M{"isDefault": true, "groupName": auth.groupName}).Select(bson.M{"roleName": 1}).All(&defaultRoles)
+	if err != nil {
+		return fmt.Errorf("query default role exception %s", err.Error())
 	}
 
-	update := bson.M{
-		"$set": bson.M{
-			"isDefault": false,
-		},
-	}
-	if err := coll.Update(query, update); err != nil {
-		if err != mgo.ErrNotFound {
-			return fmt.Errorf("default role set true to false exception %s", err.Error())
+	return w.run(auth.setDefaultRoleSteps(w, roleName, defaultRoles))
+}
+
+// 设置默认角色的步骤，defaultRoles为原默认角色，用于补偿
+func (auth *Authorization) setDefaultRoleSteps(w txnWrites, roleName string, defaultRoles []RoleInfo) []TxnStep {
+	steps := []TxnStep{}
+	for _, role := range defaultRoles {
+		q := bson.M{
+			"roleName":  role.RoleName,
+			"groupName": auth.groupName,
 		}
+		steps = append(steps, TxnStep{
+			Name: "default role set true to false",
+			Do: func() error {
+				return w.update(roleCollName, q, bson.M{"$set": bson.M{"isDefault": false}, "$inc": bson.M{"version": 1}})
+			},
+			Undo: func() error {
+				return w.update(roleCollName, q, bson.M{"$set": bson.M{"isDefault": true}, "$inc": bson.M{"version": 1}})
+			},
+		})
 	}
 
-	query1 := bson.M{
+	query := bson.M{
 		"roleName":  roleName,
 		"groupName": auth.groupName,
 	}
-	update1 := bson.M{
-		"$set": bson.M{
-			"isDefault": true,
+	steps = append(steps, TxnStep{
+		Name: "default role set false to true",
+		Do: func() error {
+			return w.update(roleCollName, query, bson.M{"$set": bson.M{"isDefault": true}, "$inc": bson.M{"version": 1}})
 		},
-	}
-
-	if err := coll.Update(query1, update1); err != nil {
-		return fmt.Errorf("default role set false to true exception %s", err.Error())
-	}
+	})
 
-	return nil
+	return steps
 }
 
 func (auth *Authorization) routerMapByReqAddr(addrList []Address) (map[string]bool, error) {
@@ -501,6 +796,7 @@ func (auth *Authorization) roleRefreshRouterMap(url, method string, enable bool)
 
 	u := bson.M{
 		"$set": bson.M{key: enable},
+		"$inc": bson.M{"version": 1},
 	}
 
 	_, err = coll.UpdateAll(q, u)
@@ -513,6 +809,7 @@ type RoleUserListView struct {
 	IsDefault bool            `json:"isDefault"`
 	Type      int             `json:"type"`
 	Routers   []RoleRouteInfo `json:"routers"`
+	Version   int64           `json:"version"`
 }
 
 func (auth *Authorization) UserOwnRolenames(userId string) ([]string, error) {
@@ -574,6 +871,7 @@ func (auth *Authorization) UserOwnRoles(userId string) ([]RoleUserListView, erro
 			IsDefault: role.IsDefault,
 			Type:      role.Type,
 			Routers:   routers,
+			Version:   role.Version,
 		})
 	}
 	return roleViews, nil
@@ -628,7 +926,7 @@ func (auth *Authorization) UserGrantRoute(userId string) (map[string]int, bool,
 	isAdmin := false
 	grantRoutes := make(map[string]int)
 	for _, role := range roles {
-		if role.Type == superAdminRoleType {
+		if role.Type == SuperAdminRoleType {
 			isAdmin = true
 		}
 		for _, addr := range role.Address {
@@ -679,7 +977,7 @@ func (auth *Authorization) QueryRoleAuth(url, method, userId string) (bool, bool
 	existDataAuth := false
 	for _, role := range roles {
 		// 如果该用户拥有超管角色，那么不需要判断是否拥有数据权限
-		if role.Type == superAdminRoleType {
+		if role.Type == SuperAdminRoleType {
 			return true, true, false
 		} else {
 			existDataAuth = role.RouterMap[fmt.Sprintf("%s%s%s", num, splitString, url)]
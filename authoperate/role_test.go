@@ -0,0 +1,36 @@
+package authoperate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckAppendAddr(t *testing.T) {
+	routers := []RouterInfo{{Uri: "/api/a"}, {Uri: "/api/b"}}
+
+	cases := []struct {
+		name      string
+		urlMethod map[string]int
+		err       string
+	}{
+		{"empty", map[string]int{}, ""},
+		{"all methods", map[string]int{"/api/a": 15, "/api/b": 1}, ""},
+		{"unknown route", map[string]int{"/api/a": 1, "/api/c": 1}, "route /api/c does not exist"},
+		{"zero methodValue", map[string]int{"/api/a": 0}, "invalid methodValue 0"},
+		{"negative methodValue", map[string]int{"/api/a": -1}, "invalid methodValue -1"},
+		{"unknown method bit", map[string]int{"/api/b": 17}, "invalid methodValue 17"},
+	}
+
+	for _, c := range cases {
+		err := checkAppendAddr(routers, c.urlMethod)
+		if c.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: checkAppendAddr error = %v, want %q", c.name, err, c.err)
+		}
+	}
+}
@@ -19,7 +19,9 @@ type RouterInfo struct {
 	Uri       string                `json:"uri" bson:"uri"`
 	Desc      string                `json:"desc" bson:"desc"`
 	GroupName string                `json:"groupName" bson:"groupName"`
-	MethodMap map[string]VerifyData `json:"methodMap" bson:"methodMap"` //key是数字
+	MethodMap map[string]VerifyData `json:"methodMap" bson:"methodMap"`       //key是数字
+	Version   int64                 `json:"version" bson:"version,omitempty"` //每次修改加1，用于乐观锁
+	Pinyin    []string              `json:"-" bson:"pinyin,omitempty"`        //desc的拼音，写入时计算，用于拼音搜索
 }
 
 type VerifyData struct {
@@ -46,9 +48,11 @@ type RouteListView struct {
 	Uri     string        `json:"uri"`
 	Desc    string        `json:"desc"`
 	Methods []RouteMethod `json:"methods"`
+	Version int64         `json:"version"`
 }
 
-func (auth *Authorization) RouterUpdateUriDesc(uri, desc string) error {
+// version大于0时要求与路由当前的版本号一致，否则返回ErrVersionConflict
+func (auth *Authorization) RouterUpdateUriDesc(uri, desc string, version int64) error {
 	session, err := auth.mongoFactory.Get()
 	if err != nil {
 		return err
@@ -57,13 +61,13 @@ func (auth *Authorization) RouterUpdateUriDesc(uri, desc string) error {
 	coll := session.DB(auth.dataBaseName).C(routerCollName)
 
 	u := bson.M{
-		"$set": bson.M{"desc": desc},
+		"$set": bson.M{"desc": desc, "pinyin": auth.pinyinOf(desc)},
 	}
 
-	return coll.Update(bson.M{"uri": uri, "groupName": auth.groupName}, u)
+	return versionUpdate(coll, bson.M{"uri": uri, "groupName": auth.groupName}, u, version)
 }
 
-func (auth *Authorization) RouterUpdateMethodDesc(uri, method, desc string) error {
+func (auth *Authorization) RouterUpdateMethodDesc(uri, method, desc string, version int64) error {
 	session, err := auth.mongoFactory.Get()
 	if err != nil {
 		return err
@@ -82,7 +86,7 @@ func (auth *Authorization) RouterUpdateMethodDesc(uri, method, desc string) erro
 		},
 	}
 
-	return coll.Update(q, u)
+	return versionUpdate(coll, q, u, version)
 }
 
 func (auth *Authorization) RouterUpsertBatch(infos []RouterInfo) error {
@@ -105,7 +109,8 @@ func (auth *Authorization) RouterUpsertBatch(infos []RouterInfo) error {
 		}
 
 		set := bson.M{
-			"desc": info.Desc,
+			"desc":   info.Desc,
+			"pinyin": auth.pinyinOf(info.Desc),
 		}
 
 		for method, p := range info.MethodMap {
@@ -115,6 +120,7 @@ func (auth *Authorization) RouterUpsertBatch(infos []RouterInfo) error {
 
 		update := bson.M{
 			"$set": set,
+			"$inc": bson.M{"version": 1},
 		}
 
 		if _, err := coll.Upsert(query, update); err != nil {
@@ -220,6 +226,9 @@ func (auth *Authorization) RouterInfoByUri(uri string) (RouteListView, error) {
 
 	router := RouterInfo{}
 	if err := coll.Find(query).One(&router); err != nil {
+		if err == mgo.ErrNotFound {
+			return RouteListView{}, ErrNotFound
+		}
 		return RouteListView{}, fmt.Errorf("query router by uri err: %s", err.Error())
 	}
 
@@ -236,10 +245,12 @@ func (auth *Authorization) RouterInfoByUri(uri string) (RouteListView, error) {
 		Uri:     router.Uri,
 		Desc:    router.Desc,
 		Methods: methods,
+		Version: router.Version,
 	}, nil
 
 }
 
+// uri按字面模糊匹配，不区分大小写
 func (auth *Authorization) RouterGetInfoReg(uri string) ([]RouteListView, error) {
 	session, err := auth.mongoFactory.Get()
 	if err != nil {
@@ -250,10 +261,7 @@ func (auth *Authorization) RouterGetInfoReg(uri string) ([]RouteListView, error)
 
 	query := bson.M{
 		"groupName": auth.groupName,
-		"uri": bson.RegEx{
-			Pattern: uri,
-			Options: "i",
-		},
+		"uri":       literalRegex(uri),
 	}
 
 	routers := []RouterInfo{}
@@ -276,6 +284,7 @@ func (auth *Authorization) RouterGetInfoReg(uri string) ([]RouteListView, error)
 			Uri:     router.Uri,
 			Desc:    router.Desc,
 			Methods: methods,
+			Version: router.Version,
 		})
 	}
 
@@ -326,6 +335,7 @@ func (auth *Authorization) RouterDelMethod(uri, method string) error {
 		"$unset": bson.M{
 			fmt.Sprintf("methodMap.%s", methodNum): 1,
 		},
+		"$inc": bson.M{"version": 1},
 	}
 
 	if err := coll.Update(query, update); err != nil {
@@ -358,6 +368,7 @@ func (auth *Authorization) RouterVerifyData(uri, method string, enable bool) err
 		"$set": bson.M{
 			fmt.Sprintf("methodMap.%s.enable", method): enable,
 		},
+		"$inc": bson.M{"version": 1},
 	}
 
 	err = coll.Update(query, set)
@@ -397,6 +408,7 @@ func (auth *Authorization) RouterList(enable bool) ([]RouteListView, error) {
 				Uri:     router.Uri,
 				Desc:    router.Desc,
 				Methods: methods,
+				Version: router.Version,
 			})
 		}
 	}
@@ -0,0 +1,238 @@
+package authoperate
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+const scopeCollName = "TC_OREO_SCOPE"
+
+// 委托管理的范围类型
+const (
+	ScopeRoleUser = "role_user" // 管理带有某个标签的角色的成员
+	ScopeRoute    = "route"     // 修改某个前缀下的路由
+)
+
+var scopeIndex mgo.Index = mgo.Index{
+	Key:    []string{"groupName", "userId", "kind", "target"},
+	Unique: true,
+	Name:   "groupName_userId_kind_target",
+}
+
+// 委托给非超管用户的管理范围，例如 Bob 可以管理标签为 team-b 的角色的成员，Carol 可以修改 /billing 下的路由
+type AdminScope struct {
+	Id           bson.ObjectId `json:"id" bson:"_id"`
+	GroupName    string        `json:"-" bson:"groupName"`
+	UserId       string        `json:"userId" bson:"userId"`
+	Kind         string        `json:"kind" bson:"kind"`
+	Target       string        `json:"target" bson:"target"` //role_user时为角色标签，route时为路由前缀
+	CreateUserId string        `json:"createUserId" bson:"createUserId"`
+	CreateTime   time.Time     `json:"createTime" bson:"createTime"`
+}
+
+func normalizeScopeTarget(kind, target string) (string, error) {
+	target = strings.TrimSpace(target)
+	switch kind {
+	case ScopeRoleUser:
+		if target == "" {
+			return "", fmt.Errorf("scope role tag is empty")
+		}
+		return target, nil
+	case ScopeRoute:
+		target = strings.ToLower(target)
+		if len(target) > 1 {
+			target = strings.TrimRight(target, "/")
+		}
+		if !strings.HasPrefix(target, "/") {
+			return "", fmt.Errorf("scope route prefix must start with /")
+		}
+		return target, nil
+	}
+	return "", fmt.Errorf("unsupported scope kind %s", kind)
+}
+
+// 添加管理范围，同一用户的相同范围只保留一条
+func (auth *Authorization) ScopeAdd(userId, kind, target, createUserId string) (AdminScope, error) {
+	scope := AdminScope{}
+	target, err := normalizeScopeTarget(kind, target)
+	if err != nil {
+		return scope, err
+	}
+
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return scope, err
+	}
+	defer auth.mongoFactory.Put(session)
+	coll := session.DB(auth.dataBaseName).C(scopeCollName)
+
+	query := bson.M{
+		"groupName": auth.groupName,
+		"userId":    userId,
+		"kind":      kind,
+		"target":    target,
+	}
+
+	update := bson.M{
+		"$setOnInsert": bson.M{
+			"_id":          bson.NewObjectId(),
+			"createUserId": createUserId,
+			"createTime":   time.Now(),
+		},
+	}
+
+	if _, err := coll.Upsert(query, update); err != nil {
+		return scope, fmt.Errorf("add admin scope exception %s", err.Error())
+	}
+
+	if err := coll.Find(query).One(&scope); err != nil {
+		return scope, fmt.Errorf("add admin scope exception %s", err.Error())
+	}
+
+	return scope, nil
+}
+
+// 查询管理范围，userId为空时返回组内所有的管理范围
+func (auth *Authorization) ScopeList(userId string) ([]AdminScope, error) {
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer auth.mongoFactory.Put(session)
+	coll := session.DB(auth.dataBaseName).C(scopeCollName)
+
+	q := bson.M{
+		"groupName": auth.groupName,
+	}
+	if userId != "" {
+		q["userId"] = userId
+	}
+
+	scopes := []AdminScope{}
+	if err := coll.Find(q).Sort("userId", "kind", "target").All(&scopes); err != nil {
+		return nil, fmt.Errorf("query admin scope exception %s", err.Error())
+	}
+
+	return scopes, nil
+}
+
+// 收回管理范围
+func (auth *Authorization) ScopeRemove(id string) error {
+	if !bson.IsObjectIdHex(id) {
+		return fmt.Errorf("invalid scope id %s", id)
+	}
+
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return err
+	}
+	defer auth.mongoFactory.Put(session)
+	coll := session.DB(auth.dataBaseName).C(scopeCollName)
+
+	err = coll.Remove(bson.M{"groupName": auth.groupName, "_id": bson.ObjectIdHex(id)})
+	if err != nil {
+		return fmt.Errorf("remove admin scope exception %s", err.Error())
+	}
+
+	return nil
+}
+
+// 删除没有任何角色使用的标签上的role_user管理范围
+func (auth *Authorization) scopePruneRoleTags(db *mgo.Database, tags []string) error {
+	unused := []string{}
+	for _, tag := range tags {
+		n, err := db.C(roleCollName).Find(bson.M{"groupName": auth.groupName, "tags": tag}).Count()
+		if err != nil {
+			return fmt.Errorf("query role tags exception %s", err.Error())
+		}
+		if n == 0 {
+			unused = append(unused, tag)
+		}
+	}
+
+	if len(unused) == 0 {
+		return nil
+	}
+
+	q := bson.M{
+		"groupName": auth.groupName,
+		"kind":      ScopeRoleUser,
+		"target":    bson.M{"$in": unused},
+	}
+
+	if _, err := db.C(scopeCollName).RemoveAll(q); err != nil {
+		return fmt.Errorf("remove admin scope exception %s", err.Error())
+	}
+
+	return nil
+}
+
+// 可以通过role_user管理范围管理成员的角色标签，超管角色即使带有标签也不能委托管理
+func scopeRoleTags(role RoleInfo) []string {
+	if role.Type == SuperAdminRoleType {
+		return nil
+	}
+	return role.Tags
+}
+
+// 用户是否可以管理角色的成员，角色的任一标签在用户的role_user管理范围内即可，超管角色只能由超管管理
+func (auth *Authorization) ScopeCheckRoleUser(userId, roleName string) (bool, error) {
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return false, err
+	}
+	defer auth.mongoFactory.Put(session)
+
+	role := RoleInfo{}
+	err = session.DB(auth.dataBaseName).C(roleCollName).
+		Find(bson.M{"groupName": auth.groupName, "roleName": roleName}).Select(bson.M{"type": 1, "tags": 1}).One(&role)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return false, nil
+		}
+		return false, fmt.Errorf("query role tags exception %s", err.Error())
+	}
+
+	tags := scopeRoleTags(role)
+	if len(tags) == 0 {
+		return false, nil
+	}
+
+	q := bson.M{
+		"groupName": auth.groupName,
+		"userId":    userId,
+		"kind":      ScopeRoleUser,
+		"target":    bson.M{"$in": tags},
+	}
+
+	n, err := session.DB(auth.dataBaseName).C(scopeCollName).Find(q).Count()
+	if err != nil {
+		return false, fmt.Errorf("query admin scope exception %s", err.Error())
+	}
+
+	return n > 0, nil
+}
+
+// 用户是否可以修改路由，路由必须在某个route管理范围的前缀之下，按路径分段匹配，/billing 不包含 /billings
+func (auth *Authorization) ScopeCheckRoute(userId, uri string) (bool, error) {
+	scopes, err := auth.ScopeList(userId)
+	if err != nil {
+		return false, err
+	}
+
+	uri = strings.ToLower(strings.TrimSpace(uri))
+	for _, scope := range scopes {
+		if scope.Kind != ScopeRoute {
+			continue
+		}
+		if scope.Target == "/" || uri == scope.Target || strings.HasPrefix(uri, scope.Target+"/") {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,43 @@
+package authoperate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScopeRoleTags(t *testing.T) {
+	cases := []struct {
+		name string
+		role RoleInfo
+		want []string
+	}{
+		{"no tags", RoleInfo{RoleName: "r"}, nil},
+		{"tagged role", RoleInfo{RoleName: "r", Tags: []string{"team-b"}}, []string{"team-b"}},
+		{"tagged superadmin", RoleInfo{RoleName: "admin", Type: SuperAdminRoleType, Tags: []string{"team-b"}}, nil},
+	}
+
+	for _, c := range cases {
+		if got := scopeRoleTags(c.role); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: scopeRoleTags = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestCheckRoleTags(t *testing.T) {
+	cases := []struct {
+		name string
+		typ  int
+		tags []string
+		ok   bool
+	}{
+		{"role with tags", 0, []string{"team-b"}, true},
+		{"superadmin without tags", SuperAdminRoleType, nil, true},
+		{"superadmin with tags", SuperAdminRoleType, []string{"team-b"}, false},
+	}
+
+	for _, c := range cases {
+		if err := checkRoleTags(c.typ, c.tags); (err == nil) != c.ok {
+			t.Errorf("%s: checkRoleTags = %v, want ok %t", c.name, err, c.ok)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package authoperate
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+// 搜索的匹配方式
+const (
+	SearchContains = "contains" // 包含关键字，默认
+	SearchPrefix   = "prefix"   // 以关键字开头
+)
+
+// 用户name和路由desc的拼音在写入时计算并存入pinyin字段，拼音搜索只查询该字段的索引
+var userPinyinIndex mgo.Index = mgo.Index{
+	Key:  []string{"groupName", "pinyin"},
+	Name: "groupName_pinyin",
+}
+
+var routerPinyinIndex mgo.Index = mgo.Index{
+	Key:  []string{"groupName", "pinyin"},
+	Name: "groupName_pinyin",
+}
+
+// 将中文转换为拼音，返回全拼和首字母等候选，如"张三"返回["zhangsan", "zs"]，
+// 库中不内置拼音词典，由使用方通过Oreo.SetPinyinConverter注入
+type PinyinFunc func(s string) []string
+
+// 搜索条件，关键字按字面匹配且不区分大小写，不会被当作正则表达式
+type SearchOptions struct {
+	Keyword string
+	Mode    string // SearchContains或SearchPrefix
+	Limit   int    // 最多返回的数量，默认50，最大500
+}
+
+func (opts SearchOptions) limit() int {
+	return ListOptions{Limit: opts.Limit}.limit()
+}
+
+func (opts SearchOptions) check() (string, error) {
+	keyword := strings.TrimSpace(opts.Keyword)
+	if keyword == "" {
+		return "", fmt.Errorf("search keyword is empty")
+	}
+
+	if opts.Mode != "" && opts.Mode != SearchContains && opts.Mode != SearchPrefix {
+		return "", fmt.Errorf("unsupported search mode %s, must be %s or %s", opts.Mode, SearchContains, SearchPrefix)
+	}
+
+	return keyword, nil
+}
+
+// 转义后的不区分大小写的正则
+func (opts SearchOptions) regex(keyword string) bson.RegEx {
+	pattern := regexp.QuoteMeta(keyword)
+	if opts.Mode == SearchPrefix {
+		pattern = "^" + pattern
+	}
+	return bson.RegEx{Pattern: pattern, Options: "i"}
+}
+
+// 匹配已经是小写的字段，不使用i选项，前缀匹配时可以利用索引确定扫描范围
+func (opts SearchOptions) lowerRegex(keyword string) bson.RegEx {
+	pattern := regexp.QuoteMeta(strings.ToLower(keyword))
+	if opts.Mode == SearchPrefix {
+		pattern = "^" + pattern
+	}
+	return bson.RegEx{Pattern: pattern}
+}
+
+// 按字面不区分大小写的包含匹配，用于替换原来直接使用用户输入的正则
+func literalRegex(s string) bson.RegEx {
+	return bson.RegEx{Pattern: regexp.QuoteMeta(s), Options: "i"}
+}
+
+// 设置拼音转换，并为已有的用户name和路由desc计算拼音
+func (auth *Authorization) SetPinyin(fn PinyinFunc) error {
+	auth.pinyin = fn
+
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return err
+	}
+	defer auth.mongoFactory.Put(session)
+	db := session.DB(auth.dataBaseName)
+
+	users := []UserInfo{}
+	err = db.C(userCollName).Find(bson.M{"groupName": auth.groupName, "name": nonASCII()}).Select(bson.M{"userId": 1, "name": 1}).All(&users)
+	if err != nil {
+		return fmt.Errorf("query users exception %s", err.Error())
+	}
+	for _, user := range users {
+		q := bson.M{"groupName": auth.groupName, "userId": user.UserId}
+		if err := db.C(userCollName).Update(q, bson.M{"$set": bson.M{"pinyin": auth.pinyinOf(user.Name)}}); err != nil && err != mgo.ErrNotFound {
+			return fmt.Errorf("update user pinyin exception %s", err.Error())
+		}
+	}
+
+	routers := []RouterInfo{}
+	err = db.C(routerCollName).Find(bson.M{"groupName": auth.groupName, "desc": nonASCII()}).Select(bson.M{"uri": 1, "desc": 1}).All(&routers)
+	if err != nil {
+		return fmt.Errorf("query router exception %s", err.Error())
+	}
+	for _, router := range routers {
+		q := bson.M{"groupName": auth.groupName, "uri": router.Uri}
+		if err := db.C(routerCollName).Update(q, bson.M{"$set": bson.M{"pinyin": auth.pinyinOf(router.Desc)}}); err != nil && err != mgo.ErrNotFound {
+			return fmt.Errorf("update router pinyin exception %s", err.Error())
+		}
+	}
+
+	return nil
+}
+
+// 写入时计算的拼音候选，统一转为小写，不包含非ASCII字符或未设置拼音转换时为空
+func (auth *Authorization) pinyinOf(s string) []string {
+	pys := []string{}
+	if auth.pinyin == nil || !hasNonASCII(s) {
+		return pys
+	}
+
+	seen := make(map[string]bool)
+	for _, py := range auth.pinyin(s) {
+		py = strings.ToLower(strings.TrimSpace(py))
+		if py == "" || seen[py] {
+			continue
+		}
+		seen[py] = true
+		pys = append(pys, py)
+	}
+	return pys
+}
+
+func hasNonASCII(s string) bool {
+	for _, r := range s {
+		if r > 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// 关键字为纯字母时才尝试匹配拼音
+func (auth *Authorization) pinyinKeyword(keyword string) (string, bool) {
+	if auth.pinyin == nil {
+		return "", false
+	}
+
+	for _, r := range keyword {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return "", false
+		}
+	}
+	return strings.ToLower(keyword), true
+}
+
+// 包含非ASCII字符的字段，只有这些文档需要计算拼音
+func nonASCII() bson.RegEx {
+	return bson.RegEx{Pattern: `[^\x00-\x7f]`}
+}
+
+// 按userId或name搜索用户，结果按userId排序
+func (auth *Authorization) UserSearch(opts SearchOptions) ([]UserDetail, error) {
+	keyword, err := opts.check()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer auth.mongoFactory.Put(session)
+	coll := session.DB(auth.dataBaseName).C(userCollName)
+
+	limit := opts.limit()
+	selector := bson.M{"userId": 1, "name": 1}
+
+	users := []UserInfo{}
+	err = coll.Find(bson.M{
+		"groupName": auth.groupName,
+		"$or": []bson.M{
+			{"userId": opts.regex(keyword)},
+			{"name": opts.regex(keyword)},
+		},
+	}).Select(selector).Sort("userId").Limit(limit).All(&users)
+	if err != nil {
+		return nil, fmt.Errorf("search users exception %s", err.Error())
+	}
+
+	if py, ok := auth.pinyinKeyword(keyword); ok {
+		cands := []UserInfo{}
+		err = coll.Find(bson.M{"groupName": auth.groupName, "pinyin": opts.lowerRegex(py)}).Select(selector).Sort("userId").Limit(limit).All(&cands)
+		if err != nil {
+			return nil, fmt.Errorf("search users exception %s", err.Error())
+		}
+		users = append(users, cands...)
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].UserId < users[j].UserId })
+
+	ul := []UserDetail{}
+	seen := make(map[string]bool)
+	for _, user := range users {
+		if seen[user.UserId] || len(ul) >= limit {
+			continue
+		}
+		seen[user.UserId] = true
+		ul = append(ul, UserDetail{UserId: user.UserId, Name: user.Name})
+	}
+
+	return ul, nil
+}
+
+// 按uri或描述搜索路由，结果按uri排序
+func (auth *Authorization) RouteSearch(opts SearchOptions) ([]RouteListView, error) {
+	keyword, err := opts.check()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer auth.mongoFactory.Put(session)
+	coll := session.DB(auth.dataBaseName).C(routerCollName)
+
+	limit := opts.limit()
+
+	routers := []RouterInfo{}
+	err = coll.Find(bson.M{
+		"groupName": auth.groupName,
+		"$or": []bson.M{
+			{"uri": opts.lowerRegex(keyword)},
+			{"desc": opts.regex(keyword)},
+		},
+	}).Sort("uri").Limit(limit).All(&routers)
+	if err != nil {
+		return nil, fmt.Errorf("search routes exception %s", err.Error())
+	}
+
+	if py, ok := auth.pinyinKeyword(keyword); ok {
+		cands := []RouterInfo{}
+		err = coll.Find(bson.M{"groupName": auth.groupName, "pinyin": opts.lowerRegex(py)}).Sort("uri").Limit(limit).All(&cands)
+		if err != nil {
+			return nil, fmt.Errorf("search routes exception %s", err.Error())
+		}
+		routers = append(routers, cands...)
+	}
+
+	sort.Slice(routers, func(i, j int) bool { return routers[i].Uri < routers[j].Uri })
+
+	rl := []RouteListView{}
+	seen := make(map[string]bool)
+	for _, router := range routers {
+		if seen[router.Uri] || len(rl) >= limit {
+			continue
+		}
+		seen[router.Uri] = true
+		rl = append(rl, auth.routeView(router, false))
+	}
+
+	return rl, nil
+}
@@ -23,12 +23,14 @@ type SignInfo struct {
 	UserId        string         `json:"userId" bson:"userId"`
 	GroupName     string         `json:"groupName" bson:"groupName"`
 	VerifyDataUri map[string]int `json:"verifyDataUri" bson:"verifyDataUri"` // key uri value 就是 1 2 4 8 和 用 $bitsAllSet 计算
+	Version       int64          `json:"version" bson:"version,omitempty"`   //每次修改加1，用于乐观锁
 }
 
 type UpsertSignInfo struct {
 	SignKey  string    `json:"signKey"`
 	UserId   string    `json:"userId"`
 	AddrList []Address `json:"addrList"`
+	Version  int64     `json:"version"` //大于0时要求与授权当前的版本号一致
 }
 
 type SignListView struct {
@@ -42,6 +44,7 @@ type SignView struct {
 	UserId  string          `json:"userId"`
 	Name    string          `json:"name"`
 	Routers []RoleRouteInfo `json:"routers"`
+	Version int64           `json:"version"`
 }
 
 func (auth *Authorization) SignDiffGlobalDataAuthRoute(signKey, userId string) ([]RouteListView, error) {
@@ -115,21 +118,15 @@ func (auth *Authorization) SignPatchVerifyData(signKey string, userIds []string,
 			"userId":    userId,
 		}
 
-		sign := SignInfo{}
-		err := coll.Find(q).One(&sign)
-		if err != nil {
-			return err
-		}
-
-		for uri, methodValue := range urlMethod {
-			if mv, ok := sign.VerifyDataUri[uri]; ok {
-				sign.VerifyDataUri[uri] = mv | methodValue
-			} else {
-				sign.VerifyDataUri[uri] = methodValue
+		err := auth.signCompareAndSet(coll, q, func(sign *SignInfo) {
+			for uri, methodValue := range urlMethod {
+				if mv, ok := sign.VerifyDataUri[uri]; ok {
+					sign.VerifyDataUri[uri] = mv | methodValue
+				} else {
+					sign.VerifyDataUri[uri] = methodValue
+				}
 			}
-		}
-
-		err = coll.Update(q, bson.M{"$set": bson.M{"verifyDataUri": sign.VerifyDataUri}})
+		})
 		if err != nil {
 			return err
 		}
@@ -153,30 +150,49 @@ func (auth *Authorization) SignRemoveVerifyData(signKey string, userIds []string
 			"userId":    userId,
 		}
 
-		sign := SignInfo{}
-		err := coll.Find(q).One(&sign)
+		err := auth.signCompareAndSet(coll, q, func(sign *SignInfo) {
+			for uri, methodValue := range sign.VerifyDataUri {
+				if mv, ok := urlMethod[uri]; ok {
+					newmv := methodValue ^ mv
+					if newmv > 0 {
+						sign.VerifyDataUri[uri] = newmv
+					} else {
+						delete(sign.VerifyDataUri, uri)
+					}
+				}
+			}
+		})
 		if err != nil {
 			return err
 		}
+	}
 
-		for uri, methodValue := range sign.VerifyDataUri {
-			if mv, ok := urlMethod[uri]; ok {
-				newmv := methodValue ^ mv
-				if newmv > 0 {
-					sign.VerifyDataUri[uri] = newmv
-				} else {
-					delete(sign.VerifyDataUri, uri)
-				}
-			}
+	return nil
+}
+
+// 读取授权后修改verifyDataUri再写回，写回时以读到的版本号为条件，期间被他人修改则重新读取，避免覆盖他人的修改
+func (auth *Authorization) signCompareAndSet(coll *mgo.Collection, q bson.M, modify func(sign *SignInfo)) error {
+	for i := 0; i < 3; i++ {
+		sign := SignInfo{}
+		if err := coll.Find(q).One(&sign); err != nil {
+			return err
 		}
 
-		err = coll.Update(q, bson.M{"$set": bson.M{"verifyDataUri": sign.VerifyDataUri}})
-		if err != nil {
+		modify(&sign)
+
+		cq := bson.M{}
+		for k, v := range q {
+			cq[k] = v
+		}
+		cq["version"] = versionMatch(sign.Version)
+
+		err := coll.Update(cq, bson.M{"$set": bson.M{"verifyDataUri": sign.VerifyDataUri}, "$inc": bson.M{"version": 1}})
+		if err != mgo.ErrNotFound {
 			return err
 		}
 	}
 
-	return nil
+	return ErrVersionConflict
 }
 
 func (auth *Authorization) userSignKeyInsert(info SignInfo) error {
@@ -187,6 +203,7 @@ func (auth *Authorization) userSignKeyInsert(info SignInfo) error {
 	defer auth.mongoFactory.Put(session)
 	coll := session.DB(auth.dataBaseName).C(signCollName)
 
+	info.Version = 1
 	return coll.Insert(info)
 }
 
@@ -312,6 +329,18 @@ func (auth *Authorization) SignUpsert(info UpsertSignInfo) error {
 		"$set": doc,
 	}
 
+	// 指定了版本号说明是修改已存在的授权，不能再新建
+	if info.Version > 0 {
+		if err := versionUpdate(coll, query, update, info.Version); err != nil {
+			if err == ErrVersionConflict {
+				return err
+			}
+			return fmt.Errorf("sign upsert exception %s", err.Error())
+		}
+		return nil
+	}
+
+	update["$inc"] = bson.M{"version": 1}
 	if _, err := coll.Upsert(query, update); err != nil {
 		return fmt.Errorf("sign upsert exception %s", err.Error())
 	}
@@ -403,6 +432,7 @@ func (auth *Authorization) SignGetInfo(signKey string) (SignListView, error) {
 			UserId:  sign.UserId,
 			Name:    userMap[sign.UserId],
 			Routers: routers,
+			Version: sign.Version,
 		})
 	}
 	signListView.SignViews = signViews
@@ -457,6 +487,7 @@ func (auth *Authorization) SignCopy(signKey, copyUserId string, pastUserIds []st
 				UserId:        pastUserId,
 				GroupName:     auth.groupName,
 				VerifyDataUri: vdu,
+				Version:       1,
 			}
 
 			if err := signColl.Insert(sign); err != nil {
@@ -483,6 +514,7 @@ func (auth *Authorization) SignCopy(signKey, copyUserId string, pastUserIds []st
 				UserId:        pastUserId,
 				GroupName:     auth.groupName,
 				VerifyDataUri: sign.VerifyDataUri,
+				Version:       1,
 			}
 
 			if err := signColl.Insert(newSign); err != nil {
@@ -497,6 +529,7 @@ func (auth *Authorization) SignCopy(signKey, copyUserId string, pastUserIds []st
 type UserSignList struct {
 	OwnSigns   []OwnSign   `json:"ownSigns"`
 	GrantSigns []GrantSign `json:"grantSigns"`
+	Version    int64       `json:"version"` //用户信息的版本号，修改自己signKey的描述时使用
 }
 
 type GrantSign struct {
@@ -505,6 +538,7 @@ type GrantSign struct {
 	OwnUser string          `json:"ownUser"`
 	OwnName string          `json:"ownName"`
 	Routers []RoleRouteInfo `json:"routers"`
+	Version int64           `json:"version"`
 }
 
 type OwnSign struct {
@@ -560,6 +594,7 @@ func (auth *Authorization) UserOwnSigns(userId string) (UserSignList, error) {
 			}
 		}
 		if user.UserId == userId {
+			userSignList.Version = user.Version
 			for sign, desc := range user.SignKey {
 				ownSigns = append(ownSigns, OwnSign{
 					SignKey: sign,
@@ -594,6 +629,7 @@ func (auth *Authorization) UserOwnSigns(userId string) (UserSignList, error) {
 			OwnUser: us.userId,
 			OwnName: us.name,
 			Routers: routers,
+			Version: info.Version,
 		})
 	}
 	userSignList.GrantSigns = grantSigns
@@ -0,0 +1,307 @@
+package authoperate
+
+import (
+	"fmt"
+	"sort"
+)
+
+// 模拟变更的类型
+const (
+	ChangeRoleUpsert      = "role_upsert"       // 与RoleUpsert一致，全量替换角色的路由和方法
+	ChangeRoleRemove      = "role_remove"       // 删除角色
+	ChangeRoleAddUser     = "role_add_user"     // 向角色添加用户
+	ChangeRoleRemoveUser  = "role_remove_user"  // 删除角色中的用户
+	ChangeSignRevoke      = "sign_revoke"       // 收回signKey的授权，指定uri时只收回该uri下的方法
+	ChangeRouteDisable    = "route_disable"     // 删除路由，指定method时只删除该方法
+	ChangeDataAuthEnable  = "data_auth_enable"  // 启用路由method的数据权限
+	ChangeDataAuthDisable = "data_auth_disable" // 停用路由method的数据权限
+)
+
+type PolicyChange struct {
+	Type        string    `json:"type"`
+	RoleName    string    `json:"roleName,omitempty"`
+	RoleType    int       `json:"roleType,omitempty"`
+	AddrList    []Address `json:"addrList,omitempty"`
+	UserIds     []string  `json:"userIds,omitempty"`
+	SignKey     string    `json:"signKey,omitempty"`
+	Uri         string    `json:"uri,omitempty"`
+	Method      string    `json:"method,omitempty"`
+	MethodValue int       `json:"methodValue,omitempty"`
+}
+
+// 变更前后某个用户权限的差异，SignKey为空表示路由权限，否则表示该signKey下的数据权限
+type PermissionDiff struct {
+	UserId  string `json:"userId"`
+	Name    string `json:"name"`
+	Uri     string `json:"uri"`
+	Method  string `json:"method"`
+	SignKey string `json:"signKey,omitempty"`
+	Gain    bool   `json:"gain"` //true表示获得权限，false表示失去权限
+}
+
+// 在内存中应用变更，不会写入数据库
+func (ps *PolicyState) Apply(change PolicyChange) error {
+	defer ps.reindex()
+
+	switch change.Type {
+	case ChangeRoleUpsert:
+		return ps.applyRoleUpsert(change)
+	case ChangeRoleRemove:
+		roles := []RoleInfo{}
+		for _, role := range ps.Roles {
+			if role.RoleName != change.RoleName {
+				roles = append(roles, role)
+			}
+		}
+		ps.Roles = roles
+	case ChangeRoleAddUser:
+		role, err := ps.findRole(change.RoleName)
+		if err != nil {
+			return err
+		}
+		set := make(map[string]struct{})
+		for _, userId := range role.UserIds {
+			set[userId] = struct{}{}
+		}
+		for _, userId := range change.UserIds {
+			if _, ok := set[userId]; !ok {
+				role.UserIds = append(role.UserIds, userId)
+				set[userId] = struct{}{}
+			}
+		}
+	case ChangeRoleRemoveUser:
+		role, err := ps.findRole(change.RoleName)
+		if err != nil {
+			return err
+		}
+		set := make(map[string]struct{})
+		for _, userId := range change.UserIds {
+			set[userId] = struct{}{}
+		}
+		userIds := []string{}
+		for _, userId := range role.UserIds {
+			if _, ok := set[userId]; !ok {
+				userIds = append(userIds, userId)
+			}
+		}
+		role.UserIds = userIds
+	case ChangeSignRevoke:
+		ps.applySignRevoke(change)
+	case ChangeRouteDisable:
+		return ps.applyRouteDisable(change)
+	case ChangeDataAuthEnable, ChangeDataAuthDisable:
+		return ps.applyDataAuth(change, change.Type == ChangeDataAuthEnable)
+	default:
+		return fmt.Errorf("unknown change type: %s", change.Type)
+	}
+
+	return nil
+}
+
+func (ps *PolicyState) findRole(roleName string) (*RoleInfo, error) {
+	for i := range ps.Roles {
+		if ps.Roles[i].RoleName == roleName {
+			return &ps.Roles[i], nil
+		}
+	}
+	return nil, fmt.Errorf("role %s not found", roleName)
+}
+
+// 与routerMapByReqAddr一致，只保留路由表中存在的路由和方法
+func (ps *PolicyState) routerMapByAddr(addrList []Address) map[string]bool {
+	ps.index()
+
+	routerMap := make(map[string]bool)
+	for _, addr := range addrList {
+		i, ok := ps.routerIndex[addr.Uri]
+		if !ok {
+			continue
+		}
+		for _, m := range ps.auth.MethodValueToMethods(addr.MethodValue) {
+			routerMap[routerMapKey(m, addr.Uri)] = ps.Routers[i].MethodMap[m].Enable
+		}
+	}
+
+	return routerMap
+}
+
+func (ps *PolicyState) applyRoleUpsert(change PolicyChange) error {
+	if change.RoleName == "" {
+		return fmt.Errorf("roleName is empty")
+	}
+
+	routerMap := ps.routerMapByAddr(change.AddrList)
+
+	if role, err := ps.findRole(change.RoleName); err == nil {
+		role.Type = change.RoleType
+		role.Address = change.AddrList
+		role.RouterMap = routerMap
+		return nil
+	}
+
+	ps.Roles = append(ps.Roles, RoleInfo{
+		RoleName:  change.RoleName,
+		GroupName: ps.auth.groupName,
+		UserIds:   []string{},
+		RouterMap: routerMap,
+		Address:   change.AddrList,
+		Type:      change.RoleType,
+	})
+
+	return nil
+}
+
+func (ps *PolicyState) applySignRevoke(change PolicyChange) {
+	set := make(map[string]struct{})
+	for _, userId := range change.UserIds {
+		set[userId] = struct{}{}
+	}
+
+	signs := []SignInfo{}
+	for _, sign := range ps.Signs {
+		if _, ok := set[sign.UserId]; !ok || sign.SignKey != change.SignKey {
+			signs = append(signs, sign)
+			continue
+		}
+
+		// 未指定uri时收回整个授权
+		if change.Uri == "" {
+			continue
+		}
+
+		if mv, ok := sign.VerifyDataUri[change.Uri]; ok {
+			revoke := change.MethodValue
+			if revoke == 0 {
+				revoke = mv
+			}
+			if mv&^revoke > 0 {
+				sign.VerifyDataUri[change.Uri] = mv &^ revoke
+			} else {
+				delete(sign.VerifyDataUri, change.Uri)
+			}
+		}
+		signs = append(signs, sign)
+	}
+
+	ps.Signs = signs
+}
+
+func (ps *PolicyState) applyRouteDisable(change PolicyChange) error {
+	routers := []RouterInfo{}
+	for _, router := range ps.Routers {
+		if router.Uri != change.Uri {
+			routers = append(routers, router)
+			continue
+		}
+
+		if change.Method == "" {
+			continue
+		}
+
+		num, err := ps.auth.MethodToNumString(change.Method)
+		if err != nil {
+			return err
+		}
+		delete(router.MethodMap, num)
+		routers = append(routers, router)
+	}
+
+	ps.Routers = routers
+	return nil
+}
+
+// 与RouterVerifyData一致，同时刷新角色中的routerMap
+func (ps *PolicyState) applyDataAuth(change PolicyChange, enable bool) error {
+	num, err := ps.auth.MethodToNumString(change.Method)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, router := range ps.Routers {
+		if router.Uri != change.Uri {
+			continue
+		}
+		vd, ok := router.MethodMap[num]
+		if !ok {
+			return fmt.Errorf("route %s %s not found", change.Method, change.Uri)
+		}
+		vd.Enable = enable
+		router.MethodMap[num] = vd
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("route %s not found", change.Uri)
+	}
+
+	key := routerMapKey(num, change.Uri)
+	for _, role := range ps.Roles {
+		if _, ok := role.RouterMap[key]; ok {
+			role.RouterMap[key] = enable
+		}
+	}
+
+	return nil
+}
+
+func (ps *PolicyState) permissionSet(userId string) map[PermissionDiff]struct{} {
+	set := make(map[PermissionDiff]struct{})
+
+	for _, rp := range ps.UserRoutePermissions(userId) {
+		set[PermissionDiff{UserId: userId, Uri: rp.Uri, Method: rp.Method}] = struct{}{}
+	}
+
+	for _, sp := range ps.UserSignPermissions(userId) {
+		set[PermissionDiff{UserId: userId, Uri: sp.Uri, Method: sp.Method, SignKey: sp.SignKey}] = struct{}{}
+	}
+
+	return set
+}
+
+// 计算变更前后所有用户获得和失去的路由权限与数据权限
+func DiffPermissions(before, after *PolicyState) []PermissionDiff {
+	set := make(map[string]struct{})
+	userIds := []string{}
+	for _, userId := range append(before.UserIds(), after.UserIds()...) {
+		if _, ok := set[userId]; !ok {
+			set[userId] = struct{}{}
+			userIds = append(userIds, userId)
+		}
+	}
+
+	diffs := []PermissionDiff{}
+	for _, userId := range userIds {
+		b := before.permissionSet(userId)
+		a := after.permissionSet(userId)
+
+		name := after.UserName(userId)
+		for p := range a {
+			if _, ok := b[p]; !ok {
+				p.Name = name
+				p.Gain = true
+				diffs = append(diffs, p)
+			}
+		}
+		for p := range b {
+			if _, ok := a[p]; !ok {
+				p.Name = name
+				diffs = append(diffs, p)
+			}
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].UserId != diffs[j].UserId {
+			return diffs[i].UserId < diffs[j].UserId
+		}
+		if diffs[i].Uri != diffs[j].Uri {
+			return diffs[i].Uri < diffs[j].Uri
+		}
+		if diffs[i].Method != diffs[j].Method {
+			return diffs[i].Method < diffs[j].Method
+		}
+		return diffs[i].SignKey < diffs[j].SignKey
+	})
+
+	return diffs
+}
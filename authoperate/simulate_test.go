@@ -0,0 +1,182 @@
+package authoperate
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// /api/a的POST开启了数据权限，admin为超管，u2创建了k2并授权u3使用POST /api/a
+func policyTestState() *PolicyState {
+	return &PolicyState{
+		Routers: []RouterInfo{
+			{Uri: "/api/a", MethodMap: map[string]VerifyData{"1": {}, "2": {Enable: true}}},
+			{Uri: "/api/b", MethodMap: map[string]VerifyData{"1": {}}},
+		},
+		Roles: []RoleInfo{
+			{RoleName: "admin", Type: SuperAdminRoleType, UserIds: []string{"u1"}, RouterMap: map[string]bool{routerMapKey("1", "/api/a"): false}},
+			{RoleName: "editor", UserIds: []string{"u2"}, RouterMap: map[string]bool{routerMapKey("1", "/api/a"): false, routerMapKey("2", "/api/a"): true}},
+			{RoleName: "viewer", UserIds: []string{"u3"}, RouterMap: map[string]bool{routerMapKey("1", "/api/b"): false}},
+		},
+		Users: []UserInfo{{UserId: "u1"}, {UserId: "u2", SignKey: map[string]string{"k2": ""}}, {UserId: "u3"}},
+		Signs: []SignInfo{{SignKey: "k2", UserId: "u3", VerifyDataUri: map[string]int{"/api/a": 2}}},
+		auth:  &Authorization{groupName: "g"},
+	}
+}
+
+// 用户的路由权限为"GET /api/a"，数据权限为"k2 POST /api/a"
+func userPermissions(ps *PolicyState, userId string) []string {
+	perms := []string{}
+	for _, rp := range ps.UserRoutePermissions(userId) {
+		perms = append(perms, rp.Method+" "+rp.Uri)
+	}
+	for _, sp := range ps.UserSignPermissions(userId) {
+		perms = append(perms, sp.SignKey+" "+sp.Method+" "+sp.Uri)
+	}
+	return perms
+}
+
+func TestPolicyStateApply(t *testing.T) {
+	cases := []struct {
+		name    string
+		changes []PolicyChange
+		userId  string
+		perms   []string
+		err     string
+	}{
+		{"unchanged", nil, "u2", []string{"GET /api/a", "POST /api/a", "k2 POST /api/a"}, ""},
+		{"superadmin", nil, "u1", []string{"GET /api/a", "* GET /api/a"}, ""},
+		{"replace role routes", []PolicyChange{
+			{Type: ChangeRoleUpsert, RoleName: "editor", AddrList: []Address{{Uri: "/api/b", MethodValue: 1}}},
+		}, "u2", []string{"GET /api/b"}, ""},
+		{"new role skips unknown routes", []PolicyChange{
+			{Type: ChangeRoleUpsert, RoleName: "ops", AddrList: []Address{{Uri: "/api/a", MethodValue: 3}, {Uri: "/api/x", MethodValue: 1}}},
+			{Type: ChangeRoleAddUser, RoleName: "ops", UserIds: []string{"u4"}},
+		}, "u4", []string{"GET /api/a", "POST /api/a"}, ""},
+		{"remove role", []PolicyChange{{Type: ChangeRoleRemove, RoleName: "viewer"}}, "u3", []string{}, ""},
+		{"add user gains granted sign", []PolicyChange{
+			{Type: ChangeRoleAddUser, RoleName: "editor", UserIds: []string{"u3", "u3"}},
+		}, "u3", []string{"GET /api/a", "POST /api/a", "GET /api/b", "k2 POST /api/a"}, ""},
+		{"remove user", []PolicyChange{{Type: ChangeRoleRemoveUser, RoleName: "editor", UserIds: []string{"u2"}}}, "u2", []string{}, ""},
+		{"revoke sign uri", []PolicyChange{
+			{Type: ChangeRoleAddUser, RoleName: "editor", UserIds: []string{"u3"}},
+			{Type: ChangeSignRevoke, SignKey: "k2", UserIds: []string{"u3"}, Uri: "/api/a", MethodValue: 2},
+		}, "u3", []string{"GET /api/a", "POST /api/a", "GET /api/b"}, ""},
+		{"disable route method", []PolicyChange{{Type: ChangeRouteDisable, Uri: "/api/a", Method: "POST"}}, "u2", []string{"GET /api/a"}, ""},
+		{"disable route", []PolicyChange{{Type: ChangeRouteDisable, Uri: "/api/a"}}, "u2", []string{}, ""},
+		{"enable data auth", []PolicyChange{{Type: ChangeDataAuthEnable, Uri: "/api/a", Method: "GET"}}, "u2",
+			[]string{"GET /api/a", "POST /api/a", "k2 GET /api/a", "k2 POST /api/a"}, ""},
+		{"disable data auth", []PolicyChange{{Type: ChangeDataAuthDisable, Uri: "/api/a", Method: "POST"}}, "u2", []string{"GET /api/a", "POST /api/a"}, ""},
+		{"unknown type", []PolicyChange{{Type: "role_rename"}}, "", nil, "unknown change type"},
+		{"empty role name", []PolicyChange{{Type: ChangeRoleUpsert}}, "", nil, "roleName is empty"},
+		{"missing role", []PolicyChange{{Type: ChangeRoleAddUser, RoleName: "ops", UserIds: []string{"u1"}}}, "", nil, "role ops not found"},
+		{"missing route", []PolicyChange{{Type: ChangeDataAuthEnable, Uri: "/api/x", Method: "GET"}}, "", nil, "route /api/x not found"},
+		{"missing method", []PolicyChange{{Type: ChangeDataAuthEnable, Uri: "/api/b", Method: "PUT"}}, "", nil, "route PUT /api/b not found"},
+		{"invalid method", []PolicyChange{{Type: ChangeRouteDisable, Uri: "/api/a", Method: "PATCH"}}, "", nil, "PATCH"},
+	}
+
+	for _, c := range cases {
+		ps := policyTestState()
+		var err error
+		for _, change := range c.changes {
+			if err = ps.Apply(change); err != nil {
+				break
+			}
+		}
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: Apply error = %v, want %q", c.name, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+			continue
+		}
+
+		if perms := userPermissions(ps, c.userId); !reflect.DeepEqual(perms, c.perms) {
+			t.Errorf("%s: %s permissions = %q, want %q", c.name, c.userId, perms, c.perms)
+		}
+	}
+}
+
+// 模拟的变更不会修改变更前的状态
+func TestPolicyStateApplyOnClone(t *testing.T) {
+	before := policyTestState()
+	after := before.Clone()
+	changes := []PolicyChange{
+		{Type: ChangeRoleAddUser, RoleName: "editor", UserIds: []string{"u3"}},
+		{Type: ChangeSignRevoke, SignKey: "k2", UserIds: []string{"u3"}, Uri: "/api/a"},
+		{Type: ChangeDataAuthEnable, Uri: "/api/a", Method: "GET"},
+	}
+	for _, change := range changes {
+		if err := after.Apply(change); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !reflect.DeepEqual(before, policyTestState()) {
+		t.Errorf("Apply on the clone modified the original state")
+	}
+}
+
+func TestDiffPermissions(t *testing.T) {
+	cases := []struct {
+		name    string
+		changes []PolicyChange
+		diffs   []string
+	}{
+		{"no changes", nil, []string{}},
+		{"remove user", []PolicyChange{{Type: ChangeRoleRemoveUser, RoleName: "editor", UserIds: []string{"u2"}}}, []string{
+			"u2 - GET /api/a",
+			"u2 - POST /api/a",
+			"u2 - k2 POST /api/a",
+		}},
+		{"add user", []PolicyChange{{Type: ChangeRoleAddUser, RoleName: "viewer", UserIds: []string{"u2", "u5"}}}, []string{
+			"u2 + GET /api/b",
+			"u5 + GET /api/b",
+		}},
+		{"enable data auth", []PolicyChange{{Type: ChangeDataAuthEnable, Uri: "/api/a", Method: "GET"}}, []string{
+			"u2 + k2 GET /api/a",
+		}},
+		{"revoke sign", []PolicyChange{
+			{Type: ChangeRoleAddUser, RoleName: "editor", UserIds: []string{"u3"}},
+			{Type: ChangeSignRevoke, SignKey: "k2", UserIds: []string{"u3"}},
+		}, []string{
+			"u3 + GET /api/a",
+			"u3 + POST /api/a",
+		}},
+		{"disable route", []PolicyChange{{Type: ChangeRouteDisable, Uri: "/api/a", Method: "GET"}}, []string{
+			"u1 - GET /api/a",
+			"u1 - * GET /api/a",
+			"u2 - GET /api/a",
+		}},
+	}
+
+	for _, c := range cases {
+		before := policyTestState()
+		after := before.Clone()
+		for _, change := range c.changes {
+			if err := after.Apply(change); err != nil {
+				t.Fatalf("%s: %v", c.name, err)
+			}
+		}
+
+		diffs := []string{}
+		for _, d := range DiffPermissions(before, after) {
+			sign := ""
+			if d.SignKey != "" {
+				sign = d.SignKey + " "
+			}
+			gain := "-"
+			if d.Gain {
+				gain = "+"
+			}
+			diffs = append(diffs, fmt.Sprintf("%s %s %s%s %s", d.UserId, gain, sign, d.Method, d.Uri))
+		}
+		if !reflect.DeepEqual(diffs, c.diffs) {
+			t.Errorf("%s: diffs = %q, want %q", c.name, diffs, c.diffs)
+		}
+	}
+}
@@ -0,0 +1,497 @@
+package authoperate
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+const (
+	snapshotCollName     = "TC_OREO_SNAPSHOT"
+	snapshotItemCollName = "TC_OREO_SNAPSHOT_ITEM"
+
+	// 快照归档的格式版本，格式不兼容时加1。格式2开始包含委托管理范围，恢复格式1的归档时保留当前的管理范围
+	SnapshotFormat = 2
+)
+
+var snapshotIndex mgo.Index = mgo.Index{
+	Key:    []string{"groupName", "seq"},
+	Unique: true,
+	Name:   "groupName_seq",
+}
+
+var snapshotItemIndex mgo.Index = mgo.Index{
+	Key:  []string{"groupName", "seq"},
+	Name: "groupName_seq",
+}
+
+// 快照的元信息，数据按条存储在TC_OREO_SNAPSHOT_ITEM中，避免大的组超过mongo单个文档的大小限制
+type SnapshotInfo struct {
+	GroupName  string    `json:"groupName" bson:"groupName"`
+	Seq        int64     `json:"seq" bson:"seq"` //组内递增的快照编号
+	Reason     string    `json:"reason" bson:"reason"`
+	Auto       bool      `json:"auto" bson:"auto"` //批量修改之前自动创建的快照
+	CreateTime time.Time `json:"createTime" bson:"createTime"`
+	Routers    int       `json:"routers" bson:"routers"`
+	Roles      int       `json:"roles" bson:"roles"`
+	Users      int       `json:"users" bson:"users"`
+	Signs      int       `json:"signs" bson:"signs"`
+	Scopes     int       `json:"scopes" bson:"scopes"`
+	Format     int       `json:"format" bson:"format"` //保存快照时归档的格式版本，为0表示格式1
+}
+
+// 组内的路由、角色、用户(包含创建的signKey)、sign授权和委托管理范围的完整数据，可以恢复到同一个组或其他组
+type SnapshotArchive struct {
+	Format  int          `json:"format"`
+	Info    SnapshotInfo `json:"info"`
+	Routers []RouterInfo `json:"routers"`
+	Roles   []RoleInfo   `json:"roles"`
+	Users   []UserInfo   `json:"users"`
+	Signs   []SignInfo   `json:"signs"`
+	Scopes  []AdminScope `json:"scopes"`
+}
+
+type snapshotItem struct {
+	GroupName string      `bson:"groupName"`
+	Seq       int64       `bson:"seq"`
+	Router    *RouterInfo `bson:"router,omitempty"`
+	Role      *RoleInfo   `bson:"role,omitempty"`
+	User      *UserInfo   `bson:"user,omitempty"`
+	Sign      *SignInfo   `bson:"sign,omitempty"`
+	Scope     *AdminScope `bson:"scope,omitempty"`
+}
+
+func (auth *Authorization) snapshotNextSeq(session *mgo.Session) (int64, error) {
+	coll := session.DB(auth.dataBaseName).C(groupCollName)
+
+	change := mgo.Change{
+		Update:    bson.M{"$inc": bson.M{"snapshotSeq": 1}},
+		ReturnNew: true,
+	}
+
+	doc := struct {
+		SnapshotSeq int64 `bson:"snapshotSeq"`
+	}{}
+
+	if _, err := coll.Find(bson.M{"groupName": auth.groupName}).Apply(change, &doc); err != nil {
+		return 0, fmt.Errorf("snapshot seq exception %s", err.Error())
+	}
+
+	return doc.SnapshotSeq, nil
+}
+
+// 读取组内当前的全部数据
+func (auth *Authorization) SnapshotLoad() (*SnapshotArchive, error) {
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer auth.mongoFactory.Put(session)
+
+	q := bson.M{
+		"groupName": auth.groupName,
+	}
+
+	archive := &SnapshotArchive{
+		Format: SnapshotFormat,
+		Info: SnapshotInfo{
+			GroupName:  auth.groupName,
+			CreateTime: time.Now(),
+		},
+		Routers: []RouterInfo{},
+		Roles:   []RoleInfo{},
+		Users:   []UserInfo{},
+		Signs:   []SignInfo{},
+		Scopes:  []AdminScope{},
+	}
+
+	db := session.DB(auth.dataBaseName)
+	if err := db.C(routerCollName).Find(q).Sort("uri").All(&archive.Routers); err != nil {
+		return nil, fmt.Errorf("query router info exception %s", err.Error())
+	}
+	if err := db.C(roleCollName).Find(q).Sort("roleName").All(&archive.Roles); err != nil {
+		return nil, fmt.Errorf("query role info exception %s", err.Error())
+	}
+	if err := db.C(userCollName).Find(q).Sort("userId").All(&archive.Users); err != nil {
+		return nil, fmt.Errorf("query users exception %s", err.Error())
+	}
+	if err := db.C(signCollName).Find(q).Sort("signKey", "userId").All(&archive.Signs); err != nil {
+		return nil, fmt.Errorf("query sign exception %s", err.Error())
+	}
+	if err := db.C(scopeCollName).Find(q).Sort("userId", "kind", "target").All(&archive.Scopes); err != nil {
+		return nil, fmt.Errorf("query admin scope exception %s", err.Error())
+	}
+
+	for i := range archive.Users {
+		archive.Users[i].Id = ""
+	}
+	archive.count()
+
+	return archive, nil
+}
+
+func (archive *SnapshotArchive) count() {
+	archive.Info.Routers = len(archive.Routers)
+	archive.Info.Roles = len(archive.Roles)
+	archive.Info.Users = len(archive.Users)
+	archive.Info.Signs = len(archive.Signs)
+	archive.Info.Scopes = len(archive.Scopes)
+}
+
+// 保存快照，先写数据再写元信息，写数据失败时列表中不会出现不完整的快照
+func (auth *Authorization) SnapshotSave(archive *SnapshotArchive, reason string, isAuto bool) (SnapshotInfo, error) {
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	defer auth.mongoFactory.Put(session)
+
+	seq, err := auth.snapshotNextSeq(session)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	items := []interface{}{}
+	item := func() snapshotItem {
+		return snapshotItem{GroupName: auth.groupName, Seq: seq}
+	}
+	for i := range archive.Routers {
+		it := item()
+		it.Router = &archive.Routers[i]
+		items = append(items, it)
+	}
+	for i := range archive.Roles {
+		it := item()
+		it.Role = &archive.Roles[i]
+		items = append(items, it)
+	}
+	for i := range archive.Users {
+		it := item()
+		it.User = &archive.Users[i]
+		items = append(items, it)
+	}
+	for i := range archive.Signs {
+		it := item()
+		it.Sign = &archive.Signs[i]
+		items = append(items, it)
+	}
+	for i := range archive.Scopes {
+		it := item()
+		it.Scope = &archive.Scopes[i]
+		items = append(items, it)
+	}
+
+	db := session.DB(auth.dataBaseName)
+	if len(items) > 0 {
+		if err := db.C(snapshotItemCollName).Insert(items...); err != nil {
+			db.C(snapshotItemCollName).RemoveAll(bson.M{"groupName": auth.groupName, "seq": seq})
+			return SnapshotInfo{}, fmt.Errorf("save snapshot exception %s", err.Error())
+		}
+	}
+
+	archive.count()
+	info := archive.Info
+	info.GroupName = auth.groupName
+	info.Seq = seq
+	info.Reason = reason
+	info.Auto = isAuto
+	info.CreateTime = time.Now()
+	info.Format = archive.Format
+
+	if err := db.C(snapshotCollName).Insert(info); err != nil {
+		db.C(snapshotItemCollName).RemoveAll(bson.M{"groupName": auth.groupName, "seq": seq})
+		return SnapshotInfo{}, fmt.Errorf("save snapshot exception %s", err.Error())
+	}
+
+	archive.Info = info
+	return info, nil
+}
+
+// 按编号倒序列出组内的快照
+func (auth *Authorization) SnapshotList() ([]SnapshotInfo, error) {
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer auth.mongoFactory.Put(session)
+	coll := session.DB(auth.dataBaseName).C(snapshotCollName)
+
+	infos := []SnapshotInfo{}
+	if err := coll.Find(bson.M{"groupName": auth.groupName}).Sort("-seq").All(&infos); err != nil {
+		return nil, fmt.Errorf("query snapshot exception %s", err.Error())
+	}
+
+	return infos, nil
+}
+
+// 读取某个快照的全部数据，快照不存在时返回ErrNotFound
+func (auth *Authorization) SnapshotGet(seq int64) (*SnapshotArchive, error) {
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer auth.mongoFactory.Put(session)
+	db := session.DB(auth.dataBaseName)
+
+	q := bson.M{
+		"groupName": auth.groupName,
+		"seq":       seq,
+	}
+
+	archive := &SnapshotArchive{
+		Routers: []RouterInfo{},
+		Roles:   []RoleInfo{},
+		Users:   []UserInfo{},
+		Signs:   []SignInfo{},
+	}
+
+	if err := db.C(snapshotCollName).Find(q).One(&archive.Info); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("query snapshot exception %s", err.Error())
+	}
+
+	archive.Format = archive.Info.Format
+	if archive.Format == 0 {
+		archive.Format = 1
+	}
+	if archive.Format >= 2 {
+		archive.Scopes = []AdminScope{}
+	}
+
+	iter := db.C(snapshotItemCollName).Find(q).Iter()
+	item := snapshotItem{}
+	for iter.Next(&item) {
+		switch {
+		case item.Router != nil:
+			archive.Routers = append(archive.Routers, *item.Router)
+		case item.Role != nil:
+			archive.Roles = append(archive.Roles, *item.Role)
+		case item.User != nil:
+			archive.Users = append(archive.Users, *item.User)
+		case item.Sign != nil:
+			archive.Signs = append(archive.Signs, *item.Sign)
+		case item.Scope != nil:
+			archive.Scopes = append(archive.Scopes, *item.Scope)
+		}
+		item = snapshotItem{}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, fmt.Errorf("query snapshot items exception %s", err.Error())
+	}
+
+	return archive, nil
+}
+
+// 删除快照，快照不存在时返回ErrNotFound
+func (auth *Authorization) SnapshotDelete(seq int64) error {
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return err
+	}
+	defer auth.mongoFactory.Put(session)
+	db := session.DB(auth.dataBaseName)
+
+	q := bson.M{
+		"groupName": auth.groupName,
+		"seq":       seq,
+	}
+
+	if err := db.C(snapshotCollName).Remove(q); err != nil {
+		if err == mgo.ErrNotFound {
+			return ErrNotFound
+		}
+		return fmt.Errorf("delete snapshot exception %s", err.Error())
+	}
+
+	if _, err := db.C(snapshotItemCollName).RemoveAll(q); err != nil {
+		return fmt.Errorf("delete snapshot items exception %s", err.Error())
+	}
+
+	return nil
+}
+
+// 只保留最新的keep个自动快照，手动创建的快照不会被清理
+func (auth *Authorization) SnapshotPruneAuto(keep int) error {
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return err
+	}
+	defer auth.mongoFactory.Put(session)
+	coll := session.DB(auth.dataBaseName).C(snapshotCollName)
+
+	old := []SnapshotInfo{}
+	err = coll.Find(bson.M{"groupName": auth.groupName, "auto": true}).Sort("-seq").Skip(keep).Select(bson.M{"seq": 1}).All(&old)
+	if err != nil {
+		return fmt.Errorf("query snapshot exception %s", err.Error())
+	}
+
+	for _, info := range old {
+		if err := auth.SnapshotDelete(info.Seq); err != nil && err != ErrNotFound {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 归档中各数据的版本号，key为集合名和数据的唯一键
+func (a *SnapshotArchive) versions() map[string]int64 {
+	versions := make(map[string]int64)
+	for _, r := range a.Routers {
+		versions[routerCollName+splitString+r.Uri] = r.Version
+	}
+	for _, r := range a.Roles {
+		versions[roleCollName+splitString+r.RoleName] = r.Version
+	}
+	for _, u := range a.Users {
+		versions[userCollName+splitString+u.UserId] = u.Version
+	}
+	for _, s := range a.Signs {
+		versions[signCollName+splitString+s.SignKey+splitString+s.UserId] = s.Version
+	}
+	return versions
+}
+
+// 用归档中的数据替换组内的路由、角色、用户、sign授权和委托管理范围，归档中的组名会被替换为当前组，
+// 格式1的归档不包含管理范围，恢复时保留当前的管理范围，恢复的数据的版本号会递增。
+// 部署支持事务时在一个事务中替换全部集合，否则按集合依次替换，某个集合失败时将已替换的集合恢复为替换前的数据
+func (auth *Authorization) SnapshotRestore(archive *SnapshotArchive) error {
+	if archive.Format < 1 || archive.Format > SnapshotFormat {
+		return fmt.Errorf("unsupported snapshot format %d, expect 1 to %d", archive.Format, SnapshotFormat)
+	}
+
+	current, err := auth.SnapshotLoad()
+	if err != nil {
+		return err
+	}
+
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return err
+	}
+	defer auth.mongoFactory.Put(session)
+	db := session.DB(auth.dataBaseName)
+
+	q := bson.M{
+		"groupName": auth.groupName,
+	}
+
+	w := auth.newTxnWriter(db)
+
+	replace := func(collName string, docs []interface{}) error {
+		if err := w.removeAll(collName, q); err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			return nil
+		}
+		return w.insert(collName, docs...)
+	}
+
+	// 恢复的数据的版本号大于当前和归档中的版本号，避免持有旧版本号的写入在恢复之后仍然成功，
+	// 撤销时写回当前数据，保持原来的版本号
+	versions := current.versions()
+	version := func(a *SnapshotArchive, key string, v int64) int64 {
+		if a == current {
+			return v
+		}
+		if cv := versions[key]; cv > v {
+			v = cv
+		}
+		return v + 1
+	}
+
+	routers := func(a *SnapshotArchive) []interface{} {
+		docs := []interface{}{}
+		for _, r := range a.Routers {
+			r.GroupName = auth.groupName
+			r.Pinyin = auth.pinyinOf(r.Desc)
+			r.Version = version(a, routerCollName+splitString+r.Uri, r.Version)
+			docs = append(docs, r)
+		}
+		return docs
+	}
+	roles := func(a *SnapshotArchive) []interface{} {
+		docs := []interface{}{}
+		for _, r := range a.Roles {
+			r.GroupName = auth.groupName
+			r.Version = version(a, roleCollName+splitString+r.RoleName, r.Version)
+			docs = append(docs, r)
+		}
+		return docs
+	}
+	users := func(a *SnapshotArchive) []interface{} {
+		docs := []interface{}{}
+		for _, u := range a.Users {
+			u.Id = ""
+			u.GroupName = auth.groupName
+			u.Pinyin = auth.pinyinOf(u.Name)
+			u.Version = version(a, userCollName+splitString+u.UserId, u.Version)
+			docs = append(docs, u)
+		}
+		return docs
+	}
+	signs := func(a *SnapshotArchive) []interface{} {
+		docs := []interface{}{}
+		for _, s := range a.Signs {
+			s.GroupName = auth.groupName
+			s.Version = version(a, signCollName+splitString+s.SignKey+splitString+s.UserId, s.Version)
+			docs = append(docs, s)
+		}
+		return docs
+	}
+
+	scopes := func(a *SnapshotArchive) []interface{} {
+		docs := []interface{}{}
+		for _, s := range a.Scopes {
+			// 归档可能来自其他组，使用新的id避免与其他组的管理范围冲突
+			if a != current {
+				s.Id = bson.NewObjectId()
+			}
+			s.GroupName = auth.groupName
+			docs = append(docs, s)
+		}
+		return docs
+	}
+
+	type restoreColl struct {
+		collName string
+		docs     func(a *SnapshotArchive) []interface{}
+	}
+
+	colls := []restoreColl{
+		{routerCollName, routers},
+		{roleCollName, roles},
+		{userCollName, users},
+		{signCollName, signs},
+	}
+	if archive.Format >= 2 {
+		colls = append(colls, restoreColl{scopeCollName, scopes})
+	}
+
+	steps := []TxnStep{}
+	for _, c := range colls {
+		c := c
+		steps = append(steps, TxnStep{
+			Name: fmt.Sprintf("restore %s", c.collName),
+			Do: func() error {
+				err := replace(c.collName, c.docs(archive))
+				if err == nil || w.txn != nil {
+					return err
+				}
+				// 删除成功但写入失败时，该集合自身也需要恢复
+				if uerr := replace(c.collName, c.docs(current)); uerr != nil {
+					return fmt.Errorf("%s, compensate exception %s", err.Error(), uerr.Error())
+				}
+				return err
+			},
+			Undo: func() error { return replace(c.collName, c.docs(current)) },
+		})
+	}
+
+	return w.run(steps)
+}
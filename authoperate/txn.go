@@ -0,0 +1,373 @@
+package authoperate
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+// 涉及多个文档的修改按步骤执行。部署支持多文档事务(4.0及以上的副本集或4.2及以上的分片集群)时，
+// 所有步骤在同一个事务中执行，失败时回滚事务；否则某一步失败时按相反的顺序执行已完成步骤的补偿操作
+type TxnStep struct {
+	Name string
+	Do   func() error
+	Undo func() error // 为nil表示该步骤不需要补偿
+}
+
+// 某一步执行失败，UndoErrs不为空说明补偿也失败了，此时数据可能处于不一致的状态，需要人工处理
+type TxnError struct {
+	Step     string
+	Err      error
+	UndoErrs []error
+}
+
+func (e *TxnError) Error() string {
+	if len(e.UndoErrs) == 0 {
+		return fmt.Sprintf("%s exception %s", e.Step, e.Err.Error())
+	}
+
+	undos := []string{}
+	for _, err := range e.UndoErrs {
+		undos = append(undos, err.Error())
+	}
+	return fmt.Sprintf("%s exception %s, compensate exception %s", e.Step, e.Err.Error(), strings.Join(undos, "; "))
+}
+
+// 依次执行步骤，某一步失败时按相反的顺序执行已完成步骤的Undo并返回*TxnError，
+// 不在事务中执行，也用于由多个独立修改组成的流程，例如按策略文件修改数据
+func RunTxnSteps(steps []TxnStep) error {
+	for i, step := range steps {
+		err := step.Do()
+		if err == nil {
+			continue
+		}
+
+		txnErr := &TxnError{
+			Step: step.Name,
+			Err:  err,
+		}
+
+		for j := i - 1; j >= 0; j-- {
+			if steps[j].Undo == nil {
+				continue
+			}
+			if uerr := steps[j].Undo(); uerr != nil {
+				txnErr.UndoErrs = append(txnErr.UndoErrs, fmt.Errorf("undo %s: %s", steps[j].Name, uerr.Error()))
+			}
+		}
+
+		return txnErr
+	}
+
+	return nil
+}
+
+// 通过isMaster判断部署是否支持多文档事务，查询失败时按不支持处理
+func detectTxnSupport(session *mgo.Session) bool {
+	res := struct {
+		SetName        string `bson:"setName"`
+		Msg            string `bson:"msg"`
+		MaxWireVersion int    `bson:"maxWireVersion"`
+	}{}
+
+	if err := session.Run("isMaster", &res); err != nil {
+		return false
+	}
+
+	if res.Msg == "isdbgrid" {
+		return res.MaxWireVersion >= 8
+	}
+	return res.SetName != "" && res.MaxWireVersion >= 7
+}
+
+// 一个多文档事务，mgo驱动没有事务接口，所以直接在写命令上携带lsid和txnNumber。
+// lsid对应服务端的一个会话，由txnSessionPool复用，同一个lsid上每个事务的txnNumber递增
+type mongoTxn struct {
+	lsid      bson.M
+	txnNumber int64
+	started   bool
+}
+
+func newMongoTxn() (*mongoTxn, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	// UUID v4
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+
+	return &mongoTxn{
+		lsid:      bson.M{"id": bson.Binary{Kind: 0x04, Data: id}},
+		txnNumber: 1,
+	}, nil
+}
+
+// 空闲会话的上限，超出的会话通过endSessions结束
+const maxIdleTxnSessions = 16
+
+// 复用事务的服务端会话，避免每个事务都在服务端留下一个会话直到超时
+type txnSessionPool struct {
+	mu   sync.Mutex
+	idle []*mongoTxn
+}
+
+// 取出一个空闲会话并递增txnNumber，没有空闲会话时新建
+func (p *txnSessionPool) get() (*mongoTxn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if n := len(p.idle); n > 0 {
+		t := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		t.txnNumber++
+		t.started = false
+		return t, nil
+	}
+
+	return newMongoTxn()
+}
+
+// 事务结束后放回会话，空闲会话已满时返回false，调用者需要结束该会话
+func (p *txnSessionPool) put(t *mongoTxn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.idle) >= maxIdleTxnSessions {
+		return false
+	}
+	p.idle = append(p.idle, t)
+	return true
+}
+
+// 取出所有空闲会话
+func (p *txnSessionPool) drain() []*mongoTxn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	idle := p.idle
+	p.idle = nil
+	return idle
+}
+
+// 结束服务端会话，未提交的事务会被回滚
+func endTxnSessions(session *mgo.Session, txns []*mongoTxn) error {
+	if len(txns) == 0 {
+		return nil
+	}
+
+	ids := []bson.M{}
+	for _, t := range txns {
+		ids = append(ids, t.lsid)
+	}
+	return session.Run(bson.D{{Name: "endSessions", Value: ids}}, nil)
+}
+
+// 结束所有空闲的事务会话，Oreo停止时调用
+func (auth *Authorization) Close() error {
+	idle := auth.txnSessions.drain()
+	if len(idle) == 0 {
+		return nil
+	}
+
+	session, err := auth.mongoFactory.Get()
+	if err != nil {
+		return err
+	}
+	defer auth.mongoFactory.Put(session)
+
+	return endTxnSessions(session, idle)
+}
+
+// 为写命令加上事务字段，第一条命令开启事务
+func (t *mongoTxn) command(cmd bson.D) bson.D {
+	cmd = append(cmd,
+		bson.DocElem{Name: "lsid", Value: t.lsid},
+		bson.DocElem{Name: "txnNumber", Value: t.txnNumber},
+		bson.DocElem{Name: "autocommit", Value: false},
+	)
+	if !t.started {
+		cmd = append(cmd, bson.DocElem{Name: "startTransaction", Value: true})
+		t.started = true
+	}
+	return cmd
+}
+
+// 提交或回滚事务，name为commitTransaction或abortTransaction，事务未开启时无需处理
+func (t *mongoTxn) end(session *mgo.Session, name string) error {
+	if !t.started {
+		return nil
+	}
+
+	cmd := bson.D{
+		{Name: name, Value: 1},
+		{Name: "lsid", Value: t.lsid},
+		{Name: "txnNumber", Value: t.txnNumber},
+		{Name: "autocommit", Value: false},
+	}
+	return session.Run(cmd, nil)
+}
+
+// 多文档修改中步骤使用的写操作，由txnWriter实现，测试时替换为可以注入失败的实现
+type txnWrites interface {
+	update(collName string, query, update bson.M) error
+	updateAll(collName string, query, update bson.M) error
+	insert(collName string, docs ...interface{}) error
+	remove(collName string, query bson.M) error
+	removeAll(collName string, query bson.M) error
+}
+
+// 多文档修改中的写操作，txn不为nil时在事务中执行
+type txnWriter struct {
+	db   *mgo.Database
+	txn  *mongoTxn
+	pool *txnSessionPool
+}
+
+func (auth *Authorization) newTxnWriter(db *mgo.Database) *txnWriter {
+	w := &txnWriter{db: db}
+	if !auth.txnSupported {
+		return w
+	}
+
+	txn, err := auth.txnSessions.get()
+	if err != nil {
+		return w
+	}
+
+	// 事务中的命令必须发往同一个主节点
+	db.Session.SetMode(mgo.Strong, false)
+	w.txn = txn
+	w.pool = &auth.txnSessions
+	return w
+}
+
+// 提交或回滚事务后归还会话，事务没有正常结束或空闲会话已满时结束该会话
+func (w *txnWriter) end(name string) error {
+	err := w.txn.end(w.db.Session, name)
+	if err != nil || !w.pool.put(w.txn) {
+		endTxnSessions(w.db.Session, []*mongoTxn{w.txn})
+	}
+	return err
+}
+
+type txnWriteResult struct {
+	N           int `bson:"n"`
+	WriteErrors []struct {
+		Code   int    `bson:"code"`
+		Errmsg string `bson:"errmsg"`
+	} `bson:"writeErrors"`
+}
+
+func (w *txnWriter) write(cmd bson.D) (int, error) {
+	res := txnWriteResult{}
+	if err := w.db.Run(w.txn.command(cmd), &res); err != nil {
+		return 0, err
+	}
+	if len(res.WriteErrors) > 0 {
+		return res.N, &mgo.LastError{Code: res.WriteErrors[0].Code, Err: res.WriteErrors[0].Errmsg}
+	}
+	return res.N, nil
+}
+
+// 与mgo.Collection.Update一致，没有匹配的文档时返回mgo.ErrNotFound
+func (w *txnWriter) update(collName string, query, update bson.M) error {
+	if w.txn == nil {
+		return w.db.C(collName).Update(query, update)
+	}
+
+	n, err := w.write(bson.D{
+		{Name: "update", Value: collName},
+		{Name: "updates", Value: []bson.M{{"q": query, "u": update}}},
+	})
+	if err == nil && n == 0 {
+		return mgo.ErrNotFound
+	}
+	return err
+}
+
+func (w *txnWriter) updateAll(collName string, query, update bson.M) error {
+	if w.txn == nil {
+		_, err := w.db.C(collName).UpdateAll(query, update)
+		return err
+	}
+
+	_, err := w.write(bson.D{
+		{Name: "update", Value: collName},
+		{Name: "updates", Value: []bson.M{{"q": query, "u": update, "multi": true}}},
+	})
+	return err
+}
+
+func (w *txnWriter) insert(collName string, docs ...interface{}) error {
+	if w.txn == nil {
+		return w.db.C(collName).Insert(docs...)
+	}
+
+	_, err := w.write(bson.D{
+		{Name: "insert", Value: collName},
+		{Name: "documents", Value: docs},
+	})
+	return err
+}
+
+func (w *txnWriter) remove(collName string, query bson.M) error {
+	if w.txn == nil {
+		return w.db.C(collName).Remove(query)
+	}
+
+	n, err := w.write(bson.D{
+		{Name: "delete", Value: collName},
+		{Name: "deletes", Value: []bson.M{{"q": query, "limit": 1}}},
+	})
+	if err == nil && n == 0 {
+		return mgo.ErrNotFound
+	}
+	return err
+}
+
+func (w *txnWriter) removeAll(collName string, query bson.M) error {
+	if w.txn == nil {
+		_, err := w.db.C(collName).RemoveAll(query)
+		return err
+	}
+
+	_, err := w.write(bson.D{
+		{Name: "delete", Value: collName},
+		{Name: "deletes", Value: []bson.M{{"q": query, "limit": 0}}},
+	})
+	return err
+}
+
+// 支持事务时在事务中依次执行所有步骤，失败时回滚事务，不需要补偿；否则通过RunTxnSteps执行
+func (w *txnWriter) run(steps []TxnStep) error {
+	if w.txn == nil {
+		return RunTxnSteps(steps)
+	}
+
+	for _, step := range steps {
+		if err := step.Do(); err != nil {
+			txnErr := &TxnError{
+				Step: step.Name,
+				Err:  err,
+			}
+			if aerr := w.end("abortTransaction"); aerr != nil {
+				txnErr.UndoErrs = append(txnErr.UndoErrs, fmt.Errorf("abort transaction: %s", aerr.Error()))
+			}
+			return txnErr
+		}
+	}
+
+	if err := w.end("commitTransaction"); err != nil {
+		return &TxnError{
+			Step: "commit transaction",
+			Err:  err,
+		}
+	}
+
+	return nil
+}
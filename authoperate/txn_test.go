@@ -0,0 +1,366 @@
+package authoperate
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+// 记录各步骤的执行顺序，fail中的步骤执行失败，undoFail中的步骤补偿失败
+func txnTestSteps(names []string, fail, undoFail map[string]bool, log *[]string) []TxnStep {
+	steps := []TxnStep{}
+	for _, name := range names {
+		name := name
+		step := TxnStep{
+			Name: name,
+			Do: func() error {
+				*log = append(*log, "do "+name)
+				if fail[name] {
+					return errors.New("injected")
+				}
+				return nil
+			},
+		}
+		if !strings.HasPrefix(name, "noundo") {
+			step.Undo = func() error {
+				*log = append(*log, "undo "+name)
+				if undoFail[name] {
+					return errors.New("injected undo")
+				}
+				return nil
+			}
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+func TestRunTxnSteps(t *testing.T) {
+	cases := []struct {
+		name     string
+		steps    []string
+		fail     map[string]bool
+		undoFail map[string]bool
+		wantLog  []string
+		wantStep string
+		wantUndo int
+	}{
+		{
+			name:    "all succeed",
+			steps:   []string{"a", "b", "c"},
+			wantLog: []string{"do a", "do b", "do c"},
+		},
+		{
+			name:     "first step fails",
+			steps:    []string{"a", "b"},
+			fail:     map[string]bool{"a": true},
+			wantLog:  []string{"do a"},
+			wantStep: "a",
+		},
+		{
+			name:     "undo in reverse order",
+			steps:    []string{"a", "b", "c", "d"},
+			fail:     map[string]bool{"c": true},
+			wantLog:  []string{"do a", "do b", "do c", "undo b", "undo a"},
+			wantStep: "c",
+		},
+		{
+			name:     "steps without undo are skipped",
+			steps:    []string{"a", "noundo-b", "c"},
+			fail:     map[string]bool{"c": true},
+			wantLog:  []string{"do a", "do noundo-b", "do c", "undo a"},
+			wantStep: "c",
+		},
+		{
+			name:     "undo failure continues",
+			steps:    []string{"a", "b", "c"},
+			fail:     map[string]bool{"c": true},
+			undoFail: map[string]bool{"b": true},
+			wantLog:  []string{"do a", "do b", "do c", "undo b", "undo a"},
+			wantStep: "c",
+			wantUndo: 1,
+		},
+	}
+
+	for _, c := range cases {
+		log := []string{}
+		err := RunTxnSteps(txnTestSteps(c.steps, c.fail, c.undoFail, &log))
+
+		if !reflect.DeepEqual(log, c.wantLog) {
+			t.Errorf("%s: log = %v, want %v", c.name, log, c.wantLog)
+		}
+
+		if c.wantStep == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.name, err)
+			}
+			continue
+		}
+
+		txnErr, ok := err.(*TxnError)
+		if !ok {
+			t.Errorf("%s: error = %v, want *TxnError", c.name, err)
+			continue
+		}
+		if txnErr.Step != c.wantStep || len(txnErr.UndoErrs) != c.wantUndo {
+			t.Errorf("%s: step = %s undoErrs = %v, want step %s with %d undo errors", c.name, txnErr.Step, txnErr.UndoErrs, c.wantStep, c.wantUndo)
+		}
+	}
+}
+
+// 不支持事务时txnWriter按补偿的方式执行
+func TestTxnWriterRunWithoutTxn(t *testing.T) {
+	log := []string{}
+	w := &txnWriter{}
+	err := w.run(txnTestSteps([]string{"a", "b"}, map[string]bool{"b": true}, nil, &log))
+
+	want := []string{"do a", "do b", "undo a"}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("log = %v, want %v", log, want)
+	}
+	if _, ok := err.(*TxnError); !ok {
+		t.Errorf("error = %v, want *TxnError", err)
+	}
+}
+
+func TestMongoTxnCommand(t *testing.T) {
+	txn, err := newMongoTxn()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := func(cmd []string) map[string]bool {
+		m := make(map[string]bool)
+		for _, name := range cmd {
+			m[name] = true
+		}
+		return m
+	}
+	names := func(tx *mongoTxn) []string {
+		cmd := tx.command(nil)
+		ns := []string{}
+		for _, e := range cmd {
+			ns = append(ns, e.Name)
+		}
+		return ns
+	}
+
+	first := fields(names(txn))
+	for _, name := range []string{"lsid", "txnNumber", "autocommit", "startTransaction"} {
+		if !first[name] {
+			t.Errorf("first command missing %s", name)
+		}
+	}
+
+	second := fields(names(txn))
+	if second["startTransaction"] {
+		t.Errorf("second command should not start the transaction again")
+	}
+	if !second["lsid"] || !second["txnNumber"] {
+		t.Errorf("second command missing session fields")
+	}
+}
+
+// 会话在事务之间复用lsid，txnNumber递增
+func TestTxnSessionPool(t *testing.T) {
+	pool := &txnSessionPool{}
+
+	first, err := pool.get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.command(nil)
+	if !pool.put(first) {
+		t.Fatalf("put into an empty pool failed")
+	}
+
+	second, err := pool.get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first || !reflect.DeepEqual(second.lsid, first.lsid) {
+		t.Errorf("second transaction uses a new session")
+	}
+	if second.txnNumber != 2 || second.started {
+		t.Errorf("second transaction txnNumber = %d started = %t, want 2 false", second.txnNumber, second.started)
+	}
+
+	other, err := pool.get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(other.lsid, second.lsid) || other.txnNumber != 1 {
+		t.Errorf("concurrent transaction shares the session in use")
+	}
+
+	for i := 0; i < maxIdleTxnSessions; i++ {
+		txn, err := newMongoTxn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pool.put(txn) {
+			t.Fatalf("put %d failed", i)
+		}
+	}
+	if pool.put(second) {
+		t.Errorf("put into a full pool should fail")
+	}
+	if idle := pool.drain(); len(idle) != maxIdleTxnSessions {
+		t.Errorf("drain = %d sessions, want %d", len(idle), maxIdleTxnSessions)
+	}
+	if idle := pool.drain(); len(idle) != 0 {
+		t.Errorf("drain twice = %d sessions, want 0", len(idle))
+	}
+}
+
+// 记录写操作，第failAt次写操作返回err，用于在流程中间注入失败
+type failingWrites struct {
+	failAt int
+	err    error
+	log    []string
+}
+
+// 记录为"操作 集合 文档标识 修改"，修改中省略版本号
+func (f *failingWrites) write(op, collName string, query, update bson.M) error {
+	entry := op + " " + collName
+	for _, key := range []string{"userId", "roleName", "signKey"} {
+		if v, ok := query[key]; ok {
+			entry += fmt.Sprintf(" %v", v)
+			break
+		}
+	}
+
+	keys := []string{}
+	for key := range update {
+		if key != "$inc" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		entry += fmt.Sprintf(" %s %v", key, update[key])
+	}
+
+	f.log = append(f.log, entry)
+	if len(f.log) == f.failAt {
+		return f.err
+	}
+	return nil
+}
+
+func (f *failingWrites) update(collName string, query, update bson.M) error {
+	return f.write("update", collName, query, update)
+}
+
+func (f *failingWrites) updateAll(collName string, query, update bson.M) error {
+	return f.write("updateAll", collName, query, update)
+}
+
+func (f *failingWrites) insert(collName string, docs ...interface{}) error {
+	return f.write("insert", collName, bson.M{"userId": docs[0].(UserInfo).UserId}, nil)
+}
+
+func (f *failingWrites) remove(collName string, query bson.M) error {
+	return f.write("remove", collName, query, nil)
+}
+
+func (f *failingWrites) removeAll(collName string, query bson.M) error {
+	return f.write("removeAll", collName, query, nil)
+}
+
+// 多文档修改的流程在中间某一步失败时，按相反的顺序补偿已完成的步骤
+func TestTxnFlowCompensation(t *testing.T) {
+	auth := &Authorization{groupName: "g"}
+	injected := errors.New("injected")
+	joined := ""
+
+	transfer := func(w txnWrites) []TxnStep {
+		return auth.transferSignKeySteps(w, "k1", "new", "u1", "old", "u2")
+	}
+	addUser := func(w txnWrites) []TxnStep {
+		return auth.addUserSteps(w, UserInfo{UserId: "u3"}, "viewer", &joined)
+	}
+	setDefault := func(w txnWrites) []TxnStep {
+		return auth.setDefaultRoleSteps(w, "editor", []RoleInfo{{RoleName: "viewer"}})
+	}
+
+	cases := []struct {
+		name   string
+		steps  func(w txnWrites) []TxnStep
+		failAt int
+		err    error
+		log    []string
+		step   string
+		joined string
+	}{
+		{"transfer succeeds", transfer, 0, nil, []string{
+			"update TC_OREO_USER u1 $unset map[signKey.k1:1]",
+			"update TC_OREO_USER u2 $set map[signKey.k1:new]",
+			"updateAll TC_OREO_SIGN k1 $set map[createUserId:u2]",
+		}, "", ""},
+		{"transfer fails on dest user", transfer, 2, injected, []string{
+			"update TC_OREO_USER u1 $unset map[signKey.k1:1]",
+			"update TC_OREO_USER u2 $set map[signKey.k1:new]",
+			"update TC_OREO_USER u1 $set map[signKey.k1:old]",
+		}, "set dest user signKey", ""},
+		{"transfer fails on sign", transfer, 3, injected, []string{
+			"update TC_OREO_USER u1 $unset map[signKey.k1:1]",
+			"update TC_OREO_USER u2 $set map[signKey.k1:new]",
+			"updateAll TC_OREO_SIGN k1 $set map[createUserId:u2]",
+			"update TC_OREO_USER u2 $unset map[signKey.k1:1]",
+			"update TC_OREO_USER u1 $set map[signKey.k1:old]",
+		}, "update sign createUserId", ""},
+		{"add user joins default role", addUser, 0, nil, []string{
+			"insert TC_OREO_USER u3",
+			"update TC_OREO_ROLES viewer $addToSet map[userIds:map[$each:[u3]]]",
+		}, "", "viewer"},
+		{"add user fails on default role", addUser, 2, injected, []string{
+			"insert TC_OREO_USER u3",
+			"update TC_OREO_ROLES viewer $addToSet map[userIds:map[$each:[u3]]]",
+			"remove TC_OREO_USER u3",
+		}, "add user to default role", ""},
+		{"default role changed meanwhile", addUser, 2, mgo.ErrNotFound, []string{
+			"insert TC_OREO_USER u3",
+			"update TC_OREO_ROLES viewer $addToSet map[userIds:map[$each:[u3]]]",
+		}, "", ""},
+		{"set default succeeds", setDefault, 0, nil, []string{
+			"update TC_OREO_ROLES viewer $set map[isDefault:false]",
+			"update TC_OREO_ROLES editor $set map[isDefault:true]",
+		}, "", ""},
+		{"set default fails on new role", setDefault, 2, injected, []string{
+			"update TC_OREO_ROLES viewer $set map[isDefault:false]",
+			"update TC_OREO_ROLES editor $set map[isDefault:true]",
+			"update TC_OREO_ROLES viewer $set map[isDefault:true]",
+		}, "default role set false to true", ""},
+	}
+
+	for _, c := range cases {
+		joined = ""
+		w := &failingWrites{failAt: c.failAt, err: c.err}
+		err := RunTxnSteps(c.steps(w))
+
+		if !reflect.DeepEqual(w.log, c.log) {
+			t.Errorf("%s: writes = %q, want %q", c.name, w.log, c.log)
+		}
+		if joined != c.joined {
+			t.Errorf("%s: joined = %q, want %q", c.name, joined, c.joined)
+		}
+
+		if c.step == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.name, err)
+			}
+			continue
+		}
+		txnErr, ok := err.(*TxnError)
+		if !ok || txnErr.Step != c.step || txnErr.Err != c.err || len(txnErr.UndoErrs) != 0 {
+			t.Errorf("%s: error = %v, want %s failed and compensated", c.name, err, c.step)
+		}
+	}
+}
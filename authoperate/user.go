@@ -20,7 +20,9 @@ type UserInfo struct {
 	Name      string            `json:"name" bson:"name"`
 	UserId    string            `json:"userId" bson:"userId"`
 	GroupName string            `json:"groupName" bson:"groupName"`
-	SignKey   map[string]string `json:"signKey" bson:"signKey"` //key是signKey，value是signKey的描述
+	SignKey   map[string]string `json:"signKey" bson:"signKey"`           //key是signKey，value是signKey的描述
+	Version   int64             `json:"version" bson:"version,omitempty"` //每次修改加1，用于乐观锁
+	Pinyin    []string          `json:"-" bson:"pinyin,omitempty"`        //name的拼音，写入时计算，用于拼音搜索
 }
 
 type AddUser struct {
@@ -33,6 +35,7 @@ type UserDetail struct {
 	Name   string `json:"name"`
 }
 
+// 依次修改srcUserId、destUserId和sign表，任意一步失败都会补偿已完成的步骤
 func (auth *Authorization) UserTransferSignKey(signKey, signDesc, srcUserId, destUserId string) error {
 	session, err := auth.mongoFactory.Get()
 	if err != nil {
@@ -41,54 +44,78 @@ func (auth *Authorization) UserTransferSignKey(signKey, signDesc, srcUserId, des
 	defer auth.mongoFactory.Put(session)
 
 	userColl := session.DB(auth.dataBaseName).C(userCollName)
+	w := auth.newTxnWriter(session.DB(auth.dataBaseName))
 
-	q := bson.M{
+	key := fmt.Sprintf("signKey.%s", signKey)
+
+	srcQuery := bson.M{
 		"groupName": auth.groupName,
 		"userId":    srcUserId,
+		key:         bson.M{"$exists": true},
 	}
 
-	u := bson.M{
-		"$unset": bson.M{fmt.Sprintf("signKey.%s", signKey): 1},
+	// 记录srcUserId原来的描述，用于补偿
+	srcUser := UserInfo{}
+	if err := userColl.Find(srcQuery).Select(bson.M{"signKey": 1}).One(&srcUser); err != nil {
+		return fmt.Errorf("user %s not own signKey %s, %s", srcUserId, signKey, err.Error())
 	}
+	srcDesc := srcUser.SignKey[signKey]
 
-	// 先删除srcUserId的此signKey
-	err = userColl.Update(q, u)
-	if err != nil {
-		return err
-	}
+	return w.run(auth.transferSignKeySteps(w, signKey, signDesc, srcUserId, srcDesc, destUserId))
+}
 
-	q = bson.M{
-		"groupName": auth.groupName,
-		"userId":    destUserId,
-	}
+// 转移signKey的步骤，srcDesc为srcUserId原来的描述，用于补偿
+func (auth *Authorization) transferSignKeySteps(w txnWrites, signKey, signDesc, srcUserId, srcDesc, destUserId string) []TxnStep {
+	key := fmt.Sprintf("signKey.%s", signKey)
 
-	u = bson.M{
-		"$set": bson.M{fmt.Sprintf("signKey.%s", signKey): signDesc},
+	srcQuery := bson.M{
+		"groupName": auth.groupName,
+		"userId":    srcUserId,
+		key:         bson.M{"$exists": true},
 	}
 
-	// 再将此signKey转移给destUserId
-	err = userColl.Update(q, u)
-	if err != nil {
-		return err
+	destQuery := bson.M{
+		"groupName": auth.groupName,
+		"userId":    destUserId,
 	}
 
-	signColl := session.DB(auth.dataBaseName).C(signCollName)
-
-	q = bson.M{
+	signQuery := bson.M{
 		"groupName": auth.groupName,
 		"signKey":   signKey,
 	}
 
-	u = bson.M{
-		"$set": bson.M{
-			"createUserId": destUserId,
+	steps := []TxnStep{
+		{
+			// 先删除srcUserId的此signKey
+			Name: "unset src user signKey",
+			Do: func() error {
+				return w.update(userCollName, srcQuery, bson.M{"$unset": bson.M{key: 1}, "$inc": bson.M{"version": 1}})
+			},
+			Undo: func() error {
+				q := bson.M{"groupName": auth.groupName, "userId": srcUserId}
+				return w.update(userCollName, q, bson.M{"$set": bson.M{key: srcDesc}, "$inc": bson.M{"version": 1}})
+			},
+		},
+		{
+			// 再将此signKey转移给destUserId
+			Name: "set dest user signKey",
+			Do: func() error {
+				return w.update(userCollName, destQuery, bson.M{"$set": bson.M{key: signDesc}, "$inc": bson.M{"version": 1}})
+			},
+			Undo: func() error {
+				return w.update(userCollName, destQuery, bson.M{"$unset": bson.M{key: 1}, "$inc": bson.M{"version": 1}})
+			},
+		},
+		{
+			// 最后将sign表中，所有此signKey的CreateUserId修改为destUserId
+			Name: "update sign createUserId",
+			Do: func() error {
+				return w.updateAll(signCollName, signQuery, bson.M{"$set": bson.M{"createUserId": destUserId}, "$inc": bson.M{"version": 1}})
+			},
 		},
 	}
 
-	// 最后将sign表中，所有此signKey的CreateUserId修改为destUserId
-	_, err = signColl.UpdateAll(q, u)
-
-	return err
+	return steps
 }
 
 func (auth *Authorization) GetAllUsers() ([]UserDetail, error) {
@@ -161,13 +188,22 @@ func (auth *Authorization) UserCheckExist(userId string) bool {
 	return cnt > 0
 }
 
-func (auth *Authorization) UserAddInfo(info AddUser) error {
+// 添加用户并将其加入默认角色，加入默认角色失败时会删除已添加的用户，组内没有默认角色时只添加用户，
+// 返回加入的默认角色，没有加入时返回空字符串
+func (auth *Authorization) UserAddInfo(info AddUser) (string, error) {
 	session, err := auth.mongoFactory.Get()
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer auth.mongoFactory.Put(session)
-	coll := session.DB(auth.dataBaseName).C(userCollName)
+	db := session.DB(auth.dataBaseName)
+	w := auth.newTxnWriter(db)
+
+	defaultRole := RoleInfo{}
+	err = db.C(roleCollName).Find(bson.M{"groupName": auth.groupName, "isDefault": true}).Select(bson.M{"roleName": 1}).One(&defaultRole)
+	if err != nil && err != mgo.ErrNotFound {
+		return "", fmt.Errorf("query default role exception %s", err.Error())
+	}
 
 	signKey := bson.NewObjectId().Hex()
 	privateKey := make(map[string]string)
@@ -178,33 +214,64 @@ func (auth *Authorization) UserAddInfo(info AddUser) error {
 		UserId:    info.UserId,
 		GroupName: auth.groupName,
 		SignKey:   privateKey,
+		Version:   1,
+		Pinyin:    auth.pinyinOf(info.Name),
 	}
 
-	if err := coll.Insert(doc); err != nil {
-		return fmt.Errorf("add user exception %s", err.Error())
-	}
-
-	// 将用户添加至默认角色
-	roleColl := session.DB(auth.dataBaseName).C(roleCollName)
-
-	query := bson.M{
-		"groupName": auth.groupName,
-		"isDefault": true,
+	joined := ""
+	if err := w.run(auth.addUserSteps(w, doc, defaultRole.RoleName, &joined)); err != nil {
+		return "", err
 	}
+	return joined, nil
+}
 
-	update := bson.M{
-		"$addToSet": bson.M{
-			"userIds": bson.M{
-				"$each": []string{info.UserId},
+// 添加用户的步骤，defaultRole不为空时将用户加入默认角色，加入后将joined设为defaultRole
+func (auth *Authorization) addUserSteps(w txnWrites, doc UserInfo, defaultRole string, joined *string) []TxnStep {
+	steps := []TxnStep{
+		{
+			Name: "add user",
+			Do: func() error {
+				return w.insert(userCollName, doc)
+			},
+			Undo: func() error {
+				return w.remove(userCollName, bson.M{"groupName": auth.groupName, "userId": doc.UserId})
 			},
 		},
 	}
 
-	if err := roleColl.Update(query, update); err != nil {
-		return fmt.Errorf("add user to default role exception %s", err.Error())
+	if defaultRole != "" {
+		// 将用户添加至默认角色，默认角色在此期间被修改时不再加入
+		steps = append(steps, TxnStep{
+			Name: "add user to default role",
+			Do: func() error {
+				query := bson.M{
+					"groupName": auth.groupName,
+					"roleName":  defaultRole,
+					"isDefault": true,
+				}
+
+				update := bson.M{
+					"$addToSet": bson.M{
+						"userIds": bson.M{
+							"$each": []string{doc.UserId},
+						},
+					},
+					"$inc": bson.M{"version": 1},
+				}
+
+				err := w.update(roleCollName, query, update)
+				if err == mgo.ErrNotFound {
+					return nil
+				}
+				if err == nil {
+					*joined = defaultRole
+				}
+				return err
+			},
+		})
 	}
 
-	return nil
+	return steps
 }
 
 func (auth *Authorization) UserAdd(info AddUser) error {
@@ -220,6 +287,8 @@ func (auth *Authorization) UserAdd(info AddUser) error {
 		UserId:    info.UserId,
 		GroupName: auth.groupName,
 		SignKey:   map[string]string{},
+		Version:   1,
+		Pinyin:    auth.pinyinOf(info.Name),
 	}
 
 	if err := coll.Insert(doc); err != nil {
@@ -267,12 +336,16 @@ func (auth *Authorization) UserGetInfoOne(userId string) (UserInfo, error) {
 	user := UserInfo{}
 
 	if err := coll.Find(query).One(&user); err != nil {
+		if err == mgo.ErrNotFound {
+			return UserInfo{}, ErrNotFound
+		}
 		return UserInfo{}, fmt.Errorf("query user exception %s", err.Error())
 	}
 
 	return user, nil
 }
 
+// userId按字面模糊匹配，不区分大小写
 func (auth *Authorization) UserGetInfoReg(userId string) ([]UserInfo, error) {
 	session, err := auth.mongoFactory.Get()
 	if err != nil {
@@ -283,10 +356,7 @@ func (auth *Authorization) UserGetInfoReg(userId string) ([]UserInfo, error) {
 
 	query := bson.M{
 		"groupName": auth.groupName,
-		"userId": bson.RegEx{
-			Options: "i",
-			Pattern: userId,
-		},
+		"userId":    literalRegex(userId),
 	}
 
 	users := []UserInfo{}
@@ -440,7 +510,8 @@ func (auth *Authorization) FindSignKeyOwner(signKey string) (string, string, err
 	return user.Name, user.UserId, err
 }
 
-func (auth *Authorization) UserUpdateSignKey(userId, signKey, signDesc string) error {
+// version大于0时要求与用户当前的版本号一致，否则返回ErrVersionConflict
+func (auth *Authorization) UserUpdateSignKey(userId, signKey, signDesc string, version int64) error {
 	session, err := auth.mongoFactory.Get()
 	if err != nil {
 		return err
@@ -460,7 +531,10 @@ func (auth *Authorization) UserUpdateSignKey(userId, signKey, signDesc string) e
 		},
 	}
 
-	if err := coll.Update(query, update); err != nil {
+	if err := versionUpdate(coll, query, update, version); err != nil {
+		if err == ErrVersionConflict {
+			return err
+		}
 		return fmt.Errorf("update signKey exception %s", err.Error())
 	}
 
@@ -495,6 +569,7 @@ func (auth *Authorization) UserCreateSignKey(userId, signDesc string) (string, e
 		"$set": bson.M{
 			fmt.Sprintf("signKey.%s", signKey): signDesc,
 		},
+		"$inc": bson.M{"version": 1},
 	}
 
 	if err := coll.Update(query, update); err != nil {
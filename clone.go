@@ -0,0 +1,106 @@
+package oreo
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/xkeyideal/oreo/authoperate"
+)
+
+// 复制权限时需要执行的操作
+const (
+	CloneRoleAddUser = "role_add_user" // 将用户加入角色
+	CloneSignGrant   = "sign_grant"    // 将signKey授权给用户
+	CloneSignAppend  = "sign_append"   // 为用户已被授权的signKey追加路由和方法
+)
+
+type CloneAction struct {
+	Type      string         `json:"type"`
+	RoleName  string         `json:"roleName,omitempty"`
+	SignKey   string         `json:"signKey,omitempty"`
+	UrlMethod map[string]int `json:"urlMethod,omitempty"`
+}
+
+// 比较两个用户的角色、路由权限和他人授权的signKey
+func (oreo *Oreo) CompareUsers(userId, otherUserId string) (authoperate.UserAccessDiff, error) {
+	state, err := oreo.auth.PolicyStateLoad()
+	if err != nil {
+		return authoperate.UserAccessDiff{}, err
+	}
+
+	return state.CompareUsers(userId, otherUserId), nil
+}
+
+// 让destUserId拥有与srcUserId相同的权限，只做增量的添加，不会删除destUserId已有的权限，
+// srcUserId自己创建的signKey属于私有数据，不会被复制，dryRun为true时只返回需要执行的操作
+func (oreo *Oreo) CloneUserAccess(srcUserId, destUserId string, dryRun bool) ([]CloneAction, error) {
+	if srcUserId == destUserId {
+		return nil, errors.New("srcUserId and destUserId are the same")
+	}
+
+	if !oreo.auth.UserCheckExist(destUserId) {
+		return nil, errors.New(fmt.Sprintf("user %s not exist", destUserId))
+	}
+
+	state, err := oreo.auth.PolicyStateLoad()
+	if err != nil {
+		return nil, err
+	}
+
+	diff := state.CompareUsers(srcUserId, destUserId)
+
+	actions := []CloneAction{}
+	for _, roleName := range diff.OnlyRoles {
+		actions = append(actions, CloneAction{
+			Type:     CloneRoleAddUser,
+			RoleName: roleName,
+		})
+	}
+
+	destGrants := state.UserSignGrants(destUserId)
+	missing := authoperate.SignGrantsMissing(state.UserSignGrants(srcUserId), destGrants)
+
+	signKeys := []string{}
+	for signKey := range missing {
+		// destUserId自己创建的signKey本身就拥有全部的数据权限
+		if state.SignKeyOwner(signKey) == destUserId {
+			continue
+		}
+		signKeys = append(signKeys, signKey)
+	}
+	sort.Strings(signKeys)
+
+	for _, signKey := range signKeys {
+		typ := CloneSignGrant
+		if _, ok := destGrants[signKey]; ok {
+			typ = CloneSignAppend
+		}
+		actions = append(actions, CloneAction{
+			Type:      typ,
+			SignKey:   signKey,
+			UrlMethod: missing[signKey],
+		})
+	}
+
+	if dryRun {
+		return actions, nil
+	}
+
+	for _, action := range actions {
+		switch action.Type {
+		case CloneRoleAddUser:
+			err = oreo.AddRoleUsers(action.RoleName, []string{destUserId})
+		case CloneSignGrant:
+			err = oreo.AddSign(action.SignKey, destUserId, action.UrlMethod)
+		case CloneSignAppend:
+			err = oreo.AppendUserSign(action.SignKey, []string{destUserId}, action.UrlMethod)
+		}
+
+		if err != nil {
+			return actions, err
+		}
+	}
+
+	return actions, nil
+}
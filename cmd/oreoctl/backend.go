@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xkeyideal/oreo"
+	"github.com/xkeyideal/oreo/authoperate"
+	"github.com/xkeyideal/oreo/route"
+)
+
+// 命令通过backend操作权限数据，直连存储和调用oreoauth的实现返回相同的结构
+type backend interface {
+	ListUsers(opts authoperate.ListOptions) (authoperate.UserPage, error)
+	GetUser(userId string) (authoperate.UserInfo, error)
+	AddUser(userId, name string, noRole bool) error
+	CompareUsers(userId, otherUserId string) (authoperate.UserAccessDiff, error)
+
+	ListRoles(opts authoperate.ListOptions) (authoperate.RolePage, error)
+	GetRole(roleName string) (authoperate.RoleListView, error)
+	AddRole(role oreo.PolicyRole) error
+	GrantRole(roleName string, userIds []string) error
+	RevokeRole(roleName string, userIds []string) error
+	RoleDiff(roleName string) ([]authoperate.RouteListView, error)
+
+	ListRoutes(opts authoperate.ListOptions) (authoperate.RoutePage, error)
+	GetRoute(url string) (authoperate.RouteListView, error)
+	AddRoute(r oreo.PolicyRoute) error
+
+	ListSigns(opts authoperate.ListOptions) (authoperate.SignPage, error)
+	GetSign(signKey string) (authoperate.SignListView, error)
+	PutSignGrant(signKey, userId string, routes map[string][]string) error    //整体替换授权
+	AppendSignGrant(signKey, userId string, routes map[string][]string) error //在已有授权上追加
+	RevokeSign(signKey, userId string) error
+	TransferSign(signKey, ownerId, destUserId, desc string) error
+	SignDiff(signKey, userId string) ([]authoperate.RouteListView, error)
+
+	ListGroups() ([]string, error)
+	Explain(url, method, userId, signKey string) (oreo.CheckExplain, error)
+	ExportPolicy() (oreo.Policy, error)
+	ImportPolicy(policy oreo.Policy) (oreo.PolicyImportResult, error)
+	PlanPolicy(policy oreo.Policy, opts oreo.PlanOptions) (oreo.PolicyPlan, error)
+	ApplyPolicy(policy oreo.Policy, opts oreo.PlanOptions) (oreo.PolicyPlan, error)
+	DiffPolicy(source oreo.Policy) (oreo.PolicyDiff, error)
+	PlanPromote(source oreo.Policy, opts oreo.PromoteOptions) (oreo.PolicyPlan, error)
+	Promote(source oreo.Policy, opts oreo.PromoteOptions) (oreo.PolicyPlan, error)
+
+	ListSnapshots() ([]authoperate.SnapshotInfo, error)
+	CreateSnapshot(reason string) (authoperate.SnapshotInfo, error)
+	GetSnapshot(seq int64) (*authoperate.SnapshotArchive, error) //seq为0时导出当前数据
+	DeleteSnapshot(seq int64) error
+	RollbackSnapshot(seq int64) error
+	RestoreSnapshot(archive *authoperate.SnapshotArchive) error
+
+	Close()
+}
+
+// 直连mongo存储，不经过oreoauth的管理权限校验
+type storeBackend struct {
+	oreo *oreo.Oreo
+}
+
+// 将方法列表转换为方法的整型值之和
+func urlMethodValues(routes map[string][]string) (map[string]int, error) {
+	urlMethod := make(map[string]int)
+	for url, methods := range routes {
+		for _, method := range methods {
+			v := methodValue(method)
+			if v == 0 {
+				return nil, fmt.Errorf("%s: invalid method %s, only support GET POST PUT DELETE", url, method)
+			}
+			urlMethod[strings.ToLower(strings.TrimSpace(url))] |= v
+		}
+	}
+	return urlMethod, nil
+}
+
+func methodValue(method string) int {
+	switch strings.ToUpper(strings.TrimSpace(method)) {
+	case "GET":
+		return 1
+	case "POST":
+		return 2
+	case "PUT":
+		return 4
+	case "DELETE":
+		return 8
+	}
+	return 0
+}
+
+func (s *storeBackend) ListUsers(opts authoperate.ListOptions) (authoperate.UserPage, error) {
+	return s.oreo.ListUsers(opts)
+}
+
+func (s *storeBackend) GetUser(userId string) (authoperate.UserInfo, error) {
+	return s.oreo.GetUser(userId)
+}
+
+func (s *storeBackend) AddUser(userId, name string, noRole bool) error {
+	if s.oreo.CheckUserExist(userId) {
+		return fmt.Errorf("user %s already exists", userId)
+	}
+
+	if noRole {
+		return s.oreo.AddUserNoRole(userId, name)
+	}
+	return s.oreo.AddUser(userId, name)
+}
+
+func (s *storeBackend) CompareUsers(userId, otherUserId string) (authoperate.UserAccessDiff, error) {
+	return s.oreo.CompareUsers(userId, otherUserId)
+}
+
+func (s *storeBackend) ListRoles(opts authoperate.ListOptions) (authoperate.RolePage, error) {
+	return s.oreo.ListRoles(opts)
+}
+
+func (s *storeBackend) GetRole(roleName string) (authoperate.RoleListView, error) {
+	rl, err := s.oreo.GetRoleList(roleName)
+	if err != nil {
+		return authoperate.RoleListView{}, err
+	}
+	if len(rl) == 0 {
+		return authoperate.RoleListView{}, fmt.Errorf("role %s not found", roleName)
+	}
+	return rl[0], nil
+}
+
+func (s *storeBackend) AddRole(role oreo.PolicyRole) error {
+	if rl, err := s.oreo.GetRoleList(role.Name); err != nil {
+		return err
+	} else if len(rl) > 0 {
+		return fmt.Errorf("role %s already exists", role.Name)
+	}
+
+	urlMethod, err := urlMethodValues(role.Routes)
+	if err != nil {
+		return err
+	}
+
+	if err := s.oreo.AddRole(role.Name, role.Desc, role.Type, role.IsDefault, urlMethod); err != nil {
+		return err
+	}
+
+	if len(role.Tags) > 0 {
+		return s.oreo.SetRoleTags(role.Name, role.Tags, 0)
+	}
+	return nil
+}
+
+func (s *storeBackend) GrantRole(roleName string, userIds []string) error {
+	if _, err := s.GetRole(roleName); err != nil {
+		return err
+	}
+	return s.oreo.AddRoleUsers(roleName, userIds)
+}
+
+func (s *storeBackend) RevokeRole(roleName string, userIds []string) error {
+	if _, err := s.GetRole(roleName); err != nil {
+		return err
+	}
+	return s.oreo.RemoveRoleUsers(roleName, userIds)
+}
+
+func (s *storeBackend) RoleDiff(roleName string) ([]authoperate.RouteListView, error) {
+	return s.oreo.RoleRouteDiff(roleName)
+}
+
+func (s *storeBackend) ListRoutes(opts authoperate.ListOptions) (authoperate.RoutePage, error) {
+	return s.oreo.ListRoutes(opts)
+}
+
+func (s *storeBackend) GetRoute(url string) (authoperate.RouteListView, error) {
+	return s.oreo.GetRouteByUrl(url)
+}
+
+func (s *storeBackend) AddRoute(r oreo.PolicyRoute) error {
+	rd := route.RouteData{Url: r.Url, UrlDesc: r.Desc}
+	for _, m := range r.Methods {
+		rd.Methods = append(rd.Methods, route.RouteMethodData{
+			Method:     m.Method,
+			MethodDesc: m.Desc,
+			Enable:     m.DataAuth,
+		})
+	}
+	return s.oreo.AddRoute([]route.RouteData{rd})
+}
+
+func (s *storeBackend) ListSigns(opts authoperate.ListOptions) (authoperate.SignPage, error) {
+	return s.oreo.ListSigns(opts)
+}
+
+func (s *storeBackend) GetSign(signKey string) (authoperate.SignListView, error) {
+	return s.oreo.GetSignByKey(signKey)
+}
+
+func (s *storeBackend) PutSignGrant(signKey, userId string, routes map[string][]string) error {
+	urlMethod, err := urlMethodValues(routes)
+	if err != nil {
+		return err
+	}
+	return s.oreo.AddSign(signKey, userId, urlMethod)
+}
+
+func (s *storeBackend) AppendSignGrant(signKey, userId string, routes map[string][]string) error {
+	urlMethod, err := urlMethodValues(routes)
+	if err != nil {
+		return err
+	}
+	return s.oreo.AppendUserSign(signKey, []string{userId}, urlMethod)
+}
+
+func (s *storeBackend) RevokeSign(signKey, userId string) error {
+	return s.oreo.RemoveSign(signKey, userId)
+}
+
+func (s *storeBackend) TransferSign(signKey, ownerId, destUserId, desc string) error {
+	return s.oreo.UserTransferSignKey(signKey, desc, ownerId, destUserId)
+}
+
+func (s *storeBackend) SignDiff(signKey, userId string) ([]authoperate.RouteListView, error) {
+	return s.oreo.UserSignDiffGlobal(signKey, userId)
+}
+
+func (s *storeBackend) ListGroups() ([]string, error) {
+	return s.oreo.ListGroups()
+}
+
+func (s *storeBackend) Explain(url, method, userId, signKey string) (oreo.CheckExplain, error) {
+	return s.oreo.ExplainCheck(url, method, userId, signKey)
+}
+
+func (s *storeBackend) ExportPolicy() (oreo.Policy, error) {
+	return s.oreo.ExportPolicy()
+}
+
+func (s *storeBackend) ImportPolicy(policy oreo.Policy) (oreo.PolicyImportResult, error) {
+	return s.oreo.ImportPolicy(policy)
+}
+
+func (s *storeBackend) PlanPolicy(policy oreo.Policy, opts oreo.PlanOptions) (oreo.PolicyPlan, error) {
+	return s.oreo.PlanPolicy(policy, opts)
+}
+
+func (s *storeBackend) ApplyPolicy(policy oreo.Policy, opts oreo.PlanOptions) (oreo.PolicyPlan, error) {
+	return s.oreo.ApplyPolicy(policy, opts)
+}
+
+func (s *storeBackend) DiffPolicy(source oreo.Policy) (oreo.PolicyDiff, error) {
+	return s.oreo.DiffPolicy(source)
+}
+
+func (s *storeBackend) PlanPromote(source oreo.Policy, opts oreo.PromoteOptions) (oreo.PolicyPlan, error) {
+	return s.oreo.PlanPromote(source, opts)
+}
+
+func (s *storeBackend) Promote(source oreo.Policy, opts oreo.PromoteOptions) (oreo.PolicyPlan, error) {
+	return s.oreo.Promote(source, opts)
+}
+
+func (s *storeBackend) ListSnapshots() ([]authoperate.SnapshotInfo, error) {
+	return s.oreo.ListSnapshots()
+}
+
+func (s *storeBackend) CreateSnapshot(reason string) (authoperate.SnapshotInfo, error) {
+	return s.oreo.CreateSnapshot(reason)
+}
+
+func (s *storeBackend) GetSnapshot(seq int64) (*authoperate.SnapshotArchive, error) {
+	if seq == 0 {
+		return s.oreo.ExportSnapshot()
+	}
+	return s.oreo.GetSnapshot(seq)
+}
+
+func (s *storeBackend) DeleteSnapshot(seq int64) error {
+	return s.oreo.DeleteSnapshot(seq)
+}
+
+func (s *storeBackend) RollbackSnapshot(seq int64) error {
+	return s.oreo.RollbackSnapshot(seq)
+}
+
+func (s *storeBackend) RestoreSnapshot(archive *authoperate.SnapshotArchive) error {
+	return s.oreo.RestoreSnapshot(archive)
+}
+
+func (s *storeBackend) Close() {
+	s.oreo.Stop()
+}
@@ -0,0 +1,1214 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xkeyideal/oreo"
+	"github.com/xkeyideal/oreo/authoperate"
+	"gopkg.in/yaml.v2"
+)
+
+// check没有权限时返回，main以2退出，方便脚本判断
+var errDenied = errors.New("permission denied")
+
+type ctl struct {
+	backend backend
+	opts    globalOptions //目标的连接参数，提升和比较时作为源的默认值
+	out     *printer
+	name    string
+	usage   string
+}
+
+// 可以重复传入的参数
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, " ")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+func (c *ctl) flags() *flag.FlagSet {
+	fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: oreoctl %s %s\n", c.name, c.usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// 解析参数并校验位置参数的数量，max小于0表示不限制
+func (c *ctl) parse(fs *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if fs.NArg() < min || (max >= 0 && fs.NArg() > max) {
+		fs.Usage()
+		return nil, fmt.Errorf("wrong number of arguments")
+	}
+	return fs.Args(), nil
+}
+
+func listFlags(fs *flag.FlagSet) *authoperate.ListOptions {
+	opts := &authoperate.ListOptions{}
+	fs.StringVar(&opts.Prefix, "prefix", "", "filter by prefix")
+	fs.StringVar(&opts.Cursor, "cursor", "", "next cursor returned by the previous page")
+	fs.IntVar(&opts.Limit, "limit", authoperate.DefaultPageLimit, "page size")
+	fs.BoolVar(&opts.WithTotal, "total", false, "also count all matched items")
+	return opts
+}
+
+// 解析url=GET,POST格式的路由参数
+func parseRoutes(values []string) (map[string][]string, error) {
+	routes := make(map[string][]string)
+	for _, v := range values {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+			return nil, fmt.Errorf("invalid route %s, must be url=GET,POST", v)
+		}
+
+		url := strings.ToLower(strings.TrimSpace(kv[0]))
+		for _, method := range strings.Split(kv[1], ",") {
+			method = strings.ToUpper(strings.TrimSpace(method))
+			if methodValue(method) == 0 {
+				return nil, fmt.Errorf("invalid method %s in %s, only support GET POST PUT DELETE", method, v)
+			}
+			routes[url] = append(routes[url], method)
+		}
+	}
+
+	if _, err := urlMethodValues(routes); err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
+
+func routeMethods(methods []authoperate.RouteMethod) string {
+	ms := []string{}
+	for _, m := range methods {
+		if m.Enable {
+			ms = append(ms, m.Method+"*")
+		} else {
+			ms = append(ms, m.Method)
+		}
+	}
+	return join(ms)
+}
+
+func roleRouteMethods(r authoperate.RoleRouteInfo) string {
+	ms := []string{}
+	for _, m := range r.Methods {
+		if m.IsDelete {
+			ms = append(ms, m.Method+"(deleted)")
+		} else {
+			ms = append(ms, m.Method)
+		}
+	}
+	return join(ms)
+}
+
+/******************user********************/
+
+func userList(c *ctl, args []string) error {
+	fs := c.flags()
+	opts := listFlags(fs)
+	fs.StringVar(&opts.RoleName, "role", "", "only users of the role")
+	fs.StringVar(&opts.Sort, "sort", "", "userId or name, prefix with - for descending")
+	if _, err := c.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	page, err := c.backend.ListUsers(*opts)
+	if err != nil {
+		return err
+	}
+
+	return c.out.print(page, func(t *table) {
+		t.header = []string{"USERID", "NAME"}
+		for _, u := range page.Users {
+			t.row(u.UserId, orDash(u.Name))
+		}
+		pageNotes(t, page.NextCursor, page.Total)
+	})
+}
+
+func userShow(c *ctl, args []string) error {
+	fs := c.flags()
+	args, err := c.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	user, err := c.backend.GetUser(args[0])
+	if err != nil {
+		return err
+	}
+
+	return c.out.print(user, func(t *table) {
+		t.note("userId:  %s", user.UserId)
+		t.note("name:    %s", orDash(user.Name))
+		t.note("version: %d", user.Version)
+		t.header = []string{"SIGNKEY", "DESC"}
+		keys := []string{}
+		for k := range user.SignKey {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			t.row(k, orDash(user.SignKey[k]))
+		}
+	})
+}
+
+func userAdd(c *ctl, args []string) error {
+	fs := c.flags()
+	noRole := fs.Bool("no-role", false, "do not add the user to the default role")
+	args, err := c.parse(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	if err := c.backend.AddUser(args[0], args[1], *noRole); err != nil {
+		return err
+	}
+	return c.out.done("user %s added", args[0])
+}
+
+func userDiff(c *ctl, args []string) error {
+	fs := c.flags()
+	args, err := c.parse(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	diff, err := c.backend.CompareUsers(args[0], args[1])
+	if err != nil {
+		return err
+	}
+
+	return c.out.print(diff, func(t *table) {
+		t.header = []string{"ONLY", "KIND", "NAME", "DETAIL"}
+		for _, side := range []struct {
+			userId string
+			roles  []string
+			routes []authoperate.RoutePermission
+			grants []authoperate.SignGrant
+		}{
+			{diff.UserId, diff.OnlyRoles, diff.OnlyRouters, diff.OnlySignGrants},
+			{diff.OtherUserId, diff.OtherOnlyRoles, diff.OtherOnlyRouters, diff.OtherOnlySignGrants},
+		} {
+			for _, role := range side.roles {
+				t.row(side.userId, "role", role, "-")
+			}
+			for _, rp := range side.routes {
+				t.row(side.userId, "route", rp.Method+" "+rp.Uri, "roles: "+join(rp.Roles))
+			}
+			for _, g := range side.grants {
+				routes := []string{}
+				for _, r := range g.Routers {
+					routes = append(routes, r.Uri+" "+join(r.Methods))
+				}
+				t.row(side.userId, "sign", g.SignKey, strings.Join(routes, "; "))
+			}
+		}
+		if len(t.rows) == 0 {
+			t.note("%s and %s have the same permissions", diff.UserId, diff.OtherUserId)
+		}
+	})
+}
+
+/******************role********************/
+
+func roleList(c *ctl, args []string) error {
+	fs := c.flags()
+	opts := listFlags(fs)
+	fs.StringVar(&opts.Tag, "tag", "", "only roles with the tag")
+	fs.StringVar(&opts.Sort, "sort", "", "roleName or desc, prefix with - for descending")
+	if _, err := c.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	page, err := c.backend.ListRoles(*opts)
+	if err != nil {
+		return err
+	}
+
+	return c.out.print(page, func(t *table) {
+		t.header = []string{"ROLE", "TYPE", "DEFAULT", "ROUTES", "USERS", "TAGS", "DESC"}
+		for _, r := range page.Roles {
+			t.row(r.RoleName, fmt.Sprint(r.Type), yesNo(r.IsDefault), fmt.Sprint(len(r.Routers)),
+				fmt.Sprint(len(r.Users)), join(r.Tags), orDash(r.Desc))
+		}
+		pageNotes(t, page.NextCursor, page.Total)
+	})
+}
+
+func roleShow(c *ctl, args []string) error {
+	fs := c.flags()
+	args, err := c.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	role, err := c.backend.GetRole(args[0])
+	if err != nil {
+		return err
+	}
+
+	return c.out.print(role, func(t *table) {
+		users := []string{}
+		for _, u := range role.Users {
+			users = append(users, u.UserId)
+		}
+		t.note("role:    %s", role.RoleName)
+		t.note("desc:    %s", orDash(role.Desc))
+		t.note("type:    %d", role.Type)
+		t.note("default: %s", yesNo(role.IsDefault))
+		t.note("tags:    %s", join(role.Tags))
+		t.note("users:   %s", join(users))
+		t.note("version: %d", role.Version)
+		t.header = []string{"URI", "METHODS", "DESC"}
+		for _, r := range role.Routers {
+			t.row(r.Uri, roleRouteMethods(r), orDash(r.UriDesc))
+		}
+	})
+}
+
+func roleAdd(c *ctl, args []string) error {
+	fs := c.flags()
+	role := oreo.PolicyRole{}
+	var tags, routes stringsFlag
+	fs.StringVar(&role.Desc, "desc", "", "role description")
+	fs.IntVar(&role.Type, "type", 0, "role type, 1 is superadmin")
+	fs.BoolVar(&role.IsDefault, "default", false, "make it the default role of new users")
+	fs.Var(&tags, "tag", "role tag, can be repeated")
+	fs.Var(&routes, "route", "url=GET,POST granted to the role, can be repeated")
+	args, err := c.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	role.Name = args[0]
+	role.Tags = tags
+	if role.Routes, err = parseRoutes(routes); err != nil {
+		return err
+	}
+
+	if err := c.backend.AddRole(role); err != nil {
+		return err
+	}
+	return c.out.done("role %s added", role.Name)
+}
+
+func roleGrant(c *ctl, args []string) error {
+	fs := c.flags()
+	args, err := c.parse(fs, args, 2, -1)
+	if err != nil {
+		return err
+	}
+
+	if err := c.backend.GrantRole(args[0], args[1:]); err != nil {
+		return err
+	}
+	return c.out.done("role %s granted to %s", args[0], strings.Join(args[1:], ","))
+}
+
+func roleRevoke(c *ctl, args []string) error {
+	fs := c.flags()
+	args, err := c.parse(fs, args, 2, -1)
+	if err != nil {
+		return err
+	}
+
+	if err := c.backend.RevokeRole(args[0], args[1:]); err != nil {
+		return err
+	}
+	return c.out.done("role %s revoked from %s", args[0], strings.Join(args[1:], ","))
+}
+
+// 列出角色还没有的路由和方法
+func roleDiff(c *ctl, args []string) error {
+	fs := c.flags()
+	args, err := c.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	dr, err := c.backend.RoleDiff(args[0])
+	if err != nil {
+		return err
+	}
+
+	return c.out.print(dr, func(t *table) {
+		t.header = []string{"URI", "NOT GRANTED", "DESC"}
+		for _, r := range dr {
+			t.row(r.Uri, routeMethods(r.Methods), orDash(r.Desc))
+		}
+	})
+}
+
+/******************route********************/
+
+func routeList(c *ctl, args []string) error {
+	fs := c.flags()
+	opts := listFlags(fs)
+	fs.BoolVar(&opts.DataAuth, "data-auth", false, "only routes with data permission enabled")
+	fs.StringVar(&opts.Sort, "sort", "", "uri or desc, prefix with - for descending")
+	if _, err := c.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	page, err := c.backend.ListRoutes(*opts)
+	if err != nil {
+		return err
+	}
+
+	return c.out.print(page, func(t *table) {
+		t.header = []string{"URI", "METHODS", "DESC"}
+		for _, r := range page.Routes {
+			t.row(r.Uri, routeMethods(r.Methods), orDash(r.Desc))
+		}
+		t.note("* data permission enabled")
+		pageNotes(t, page.NextCursor, page.Total)
+	})
+}
+
+func routeShow(c *ctl, args []string) error {
+	fs := c.flags()
+	args, err := c.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	rv, err := c.backend.GetRoute(args[0])
+	if err != nil {
+		return err
+	}
+
+	return c.out.print(rv, func(t *table) {
+		t.note("uri:     %s", rv.Uri)
+		t.note("desc:    %s", orDash(rv.Desc))
+		t.note("version: %d", rv.Version)
+		t.header = []string{"METHOD", "DATA AUTH", "DESC"}
+		for _, m := range rv.Methods {
+			t.row(m.Method, yesNo(m.Enable), orDash(m.Desc))
+		}
+	})
+}
+
+func routeAdd(c *ctl, args []string) error {
+	fs := c.flags()
+	r := oreo.PolicyRoute{}
+	var methods, dataAuth stringsFlag
+	fs.StringVar(&r.Desc, "desc", "", "route description")
+	fs.Var(&methods, "method", "METHOD or METHOD=desc, can be repeated")
+	fs.Var(&dataAuth, "data-auth", "METHOD with data permission enabled, can be repeated")
+	args, err := c.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	r.Url = args[0]
+	enable := make(map[string]bool)
+	for _, m := range dataAuth {
+		enable[strings.ToUpper(strings.TrimSpace(m))] = true
+	}
+
+	for _, m := range methods {
+		kv := strings.SplitN(m, "=", 2)
+		pm := oreo.PolicyMethod{Method: strings.ToUpper(strings.TrimSpace(kv[0]))}
+		if methodValue(pm.Method) == 0 {
+			return fmt.Errorf("invalid method %s, only support GET POST PUT DELETE", kv[0])
+		}
+		if len(kv) == 2 {
+			pm.Desc = kv[1]
+		}
+		pm.DataAuth = enable[pm.Method]
+		delete(enable, pm.Method)
+		r.Methods = append(r.Methods, pm)
+	}
+
+	if len(r.Methods) == 0 {
+		return fmt.Errorf("at least one -method is required")
+	}
+	for m := range enable {
+		return fmt.Errorf("-data-auth %s is not in -method", m)
+	}
+
+	if err := c.backend.AddRoute(r); err != nil {
+		return err
+	}
+	return c.out.done("route %s added", r.Url)
+}
+
+/******************sign********************/
+
+func signList(c *ctl, args []string) error {
+	fs := c.flags()
+	opts := listFlags(fs)
+	fs.StringVar(&opts.Sort, "sort", "", "signKey, userId or desc, prefix with - for descending")
+	if _, err := c.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	page, err := c.backend.ListSigns(*opts)
+	if err != nil {
+		return err
+	}
+
+	return c.out.print(page, func(t *table) {
+		t.header = []string{"SIGNKEY", "OWNER", "DESC"}
+		for _, s := range page.Signs {
+			t.row(s.SignKey, s.UserId, orDash(s.Desc))
+		}
+		pageNotes(t, page.NextCursor, page.Total)
+	})
+}
+
+func signShow(c *ctl, args []string) error {
+	fs := c.flags()
+	args, err := c.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	sl, err := c.backend.GetSign(args[0])
+	if err != nil {
+		return err
+	}
+
+	return c.out.print(sl, func(t *table) {
+		t.note("signKey: %s", sl.SignKey)
+		t.note("owner:   %s %s", orDash(sl.OwnerId), sl.Name)
+		t.header = []string{"USERID", "NAME", "URI", "METHODS"}
+		for _, v := range sl.SignViews {
+			for _, r := range v.Routers {
+				t.row(v.UserId, orDash(v.Name), r.Uri, roleRouteMethods(r))
+			}
+		}
+	})
+}
+
+// 默认在已有授权上追加，-replace时整体替换
+func signGrant(c *ctl, args []string) error {
+	fs := c.flags()
+	var routes stringsFlag
+	replace := fs.Bool("replace", false, "replace the existing grant instead of appending to it")
+	fs.Var(&routes, "route", "url=GET,POST granted to the user, can be repeated")
+	args, err := c.parse(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	signKey, userId := args[0], args[1]
+	rm, err := parseRoutes(routes)
+	if err != nil {
+		return err
+	}
+	if len(rm) == 0 {
+		return fmt.Errorf("at least one -route is required")
+	}
+
+	granted := false
+	if !*replace {
+		sl, err := c.backend.GetSign(signKey)
+		if err != nil {
+			return err
+		}
+		for _, v := range sl.SignViews {
+			granted = granted || v.UserId == userId
+		}
+	}
+
+	if granted {
+		err = c.backend.AppendSignGrant(signKey, userId, rm)
+	} else {
+		err = c.backend.PutSignGrant(signKey, userId, rm)
+	}
+	if err != nil {
+		return err
+	}
+	return c.out.done("signKey %s granted to %s", signKey, userId)
+}
+
+func signRevoke(c *ctl, args []string) error {
+	fs := c.flags()
+	args, err := c.parse(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	if err := c.backend.RevokeSign(args[0], args[1]); err != nil {
+		return err
+	}
+	return c.out.done("signKey %s revoked from %s", args[0], args[1])
+}
+
+// 创建者从存储中查询，描述为空时沿用原来的描述
+func signTransfer(c *ctl, args []string) error {
+	fs := c.flags()
+	desc := fs.String("desc", "", "new description of the signKey")
+	args, err := c.parse(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	signKey, destUserId := args[0], args[1]
+	sl, err := c.backend.GetSign(signKey)
+	if err != nil {
+		return err
+	}
+	if sl.OwnerId == "" {
+		return fmt.Errorf("signKey %s not found", signKey)
+	}
+	if sl.OwnerId == destUserId {
+		return fmt.Errorf("signKey %s is already owned by %s", signKey, destUserId)
+	}
+
+	if *desc == "" {
+		owner, err := c.backend.GetUser(sl.OwnerId)
+		if err != nil {
+			return err
+		}
+		*desc = owner.SignKey[signKey]
+	}
+
+	if err := c.backend.TransferSign(signKey, sl.OwnerId, destUserId, *desc); err != nil {
+		return err
+	}
+	return c.out.done("signKey %s transferred from %s to %s", signKey, sl.OwnerId, destUserId)
+}
+
+// 列出开启了数据权限但没有授权给用户的路由和方法
+func signDiff(c *ctl, args []string) error {
+	fs := c.flags()
+	args, err := c.parse(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	dr, err := c.backend.SignDiff(args[0], args[1])
+	if err != nil {
+		return err
+	}
+
+	return c.out.print(dr, func(t *table) {
+		t.header = []string{"URI", "NOT GRANTED", "DESC"}
+		for _, r := range dr {
+			t.row(r.Uri, routeMethods(r.Methods), orDash(r.Desc))
+		}
+	})
+}
+
+/******************group********************/
+
+func groupList(c *ctl, args []string) error {
+	fs := c.flags()
+	if _, err := c.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	groups, err := c.backend.ListGroups()
+	if err != nil {
+		return err
+	}
+
+	return c.out.print(groups, func(t *table) {
+		t.header = []string{"GROUP"}
+		for _, g := range groups {
+			t.row(g)
+		}
+	})
+}
+
+/******************check********************/
+
+func check(c *ctl, args []string) error {
+	fs := c.flags()
+	userId := fs.String("user", "", "userId")
+	method := fs.String("method", "GET", "http method")
+	url := fs.String("url", "", "request url")
+	signKey := fs.String("sign", "", "signKey")
+	if _, err := c.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if *userId == "" || *url == "" {
+		fs.Usage()
+		return fmt.Errorf("-user and -url are required")
+	}
+
+	explain, err := c.backend.Explain(*url, *method, *userId, *signKey)
+	if err != nil {
+		return err
+	}
+
+	err = c.out.print(explain, func(t *table) {
+		result := "DENY"
+		if explain.Allowed {
+			result = "ALLOW"
+		}
+		t.note("result:     %s", result)
+		t.note("request:    %s %s", explain.Method, explain.Url)
+		t.note("route:      %s", orDash(explain.Route))
+		t.note("user roles: %s", join(explain.UserRoles))
+		t.note("granted by: %s", join(explain.Roles))
+		t.note("superadmin: %s", yesNo(explain.IsAdmin))
+		t.note("data auth:  %s", yesNo(explain.DataAuth))
+		if explain.SignKey != "" {
+			t.note("signKey:    %s owned by %s, via %s", explain.SignKey, orDash(explain.SignOwner), orDash(explain.SignVia))
+		}
+		if explain.Reason != "" {
+			t.note("reason:     %s", explain.Reason)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if !explain.Allowed {
+		return errDenied
+	}
+	return nil
+}
+
+/******************policy********************/
+
+func isYAML(file string) bool {
+	ext := strings.ToLower(filepath.Ext(file))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// 导出的策略文件按扩展名使用YAML或JSON格式，不指定文件时以JSON输出到标准输出
+func policyExport(c *ctl, args []string) error {
+	fs := c.flags()
+	file := fs.String("f", "", "write to the file instead of stdout, .yaml or .yml for YAML")
+	if _, err := c.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	policy, err := c.backend.ExportPolicy()
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	if isYAML(*file) {
+		data, err = yaml.Marshal(policy)
+	} else {
+		data, err = json.MarshalIndent(policy, "", "  ")
+		data = append(data, '\n')
+	}
+	if err != nil {
+		return err
+	}
+
+	if *file == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	if err := ioutil.WriteFile(*file, data, 0644); err != nil {
+		return err
+	}
+	return c.out.done("policy of group %s exported to %s: %d routes, %d users, %d roles, %d sign grants",
+		policy.Group, *file, len(policy.Routes), len(policy.Users), len(policy.Roles), len(policy.Signs))
+}
+
+func readPolicy(file string) (oreo.Policy, error) {
+	policy := oreo.Policy{}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return policy, err
+	}
+
+	if isYAML(file) {
+		err = yaml.UnmarshalStrict(data, &policy)
+	} else {
+		err = json.Unmarshal(data, &policy)
+	}
+	if err != nil {
+		return policy, fmt.Errorf("parse %s: %s", file, err.Error())
+	}
+	return policy, nil
+}
+
+// 增量导入，只会新增和合并，不会删除数据
+func policyImport(c *ctl, args []string) error {
+	fs := c.flags()
+	file := fs.String("f", "", "policy file exported by policy export, JSON or YAML")
+	if _, err := c.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if *file == "" {
+		fs.Usage()
+		return fmt.Errorf("-f is required")
+	}
+
+	policy, err := readPolicy(*file)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.backend.ImportPolicy(policy)
+	if err != nil {
+		return err
+	}
+
+	return c.out.print(res, func(t *table) {
+		t.note("imported %d routes, %d users, %d roles, %d sign grants", res.Routes, res.Users, res.Roles, res.Signs)
+	})
+}
+
+// 在标准错误输出提示，只有输入yes才确认
+func confirm(format string, args ...interface{}) bool {
+	fmt.Fprintf(os.Stderr, format+" only yes will be accepted: ", args...)
+	answer := ""
+	fmt.Scanln(&answer)
+	return answer == "yes"
+}
+
+func printPlan(c *ctl, plan oreo.PolicyPlan) error {
+	return c.out.print(plan, func(t *table) {
+		t.header = []string{"ACTION", "KIND", "NAME", "CHANGE"}
+		count := make(map[string]int)
+		skipped := 0
+		for _, change := range plan.Changes {
+			for _, d := range change.Details {
+				t.row(change.Action, change.Kind, change.Name, d)
+			}
+			for _, d := range change.Skipped {
+				t.row("skip", change.Kind, change.Name, d)
+			}
+			if len(change.Details) > 0 {
+				count[change.Action]++
+			}
+			skipped += len(change.Skipped)
+		}
+
+		if !plan.HasChanges() {
+			t.note("no changes, group %s matches the policy", plan.Group)
+		} else {
+			t.note("plan for group %s: %d to create, %d to update, %d to delete",
+				plan.Group, count[oreo.PlanCreate], count[oreo.PlanUpdate], count[oreo.PlanDelete])
+		}
+		if skipped > 0 {
+			t.note("%d deletions skipped, use -prune to delete what the policy does not list", skipped)
+		}
+	})
+}
+
+// 计算策略与当前数据的差异，不会修改数据
+func policyPlan(c *ctl, args []string) error {
+	fs := c.flags()
+	file := fs.String("f", "", "policy file, JSON or YAML")
+	prune := fs.Bool("prune", false, "delete routes, methods, roles, role routes and role users not listed in the policy")
+	if _, err := c.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if *file == "" {
+		fs.Usage()
+		return fmt.Errorf("-f is required")
+	}
+
+	policy, err := readPolicy(*file)
+	if err != nil {
+		return err
+	}
+
+	plan, err := c.backend.PlanPolicy(policy, oreo.PlanOptions{Prune: *prune})
+	if err != nil {
+		return err
+	}
+	return printPlan(c, plan)
+}
+
+// 先计算并展示计划，确认后按计划的指纹执行，计划之后数据被他人修改时不会执行
+func policyApply(c *ctl, args []string) error {
+	fs := c.flags()
+	file := fs.String("f", "", "policy file, JSON or YAML")
+	prune := fs.Bool("prune", false, "delete routes, methods, roles, role routes and role users not listed in the policy")
+	yes := fs.Bool("yes", false, "apply without confirmation")
+	if _, err := c.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if *file == "" {
+		fs.Usage()
+		return fmt.Errorf("-f is required")
+	}
+
+	policy, err := readPolicy(*file)
+	if err != nil {
+		return err
+	}
+
+	opts := oreo.PlanOptions{Prune: *prune}
+	plan, err := c.backend.PlanPolicy(policy, opts)
+	if err != nil {
+		return err
+	}
+
+	if !plan.HasChanges() {
+		return printPlan(c, plan)
+	}
+
+	if !*yes {
+		if c.out.format != "json" {
+			if err := printPlan(c, plan); err != nil {
+				return err
+			}
+		}
+
+		if !confirm("apply these changes to group %s?", plan.Group) {
+			return fmt.Errorf("apply cancelled")
+		}
+	}
+
+	opts.Fingerprint = plan.Fingerprint
+	applied, err := c.backend.ApplyPolicy(policy, opts)
+	if err != nil {
+		return err
+	}
+
+	if c.out.format == "json" {
+		return c.out.print(applied, nil)
+	}
+	if *yes {
+		if err := printPlan(c, applied); err != nil {
+			return err
+		}
+	}
+	return c.out.done("policy applied to group %s", applied.Group)
+}
+
+/******************promote********************/
+
+// 提升和比较的源，可以是同一存储的其他组、其他存储、其他oreoauth或导出的策略文件
+type source struct {
+	opts globalOptions
+	file string
+}
+
+func (c *ctl) sourceFlags(fs *flag.FlagSet) *source {
+	s := &source{opts: c.opts}
+	s.opts.store, s.opts.endpoint = "", ""
+	fs.StringVar(&s.opts.group, "from-group", "", "source group name")
+	fs.StringVar(&s.opts.store, "from-store", "", "source mongo dsn, the target store by default")
+	fs.StringVar(&s.opts.db, "from-db", c.opts.db, "source mongo database name")
+	fs.StringVar(&s.opts.endpoint, "from-endpoint", "", "source oreoauth url prefix, the target endpoint by default")
+	fs.StringVar(&s.opts.token, "from-token", c.opts.token, "bearer token for -from-endpoint")
+	fs.StringVar(&s.file, "from-file", "", "policy file exported from the source instead of connecting to it")
+	return s
+}
+
+// 导出源的策略，没有指定源的存储和oreoauth时使用目标的存储
+func (s *source) policy(c *ctl) (oreo.Policy, error) {
+	if s.file != "" {
+		return readPolicy(s.file)
+	}
+
+	// oreoauth只管理一个组，-from-group只能用于直连存储
+	if s.opts.store == "" && s.opts.endpoint == "" {
+		if c.opts.store == "" {
+			return oreo.Policy{}, fmt.Errorf("-from-store, -from-endpoint or -from-file is required with -endpoint")
+		}
+		if s.opts.group == "" || (s.opts.group == c.opts.group && s.opts.db == c.opts.db) {
+			return oreo.Policy{}, fmt.Errorf("-from-group of another group, -from-store, -from-endpoint or -from-file is required")
+		}
+		s.opts.store = c.opts.store
+	}
+	if s.opts.store != "" && s.opts.group == "" {
+		s.opts.group = c.opts.group
+	}
+
+	b, err := newBackend(s.opts)
+	if err != nil {
+		return oreo.Policy{}, fmt.Errorf("source: %s", err.Error())
+	}
+	defer b.Close()
+
+	policy, err := b.ExportPolicy()
+	if err != nil {
+		return policy, fmt.Errorf("source: %s", err.Error())
+	}
+	return policy, nil
+}
+
+// 比较源与目标的路由、角色和默认角色
+func policyDiff(c *ctl, args []string) error {
+	fs := c.flags()
+	src := c.sourceFlags(fs)
+	if _, err := c.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	policy, err := src.policy(c)
+	if err != nil {
+		return err
+	}
+
+	diff, err := c.backend.DiffPolicy(policy)
+	if err != nil {
+		return err
+	}
+
+	return c.out.print(diff, func(t *table) {
+		t.header = []string{"ACTION", "KIND", "NAME", "CHANGE"}
+		for _, change := range diff.Changes {
+			for _, d := range change.Details {
+				t.row(change.Action, change.Kind, change.Name, d)
+			}
+		}
+
+		if diff.SourceDefault != diff.TargetDefault {
+			t.note("default role: %s in %s, %s in %s", orNone(diff.SourceDefault), diff.Source, orNone(diff.TargetDefault), diff.Target)
+		}
+		if !diff.HasDiff() {
+			t.note("no differences between %s and %s", diff.Source, diff.Target)
+		} else {
+			t.note("changes to make %s match %s, delete means only in %s", diff.Target, diff.Source, diff.Target)
+		}
+	})
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// 将源选中的路由和角色提升到目标，先展示计划，确认后按计划的指纹执行
+func policyPromote(c *ctl, args []string) error {
+	fs := c.flags()
+	src := c.sourceFlags(fs)
+	routes := stringsFlag{}
+	roles := stringsFlag{}
+	fs.Var(&routes, "route", "route url to promote, repeatable, all routes and roles when neither -route nor -role is given")
+	fs.Var(&roles, "role", "role name to promote, repeatable")
+	defaultRole := fs.Bool("default-role", false, "also promote the default role setting")
+	users := fs.Bool("users", false, "also promote members of the promoted roles")
+	signs := fs.Bool("signs", false, "also promote signKey ownership and sign grants")
+	prune := fs.Bool("prune", false, "delete methods, role routes, members and grants the source does not have from what is promoted")
+	yes := fs.Bool("yes", false, "promote without confirmation")
+	if _, err := c.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	policy, err := src.policy(c)
+	if err != nil {
+		return err
+	}
+
+	opts := oreo.PromoteOptions{
+		Routes:      routes,
+		Roles:       roles,
+		DefaultRole: *defaultRole,
+		Users:       *users,
+		Signs:       *signs,
+		Prune:       *prune,
+	}
+	plan, err := c.backend.PlanPromote(policy, opts)
+	if err != nil {
+		return err
+	}
+
+	if !plan.HasChanges() {
+		return printPlan(c, plan)
+	}
+
+	if !*yes {
+		if c.out.format != "json" {
+			if err := printPlan(c, plan); err != nil {
+				return err
+			}
+		}
+
+		if !confirm("promote these changes from %s to group %s?", policy.Group, plan.Group) {
+			return fmt.Errorf("promote cancelled")
+		}
+	}
+
+	opts.Fingerprint = plan.Fingerprint
+	applied, err := c.backend.Promote(policy, opts)
+	if err != nil {
+		return err
+	}
+
+	if c.out.format == "json" {
+		return c.out.print(applied, nil)
+	}
+	if *yes {
+		if err := printPlan(c, applied); err != nil {
+			return err
+		}
+	}
+	return c.out.done("promoted from %s to group %s", policy.Group, applied.Group)
+}
+
+/******************snapshot********************/
+
+func parseSeq(arg string) (int64, error) {
+	seq, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || seq <= 0 {
+		return 0, fmt.Errorf("invalid snapshot seq %s", arg)
+	}
+	return seq, nil
+}
+
+func snapshotList(c *ctl, args []string) error {
+	if _, err := c.parse(c.flags(), args, 0, 0); err != nil {
+		return err
+	}
+
+	infos, err := c.backend.ListSnapshots()
+	if err != nil {
+		return err
+	}
+
+	return c.out.print(infos, func(t *table) {
+		t.header = []string{"SEQ", "CREATED", "AUTO", "ROUTES", "ROLES", "USERS", "SIGNS", "SCOPES", "REASON"}
+		for _, info := range infos {
+			t.row(fmt.Sprint(info.Seq), info.CreateTime.Format("2006-01-02 15:04:05"), fmt.Sprint(info.Auto),
+				fmt.Sprint(info.Routers), fmt.Sprint(info.Roles), fmt.Sprint(info.Users), fmt.Sprint(info.Signs),
+				fmt.Sprint(info.Scopes), info.Reason)
+		}
+	})
+}
+
+func snapshotCreate(c *ctl, args []string) error {
+	fs := c.flags()
+	reason := fs.String("reason", "", "why the snapshot is taken")
+	if _, err := c.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	info, err := c.backend.CreateSnapshot(*reason)
+	if err != nil {
+		return err
+	}
+
+	return c.out.print(info, func(t *table) {
+		t.note("snapshot %d of group %s created: %d routes, %d roles, %d users, %d sign grants",
+			info.Seq, info.GroupName, info.Routers, info.Roles, info.Users, info.Signs)
+	})
+}
+
+// 导出快照或当前数据的归档，JSON格式，不指定文件时输出到标准输出
+func snapshotExport(c *ctl, args []string) error {
+	fs := c.flags()
+	seq := fs.Int64("seq", 0, "snapshot to export, the current data when 0")
+	file := fs.String("f", "", "write to the file instead of stdout")
+	if _, err := c.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	archive, err := c.backend.GetSnapshot(*seq)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if *file == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	if err := ioutil.WriteFile(*file, data, 0644); err != nil {
+		return err
+	}
+	return c.out.done("archive of group %s exported to %s: %d routes, %d roles, %d users, %d sign grants",
+		archive.Info.GroupName, *file, len(archive.Routers), len(archive.Roles), len(archive.Users), len(archive.Signs))
+}
+
+// 用归档替换-group指定组的全部数据，归档可以来自其他组
+func snapshotImport(c *ctl, args []string) error {
+	fs := c.flags()
+	file := fs.String("f", "", "archive exported by snapshot export")
+	yes := fs.Bool("yes", false, "import without confirmation")
+	if _, err := c.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if *file == "" {
+		fs.Usage()
+		return fmt.Errorf("-f is required")
+	}
+
+	data, err := ioutil.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+
+	archive := &authoperate.SnapshotArchive{}
+	if err := json.Unmarshal(data, archive); err != nil {
+		return fmt.Errorf("parse %s: %s", *file, err.Error())
+	}
+
+	if !*yes && !confirm("replace all routes, roles, users and sign grants with the archive of group %s (%d routes, %d roles, %d users, %d sign grants)?",
+		archive.Info.GroupName, len(archive.Routers), len(archive.Roles), len(archive.Users), len(archive.Signs)) {
+		return fmt.Errorf("import cancelled")
+	}
+
+	if err := c.backend.RestoreSnapshot(archive); err != nil {
+		return err
+	}
+	return c.out.done("archive of group %s imported", archive.Info.GroupName)
+}
+
+func snapshotRollback(c *ctl, args []string) error {
+	fs := c.flags()
+	yes := fs.Bool("yes", false, "rollback without confirmation")
+	rest, err := c.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	seq, err := parseSeq(rest[0])
+	if err != nil {
+		return err
+	}
+
+	if !*yes && !confirm("replace all routes, roles, users and sign grants with snapshot %d?", seq) {
+		return fmt.Errorf("rollback cancelled")
+	}
+
+	if err := c.backend.RollbackSnapshot(seq); err != nil {
+		return err
+	}
+	return c.out.done("rolled back to snapshot %d", seq)
+}
+
+func snapshotDelete(c *ctl, args []string) error {
+	rest, err := c.parse(c.flags(), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	seq, err := parseSeq(rest[0])
+	if err != nil {
+		return err
+	}
+
+	if err := c.backend.DeleteSnapshot(seq); err != nil {
+		return err
+	}
+	return c.out.done("snapshot %d deleted", seq)
+}
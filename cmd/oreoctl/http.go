@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xkeyideal/oreo"
+	"github.com/xkeyideal/oreo/authoperate"
+	"github.com/xkeyideal/oreo/oreoauth"
+)
+
+// 调用oreoauth的v2管理api，管理权限由oreoauth根据token校验，不会发送userId请求头
+type httpBackend struct {
+	base   string
+	token  string
+	client *http.Client
+}
+
+func newHTTPBackend(endpoint, token string, timeout time.Duration) *httpBackend {
+	return &httpBackend{
+		base:   strings.TrimRight(endpoint, "/") + "/oreo/auth/v2",
+		token:  token,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+type apiErrorResp struct {
+	Error oreoauth.APIError `json:"error"`
+}
+
+// 发送请求并将返回的JSON解析到result，result为nil时忽略返回内容
+func (h *httpBackend) do(method, path string, query url.Values, body, result interface{}) error {
+	u := h.base + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if h.token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		er := apiErrorResp{}
+		if err := json.Unmarshal(data, &er); err != nil || er.Error.Code == "" {
+			return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+		}
+
+		msg := fmt.Sprintf("%s: %s", er.Error.Code, er.Error.Message)
+		for _, d := range er.Error.Details {
+			msg += fmt.Sprintf("\n  %s: %s", d.Field, d.Reason)
+		}
+		return fmt.Errorf("%s", msg)
+	}
+
+	if result == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
+
+func listQuery(opts authoperate.ListOptions) url.Values {
+	q := url.Values{}
+	set := func(k, v string) {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+
+	set("cursor", opts.Cursor)
+	set("prefix", opts.Prefix)
+	set("roleName", opts.RoleName)
+	set("tag", opts.Tag)
+	set("sort", opts.Sort)
+	if opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.DataAuth {
+		q.Set("dataAuth", "true")
+	}
+	if opts.WithTotal {
+		q.Set("total", "true")
+	}
+	return q
+}
+
+func esc(s string) string {
+	return url.PathEscape(s)
+}
+
+func (h *httpBackend) ListUsers(opts authoperate.ListOptions) (authoperate.UserPage, error) {
+	page := authoperate.UserPage{}
+	err := h.do("GET", "/users", listQuery(opts), nil, &page)
+	return page, err
+}
+
+func (h *httpBackend) GetUser(userId string) (authoperate.UserInfo, error) {
+	user := authoperate.UserInfo{}
+	err := h.do("GET", "/users/"+esc(userId), nil, nil, &user)
+	return user, err
+}
+
+func (h *httpBackend) AddUser(userId, name string, noRole bool) error {
+	body := map[string]interface{}{"userId": userId, "name": name, "noRole": noRole}
+	return h.do("POST", "/users", nil, body, nil)
+}
+
+func (h *httpBackend) CompareUsers(userId, otherUserId string) (authoperate.UserAccessDiff, error) {
+	diff := authoperate.UserAccessDiff{}
+	err := h.do("GET", "/users/"+esc(userId)+"/diff", url.Values{"with": {otherUserId}}, nil, &diff)
+	return diff, err
+}
+
+func (h *httpBackend) ListRoles(opts authoperate.ListOptions) (authoperate.RolePage, error) {
+	page := authoperate.RolePage{}
+	err := h.do("GET", "/roles", listQuery(opts), nil, &page)
+	return page, err
+}
+
+func (h *httpBackend) GetRole(roleName string) (authoperate.RoleListView, error) {
+	role := authoperate.RoleListView{}
+	err := h.do("GET", "/roles/"+esc(roleName), nil, nil, &role)
+	return role, err
+}
+
+func (h *httpBackend) AddRole(role oreo.PolicyRole) error {
+	body := map[string]interface{}{
+		"roleName":   role.Name,
+		"desc":       role.Desc,
+		"type":       role.Type,
+		"isDefault":  role.IsDefault,
+		"tags":       role.Tags,
+		"urlMethods": role.Routes,
+	}
+	return h.do("POST", "/roles", nil, body, nil)
+}
+
+func (h *httpBackend) GrantRole(roleName string, userIds []string) error {
+	return h.do("POST", "/roles/"+esc(roleName)+"/users", nil, map[string][]string{"userIds": userIds}, nil)
+}
+
+func (h *httpBackend) RevokeRole(roleName string, userIds []string) error {
+	for _, userId := range userIds {
+		if err := h.do("DELETE", "/roles/"+esc(roleName)+"/users/"+esc(userId), nil, nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *httpBackend) RoleDiff(roleName string) ([]authoperate.RouteListView, error) {
+	dr := []authoperate.RouteListView{}
+	err := h.do("GET", "/roles/"+esc(roleName)+"/routes", nil, nil, &dr)
+	return dr, err
+}
+
+func (h *httpBackend) ListRoutes(opts authoperate.ListOptions) (authoperate.RoutePage, error) {
+	page := authoperate.RoutePage{}
+	err := h.do("GET", "/routes", listQuery(opts), nil, &page)
+	return page, err
+}
+
+func (h *httpBackend) GetRoute(u string) (authoperate.RouteListView, error) {
+	rv := authoperate.RouteListView{}
+	err := h.do("GET", "/route", url.Values{"url": {u}}, nil, &rv)
+	return rv, err
+}
+
+func (h *httpBackend) AddRoute(r oreo.PolicyRoute) error {
+	methods := []map[string]interface{}{}
+	for _, m := range r.Methods {
+		methods = append(methods, map[string]interface{}{
+			"method":     m.Method,
+			"methodDesc": m.Desc,
+			"enable":     m.DataAuth,
+		})
+	}
+
+	body := []map[string]interface{}{{"url": r.Url, "urlDesc": r.Desc, "methods": methods}}
+	return h.do("POST", "/routes", nil, body, nil)
+}
+
+func (h *httpBackend) ListSigns(opts authoperate.ListOptions) (authoperate.SignPage, error) {
+	page := authoperate.SignPage{}
+	err := h.do("GET", "/signs", listQuery(opts), nil, &page)
+	return page, err
+}
+
+func (h *httpBackend) GetSign(signKey string) (authoperate.SignListView, error) {
+	sl := authoperate.SignListView{}
+	err := h.do("GET", "/signs/"+esc(signKey), nil, nil, &sl)
+	return sl, err
+}
+
+func (h *httpBackend) PutSignGrant(signKey, userId string, routes map[string][]string) error {
+	body := map[string]interface{}{"urlMethods": routes}
+	return h.do("PUT", "/signs/"+esc(signKey)+"/grants/"+esc(userId), nil, body, nil)
+}
+
+func (h *httpBackend) AppendSignGrant(signKey, userId string, routes map[string][]string) error {
+	body := map[string]interface{}{"userIds": []string{userId}, "add": routes}
+	return h.do("PATCH", "/signs/"+esc(signKey)+"/grants", nil, body, nil)
+}
+
+func (h *httpBackend) RevokeSign(signKey, userId string) error {
+	return h.do("DELETE", "/signs/"+esc(signKey)+"/grants/"+esc(userId), nil, nil, nil)
+}
+
+func (h *httpBackend) TransferSign(signKey, ownerId, destUserId, desc string) error {
+	body := map[string]string{"destUserId": destUserId, "desc": desc}
+	return h.do("POST", "/users/"+esc(ownerId)+"/signs/"+esc(signKey)+"/transfer", nil, body, nil)
+}
+
+func (h *httpBackend) SignDiff(signKey, userId string) ([]authoperate.RouteListView, error) {
+	dr := []authoperate.RouteListView{}
+	err := h.do("GET", "/signs/"+esc(signKey)+"/grants/"+esc(userId)+"/diff", nil, nil, &dr)
+	return dr, err
+}
+
+func (h *httpBackend) ListGroups() ([]string, error) {
+	groups := []string{}
+	err := h.do("GET", "/groups", nil, nil, &groups)
+	return groups, err
+}
+
+func (h *httpBackend) Explain(u, method, userId, signKey string) (oreo.CheckExplain, error) {
+	explain := oreo.CheckExplain{}
+	q := url.Values{"url": {u}, "method": {method}, "userId": {userId}, "signKey": {signKey}}
+	err := h.do("GET", "/check", q, nil, &explain)
+	return explain, err
+}
+
+func (h *httpBackend) ExportPolicy() (oreo.Policy, error) {
+	policy := oreo.Policy{}
+	err := h.do("GET", "/policy", nil, nil, &policy)
+	return policy, err
+}
+
+func (h *httpBackend) ImportPolicy(policy oreo.Policy) (oreo.PolicyImportResult, error) {
+	res := oreo.PolicyImportResult{}
+	err := h.do("POST", "/policy", nil, policy, &res)
+	return res, err
+}
+
+func (h *httpBackend) PlanPolicy(policy oreo.Policy, opts oreo.PlanOptions) (oreo.PolicyPlan, error) {
+	plan := oreo.PolicyPlan{}
+	body := map[string]interface{}{"policy": policy, "prune": opts.Prune}
+	err := h.do("POST", "/policy/plan", nil, body, &plan)
+	return plan, err
+}
+
+func (h *httpBackend) ApplyPolicy(policy oreo.Policy, opts oreo.PlanOptions) (oreo.PolicyPlan, error) {
+	plan := oreo.PolicyPlan{}
+	body := map[string]interface{}{"policy": policy, "prune": opts.Prune, "fingerprint": opts.Fingerprint}
+	err := h.do("POST", "/policy/apply", nil, body, &plan)
+	return plan, err
+}
+
+func (h *httpBackend) DiffPolicy(source oreo.Policy) (oreo.PolicyDiff, error) {
+	diff := oreo.PolicyDiff{}
+	err := h.do("POST", "/policy/diff", nil, source, &diff)
+	return diff, err
+}
+
+func (h *httpBackend) PlanPromote(source oreo.Policy, opts oreo.PromoteOptions) (oreo.PolicyPlan, error) {
+	plan := oreo.PolicyPlan{}
+	err := h.do("POST", "/policy/promote/plan", nil, promoteBody(source, opts), &plan)
+	return plan, err
+}
+
+func (h *httpBackend) Promote(source oreo.Policy, opts oreo.PromoteOptions) (oreo.PolicyPlan, error) {
+	plan := oreo.PolicyPlan{}
+	err := h.do("POST", "/policy/promote", nil, promoteBody(source, opts), &plan)
+	return plan, err
+}
+
+func promoteBody(source oreo.Policy, opts oreo.PromoteOptions) interface{} {
+	return struct {
+		Source oreo.Policy `json:"source"`
+		oreo.PromoteOptions
+	}{source, opts}
+}
+
+func (h *httpBackend) ListSnapshots() ([]authoperate.SnapshotInfo, error) {
+	infos := []authoperate.SnapshotInfo{}
+	err := h.do("GET", "/snapshots", nil, nil, &infos)
+	return infos, err
+}
+
+func (h *httpBackend) CreateSnapshot(reason string) (authoperate.SnapshotInfo, error) {
+	info := authoperate.SnapshotInfo{}
+	err := h.do("POST", "/snapshots", nil, map[string]string{"reason": reason}, &info)
+	return info, err
+}
+
+func (h *httpBackend) GetSnapshot(seq int64) (*authoperate.SnapshotArchive, error) {
+	path := "/archive"
+	if seq > 0 {
+		path = fmt.Sprintf("/snapshots/%d", seq)
+	}
+
+	archive := &authoperate.SnapshotArchive{}
+	if err := h.do("GET", path, nil, nil, archive); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+func (h *httpBackend) DeleteSnapshot(seq int64) error {
+	return h.do("DELETE", fmt.Sprintf("/snapshots/%d", seq), nil, nil, nil)
+}
+
+func (h *httpBackend) RollbackSnapshot(seq int64) error {
+	return h.do("POST", fmt.Sprintf("/snapshots/%d/rollback", seq), nil, nil, nil)
+}
+
+func (h *httpBackend) RestoreSnapshot(archive *authoperate.SnapshotArchive) error {
+	return h.do("POST", "/archive", nil, archive, nil)
+}
+
+func (h *httpBackend) Close() {}
@@ -0,0 +1,204 @@
+// oreoctl 是oreo权限数据的命令行管理工具，可以直接连接mongo存储，也可以通过oreoauth的v2管理api操作
+//
+//	oreoctl -store mongodb://127.0.0.1:27017 -db oreo -group demo user list
+//	oreoctl -endpoint http://127.0.0.1:8080/api -token $OREO_TOKEN role grant developer u1 u2
+//	oreoctl -o json check -user u1 -method GET -url /api/orders/1 -sign 5a1b
+//
+// 全局参数需要写在命令之前，命令的参数需要写在位置参数之前
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xkeyideal/oreo"
+)
+
+type globalOptions struct {
+	store    string
+	db       string
+	group    string
+	endpoint string
+	token    string
+	output   string
+	timeout  time.Duration
+}
+
+type command struct {
+	usage string
+	run   func(ctl *ctl, args []string) error
+}
+
+// 资源和动作对应的命令，check、policy等没有资源的命令动作为空
+var commands = map[string]map[string]command{
+	"user": {
+		"list": {"[-prefix p] [-role r] [-sort userId|name] [-limit n] [-cursor c] [-total]", userList},
+		"show": {"<userId>", userShow},
+		"add":  {"[-no-role] <userId> <name>", userAdd},
+		"diff": {"<userId> <otherUserId>", userDiff},
+	},
+	"role": {
+		"list":   {"[-prefix p] [-tag t] [-limit n] [-cursor c] [-total]", roleList},
+		"show":   {"<roleName>", roleShow},
+		"add":    {"[-desc d] [-type n] [-default] [-tag t]... [-route url=GET,POST]... <roleName>", roleAdd},
+		"grant":  {"<roleName> <userId>...", roleGrant},
+		"revoke": {"<roleName> <userId>...", roleRevoke},
+		"diff":   {"<roleName>", roleDiff},
+	},
+	"route": {
+		"list": {"[-prefix p] [-data-auth] [-limit n] [-cursor c] [-total]", routeList},
+		"show": {"<url>", routeShow},
+		"add":  {"[-desc d] [-method GET=desc]... [-data-auth GET]... <url>", routeAdd},
+	},
+	"sign": {
+		"list":     {"[-prefix p] [-limit n] [-cursor c] [-total]", signList},
+		"show":     {"<signKey>", signShow},
+		"grant":    {"[-replace] -route url=GET,POST... <signKey> <userId>", signGrant},
+		"revoke":   {"<signKey> <userId>", signRevoke},
+		"transfer": {"[-desc d] <signKey> <destUserId>", signTransfer},
+		"diff":     {"<signKey> <userId>", signDiff},
+	},
+	"group": {
+		"list": {"", groupList},
+	},
+	"check": {
+		"": {"-user u -method m -url u [-sign s]", check},
+	},
+	"policy": {
+		"export":  {"[-f file]", policyExport},
+		"import":  {"-f file", policyImport},
+		"plan":    {"[-prune] -f file", policyPlan},
+		"apply":   {"[-prune] [-yes] -f file", policyApply},
+		"diff":    {"-from-group g|-from-store dsn|-from-endpoint url|-from-file file", policyDiff},
+		"promote": {"-from-group g|-from-store dsn|-from-endpoint url|-from-file file [-route url...] [-role r...] [-default-role] [-users] [-signs] [-prune] [-yes]", policyPromote},
+	},
+	"snapshot": {
+		"list":     {"", snapshotList},
+		"create":   {"[-reason r]", snapshotCreate},
+		"export":   {"[-seq n] [-f file]", snapshotExport},
+		"import":   {"[-yes] -f file", snapshotImport},
+		"rollback": {"[-yes] <seq>", snapshotRollback},
+		"delete":   {"<seq>", snapshotDelete},
+	},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: oreoctl [global options] <resource> <action> [options] [args]\n\nglobal options:\n")
+	flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, "\ncommands:\n")
+
+	resources := []string{}
+	for resource := range commands {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+
+	for _, resource := range resources {
+		actions := []string{}
+		for action := range commands[resource] {
+			actions = append(actions, action)
+		}
+		sort.Strings(actions)
+
+		for _, action := range actions {
+			fmt.Fprintf(os.Stderr, "  %s %s\n", strings.TrimSpace(resource+" "+action), commands[resource][action].usage)
+		}
+	}
+}
+
+func main() {
+	opts := globalOptions{}
+	flag.StringVar(&opts.store, "store", os.Getenv("OREO_STORE"), "mongo dsn, connect to the store directly")
+	flag.StringVar(&opts.db, "db", envDefault("OREO_DB", "oreo"), "mongo database name")
+	flag.StringVar(&opts.group, "group", os.Getenv("OREO_GROUP"), "oreo group name, required with -store")
+	flag.StringVar(&opts.endpoint, "endpoint", os.Getenv("OREO_ENDPOINT"), "oreoauth url prefix, e.g. http://127.0.0.1:8080/api")
+	flag.StringVar(&opts.token, "token", os.Getenv("OREO_TOKEN"), "bearer token of the admin, required by oreoauth with -endpoint")
+	flag.StringVar(&opts.output, "o", "table", "output format, table or json")
+	flag.DurationVar(&opts.timeout, "timeout", 10*time.Second, "store connect or http request timeout")
+	flag.Usage = usage
+	flag.Parse()
+
+	if err := run(opts, flag.Args()); err == errDenied {
+		os.Exit(2)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "oreoctl: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+func run(opts globalOptions, args []string) error {
+	if len(args) == 0 {
+		usage()
+		return fmt.Errorf("missing command")
+	}
+
+	actions, ok := commands[args[0]]
+	if !ok {
+		usage()
+		return fmt.Errorf("unknown command %s", args[0])
+	}
+
+	action, args := "", args[1:]
+	if _, ok := actions[""]; !ok {
+		if len(args) == 0 {
+			return fmt.Errorf("missing action for %s", flag.Arg(0))
+		}
+		action, args = args[0], args[1:]
+	}
+
+	cmd, ok := actions[action]
+	if !ok {
+		return fmt.Errorf("unknown action %s %s", flag.Arg(0), action)
+	}
+
+	if opts.output != "table" && opts.output != "json" {
+		return fmt.Errorf("unsupported output format %s", opts.output)
+	}
+
+	b, err := newBackend(opts)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	ctl := &ctl{
+		backend: b,
+		opts:    opts,
+		out:     newPrinter(os.Stdout, opts.output),
+		name:    strings.TrimSpace(flag.Arg(0) + " " + action),
+		usage:   cmd.usage,
+	}
+	return cmd.run(ctl, args)
+}
+
+func newBackend(opts globalOptions) (backend, error) {
+	switch {
+	case opts.store != "" && opts.endpoint != "":
+		return nil, fmt.Errorf("-store and -endpoint can not be used together")
+	case opts.store != "":
+		if opts.group == "" {
+			return nil, fmt.Errorf("-group is required with -store")
+		}
+
+		o, err := oreo.NewOreo(opts.group, true, time.Minute, opts.store, opts.db, 2, opts.timeout)
+		if err != nil {
+			return nil, err
+		}
+		return &storeBackend{oreo: o}, nil
+	case opts.endpoint != "":
+		return newHTTPBackend(opts.endpoint, opts.token, opts.timeout), nil
+	}
+
+	return nil, fmt.Errorf("-store or -endpoint is required")
+}
+
+func envDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
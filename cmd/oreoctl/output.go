@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// table格式输出给人看，json格式输出完整的数据，方便脚本处理
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+func newPrinter(w io.Writer, format string) *printer {
+	return &printer{w: w, format: format}
+}
+
+type table struct {
+	header []string
+	rows   [][]string
+	notes  []string //表格之后的说明，如下一页的游标
+}
+
+func (t *table) row(cols ...string) {
+	t.rows = append(t.rows, cols)
+}
+
+func (t *table) note(format string, args ...interface{}) {
+	t.notes = append(t.notes, fmt.Sprintf(format, args...))
+}
+
+// json格式直接输出v，table格式由fill填充表格
+func (p *printer) print(v interface{}, fill func(t *table)) error {
+	if p.format == "json" {
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	t := &table{}
+	fill(t)
+
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	if len(t.header) > 0 {
+		fmt.Fprintln(tw, strings.Join(t.header, "\t"))
+	}
+	for _, row := range t.rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, note := range t.notes {
+		fmt.Fprintln(p.w, note)
+	}
+	return nil
+}
+
+// 操作类命令的结果，json格式输出{"ok":true,"message":...}
+func (p *printer) done(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	return p.print(map[string]interface{}{"ok": true, "message": msg}, func(t *table) {
+		t.note("%s", msg)
+	})
+}
+
+func pageNotes(t *table, nextCursor string, total int) {
+	if total >= 0 {
+		t.note("total: %d", total)
+	}
+	if nextCursor != "" {
+		t.note("next cursor: %s", nextCursor)
+	}
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func join(ss []string) string {
+	if len(ss) == 0 {
+		return "-"
+	}
+	return strings.Join(ss, ",")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
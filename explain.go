@@ -0,0 +1,91 @@
+package oreo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xkeyideal/oreo/authoperate"
+)
+
+// CheckUserAuth的判断过程，用于排查为什么有权限或没有权限
+type CheckExplain struct {
+	Url       string   `json:"url"`
+	Method    string   `json:"method"`
+	UserId    string   `json:"userId"`
+	SignKey   string   `json:"signKey"`
+	Route     string   `json:"route"`     //匹配到的路由模板，为空表示没有匹配到路由
+	UserRoles []string `json:"userRoles"` //用户拥有的所有角色
+	Roles     []string `json:"roles"`     //授予该路由方法的角色
+	IsAdmin   bool     `json:"isAdmin"`   //通过超管角色获得权限，不判断数据权限
+	DataAuth  bool     `json:"dataAuth"`  //是否需要判断数据权限
+	SignOwner string   `json:"signOwner"` //signKey的创建者
+	SignVia   string   `json:"signVia"`   //数据权限的来源，owner、grant或admin，为空表示没有数据权限
+	Allowed   bool     `json:"allowed"`
+	Reason    string   `json:"reason"` //没有权限的原因
+}
+
+// 与CheckUserAuth的判断规则一致，额外返回权限来自哪些角色和数据权限的来源
+func (oreo *Oreo) ExplainCheck(url, method, userId, signKey string) (CheckExplain, error) {
+	method = strings.TrimSpace(strings.ToUpper(method))
+
+	explain := CheckExplain{
+		Url:       url,
+		Method:    method,
+		UserId:    userId,
+		SignKey:   signKey,
+		UserRoles: []string{},
+		Roles:     []string{},
+	}
+
+	rawurl, ok := oreo.route.Match(oreo.groupName, method, url)
+	if !ok {
+		explain.Reason = fmt.Sprintf("[%s %s] - 路由未匹配成功", method, url)
+		return explain, nil
+	}
+	explain.Route = rawurl
+
+	state, err := oreo.auth.PolicyStateLoad()
+	if err != nil {
+		return explain, err
+	}
+
+	explain.UserRoles = state.UserRoleNames(userId)
+	for _, rp := range state.UserRoutePermissions(userId) {
+		if rp.Uri == rawurl && rp.Method == method {
+			explain.Roles = rp.Roles
+			break
+		}
+	}
+
+	isAdmin, _, existDataAuth := state.RoleAuth(rawurl, method, userId)
+	explain.IsAdmin = isAdmin
+	explain.DataAuth = existDataAuth
+	explain.SignOwner = state.SignKeyOwner(signKey)
+
+	switch {
+	case isAdmin:
+		explain.SignVia = authoperate.SignViaAdmin
+	case explain.SignOwner == userId && userId != "":
+		explain.SignVia = authoperate.SignViaOwner
+	case state.SignAuth(signKey, rawurl, method, userId):
+		explain.SignVia = authoperate.SignViaGrant
+	}
+
+	_, explain.Allowed, explain.Reason = state.CheckAuth(rawurl, method, userId, signKey)
+
+	return explain, nil
+}
+
+// 查询存储中所有的组名，不返回组的token
+func (oreo *Oreo) ListGroups() ([]string, error) {
+	groups, err := oreo.auth.GetGroupInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, group := range groups {
+		names = append(names, group.GroupName)
+	}
+	return names, nil
+}
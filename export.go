@@ -0,0 +1,170 @@
+package oreo
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/xkeyideal/oreo/authoperate"
+)
+
+const (
+	MatrixFormatCSV  = "csv"
+	MatrixFormatJSON = "json"
+)
+
+// 权限矩阵中的一个用户，JSON格式导出时每个用户单独序列化
+type UserPermission struct {
+	UserId  string                        `json:"userId"`
+	Name    string                        `json:"name"`
+	Roles   []string                      `json:"roles"`
+	Routers []authoperate.RoutePermission `json:"routers"`
+	Signs   []authoperate.SignPermission  `json:"signs"`
+}
+
+// 导出组内所有用户的有效权限，逐个用户计算并写入w，
+// csv格式每行一个用户，每列一个路由方法，单元格为权限来源的角色
+func (oreo *Oreo) ExportPermissionMatrix(w io.Writer, format string) error {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case MatrixFormatCSV, "":
+		return oreo.exportMatrixCSV(w)
+	case MatrixFormatJSON:
+		return oreo.exportMatrixJSON(w)
+	}
+
+	return fmt.Errorf("unsupported export format: %s", format)
+}
+
+func (oreo *Oreo) exportMatrixCSV(w io.Writer) error {
+	routes, err := oreo.auth.RouterList(false)
+	if err != nil {
+		return err
+	}
+
+	columns := []string{}
+	for _, route := range routes {
+		methods := []string{}
+		for _, m := range route.Methods {
+			methods = append(methods, m.Method)
+		}
+		sort.Slice(methods, func(i, j int) bool { return methodOrder(methods[i]) < methodOrder(methods[j]) })
+		for _, method := range methods {
+			columns = append(columns, fmt.Sprintf("%s %s", method, route.Uri))
+		}
+	}
+
+	writer := csv.NewWriter(w)
+
+	header := append([]string{"userId", "name", "roles"}, columns...)
+	header = append(header, "signKeys")
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	err = oreo.auth.PolicyStateEachUser(func(state *authoperate.PolicyState, userId string) error {
+		cells := make(map[string]string)
+		for _, rp := range state.UserRoutePermissions(userId) {
+			cell := strings.Join(rp.Roles, "|")
+			if rp.DataAuth {
+				cell += " (data)"
+			}
+			cells[fmt.Sprintf("%s %s", rp.Method, rp.Uri)] = cell
+		}
+
+		row := []string{userId, state.UserName(userId), strings.Join(state.UserRoleNames(userId), "|")}
+		for _, column := range columns {
+			row = append(row, cells[column])
+		}
+		row = append(row, signCell(state.UserSignPermissions(userId)))
+
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+
+		writer.Flush()
+		return writer.Error()
+	})
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func (oreo *Oreo) exportMatrixJSON(w io.Writer) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	first := true
+	err := oreo.auth.PolicyStateEachUser(func(state *authoperate.PolicyState, userId string) error {
+		up := UserPermission{
+			UserId:  userId,
+			Name:    state.UserName(userId),
+			Roles:   state.UserRoleNames(userId),
+			Routers: state.UserRoutePermissions(userId),
+			Signs:   state.UserSignPermissions(userId),
+		}
+
+		b, err := json.Marshal(up)
+		if err != nil {
+			return err
+		}
+
+		if !first {
+			if _, err := io.WriteString(w, ",\n"); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		_, err = w.Write(b)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "]\n")
+	return err
+}
+
+// signKey授权合并到一个单元格中，例如: key1(grant): GET /a, PUT /a; key2(owner): GET /a
+func signCell(perms []authoperate.SignPermission) string {
+	keys := []string{}
+	routes := make(map[string][]string)
+	for _, sp := range perms {
+		key := fmt.Sprintf("%s(%s)", sp.SignKey, sp.Via)
+		if _, ok := routes[key]; !ok {
+			keys = append(keys, key)
+		}
+		routes[key] = append(routes[key], fmt.Sprintf("%s %s", sp.Method, sp.Uri))
+	}
+
+	sort.Strings(keys)
+
+	cells := []string{}
+	for _, key := range keys {
+		cells = append(cells, fmt.Sprintf("%s: %s", key, strings.Join(routes[key], ", ")))
+	}
+
+	return strings.Join(cells, "; ")
+}
+
+func methodOrder(method string) int {
+	switch method {
+	case "GET":
+		return 1
+	case "POST":
+		return 2
+	case "PUT":
+		return 4
+	case "DELETE":
+		return 8
+	}
+	return 16
+}
@@ -0,0 +1,152 @@
+package oreo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/xkeyideal/oreo/vestigo"
+)
+
+// 从请求中获取当前登录用户，返回空字符串表示未登录
+type IdentityExtractor func(r *http.Request) (string, error)
+
+// 从请求中获取访问数据时使用的signKey
+type SignKeyExtractor func(r *http.Request) string
+
+// 拒绝访问时的响应，status为401表示未登录，403表示没有权限
+type DenyRenderer func(w http.ResponseWriter, r *http.Request, status int, err error)
+
+type MiddlewareOptions struct {
+	Identity IdentityExtractor // 默认读取userId请求头
+	SignKey  SignKeyExtractor  // 默认读取signKey请求头
+	Deny     DenyRenderer      // 默认返回 {"code":status,"msg":err}
+}
+
+var ErrUnauthenticated = errors.New("userId is empty")
+
+type contextKey int
+
+const (
+	userIdContextKey contextKey = iota
+	isAdminContextKey
+)
+
+func HeaderIdentity(name string) IdentityExtractor {
+	return func(r *http.Request) (string, error) {
+		return strings.TrimSpace(r.Header.Get(name)), nil
+	}
+}
+
+func HeaderSignKey(name string) SignKeyExtractor {
+	return func(r *http.Request) string {
+		return strings.TrimSpace(r.Header.Get(name))
+	}
+}
+
+func JSONDeny(w http.ResponseWriter, r *http.Request, status int, err error) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"code": status,
+		"msg":  err.Error(),
+	})
+}
+
+func (opts MiddlewareOptions) withDefault() MiddlewareOptions {
+	if opts.Identity == nil {
+		opts.Identity = HeaderIdentity("userId")
+	}
+	if opts.SignKey == nil {
+		opts.SignKey = HeaderSignKey("signKey")
+	}
+	if opts.Deny == nil {
+		opts.Deny = JSONDeny
+	}
+	return opts
+}
+
+// 校验请求的路由和数据权限，通过时返回携带userId和isAdmin的请求，否则返回拒绝的状态码
+func (oreo *Oreo) AuthorizeRequest(r *http.Request, opts MiddlewareOptions) (*http.Request, int, error) {
+	opts = opts.withDefault()
+
+	userId, err := opts.Identity(r)
+	if err != nil {
+		return r, http.StatusUnauthorized, err
+	}
+	if userId == "" {
+		return r, http.StatusUnauthorized, ErrUnauthenticated
+	}
+
+	isAdmin, ok, msg := oreo.CheckUserAuth(r.URL.Path, r.Method, userId, opts.SignKey(r))
+	if !ok {
+		return r, http.StatusForbidden, errors.New(msg)
+	}
+
+	return r.WithContext(ContextWithUser(r.Context(), userId, isAdmin)), 0, nil
+}
+
+// net/http的权限中间件，chi等兼容net/http的框架可以直接使用
+func (oreo *Oreo) Middleware(opts MiddlewareOptions) func(http.Handler) http.Handler {
+	opts = opts.withDefault()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r, status, err := oreo.AuthorizeRequest(r, opts)
+			if err != nil {
+				opts.Deny(w, r, status, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ContextWithUser(ctx context.Context, userId string, isAdmin bool) context.Context {
+	ctx = context.WithValue(ctx, userIdContextKey, userId)
+	return context.WithValue(ctx, isAdminContextKey, isAdmin)
+}
+
+// 中间件校验通过后的当前登录用户
+func UserIdFromContext(ctx context.Context) string {
+	userId, _ := ctx.Value(userIdContextKey).(string)
+	return userId
+}
+
+func IsAdminFromContext(ctx context.Context) bool {
+	isAdmin, _ := ctx.Value(isAdminContextKey).(bool)
+	return isAdmin
+}
+
+type vestigoInterceptor struct {
+	oreo *Oreo
+	opts MiddlewareOptions
+}
+
+// vestigo的权限拦截器，在handler之前执行，
+// vestigo的拦截器无法替换请求，handler中无法通过UserIdFromContext获取登录用户
+func (oreo *Oreo) VestigoInterceptor(opts MiddlewareOptions) vestigo.Interceptor {
+	return &vestigoInterceptor{
+		oreo: oreo,
+		opts: opts.withDefault(),
+	}
+}
+
+func (vi *vestigoInterceptor) Before() bool {
+	return true
+}
+
+func (vi *vestigoInterceptor) After() bool {
+	return false
+}
+
+func (vi *vestigoInterceptor) Intercept(w http.ResponseWriter, r *http.Request) bool {
+	_, status, err := vi.oreo.AuthorizeRequest(r, vi.opts)
+	if err != nil {
+		vi.opts.Deny(w, r, status, err)
+		return false
+	}
+	return true
+}
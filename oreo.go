@@ -16,6 +16,7 @@ type Oreo struct {
 	mongoFactory *mongo.MongoFactory
 	route        route.RouteType
 	groupName    string
+	snapshotKeep int //保留的自动快照数量，为0时批量修改之前不自动创建快照
 	done         chan struct{}
 }
 
@@ -23,8 +24,9 @@ func NewOreo(groupName string, singleton bool, cacheInterval time.Duration,
 	mgoDsn, db string, maxOpenConn int, connTimeout time.Duration) (*Oreo, error) {
 
 	oreo := &Oreo{
-		groupName: groupName,
-		done:      make(chan struct{}),
+		groupName:    groupName,
+		snapshotKeep: defaultSnapshotKeep,
+		done:         make(chan struct{}),
 	}
 
 	mgoFactory, err := mongo.NewMongoFactory(mgoDsn, maxOpenConn, connTimeout)
@@ -60,6 +62,7 @@ func NewOreo(groupName string, singleton bool, cacheInterval time.Duration,
 
 func (oreo *Oreo) Stop() {
 	close(oreo.done)
+	oreo.auth.Close()
 	oreo.mongoFactory.Close()
 }
 
@@ -122,6 +125,35 @@ func (oreo *Oreo) PrintRoutes() {
 	oreo.route.PrintAllRoutes()
 }
 
+// 查询userId在seq之后的权限变更事件，返回事件和下一次查询的起点
+func (oreo *Oreo) QueryPermissionEvents(userId string, seq int64, limit int) ([]authoperate.PermissionEvent, int64, error) {
+	return oreo.auth.EventQuery(userId, seq, limit)
+}
+
+// 查询最新的权限变更事件序号
+func (oreo *Oreo) LastPermissionEventSeq() (int64, error) {
+	return oreo.auth.EventLastSeq()
+}
+
+// 权限变更事件只用于通知前端刷新缓存，写入失败不影响本次操作的结果
+func (oreo *Oreo) publishEvent(typ string, userIds []string, roleName, signKey, uri string) {
+	oreo.auth.EventPublish(authoperate.PermissionEvent{
+		Type:     typ,
+		UserIds:  userIds,
+		RoleName: roleName,
+		SignKey:  signKey,
+		Uri:      uri,
+	})
+}
+
+func (oreo *Oreo) publishRoleUpdate(roleName string) {
+	userIds, err := oreo.auth.RoleUserIds(roleName)
+	if err != nil {
+		return
+	}
+	oreo.publishEvent(authoperate.EventRoleUpdate, userIds, roleName, "", "")
+}
+
 /******************User********************/
 
 //获取所有用户，仅返回用户名和工号
@@ -135,7 +167,15 @@ func (oreo *Oreo) AddUser(userId, name string) error {
 		UserId: userId,
 		Name:   name,
 	}
-	return oreo.auth.UserAddInfo(info)
+	roleName, err := oreo.auth.UserAddInfo(info)
+	if err != nil {
+		return err
+	}
+
+	if roleName != "" {
+		oreo.publishEvent(authoperate.EventRoleGrant, []string{userId}, roleName, "", "")
+	}
+	return nil
 }
 
 // 判断用户是否存在
@@ -157,7 +197,12 @@ func (oreo *Oreo) GetAllSign() (map[string]string, error) {
 	return oreo.auth.GetAllUserSign()
 }
 
-// 根据Id正则查询用户信息列表
+// 查询单个用户，不存在时返回authoperate.ErrNotFound
+func (oreo *Oreo) GetUser(userId string) (authoperate.UserInfo, error) {
+	return oreo.auth.UserGetInfoOne(userId)
+}
+
+// 根据Id模糊查询用户信息列表，userId按字面匹配，不会被当作正则表达式
 func (oreo *Oreo) GetUserByIdRegex(userId string) ([]authoperate.UserInfo, error) {
 	return oreo.auth.UserGetInfoReg(userId)
 }
@@ -177,6 +222,35 @@ func (oreo *Oreo) UserOwnRoleTypes(userId string) ([]int, error) {
 	return oreo.auth.UserOwnRoleTypes(userId)
 }
 
+// 用户是否属于超管角色
+func (oreo *Oreo) IsSuperAdmin(userId string) (bool, error) {
+	types, err := oreo.auth.UserOwnRoleTypes(userId)
+	if err != nil {
+		return false, err
+	}
+
+	for _, typ := range types {
+		if typ == authoperate.SuperAdminRoleType {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// 查询signKey的创建者
+func (oreo *Oreo) SignKeyOwner(signKey string) (string, error) {
+	_, userId, err := oreo.auth.FindSignKeyOwner(signKey)
+	if err != nil {
+		return "", fmt.Errorf("signKey[%s] owner not found", signKey)
+	}
+	return userId, nil
+}
+
+// 用户是否拥有signKey在某个路由方法上的数据权限，signKey的创建者拥有全部数据权限
+func (oreo *Oreo) CheckSignAuth(signKey, url, method, userId string) bool {
+	return oreo.auth.QuerySignAuth(signKey, url, method, userId)
+}
+
 // 用户添加自己的signKey
 func (oreo *Oreo) CreateUserSignKey(userId, signDesc string) (string, error) {
 	return oreo.auth.UserCreateSignKey(userId, signDesc)
@@ -184,18 +258,34 @@ func (oreo *Oreo) CreateUserSignKey(userId, signDesc string) (string, error) {
 
 //更新用户的某个signKey的描述
 func (oreo *Oreo) UpdateUserSignKey(userId, signKey, signDesc string) error {
-	return oreo.auth.UserUpdateSignKey(userId, signKey, signDesc)
+	return oreo.UpdateUserSignKeyWithVersion(userId, signKey, signDesc, 0)
+}
+
+// 带版本号更新signKey的描述，version为用户信息的版本号，不一致时返回authoperate.ErrVersionConflict，为0时不校验
+func (oreo *Oreo) UpdateUserSignKeyWithVersion(userId, signKey, signDesc string, version int64) error {
+	return oreo.auth.UserUpdateSignKey(userId, signKey, signDesc, version)
 }
 
 // 转让某人的signKey给他人
 func (oreo *Oreo) UserTransferSignKey(signKey, signDesc, srcUserId, destUserId string) error {
-	return oreo.auth.UserTransferSignKey(signKey, signDesc, srcUserId, destUserId)
+	if err := oreo.auth.UserTransferSignKey(signKey, signDesc, srcUserId, destUserId); err != nil {
+		return err
+	}
+
+	oreo.publishEvent(authoperate.EventSignRevoke, []string{srcUserId}, "", signKey, "")
+	oreo.publishEvent(authoperate.EventSignGrant, []string{destUserId}, "", signKey, "")
+	return nil
 }
 
 /******************Role********************/
 
-// 添加角色，目前url+methodValue是一改全改，不会做merge操作的增量修改
+// 添加角色，目前url+methodValue是一改全改，不会做merge操作的增量修改，增量修改使用AppendRoleRoute和RemoveRoleRoute
 func (oreo *Oreo) AddRole(roleName, roleDesc string, roleType int, isDefault bool, urlMethod map[string]int) error {
+	return oreo.AddRoleWithVersion(roleName, roleDesc, roleType, isDefault, urlMethod, 0)
+}
+
+// 带版本号修改角色，version大于0时角色必须存在且版本号一致，否则返回authoperate.ErrVersionConflict
+func (oreo *Oreo) AddRoleWithVersion(roleName, roleDesc string, roleType int, isDefault bool, urlMethod map[string]int, version int64) error {
 	addrs := []authoperate.Address{}
 
 	for url, methodValue := range urlMethod {
@@ -211,19 +301,73 @@ func (oreo *Oreo) AddRole(roleName, roleDesc string, roleType int, isDefault boo
 		AddrList:  addrs,
 		Type:      roleType,
 		IsDefault: isDefault,
+		Version:   version,
+	}
+
+	if err := oreo.auth.RoleUpsert(roleInfo); err != nil {
+		return err
+	}
+
+	oreo.publishRoleUpdate(roleName)
+	return nil
+}
+
+// 为角色增量添加路由和方法，不会影响角色已有的路由和方法
+func (oreo *Oreo) AppendRoleRoute(roleName string, urlMethod map[string]int) error {
+	if err := oreo.auth.RoleAppendAddr(roleName, lowerUrlMethod(urlMethod)); err != nil {
+		return err
+	}
+
+	oreo.publishRoleUpdate(roleName)
+	return nil
+}
+
+// 为角色增量删除路由和方法
+func (oreo *Oreo) RemoveRoleRoute(roleName string, urlMethod map[string]int) error {
+	if err := oreo.auth.RoleRemoveAddr(roleName, lowerUrlMethod(urlMethod)); err != nil {
+		return err
 	}
 
-	return oreo.auth.RoleUpsert(roleInfo)
+	oreo.publishRoleUpdate(roleName)
+	return nil
+}
+
+func lowerUrlMethod(urlMethod map[string]int) map[string]int {
+	um := make(map[string]int, len(urlMethod))
+	for url, methodValue := range urlMethod {
+		um[strings.TrimSpace(strings.ToLower(url))] |= methodValue
+	}
+	return um
 }
 
 // 添加用户为某个角色
 func (oreo *Oreo) AddRoleUsers(roleName string, userIds []string) error {
-	return oreo.auth.RoleAddUser(roleName, userIds)
+	return oreo.AddRoleUsersWithVersion(roleName, userIds, 0)
+}
+
+// 带版本号添加角色用户，version为角色的版本号，为0时不校验
+func (oreo *Oreo) AddRoleUsersWithVersion(roleName string, userIds []string, version int64) error {
+	if err := oreo.auth.RoleAddUser(roleName, userIds, version); err != nil {
+		return err
+	}
+
+	oreo.publishEvent(authoperate.EventRoleGrant, userIds, roleName, "", "")
+	return nil
 }
 
 // 删除角色
 func (oreo *Oreo) RemoveRole(roleName string) error {
-	return oreo.auth.RoleRemove(roleName)
+	userIds, err := oreo.auth.RoleUserIds(roleName)
+	if err != nil {
+		return err
+	}
+
+	if err := oreo.auth.RoleRemove(roleName); err != nil {
+		return err
+	}
+
+	oreo.publishEvent(authoperate.EventRoleRevoke, userIds, roleName, "", "")
+	return nil
 }
 
 // 查询用户拥有的角色名称，仅返回角色名称
@@ -233,7 +377,17 @@ func (oreo *Oreo) UserOwnRolenames(userId string) ([]string, error) {
 
 // 删除角色中的用户
 func (oreo *Oreo) RemoveRoleUsers(roleName string, userIds []string) error {
-	return oreo.auth.RoleRemoveUser(roleName, userIds)
+	return oreo.RemoveRoleUsersWithVersion(roleName, userIds, 0)
+}
+
+// 带版本号删除角色用户，version为角色的版本号，为0时不校验
+func (oreo *Oreo) RemoveRoleUsersWithVersion(roleName string, userIds []string, version int64) error {
+	if err := oreo.auth.RoleRemoveUser(roleName, userIds, version); err != nil {
+		return err
+	}
+
+	oreo.publishEvent(authoperate.EventRoleRevoke, userIds, roleName, "", "")
+	return nil
 }
 
 // 角色拥有的路由和方法与全局路由和方法的diff
@@ -248,12 +402,32 @@ func (oreo *Oreo) GetRoleList(roleName string) ([]authoperate.RoleListView, erro
 
 // 设置默认角色
 func (oreo *Oreo) SetDefaultRole(roleName string) error {
-	return oreo.auth.RoleSetDefault(roleName)
+	if err := oreo.auth.RoleSetDefault(roleName); err != nil {
+		return err
+	}
+
+	oreo.publishEvent(authoperate.EventDefaultRole, []string{authoperate.EventAllUsers}, roleName, "", "")
+	return nil
 }
 
 // 更新角色的类型
 func (oreo *Oreo) UpdateRoleTypeDesc(roleName string, roleDesc string, roleType int) error {
-	return oreo.auth.RoleUpdateTypeDesc(roleName, roleDesc, roleType)
+	return oreo.UpdateRoleTypeDescWithVersion(roleName, roleDesc, roleType, 0)
+}
+
+// 带版本号更新角色的类型，version为角色的版本号，为0时不校验
+func (oreo *Oreo) UpdateRoleTypeDescWithVersion(roleName string, roleDesc string, roleType int, version int64) error {
+	if err := oreo.auth.RoleUpdateTypeDesc(roleName, roleDesc, roleType, version); err != nil {
+		return err
+	}
+
+	oreo.publishRoleUpdate(roleName)
+	return nil
+}
+
+// 设置角色的标签，version大于0时要求与角色当前的版本号一致
+func (oreo *Oreo) SetRoleTags(roleName string, tags []string, version int64) error {
+	return oreo.auth.RoleSetTags(roleName, tags, version)
 }
 
 /******************Route********************/
@@ -263,37 +437,90 @@ func (oreo *Oreo) AddRoute(routes []route.RouteData) error {
 	return oreo.route.AddRoute(oreo.groupName, routes)
 }
 
+// 从OpenAPI文档导入路由，与已有路由冲突的路由不会导入，在返回值的Conflicts中列出，dryRun为true时只解析不入库
+func (oreo *Oreo) ImportOpenAPI(data []byte, basePath string, dryRun bool) (route.OpenAPIImport, error) {
+	_, urls, err := oreo.auth.RouterGetInfoAndUrls()
+	if err != nil {
+		return route.OpenAPIImport{}, err
+	}
+
+	res, err := route.ParseOpenAPI(data, basePath, urls)
+	if err != nil {
+		return res, err
+	}
+
+	if dryRun || len(res.Routes) == 0 {
+		return res, nil
+	}
+
+	if err := oreo.autoSnapshot("before import openapi"); err != nil {
+		return res, err
+	}
+
+	return res, oreo.route.AddRoute(oreo.groupName, res.Routes)
+}
+
 // 更新路由的描述信息
 func (oreo *Oreo) UpdateRouteDesc(url, desc string) error {
+	return oreo.UpdateRouteDescWithVersion(url, desc, 0)
+}
+
+// 带版本号更新路由的描述信息，version为路由的版本号，为0时不校验
+func (oreo *Oreo) UpdateRouteDescWithVersion(url, desc string, version int64) error {
 	url = strings.ToLower(strings.TrimSpace(url))
-	return oreo.auth.RouterUpdateUriDesc(url, desc)
+	return oreo.auth.RouterUpdateUriDesc(url, desc, version)
 }
 
 // 更新路由下Method的描述信息
 func (oreo *Oreo) UpdateRouteMethodDesc(url, method, desc string) error {
+	return oreo.UpdateRouteMethodDescWithVersion(url, method, desc, 0)
+}
+
+// 带版本号更新路由下Method的描述信息，version为路由的版本号，为0时不校验
+func (oreo *Oreo) UpdateRouteMethodDescWithVersion(url, method, desc string, version int64) error {
 	url = strings.ToLower(strings.TrimSpace(url))
 	method = strings.ToUpper(strings.TrimSpace(method))
-	return oreo.auth.RouterUpdateMethodDesc(url, method, desc)
+	return oreo.auth.RouterUpdateMethodDesc(url, method, desc, version)
 }
 
 // url + method 启用数据权限
 func (oreo *Oreo) EnableRouteDataAuth(url, method string) error {
-	return oreo.route.EnableRouteDataAuth(oreo.groupName, url, method)
+	if err := oreo.route.EnableRouteDataAuth(oreo.groupName, url, method); err != nil {
+		return err
+	}
+
+	oreo.publishEvent(authoperate.EventRouteUpdate, []string{authoperate.EventAllUsers}, "", "", url)
+	return nil
 }
 
 // url + method 停用数据权限
 func (oreo *Oreo) DisableRouteDataAuth(url, method string) error {
-	return oreo.route.DisableRouteDataAuth(oreo.groupName, url, method)
+	if err := oreo.route.DisableRouteDataAuth(oreo.groupName, url, method); err != nil {
+		return err
+	}
+
+	oreo.publishEvent(authoperate.EventRouteUpdate, []string{authoperate.EventAllUsers}, "", "", url)
+	return nil
 }
 
 //删除一个路由和method
 func (oreo *Oreo) DeleteRouteByMethod(url, method string) error {
-	return oreo.route.DeleteRouteByMethod(oreo.groupName, url, method)
+	if err := oreo.route.DeleteRouteByMethod(oreo.groupName, url, method); err != nil {
+		return err
+	}
+
+	oreo.publishEvent(authoperate.EventRouteUpdate, []string{authoperate.EventAllUsers}, "", "", url)
+	return nil
 }
 
 // 删除路由
 func (oreo *Oreo) DeleteRoute(url string) error {
-	return oreo.route.DeleteRoute(oreo.groupName, url)
+	if err := oreo.route.DeleteRoute(oreo.groupName, url); err != nil {
+		return err
+	}
+
+	oreo.publishEvent(authoperate.EventRouteUpdate, []string{authoperate.EventAllUsers}, "", "", url)
+	return nil
 }
 
 // 查询路由列表
@@ -307,7 +534,7 @@ func (oreo *Oreo) GetRouteByUrl(url string) (authoperate.RouteListView, error) {
 	return oreo.auth.RouterInfoByUri(url)
 }
 
-// 根据url正则查询路由信息
+// 根据url模糊查询路由信息，url按字面匹配，不会被当作正则表达式
 func (oreo *Oreo) GetRouteByUrlRegex(url string) ([]authoperate.RouteListView, error) {
 	url = strings.ToLower(strings.TrimSpace(url))
 	return oreo.auth.RouterGetInfoReg(url)
@@ -322,7 +549,11 @@ func (oreo *Oreo) GetDataAuthRoutes() ([]authoperate.RouteListView, error) {
 
 // 添加Sign，目前url+methodValue是一改全改，不会做merge操作的增量更新
 func (oreo *Oreo) AddSign(signKey, userId string, urlMethod map[string]int) error {
+	return oreo.AddSignWithVersion(signKey, userId, urlMethod, 0)
+}
 
+// 带版本号修改Sign，version大于0时授权必须存在且版本号一致，否则返回authoperate.ErrVersionConflict
+func (oreo *Oreo) AddSignWithVersion(signKey, userId string, urlMethod map[string]int, version int64) error {
 	addrs := []authoperate.Address{}
 
 	for url, methodValue := range urlMethod {
@@ -336,14 +567,25 @@ func (oreo *Oreo) AddSign(signKey, userId string, urlMethod map[string]int) erro
 		SignKey:  signKey,
 		UserId:   userId,
 		AddrList: addrs,
+		Version:  version,
+	}
+
+	if err := oreo.auth.SignUpsert(signInfo); err != nil {
+		return err
 	}
 
-	return oreo.auth.SignUpsert(signInfo)
+	oreo.publishEvent(authoperate.EventSignGrant, []string{userId}, "", signKey, "")
+	return nil
 }
 
 // 删除Sign
 func (oreo *Oreo) RemoveSign(signKey, userId string) error {
-	return oreo.auth.SignRemove(signKey, userId)
+	if err := oreo.auth.SignRemove(signKey, userId); err != nil {
+		return err
+	}
+
+	oreo.publishEvent(authoperate.EventSignRevoke, []string{userId}, "", signKey, "")
+	return nil
 }
 
 // 通过signKey查询sign信息
@@ -353,20 +595,64 @@ func (oreo *Oreo) GetSignByKey(signKey string) (authoperate.SignListView, error)
 
 // 复制sign
 func (oreo *Oreo) CopyUserSign(signKey, srcUserId string, destUserIds []string) error {
-	return oreo.auth.SignCopy(signKey, srcUserId, destUserIds)
+	if err := oreo.auth.SignCopy(signKey, srcUserId, destUserIds); err != nil {
+		return err
+	}
+
+	oreo.publishEvent(authoperate.EventSignGrant, destUserIds, "", signKey, "")
+	return nil
 }
 
 // 为批量用户新增数据权限的url和method
 func (oreo *Oreo) AppendUserSign(signKey string, userIds []string, urlMethod map[string]int) error {
-	return oreo.auth.SignPatchVerifyData(signKey, userIds, urlMethod)
+	if err := oreo.auth.SignPatchVerifyData(signKey, userIds, urlMethod); err != nil {
+		return err
+	}
+
+	oreo.publishEvent(authoperate.EventSignGrant, userIds, "", signKey, "")
+	return nil
 }
 
 // 为批量用户删除数据权限的url和method
 func (oreo *Oreo) RemoveUserSign(signKey string, userIds []string, urlMethod map[string]int) error {
-	return oreo.auth.SignRemoveVerifyData(signKey, userIds, urlMethod)
+	if err := oreo.auth.SignRemoveVerifyData(signKey, userIds, urlMethod); err != nil {
+		return err
+	}
+
+	oreo.publishEvent(authoperate.EventSignRevoke, userIds, "", signKey, "")
+	return nil
 }
 
 // 单个用户拥有的某个signKey包含的路由和方法与全局开启数据权限的路由和方法的diff
 func (oreo *Oreo) UserSignDiffGlobal(signKey, userId string) ([]authoperate.RouteListView, error) {
 	return oreo.auth.SignDiffGlobalDataAuthRoute(signKey, userId)
 }
+
+/******************Access********************/
+
+// 查询哪些用户拥有url+method的路由权限，url可以是路由模板也可以是实际请求的url
+func (oreo *Oreo) RouteAccessUsers(url, method string) ([]authoperate.RouteAccessUser, error) {
+	method = strings.TrimSpace(strings.ToUpper(method))
+
+	rawurl, ok := oreo.route.Match(oreo.groupName, method, url)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("[%s %s] - 路由未匹配成功", method, url))
+	}
+
+	state, err := oreo.auth.PolicyStateLoad()
+	if err != nil {
+		return nil, err
+	}
+
+	return state.RouteAccess(rawurl, method), nil
+}
+
+// 查询哪些用户能够访问signKey下的数据，以及能通过哪些路由和方法访问
+func (oreo *Oreo) SignKeyAccessUsers(signKey string) ([]authoperate.SignAccessUser, error) {
+	state, err := oreo.auth.PolicyStateLoad()
+	if err != nil {
+		return nil, err
+	}
+
+	return state.SignKeyAccess(signKey), nil
+}
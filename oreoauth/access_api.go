@@ -0,0 +1,36 @@
+package oreoauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func routeAccessUsers(c *gin.Context) {
+	url := strings.TrimSpace(c.Query("url"))
+	method := strings.TrimSpace(c.Query("method"))
+
+	users, err := LibraOreoAuth.RouteAccessUsers(url, method)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+		return
+	}
+
+	res, _ := json.Marshal(users)
+	setStrResp(http.StatusOK, 0, "OK", string(res), c)
+}
+
+func signAccessUsers(c *gin.Context) {
+	signKey := strings.TrimSpace(c.Query("signKey"))
+
+	users, err := LibraOreoAuth.SignKeyAccessUsers(signKey)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+		return
+	}
+
+	res, _ := json.Marshal(users)
+	setStrResp(http.StatusOK, 0, "OK", string(res), c)
+}
@@ -31,6 +31,11 @@ func DiffOreoProjectRoutes(projectRoutes map[string][]string) (ProjectRoute, err
 		return ProjectRoute{}, err
 	}
 
+	return diffProjectRoutes(oreoRoutes, projectRoutes), nil
+}
+
+// 比较数据库中的路由与项目的路由
+func diffProjectRoutes(oreoRoutes []authoperate.RouteListView, projectRoutes map[string][]string) ProjectRoute {
 	entryRoutes := []authoperate.RouteListView{}
 	illegalRoutes := []authoperate.RouteListView{}
 	uriSet := make(map[string]string)
@@ -114,7 +119,7 @@ func DiffOreoProjectRoutes(projectRoutes map[string][]string) (ProjectRoute, err
 		ExportRoutes:  exportRoutes,
 	}
 
-	return projectRoute, nil
+	return projectRoute
 }
 
 func Start(groupName string, singleTon bool, cacheInterval time.Duration, mgoUrl, database string) {
@@ -0,0 +1,33 @@
+package oreoauth
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed console
+var consoleAssets embed.FS
+
+// 注册管理后台的静态页面，{prefix}/oreo/auth/console/，页面只调用{prefix}/oreo/auth/v2的管理api，
+// 因此需要同时注册OreoAuthRouterV2。页面本身不包含权限数据，管理权限仍由v2接口校验，
+// mw可以用来限制谁能打开页面
+func OreoAuthConsole(router *gin.Engine, prefix string, mw ...gin.HandlerFunc) {
+	assets, err := fs.Sub(consoleAssets, "console")
+	if err != nil {
+		panic(err)
+	}
+
+	base := fmt.Sprintf("%s/oreo/auth/console", prefix)
+
+	group := router.Group(base, mw...)
+	{
+		group.GET("", func(c *gin.Context) {
+			c.Redirect(http.StatusMovedPermanently, base+"/")
+		})
+		group.StaticFS("/", http.FS(assets))
+	}
+}
@@ -0,0 +1,628 @@
+// oreo管理后台，只调用oreoauth的v2管理api，登录用户由v2接口的登录中间件根据token或cookie识别，管理权限由接口校验
+(function () {
+  'use strict';
+
+  // 页面地址为{prefix}/oreo/auth/console/，管理api为{prefix}/oreo/auth/v2
+  var API = location.pathname.replace(/\/console(\/.*)?$/, '/v2');
+  var METHODS = ['GET', 'POST', 'PUT', 'DELETE'];
+
+  var view = document.getElementById('view');
+  var errorBox = document.getElementById('error');
+  var identityForm = document.getElementById('identity');
+
+  /******************请求********************/
+
+  function token() {
+    return sessionStorage.getItem('oreo.token') || '';
+  }
+
+  function query(params) {
+    var q = [];
+    Object.keys(params || {}).forEach(function (k) {
+      var v = params[k];
+      if (v !== undefined && v !== null && v !== '' && v !== false) {
+        q.push(encodeURIComponent(k) + '=' + encodeURIComponent(v));
+      }
+    });
+    return q.length ? '?' + q.join('&') : '';
+  }
+
+  // 请求成功时返回解析后的JSON，204返回null，失败时抛出v2统一格式的错误信息
+  function api(method, path, params, body) {
+    var headers = {};
+    if (token()) {
+      headers.Authorization = 'Bearer ' + token();
+    }
+    if (body !== undefined) {
+      headers['Content-Type'] = 'application/json';
+    }
+
+    return fetch(API + path + query(params), {
+      method: method,
+      headers: headers,
+      credentials: 'same-origin',
+      body: body === undefined ? undefined : JSON.stringify(body)
+    }).then(function (resp) {
+      return resp.text().then(function (text) {
+        var data = text ? JSON.parse(text) : null;
+        if (!resp.ok) {
+          var e = (data && data.error) || {code: String(resp.status), message: resp.statusText};
+          var msg = e.code + ': ' + e.message;
+          (e.details || []).forEach(function (d) {
+            msg += '\n  ' + d.field + ': ' + d.reason;
+          });
+          throw new Error(msg);
+        }
+        return data;
+      });
+    });
+  }
+
+  function showError(err) {
+    errorBox.textContent = err ? String(err.message || err) : '';
+    errorBox.hidden = !err;
+  }
+
+  /******************DOM********************/
+
+  // 创建元素，文本一律通过textContent写入
+  function h(tag, attrs) {
+    var el = document.createElement(tag);
+    Object.keys(attrs || {}).forEach(function (k) {
+      var v = attrs[k];
+      if (k.indexOf('on') === 0) {
+        el.addEventListener(k.slice(2), v);
+      } else if (k === 'class') {
+        el.className = v;
+      } else if (k in el) {
+        el[k] = v;
+      } else {
+        el.setAttribute(k, v);
+      }
+    });
+    for (var i = 2; i < arguments.length; i++) {
+      append(el, arguments[i]);
+    }
+    return el;
+  }
+
+  function append(el, child) {
+    if (child === undefined || child === null || child === false) {
+      return;
+    }
+    if (Array.isArray(child)) {
+      child.forEach(function (c) { append(el, c); });
+      return;
+    }
+    el.appendChild(child instanceof Node ? child : document.createTextNode(String(child)));
+  }
+
+  function clear(el) {
+    while (el.firstChild) {
+      el.removeChild(el.firstChild);
+    }
+    return el;
+  }
+
+  function dash(s) {
+    return s === undefined || s === null || s === '' ? '-' : s;
+  }
+
+  function tags(list) {
+    return (list || []).map(function (t) { return h('span', {class: 'tag'}, t); });
+  }
+
+  // rows为单元格数组，onclick不为空时整行可点击
+  function table(headers, rows, onclick) {
+    return h('table', {},
+      h('thead', {}, h('tr', {}, headers.map(function (t) { return h('th', {}, t); }))),
+      h('tbody', {}, rows.length === 0
+        ? h('tr', {}, h('td', {colSpan: headers.length, class: 'muted'}, '没有数据'))
+        : rows.map(function (row, i) {
+          var tr = h('tr', onclick ? {class: 'link'} : {}, row.map(function (cell) { return h('td', {}, cell); }));
+          if (onclick) {
+            tr.addEventListener('click', function () {
+              Array.prototype.forEach.call(tr.parentNode.children, function (r) { r.classList.remove('selected'); });
+              tr.classList.add('selected');
+              onclick(i);
+            });
+          }
+          return tr;
+        })));
+  }
+
+  function dl(items) {
+    return h('dl', {}, items.map(function (item) {
+      return [h('dt', {}, item[0]), h('dd', {}, item[1])];
+    }));
+  }
+
+  function button(text, onclick) {
+    return h('button', {type: 'button', onclick: function () { run(onclick); }}, text);
+  }
+
+  // 执行操作并显示错误
+  function run(fn) {
+    showError(null);
+    Promise.resolve().then(fn).catch(showError);
+  }
+
+  // 解析每行一个的url=GET,POST
+  function parseRoutes(text) {
+    var routes = {};
+    text.split('\n').forEach(function (line) {
+      line = line.trim();
+      if (!line) {
+        return;
+      }
+      var i = line.indexOf('=');
+      if (i <= 0) {
+        throw new Error('invalid route ' + line + ', must be url=GET,POST');
+      }
+      var url = line.slice(0, i).trim().toLowerCase();
+      routes[url] = (routes[url] || []).concat(line.slice(i + 1).split(',').map(function (m) {
+        return m.trim().toUpperCase();
+      }));
+    });
+    return routes;
+  }
+
+  function routeMethods(methods) {
+    return tags((methods || []).map(function (m) { return m.enable ? m.method + '*' : m.method; }));
+  }
+
+  function roleRouteMethods(methods) {
+    return (methods || []).map(function (m) {
+      return h('span', {class: m.isDelete ? 'tag deleted' : 'tag'}, m.method);
+    });
+  }
+
+  // 带游标分页的列表，load(cursor)返回page，render(page)返回列表元素
+  function pager(container, load, render) {
+    var cursors = [''];
+
+    function show() {
+      return load(cursors[cursors.length - 1]).then(function (page) {
+        clear(container).appendChild(render(page));
+        var bar = h('div', {class: 'toolbar'});
+        if (page.total >= 0) {
+          bar.appendChild(h('span', {class: 'muted'}, '共 ' + page.total + ' 条'));
+        }
+        if (cursors.length > 1) {
+          bar.appendChild(button('上一页', function () { cursors.pop(); return show(); }));
+        }
+        if (page.nextCursor) {
+          bar.appendChild(button('下一页', function () { cursors.push(page.nextCursor); return show(); }));
+        }
+        container.appendChild(bar);
+      });
+    }
+
+    return function reset() {
+      cursors = [''];
+      return show();
+    };
+  }
+
+  /******************路由********************/
+
+  function routesView() {
+    var prefix = h('input', {placeholder: 'uri前缀'});
+    var dataAuth = h('input', {type: 'checkbox'});
+    var keyword = h('input', {placeholder: '搜索uri或描述'});
+    var list = h('div');
+
+    function render(routes) {
+      return table(['uri', '方法(*为数据权限)', '描述', '版本'], routes.map(function (r) {
+        return [r.uri, routeMethods(r.methods), dash(r.desc), r.version];
+      }));
+    }
+
+    var reload = pager(list, function (cursor) {
+      return api('GET', '/routes', {prefix: prefix.value, dataAuth: dataAuth.checked, cursor: cursor, total: true});
+    }, function (page) {
+      return render(page.routes || []);
+    });
+
+    function search() {
+      if (!keyword.value.trim()) {
+        return reload();
+      }
+      return api('GET', '/search/routes', {q: keyword.value}).then(function (routes) {
+        clear(list).appendChild(render(routes || []));
+      });
+    }
+
+    append(view, [
+      h('div', {class: 'toolbar'}, prefix, h('label', {}, dataAuth, '只看数据权限'), button('筛选', reload),
+        keyword, button('搜索', search)),
+      list
+    ]);
+    run(reload);
+  }
+
+  /******************角色********************/
+
+  function rolesView() {
+    var prefix = h('input', {placeholder: '角色名前缀'});
+    var tag = h('input', {placeholder: '标签'});
+    var list = h('div');
+    var detail = h('div');
+
+    var reload = pager(list, function (cursor) {
+      return api('GET', '/roles', {prefix: prefix.value, tag: tag.value, cursor: cursor});
+    }, function (page) {
+      var roles = page.roles || [];
+      return table(['角色', '类型', '默认', '标签'], roles.map(function (r) {
+        return [r.roleName, r.type === 1 ? '超管' : r.type, r.isDefault ? '是' : '', tags(r.tags)];
+      }), function (i) {
+        run(function () { return roleDetail(detail, roles[i].roleName); });
+      });
+    });
+
+    append(view, [
+      h('div', {class: 'toolbar'}, prefix, tag, button('筛选', reload)),
+      h('div', {class: 'cols'}, list, detail)
+    ]);
+    run(reload);
+  }
+
+  // 与RoleRouteDiff一致，已拥有的方法勾选，未拥有的方法不勾选，保存时只提交变化的部分
+  function roleDetail(detail, roleName) {
+    var path = '/roles/' + encodeURIComponent(roleName);
+
+    return Promise.all([api('GET', path), api('GET', path + '/routes')]).then(function (res) {
+      var role = res[0];
+      var diff = res[1] || [];
+
+      var routes = {};
+      function route(uri, desc) {
+        routes[uri] = routes[uri] || {uri: uri, desc: desc, methods: {}};
+        return routes[uri];
+      }
+      (role.routers || []).forEach(function (r) {
+        var rt = route(r.uri, r.uriDesc);
+        rt.deleted = r.isDelete;
+        (r.methods || []).forEach(function (m) {
+          rt.methods[m.method] = {held: true, deleted: m.isDelete};
+        });
+      });
+      diff.forEach(function (r) {
+        var rt = route(r.uri, r.desc);
+        (r.methods || []).forEach(function (m) {
+          if (!rt.methods[m.method]) {
+            rt.methods[m.method] = {held: false};
+          }
+        });
+      });
+
+      var boxes = [];
+      var rows = Object.keys(routes).sort().map(function (uri) {
+        var rt = routes[uri];
+        return [h('span', {class: rt.deleted ? 'deleted' : ''}, uri), dash(rt.desc)].concat(METHODS.map(function (method) {
+          var m = rt.methods[method];
+          if (!m) {
+            return '';
+          }
+          var box = h('input', {type: 'checkbox', checked: m.held, title: m.deleted ? '路由方法已删除' : method});
+          boxes.push({uri: uri, method: method, held: m.held, box: box});
+          return box;
+        }));
+      });
+
+      function save() {
+        var patch = {add: {}, remove: {}};
+        boxes.forEach(function (b) {
+          if (b.box.checked !== b.held) {
+            var side = b.box.checked ? patch.add : patch.remove;
+            side[b.uri] = (side[b.uri] || []).concat(b.method);
+          }
+        });
+        if (!Object.keys(patch.add).length && !Object.keys(patch.remove).length) {
+          throw new Error('没有修改');
+        }
+        return api('PATCH', path + '/routes', null, patch).then(function () {
+          return roleDetail(detail, roleName);
+        });
+      }
+
+      var userId = h('input', {placeholder: 'userId，多个用逗号分隔'});
+
+      function addUsers() {
+        var userIds = userId.value.split(',').map(function (s) { return s.trim(); }).filter(Boolean);
+        return api('POST', path + '/users', null, {userIds: userIds}).then(function () {
+          return roleDetail(detail, roleName);
+        });
+      }
+
+      function removeUser(u) {
+        return function () {
+          return api('DELETE', path + '/users/' + encodeURIComponent(u.userId)).then(function () {
+            return roleDetail(detail, roleName);
+          });
+        };
+      }
+
+      clear(detail);
+      append(detail, [
+        h('h2', {}, role.roleName),
+        dl([
+          ['描述', dash(role.desc)],
+          ['类型', role.type === 1 ? '超管，拥有所有路由权限' : String(role.type)],
+          ['默认角色', role.isDefault ? '是' : '否'],
+          ['标签', tags(role.tags)],
+          ['版本', String(role.version)]
+        ]),
+        h('h3', {}, '路由权限'),
+        table(['uri', '描述'].concat(METHODS), rows),
+        button('保存路由权限', save),
+        h('h3', {}, '用户'),
+        table(['userId', '姓名', ''], (role.users || []).map(function (u) {
+          return [u.userId, dash(u.name), button('移除', removeUser(u))];
+        })),
+        h('div', {class: 'toolbar'}, userId, button('添加用户', addUsers))
+      ]);
+    });
+  }
+
+  /******************用户********************/
+
+  function usersView() {
+    var prefix = h('input', {placeholder: 'userId前缀'});
+    var keyword = h('input', {placeholder: '搜索userId或姓名'});
+    var list = h('div');
+    var detail = h('div');
+
+    function render(users) {
+      return table(['userId', '姓名'], users.map(function (u) {
+        return [u.userId, dash(u.name)];
+      }), function (i) {
+        run(function () { return userDetail(detail, users[i].userId); });
+      });
+    }
+
+    var reload = pager(list, function (cursor) {
+      return api('GET', '/users', {prefix: prefix.value, cursor: cursor});
+    }, function (page) {
+      return render(page.users || []);
+    });
+
+    function search() {
+      if (!keyword.value.trim()) {
+        return reload();
+      }
+      return api('GET', '/search/users', {q: keyword.value}).then(function (users) {
+        clear(list).appendChild(render(users || []));
+      });
+    }
+
+    append(view, [
+      h('div', {class: 'toolbar'}, prefix, button('筛选', reload), keyword, button('搜索', search)),
+      h('div', {class: 'cols'}, list, detail)
+    ]);
+    run(reload);
+  }
+
+  function userDetail(detail, userId) {
+    var path = '/users/' + encodeURIComponent(userId);
+
+    return Promise.all([api('GET', path), api('GET', path + '/roles'), api('GET', path + '/signs')]).then(function (res) {
+      var user = res[0];
+      var roles = res[1] || [];
+      var signs = res[2] || {};
+
+      var other = h('input', {placeholder: '对比的userId'});
+      var diffBox = h('div');
+
+      function compare() {
+        return api('GET', path + '/diff', {with: other.value.trim()}).then(function (diff) {
+          var rows = [];
+          [[diff.userId, diff.onlyRoles, diff.onlyRouters, diff.onlySignGrants],
+            [diff.otherUserId, diff.otherOnlyRoles, diff.otherOnlyRouters, diff.otherOnlySignGrants]].forEach(function (side) {
+            (side[1] || []).forEach(function (r) { rows.push([side[0], '角色', r]); });
+            (side[2] || []).forEach(function (r) { rows.push([side[0], '路由', r.method + ' ' + r.uri]); });
+            (side[3] || []).forEach(function (g) { rows.push([side[0], 'signKey', g.signKey]); });
+          });
+          clear(diffBox).appendChild(table(['只有', '类型', '权限'], rows));
+        });
+      }
+
+      clear(detail);
+      append(detail, [
+        h('h2', {}, user.userId + ' ' + (user.name || '')),
+        h('h3', {}, '角色'),
+        table(['角色', '路由'], roles.map(function (r) {
+          return [r.roleName, r.type === 1 ? '超管' : String((r.routers || []).length)];
+        })),
+        h('h3', {}, '创建的signKey'),
+        table(['signKey', '描述'], (signs.ownSigns || []).map(function (s) {
+          return [s.signKey, dash(s.desc)];
+        })),
+        h('h3', {}, '被授权的signKey'),
+        table(['signKey', '创建者', '路由'], (signs.grantSigns || []).map(function (s) {
+          return [s.signKey, s.ownUser + ' ' + (s.ownName || ''), (s.routers || []).map(function (r) {
+            return h('div', {}, r.uri, ' ', roleRouteMethods(r.methods));
+          })];
+        })),
+        h('h3', {}, '权限对比'),
+        h('div', {class: 'toolbar'}, other, button('对比', compare)),
+        diffBox
+      ]);
+    });
+  }
+
+  /******************signKey********************/
+
+  function signsView() {
+    var prefix = h('input', {placeholder: 'signKey前缀'});
+    var list = h('div');
+    var detail = h('div');
+
+    var reload = pager(list, function (cursor) {
+      return api('GET', '/signs', {prefix: prefix.value, cursor: cursor});
+    }, function (page) {
+      var signs = page.signs || [];
+      return table(['signKey', '创建者', '描述'], signs.map(function (s) {
+        return [s.signKey, s.userId, dash(s.desc)];
+      }), function (i) {
+        run(function () { return signDetail(detail, signs[i].signKey); });
+      });
+    });
+
+    append(view, [
+      h('div', {class: 'toolbar'}, prefix, button('筛选', reload)),
+      h('div', {class: 'cols'}, list, detail)
+    ]);
+    run(reload);
+  }
+
+  function signDetail(detail, signKey) {
+    var path = '/signs/' + encodeURIComponent(signKey);
+
+    return api('GET', path).then(function (sign) {
+      var views = sign.signViews || [];
+      var userId = h('input', {placeholder: '被授权的userId'});
+      var routes = h('textarea', {placeholder: '每行一个 url=GET,POST'});
+
+      function revoke(v) {
+        return function () {
+          return api('DELETE', path + '/grants/' + encodeURIComponent(v.userId)).then(function () {
+            return signDetail(detail, signKey);
+          });
+        };
+      }
+
+      // 已授权的用户追加路由，未授权的用户新增授权
+      function grant() {
+        var uid = userId.value.trim();
+        var rm = parseRoutes(routes.value);
+        var granted = views.some(function (v) { return v.userId === uid; });
+        var req = granted
+          ? api('PATCH', path + '/grants', null, {userIds: [uid], add: rm})
+          : api('PUT', path + '/grants/' + encodeURIComponent(uid), null, {urlMethods: rm});
+        return req.then(function () {
+          return signDetail(detail, signKey);
+        });
+      }
+
+      clear(detail);
+      append(detail, [
+        h('h2', {}, sign.signKey),
+        dl([['创建者', dash(sign.ownerId) + ' ' + (sign.name || '')]]),
+        h('h3', {}, '被授权的用户'),
+        table(['userId', '姓名', '路由', ''], views.map(function (v) {
+          return [v.userId, dash(v.name), (v.routers || []).map(function (r) {
+            return h('div', {}, r.uri, ' ', roleRouteMethods(r.methods));
+          }), button('收回', revoke(v))];
+        })),
+        h('h3', {}, '授权'),
+        h('div', {class: 'toolbar'}, userId, button('授权', grant)),
+        routes
+      ]);
+    });
+  }
+
+  /******************权限解释********************/
+
+  function checkView() {
+    var url = h('input', {placeholder: '/api/orders/1'});
+    var method = h('select', {}, METHODS.map(function (m) { return h('option', {value: m}, m); }));
+    var userId = h('input', {placeholder: 'userId'});
+    var signKey = h('input', {placeholder: 'signKey，可以不填'});
+    var result = h('div');
+
+    function check() {
+      return api('GET', '/check', {url: url.value.trim(), method: method.value, userId: userId.value.trim(), signKey: signKey.value.trim()}).then(function (e) {
+        clear(result).appendChild(dl([
+          ['结果', h('span', {class: e.allowed ? 'allow' : 'deny'}, e.allowed ? '允许' : '拒绝')],
+          ['原因', dash(e.reason)],
+          ['匹配的路由', dash(e.route)],
+          ['用户的角色', tags(e.userRoles)],
+          ['授权的角色', tags(e.roles)],
+          ['超管', e.isAdmin ? '是' : '否'],
+          ['数据权限', e.dataAuth ? '需要' : '不需要'],
+          ['signKey创建者', dash(e.signOwner)],
+          ['数据权限来源', dash(e.signVia)]
+        ]));
+      });
+    }
+
+    append(view, [h('div', {class: 'toolbar'}, method, url, userId, signKey, button('解释', check)), result]);
+  }
+
+  /******************变更模拟********************/
+
+  var simulateExample = {
+    changes: [{type: 'role_remove_user', roleName: 'developer', userIds: ['u1']}],
+    records: []
+  };
+
+  function simulateView() {
+    var input = h('textarea', {value: JSON.stringify(simulateExample, null, 2)});
+    var result = h('div');
+
+    function simulate() {
+      var body;
+      try {
+        body = JSON.parse(input.value);
+      } catch (e) {
+        throw new Error('invalid json: ' + e.message);
+      }
+      return api('POST', '/simulate', null, body).then(function (res) {
+        clear(result);
+        append(result, [
+          h('h3', {}, '受影响的权限'),
+          table(['userId', '姓名', '方法', 'uri', 'signKey', '变化'], (res.diffs || []).map(function (d) {
+            return [d.userId, dash(d.name), d.method, d.uri, dash(d.signKey),
+              h('span', {class: d.gain ? 'allow' : 'deny'}, d.gain ? '获得' : '失去')];
+          })),
+          h('h3', {}, '结果变化的校验记录'),
+          table(['行', '记录', '变更前', '变更后', '原因'], (res.flips || []).map(function (f) {
+            return [f.line, JSON.stringify(f.record), f.before ? '允许' : '拒绝', f.after ? '允许' : '拒绝', dash(f.reason)];
+          }))
+        ]);
+      });
+    }
+
+    append(view, [
+      h('p', {class: 'muted'}, '模拟权限变更，不会写入数据。changes的格式与v1的/simulate一致。'),
+      input,
+      h('div', {class: 'toolbar'}, button('模拟', simulate)),
+      result
+    ]);
+  }
+
+  /******************入口********************/
+
+  var views = {
+    routes: routesView,
+    roles: rolesView,
+    users: usersView,
+    signs: signsView,
+    check: checkView,
+    simulate: simulateView
+  };
+
+  function route() {
+    var name = location.hash.slice(1);
+    if (!views[name]) {
+      name = 'routes';
+    }
+    Array.prototype.forEach.call(document.querySelectorAll('#tabs a'), function (a) {
+      a.classList.toggle('active', a.getAttribute('href') === '#' + name);
+    });
+    showError(null);
+    clear(view);
+    views[name]();
+  }
+
+  identityForm.token.value = token();
+  identityForm.addEventListener('submit', function (e) {
+    e.preventDefault();
+    sessionStorage.setItem('oreo.token', identityForm.token.value.trim());
+    route();
+  });
+
+  window.addEventListener('hashchange', route);
+  route();
+})();
@@ -1,5 +1,7 @@
 package oreoauth
 
+import "github.com/xkeyideal/oreo"
+
 type AuthUrlMethod struct {
 	Url    string `json:"url"`
 	Method string `json:"method"`
@@ -25,6 +27,11 @@ type AuthRole struct {
 	UrlMethods map[string][]string `json:"urlMethods"`
 }
 
+type AuthRoleRoute struct {
+	RoleName   string              `json:"roleName"`
+	UrlMethods map[string][]string `json:"urlMethods"`
+}
+
 type AuthRoleUser struct {
 	RoleName  string   `json:"roleName"`
 	RoleUsers []string `json:"roleUsers"`
@@ -36,6 +43,17 @@ type AuthRoleInfo struct {
 	RoleType int    `json:"roleType"`
 }
 
+type AuthRoleTag struct {
+	RoleName string   `json:"roleName"`
+	Tags     []string `json:"tags"`
+}
+
+type AuthScope struct {
+	UserId string `json:"userId"`
+	Kind   string `json:"kind"`   //role_user或route
+	Target string `json:"target"` //role_user时为角色标签，route时为路由前缀
+}
+
 type AuthUser struct {
 	UserId string `json:"userId"`
 	Name   string `json:"name"`
@@ -47,6 +65,12 @@ type AuthUserSign struct {
 	SignDesc string `json:"signDesc"`
 }
 
+type AuthSignTransfer struct {
+	SignKey    string `json:"signKey"`
+	SignDesc   string `json:"signDesc"` //为空时沿用原创建者的描述
+	DestUserId string `json:"destUserId"`
+}
+
 type AuthSign struct {
 	UserId     string              `json:"userId"`
 	SignKey    string              `json:"signKey"`
@@ -65,3 +89,25 @@ type AuthSignUri struct {
 	UserIds    []string            `json:"userIds"`
 	UrlMethods map[string][]string `json:"urlMethods"`
 }
+
+type AuthPolicyChange struct {
+	Type       string              `json:"type"`
+	RoleName   string              `json:"roleName"`
+	RoleType   int                 `json:"roleType"`
+	UrlMethods map[string][]string `json:"urlMethods"` //role_upsert时为角色的全部路由和方法，sign_revoke时为需要收回的路由和方法
+	UserIds    []string            `json:"userIds"`
+	SignKey    string              `json:"signKey"`
+	Url        string              `json:"url"`
+	Method     string              `json:"method"`
+}
+
+type AuthSimulate struct {
+	Changes []AuthPolicyChange `json:"changes"`
+	Records []oreo.CheckRecord `json:"records"` //需要重放的历史校验记录，可以不传
+}
+
+type AuthUserClone struct {
+	SrcUserId  string `json:"srcUserId"`
+	DestUserId string `json:"destUserId"`
+	DryRun     bool   `json:"dryRun"`
+}
@@ -0,0 +1,89 @@
+package oreoauth
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	eventPollInterval = 2 * time.Second
+	eventBatchLimit   = 100
+	eventRetry        = 3000 //浏览器断线后重连的间隔，单位毫秒
+)
+
+// 事件推送的起点，浏览器重连时会带上Last-Event-ID，首次连接则从最新的事件开始推送
+func eventStartSeq(c *gin.Context) (int64, error) {
+	lastId := strings.TrimSpace(c.GetHeader("Last-Event-ID"))
+	if lastId == "" {
+		lastId = strings.TrimSpace(c.Query("lastEventId"))
+	}
+
+	if lastId == "" {
+		return LibraOreoAuth.LastPermissionEventSeq()
+	}
+
+	return strconv.ParseInt(lastId, 10, 64)
+}
+
+// 以SSE的方式推送当前登录用户的权限变更事件，前端收到后刷新UserGrantRoute等缓存
+func userEvent(c *gin.Context) {
+	// 只使用权限中间件识别的登录用户，不能通过请求头订阅其他用户的事件
+	userId, err := checkCaller(c)
+	if err != nil {
+		setStrResp(http.StatusUnauthorized, OREO_AUTH_ERR, err.Error(), "", c)
+		return
+	}
+
+	seq, err := eventStartSeq(c)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	c.Render(-1, sse.Event{
+		Id:    strconv.FormatInt(seq, 10),
+		Event: "ready",
+		Retry: eventRetry,
+		Data:  "",
+	})
+
+	ticker := time.NewTicker(eventPollInterval)
+	defer ticker.Stop()
+
+	done := c.Request.Context().Done()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-done:
+			return false
+		case <-ticker.C:
+		}
+
+		events, next, err := LibraOreoAuth.QueryPermissionEvents(userId, seq, eventBatchLimit)
+		if err != nil {
+			c.SSEvent("error", err.Error())
+			return false
+		}
+
+		for _, event := range events {
+			c.Render(-1, sse.Event{
+				Id:    strconv.FormatInt(event.Seq, 10),
+				Event: event.Type,
+				Data:  event,
+			})
+		}
+		seq = next
+
+		return true
+	})
+}
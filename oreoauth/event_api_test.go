@@ -0,0 +1,24 @@
+package oreoauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 没有中间件识别的登录用户时，不能通过userId请求头订阅其他用户的事件
+func TestUserEventRequiresIdentity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/oreo/auth/user/event", nil)
+	c.Request.Header.Set("userId", "victim")
+
+	userEvent(c)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("userEvent status = %d, want 401", w.Code)
+	}
+}
@@ -0,0 +1,44 @@
+package oreoauth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/xkeyideal/oreo"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 下载组内所有用户的权限矩阵，边计算边写入响应，不会将所有用户的权限放在内存中
+func exportPermissionMatrix(c *gin.Context) {
+	format := strings.ToLower(strings.TrimSpace(c.DefaultQuery("format", oreo.MatrixFormatCSV)))
+
+	contentType := "text/csv; charset=utf-8"
+	switch format {
+	case oreo.MatrixFormatCSV:
+	case oreo.MatrixFormatJSON:
+		contentType = "application/json; charset=utf-8"
+	default:
+		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, fmt.Sprintf("unsupported export format: %s", format), "", c)
+		return
+	}
+
+	filename := fmt.Sprintf("oreo_permission_%s.%s", time.Now().Format("20060102150405"), format)
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	c.Status(http.StatusOK)
+
+	if format == oreo.MatrixFormatCSV {
+		// 写入BOM，Excel打开中文不会乱码
+		c.Writer.WriteString("\xEF\xBB\xBF")
+	}
+
+	// 响应头已经写出，出错时只能中断输出
+	if err := LibraOreoAuth.ExportPermissionMatrix(c.Writer, format); err != nil {
+		c.Error(err)
+		c.Abort()
+	}
+}
@@ -0,0 +1,133 @@
+package oreoauth
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xkeyideal/oreo"
+)
+
+type FilterOptions struct {
+	Identity  func(c *gin.Context) (string, error)        // 获取当前登录用户，默认读取userId请求头
+	SignKey   func(c *gin.Context) string                 // 获取signKey，默认读取signKey请求头
+	Skip      []string                                    // 不校验权限的路径，例如 /health、/static/**
+	Anonymous []string                                    // 未登录时允许访问的路径，登录后仍然校验权限
+	Deny      func(c *gin.Context, status int, err error) // 拒绝访问时的响应，status为401或403
+}
+
+func IdentityFromHeader(name string) func(c *gin.Context) (string, error) {
+	return func(c *gin.Context) (string, error) {
+		return strings.TrimSpace(c.GetHeader(name)), nil
+	}
+}
+
+func IdentityFromCookie(name string) func(c *gin.Context) (string, error) {
+	return func(c *gin.Context) (string, error) {
+		v, err := c.Cookie(name)
+		if err == http.ErrNoCookie {
+			return "", nil
+		}
+		return strings.TrimSpace(v), err
+	}
+}
+
+// 上游的登录中间件通过c.Set设置的登录用户
+func IdentityFromContext(key string) func(c *gin.Context) (string, error) {
+	return func(c *gin.Context) (string, error) {
+		return strings.TrimSpace(c.GetString(key)), nil
+	}
+}
+
+func SignKeyFromHeader(name string) func(c *gin.Context) string {
+	return func(c *gin.Context) string {
+		return strings.TrimSpace(c.GetHeader(name))
+	}
+}
+
+func SignKeyFromQuery(name string) func(c *gin.Context) string {
+	return func(c *gin.Context) string {
+		return strings.TrimSpace(c.Query(name))
+	}
+}
+
+func SignKeyFromParam(name string) func(c *gin.Context) string {
+	return func(c *gin.Context) string {
+		return strings.TrimSpace(c.Param(name))
+	}
+}
+
+func denyJSON(c *gin.Context, status int, err error) {
+	c.JSON(status, gin.H{
+		"code": status,
+		"msg":  err.Error(),
+	})
+}
+
+// 路径匹配规则与path.Match一致，以/**结尾时匹配该前缀下的所有路径
+func matchPaths(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "/**") {
+			prefix := strings.TrimSuffix(pattern, "/**")
+			if p == prefix || strings.HasPrefix(p, prefix+"/") {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// 根据opts创建权限校验中间件，校验通过后userId和isAdmin会放入gin.Context
+func NewPermissionFilter(opts FilterOptions) gin.HandlerFunc {
+	if opts.Identity == nil {
+		opts.Identity = IdentityFromHeader("userId")
+	}
+	if opts.SignKey == nil {
+		opts.SignKey = SignKeyFromHeader("signKey")
+	}
+	if opts.Deny == nil {
+		opts.Deny = denyJSON
+	}
+
+	return func(c *gin.Context) {
+		uri := c.Request.URL.Path
+		if matchPaths(opts.Skip, uri) {
+			c.Next()
+			return
+		}
+
+		userId, err := opts.Identity(c)
+		if err != nil {
+			opts.Deny(c, http.StatusUnauthorized, err)
+			c.Abort()
+			return
+		}
+
+		if userId == "" && matchPaths(opts.Anonymous, uri) {
+			c.Next()
+			return
+		}
+
+		mo := oreo.MiddlewareOptions{
+			Identity: func(r *http.Request) (string, error) { return userId, nil },
+			SignKey:  func(r *http.Request) string { return opts.SignKey(c) },
+		}
+
+		r, status, err := LibraOreoAuth.AuthorizeRequest(c.Request, mo)
+		if err != nil {
+			opts.Deny(c, status, err)
+			c.Abort()
+			return
+		}
+
+		c.Request = r
+		c.Set("userId", userId)
+		c.Set("isAdmin", oreo.IsAdminFromContext(r.Context()))
+		c.Next()
+	}
+}
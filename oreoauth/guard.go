@@ -0,0 +1,231 @@
+package oreoauth
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 获取调用管理api的当前登录用户，默认只使用登录或权限中间件放入gin.Context的userId，没有时视为未登录，
+// 不会读取客户端可以伪造的userId请求头。使用JWT识别用户时可以替换为 verifier.Identity()
+var AdminIdentity = func(c *gin.Context) (string, error) {
+	return c.GetString("userId"), nil
+}
+
+// 管理权限校验使用的权限查询，由*oreo.Oreo实现
+type guardAuth interface {
+	IsSuperAdmin(userId string) (bool, error)
+	CanManageRoleUsers(userId, roleName string) (bool, error)
+	CanEditRoute(userId, uri string) (bool, error)
+	CheckSignAuth(signKey, url, method, userId string) bool
+}
+
+// 默认使用LibraOreoAuth，测试时可以替换
+var guardOreo = func() guardAuth {
+	return LibraOreoAuth
+}
+
+// 管理api的路由前缀，委托授权signKey时使用 {adminBasePath}/sign 的POST数据权限
+var adminBasePath = "/oreo/auth"
+
+// 被授权signKey在 {prefix}/oreo/auth/sign POST 上的数据权限的用户，可以代替创建者授权和转让该signKey
+func GrantSignUri() string {
+	return adminBasePath + "/sign"
+}
+
+// 管理权限校验失败，status为401或403，其他错误为查询数据库失败
+type guardError struct {
+	status int
+	msg    string
+}
+
+func (e *guardError) Error() string {
+	return e.msg
+}
+
+func unauthenticated(msg string) error {
+	return &guardError{status: http.StatusUnauthorized, msg: msg}
+}
+
+func forbidden(format string, args ...interface{}) error {
+	return &guardError{status: http.StatusForbidden, msg: fmt.Sprintf(format, args...)}
+}
+
+// v1接口的管理权限校验失败响应
+func setGuardErrResp(err error, c *gin.Context) {
+	if ge, ok := err.(*guardError); ok {
+		code := OREO_FORBIDDEN
+		if ge.status == http.StatusUnauthorized {
+			code = OREO_UNAUTHENTICATED
+		}
+		setStrResp(ge.status, code, ge.msg, "", c)
+		return
+	}
+
+	setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+}
+
+// 获取当前登录用户
+func checkCaller(c *gin.Context) (string, error) {
+	userId, err := AdminIdentity(c)
+	if err != nil {
+		return "", unauthenticated(err.Error())
+	}
+	if userId == "" {
+		return "", unauthenticated("not logged in")
+	}
+	return userId, nil
+}
+
+// 只有超管可以修改角色，第一个超管需要通过Go API或 oreoctl -store 直接创建
+func checkSuperAdmin(c *gin.Context) (string, error) {
+	caller, err := checkCaller(c)
+	if err != nil {
+		return "", err
+	}
+
+	isAdmin, err := guardOreo().IsSuperAdmin(caller)
+	if err != nil {
+		return "", err
+	}
+	if !isAdmin {
+		return "", forbidden("[%s]不是超管", caller)
+	}
+
+	return caller, nil
+}
+
+// 超管和被委托管理该角色标签的用户可以管理角色的成员
+func checkRoleUserManager(c *gin.Context, roleName string) (string, error) {
+	caller, err := checkCaller(c)
+	if err != nil {
+		return "", err
+	}
+
+	isAdmin, err := guardOreo().IsSuperAdmin(caller)
+	if err == nil && !isAdmin {
+		isAdmin, err = guardOreo().CanManageRoleUsers(caller, roleName)
+	}
+	if err != nil {
+		return "", err
+	}
+	if !isAdmin {
+		return "", forbidden("[%s]没有管理角色[%s]成员的权限", caller, roleName)
+	}
+
+	return caller, nil
+}
+
+// 超管和被委托修改路由前缀的用户可以修改路由，urls必须都在委托的范围内
+func checkRouteEditor(c *gin.Context, urls ...string) (string, error) {
+	caller, err := checkCaller(c)
+	if err != nil {
+		return "", err
+	}
+
+	isAdmin, err := guardOreo().IsSuperAdmin(caller)
+	if err != nil {
+		return "", err
+	}
+	if isAdmin {
+		return caller, nil
+	}
+
+	if len(urls) == 0 {
+		return "", forbidden("[%s]不是超管", caller)
+	}
+
+	for _, url := range urls {
+		can, err := guardOreo().CanEditRoute(caller, url)
+		if err != nil {
+			return "", err
+		}
+		if !can {
+			return "", forbidden("[%s]没有修改路由[%s]的权限", caller, url)
+		}
+	}
+
+	return caller, nil
+}
+
+// signKey的创建者、被委托管理该signKey的用户和超管可以授权、收回和转让signKey
+func checkSignManager(c *gin.Context, signKey string) (string, error) {
+	caller, err := checkCaller(c)
+	if err != nil {
+		return "", err
+	}
+
+	if guardOreo().CheckSignAuth(signKey, GrantSignUri(), "POST", caller) {
+		return caller, nil
+	}
+
+	isAdmin, err := guardOreo().IsSuperAdmin(caller)
+	if err != nil {
+		return "", err
+	}
+	if !isAdmin {
+		return "", forbidden("[%s]不是signKey[%s]的创建者或管理者", caller, signKey)
+	}
+
+	return caller, nil
+}
+
+// 用户只能操作自己的signKey，userId为空时使用当前登录用户
+func checkSelf(c *gin.Context, userId string) (string, error) {
+	caller, err := checkCaller(c)
+	if err != nil {
+		return "", err
+	}
+
+	if userId != "" && userId != caller {
+		return "", forbidden("[%s]不能操作[%s]的signKey", caller, userId)
+	}
+
+	return caller, nil
+}
+
+func requireSuperAdmin(c *gin.Context) (string, bool) {
+	caller, err := checkSuperAdmin(c)
+	if err != nil {
+		setGuardErrResp(err, c)
+		return "", false
+	}
+	return caller, true
+}
+
+func requireRoleUserManager(c *gin.Context, roleName string) (string, bool) {
+	caller, err := checkRoleUserManager(c, roleName)
+	if err != nil {
+		setGuardErrResp(err, c)
+		return "", false
+	}
+	return caller, true
+}
+
+func requireRouteEditor(c *gin.Context, urls ...string) (string, bool) {
+	caller, err := checkRouteEditor(c, urls...)
+	if err != nil {
+		setGuardErrResp(err, c)
+		return "", false
+	}
+	return caller, true
+}
+
+func requireSignManager(c *gin.Context, signKey string) (string, bool) {
+	caller, err := checkSignManager(c, signKey)
+	if err != nil {
+		setGuardErrResp(err, c)
+		return "", false
+	}
+	return caller, true
+}
+
+func requireSelf(c *gin.Context, userId string) (string, bool) {
+	caller, err := checkSelf(c, userId)
+	if err != nil {
+		setGuardErrResp(err, c)
+		return "", false
+	}
+	return caller, true
+}
@@ -0,0 +1,110 @@
+package oreoauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 没有中间件设置登录用户时，userId请求头不能作为管理api的调用者
+func TestCheckCallerIgnoresHeader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Request.Header.Set("userId", "admin")
+
+	_, err := checkCaller(c)
+	ge, ok := err.(*guardError)
+	if !ok || ge.status != http.StatusUnauthorized {
+		t.Fatalf("checkCaller = %v, want 401", err)
+	}
+
+	c.Set("userId", "u1")
+	caller, err := checkCaller(c)
+	if err != nil || caller != "u1" {
+		t.Errorf("checkCaller = %s, %v, want u1", caller, err)
+	}
+}
+
+// admin为超管，u1创建了k1，u2可以修改/api/users下的路由
+type fakeGuardAuth struct{}
+
+func (fakeGuardAuth) IsSuperAdmin(userId string) (bool, error) {
+	return userId == "admin", nil
+}
+
+func (fakeGuardAuth) CanManageRoleUsers(userId, roleName string) (bool, error) {
+	return false, nil
+}
+
+func (fakeGuardAuth) CanEditRoute(userId, uri string) (bool, error) {
+	return userId == "u2" && (uri == "/api/users" || strings.HasPrefix(uri, "/api/users/")), nil
+}
+
+func (fakeGuardAuth) CheckSignAuth(signKey, url, method, userId string) bool {
+	return signKey == "k1" && userId == "u1" && url == GrantSignUri() && method == "POST"
+}
+
+func TestGuardChecks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	old := guardOreo
+	guardOreo = func() guardAuth { return fakeGuardAuth{} }
+	defer func() { guardOreo = old }()
+
+	signManager := func(signKey string) func(*gin.Context) (string, error) {
+		return func(c *gin.Context) (string, error) { return checkSignManager(c, signKey) }
+	}
+	self := func(userId string) func(*gin.Context) (string, error) {
+		return func(c *gin.Context) (string, error) { return checkSelf(c, userId) }
+	}
+	routeEditor := func(urls ...string) func(*gin.Context) (string, error) {
+		return func(c *gin.Context) (string, error) { return checkRouteEditor(c, urls...) }
+	}
+
+	cases := []struct {
+		name   string
+		caller string
+		check  func(*gin.Context) (string, error)
+		status int
+	}{
+		{"sign owner", "u1", signManager("k1"), http.StatusOK},
+		{"sign superadmin", "admin", signManager("k1"), http.StatusOK},
+		{"sign non-owner", "u2", signManager("k1"), http.StatusForbidden},
+		{"sign other key", "u1", signManager("k2"), http.StatusForbidden},
+		{"sign no identity", "", signManager("k1"), http.StatusUnauthorized},
+		{"self", "u1", self("u1"), http.StatusOK},
+		{"self default", "u1", self(""), http.StatusOK},
+		{"self other user", "u1", self("u2"), http.StatusForbidden},
+		{"self no identity", "", self("u1"), http.StatusUnauthorized},
+		{"route superadmin", "admin", routeEditor("/api/orders"), http.StatusOK},
+		{"route in scope", "u2", routeEditor("/api/users", "/api/users/:id"), http.StatusOK},
+		{"route out of scope", "u2", routeEditor("/api/users/:id", "/api/usersx"), http.StatusForbidden},
+		{"route no scope", "u1", routeEditor("/api/users"), http.StatusForbidden},
+		{"route no urls", "u2", routeEditor(), http.StatusForbidden},
+		{"route no identity", "", routeEditor("/api/users"), http.StatusUnauthorized},
+	}
+
+	for _, c := range cases {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+		if c.caller != "" {
+			ctx.Set("userId", c.caller)
+		}
+
+		caller, err := c.check(ctx)
+		if c.status == http.StatusOK {
+			if err != nil || caller != c.caller {
+				t.Errorf("%s: check = %s, %v, want %s", c.name, caller, err, c.caller)
+			}
+			continue
+		}
+		if ge, ok := err.(*guardError); !ok || ge.status != c.status {
+			t.Errorf("%s: check error = %v, want %d", c.name, err, c.status)
+		}
+	}
+}
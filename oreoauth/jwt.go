@@ -0,0 +1,364 @@
+package oreoauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	JWTClaimsContextKey  = "jwtClaims"
+	JWTSignKeyContextKey = "jwtSignKey"
+)
+
+var ErrJWTInvalid = errors.New("invalid jwt")
+
+type JWTOptions struct {
+	HMACKey      []byte                      // HS256的密钥
+	PublicKeys   map[string]crypto.PublicKey // RS256/ES256的公钥，key为kid，token中没有kid时使用key为""的公钥
+	JWKSFile     string                      // 从JWKS文件中加载公钥，与PublicKeys合并
+	UserIdClaim  string                      // 用户id所在的claim，默认为sub
+	SignKeyClaim string                      // signKey所在的claim，为空时读取signKey请求头
+	Audience     string                      // 不为空时校验aud
+	Issuer       string                      // 不为空时校验iss
+	Leeway       time.Duration               // 校验exp和nbf时允许的时钟误差
+	AllowNoExp   bool                        // 为true时允许没有exp的token，默认拒绝，避免签发的token永久有效
+	Cookie       string                      // 不为空时，Authorization请求头没有token则从该cookie读取
+}
+
+type JWTVerifier struct {
+	opts JWTOptions
+	keys map[string]crypto.PublicKey
+	now  func() time.Time
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+func NewJWTVerifier(opts JWTOptions) (*JWTVerifier, error) {
+	if opts.UserIdClaim == "" {
+		opts.UserIdClaim = "sub"
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for kid, key := range opts.PublicKeys {
+		keys[kid] = key
+	}
+
+	if opts.JWKSFile != "" {
+		data, err := ioutil.ReadFile(opts.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		jwks, err := ParseJWKS(data)
+		if err != nil {
+			return nil, err
+		}
+		for kid, key := range jwks {
+			keys[kid] = key
+		}
+	}
+
+	if len(opts.HMACKey) == 0 && len(keys) == 0 {
+		return nil, errors.New("jwt verifier has no key")
+	}
+
+	return &JWTVerifier{
+		opts: opts,
+		keys: keys,
+		now:  time.Now,
+	}, nil
+}
+
+// 校验token的签名、exp、nbf、aud和iss，返回token中的claims，未设置AllowNoExp时token必须包含exp
+func (v *JWTVerifier) Verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrJWTInvalid
+	}
+
+	header := jwtHeader{}
+	if err := jwtDecodeJSON(parts[0], &header); err != nil {
+		return nil, err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrJWTInvalid
+	}
+
+	if err := v.verifySignature(header, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	claims := make(map[string]interface{})
+	if err := jwtDecodeJSON(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	if err := v.verifyClaims(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (v *JWTVerifier) verifySignature(header jwtHeader, signed string, sig []byte) error {
+	hash := sha256.Sum256([]byte(signed))
+
+	switch header.Alg {
+	case "HS256":
+		if len(v.opts.HMACKey) == 0 {
+			return fmt.Errorf("jwt alg %s not allowed", header.Alg)
+		}
+		mac := hmac.New(sha256.New, v.opts.HMACKey)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return ErrJWTInvalid
+		}
+		return nil
+	case "RS256":
+		key, ok := v.keys[header.Kid].(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("jwt rsa key %s not found", header.Kid)
+		}
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], sig); err != nil {
+			return ErrJWTInvalid
+		}
+		return nil
+	case "ES256":
+		key, ok := v.keys[header.Kid].(*ecdsa.PublicKey)
+		if !ok || key.Curve != elliptic.P256() {
+			return fmt.Errorf("jwt ecdsa key %s not found", header.Kid)
+		}
+		if len(sig) != 64 {
+			return ErrJWTInvalid
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(key, hash[:], r, s) {
+			return ErrJWTInvalid
+		}
+		return nil
+	}
+
+	return fmt.Errorf("jwt alg %s not allowed", header.Alg)
+}
+
+func (v *JWTVerifier) verifyClaims(claims map[string]interface{}) error {
+	now := v.now()
+
+	if _, ok := claims["exp"]; ok || !v.opts.AllowNoExp {
+		exp, ok := claims["exp"].(float64)
+		if !ok {
+			return errors.New("jwt exp is missing or invalid")
+		}
+		if now.After(time.Unix(int64(exp), 0).Add(v.opts.Leeway)) {
+			return errors.New("jwt is expired")
+		}
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok {
+		if now.Add(v.opts.Leeway).Before(time.Unix(int64(nbf), 0)) {
+			return errors.New("jwt is not valid yet")
+		}
+	}
+
+	if v.opts.Audience != "" && !jwtAudience(claims["aud"], v.opts.Audience) {
+		return errors.New("jwt audience mismatch")
+	}
+
+	if v.opts.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.opts.Issuer {
+			return errors.New("jwt issuer mismatch")
+		}
+	}
+
+	return nil
+}
+
+func jwtAudience(aud interface{}, audience string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == audience
+	case []interface{}:
+		for _, v := range a {
+			if s, ok := v.(string); ok && s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func jwtDecodeJSON(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return ErrJWTInvalid
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return ErrJWTInvalid
+	}
+	return nil
+}
+
+func jwtClaimString(claims map[string]interface{}, name string) string {
+	switch v := claims[name].(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	}
+	return ""
+}
+
+func (v *JWTVerifier) token(c *gin.Context) string {
+	auth := strings.TrimSpace(c.GetHeader("Authorization"))
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+
+	if v.opts.Cookie != "" {
+		if token, err := c.Cookie(v.opts.Cookie); err == nil {
+			return strings.TrimSpace(token)
+		}
+	}
+
+	return ""
+}
+
+// 作为FilterOptions.Identity使用，校验通过后claims放入gin.Context的jwtClaims中，没有token时视为未登录
+func (v *JWTVerifier) Identity() func(c *gin.Context) (string, error) {
+	return func(c *gin.Context) (string, error) {
+		token := v.token(c)
+		if token == "" {
+			return "", nil
+		}
+
+		claims, err := v.Verify(token)
+		if err != nil {
+			return "", err
+		}
+
+		c.Set(JWTClaimsContextKey, claims)
+		if v.opts.SignKeyClaim != "" {
+			c.Set(JWTSignKeyContextKey, jwtClaimString(claims, v.opts.SignKeyClaim))
+		}
+
+		userId := jwtClaimString(claims, v.opts.UserIdClaim)
+		if userId == "" {
+			return "", fmt.Errorf("jwt claim %s is empty", v.opts.UserIdClaim)
+		}
+		return userId, nil
+	}
+}
+
+// 作为FilterOptions.SignKey使用，未配置SignKeyClaim时读取signKey请求头
+func (v *JWTVerifier) SignKey() func(c *gin.Context) string {
+	return func(c *gin.Context) string {
+		if v.opts.SignKeyClaim != "" {
+			return c.GetString(JWTSignKeyContextKey)
+		}
+		return strings.TrimSpace(c.GetHeader("signKey"))
+	}
+}
+
+// 使用JWT识别登录用户的权限校验中间件
+func NewJWTPermissionFilter(v *JWTVerifier, opts FilterOptions) gin.HandlerFunc {
+	opts.Identity = v.Identity()
+	opts.SignKey = v.SignKey()
+	return NewPermissionFilter(opts)
+}
+
+// 解析PEM格式的公钥，支持RSA和ECDSA
+func ParsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid pem public key")
+	}
+
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+		return cert.PublicKey, nil
+	}
+
+	return x509.ParsePKCS1PublicKey(block.Bytes)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// 解析JWKS，返回kid对应的公钥，只支持RSA和P-256的EC公钥
+func ParseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	jwks := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("parse jwks exception %s", err.Error())
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range jwks.Keys {
+		switch k.Kty {
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(k.N)
+			if err != nil {
+				return nil, fmt.Errorf("jwk %s invalid n", k.Kid)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(k.E)
+			if err != nil {
+				return nil, fmt.Errorf("jwk %s invalid e", k.Kid)
+			}
+			keys[k.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "EC":
+			if k.Crv != "P-256" {
+				continue
+			}
+			x, err := base64.RawURLEncoding.DecodeString(k.X)
+			if err != nil {
+				return nil, fmt.Errorf("jwk %s invalid x", k.Kid)
+			}
+			y, err := base64.RawURLEncoding.DecodeString(k.Y)
+			if err != nil {
+				return nil, fmt.Errorf("jwk %s invalid y", k.Kid)
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(x),
+				Y:     new(big.Int).SetBytes(y),
+			}
+		}
+	}
+
+	return keys, nil
+}
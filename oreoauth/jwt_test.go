@@ -0,0 +1,202 @@
+package oreoauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// 签发测试用的token，key为[]byte时使用HS256，否则按私钥类型使用RS256或ES256
+func jwtTestSign(t *testing.T, key interface{}, kid string, claims map[string]interface{}) string {
+	header := map[string]string{"kid": kid}
+	switch key.(type) {
+	case []byte:
+		header["alg"] = "HS256"
+	case *rsa.PrivateKey:
+		header["alg"] = "RS256"
+	case *ecdsa.PrivateKey:
+		header["alg"] = "ES256"
+	}
+
+	seg := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := seg(header) + "." + seg(claims)
+	hash := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		b, err := rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = b
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestJWTVerify(t *testing.T) {
+	hmacKey := []byte("oreo-test-secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	unix := func(d time.Duration) float64 { return float64(now.Add(d).Unix()) }
+
+	opts := JWTOptions{
+		HMACKey: hmacKey,
+		PublicKeys: map[string]crypto.PublicKey{
+			"rsa": &rsaKey.PublicKey,
+			"ec":  &ecKey.PublicKey,
+		},
+		Audience: "oreo",
+		Issuer:   "test",
+		Leeway:   30 * time.Second,
+	}
+
+	valid := func(extra map[string]interface{}) map[string]interface{} {
+		claims := map[string]interface{}{
+			"sub": "u1",
+			"aud": "oreo",
+			"iss": "test",
+			"exp": unix(time.Hour),
+		}
+		for k, v := range extra {
+			if v == nil {
+				delete(claims, k)
+				continue
+			}
+			claims[k] = v
+		}
+		return claims
+	}
+
+	cases := []struct {
+		name       string
+		key        interface{}
+		kid        string
+		claims     map[string]interface{}
+		allowNoExp bool
+		ok         bool
+	}{
+		{"hs256", hmacKey, "", valid(nil), false, true},
+		{"rs256", rsaKey, "rsa", valid(nil), false, true},
+		{"es256", ecKey, "ec", valid(nil), false, true},
+		{"wrong hmac key", []byte("other"), "", valid(nil), false, false},
+		{"wrong ecdsa key", otherKey, "ec", valid(nil), false, false},
+		{"unknown kid", rsaKey, "missing", valid(nil), false, false},
+		{"expired", hmacKey, "", valid(map[string]interface{}{"exp": unix(-time.Minute)}), false, false},
+		{"expired within leeway", hmacKey, "", valid(map[string]interface{}{"exp": unix(-10 * time.Second)}), false, true},
+		{"missing exp", hmacKey, "", valid(map[string]interface{}{"exp": nil}), false, false},
+		{"missing exp allowed", hmacKey, "", valid(map[string]interface{}{"exp": nil}), true, true},
+		{"expired with allow no exp", hmacKey, "", valid(map[string]interface{}{"exp": unix(-time.Minute)}), true, false},
+		{"string exp", hmacKey, "", valid(map[string]interface{}{"exp": "never"}), true, false},
+		{"not valid yet", hmacKey, "", valid(map[string]interface{}{"nbf": unix(time.Minute)}), false, false},
+		{"audience list", hmacKey, "", valid(map[string]interface{}{"aud": []string{"x", "oreo"}}), false, true},
+		{"audience mismatch", hmacKey, "", valid(map[string]interface{}{"aud": "other"}), false, false},
+		{"issuer mismatch", hmacKey, "", valid(map[string]interface{}{"iss": "other"}), false, false},
+	}
+
+	for _, c := range cases {
+		o := opts
+		o.AllowNoExp = c.allowNoExp
+		v, err := NewJWTVerifier(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v.now = func() time.Time { return now }
+
+		_, err = v.Verify(jwtTestSign(t, c.key, c.kid, c.claims))
+		if c.ok && err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+		}
+		if !c.ok && err == nil {
+			t.Errorf("%s: expected error", c.name)
+		}
+	}
+}
+
+func TestJWTVerifyRejectsAlgNone(t *testing.T) {
+	v, err := NewJWTVerifier(JWTOptions{HMACKey: []byte("secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enc := base64.RawURLEncoding.EncodeToString
+	token := enc([]byte(`{"alg":"none"}`)) + "." + enc([]byte(`{"sub":"u1","exp":9999999999}`)) + "."
+	if _, err := v.Verify(token); err == nil {
+		t.Errorf("alg none should be rejected")
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enc := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	data, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "RSA", "kid": "r", "n": enc(rsaKey.N.Bytes()), "e": enc(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "e", "crv": "P-256", "x": enc(ecKey.X.Bytes()), "y": enc(ecKey.Y.Bytes())},
+			{"kty": "EC", "kid": "p384", "crv": "P-384"},
+		},
+	})
+
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if k, ok := keys["r"].(*rsa.PublicKey); !ok || !k.Equal(&rsaKey.PublicKey) {
+		t.Errorf("rsa key mismatch")
+	}
+	if k, ok := keys["e"].(*ecdsa.PublicKey); !ok || !k.Equal(&ecKey.PublicKey) {
+		t.Errorf("ec key mismatch")
+	}
+	if _, ok := keys["p384"]; ok {
+		t.Errorf("P-384 key should be skipped")
+	}
+}
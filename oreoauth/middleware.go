@@ -0,0 +1,27 @@
+package oreoauth
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/xkeyideal/oreo"
+)
+
+// gin的权限中间件，校验逻辑与oreo.Middleware一致，通过后userId和isAdmin会放入gin.Context
+func GinMiddleware(o *oreo.Oreo, opts oreo.MiddlewareOptions) gin.HandlerFunc {
+	if opts.Deny == nil {
+		opts.Deny = oreo.JSONDeny
+	}
+
+	return func(c *gin.Context) {
+		r, status, err := o.AuthorizeRequest(c.Request, opts)
+		if err != nil {
+			opts.Deny(c.Writer, c.Request, status, err)
+			c.Abort()
+			return
+		}
+
+		c.Request = r
+		c.Set("userId", oreo.UserIdFromContext(r.Context()))
+		c.Set("isAdmin", oreo.IsAdminFromContext(r.Context()))
+		c.Next()
+	}
+}
@@ -0,0 +1,541 @@
+package oreoauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xkeyideal/oreo"
+	"github.com/xkeyideal/oreo/authoperate"
+	"github.com/xkeyideal/oreo/route"
+)
+
+// 管理api的描述，body和result为nil表示没有请求体或返回结果为空字符串
+type apiDoc struct {
+	method  string
+	path    string
+	summary string
+	query   []string
+	status  int
+	ifMatch bool // 支持If-Match乐观锁，版本冲突时返回412
+	etag    bool // 单个文档的查询结果返回ETag
+	body    interface{}
+	result  interface{}
+	produce string // 不是统一的json响应时的Content-Type
+	guard   string // 调用者需要满足的管理权限，不满足时返回403
+
+	conflict bool // v2接口在资源已存在时返回409
+}
+
+const (
+	guardSuperAdmin  = "superadmin"  // 超管
+	guardSignManager = "signManager" // signKey的创建者、被委托管理该signKey的用户或超管
+	guardSelf        = "self"        // 只能操作自己的数据
+
+	guardRoleUserManager = "roleUserManager" // 超管或被委托管理该角色标签的用户
+	guardRouteEditor     = "routeEditor"     // 超管或被委托修改该路由前缀的用户
+)
+
+// 新增管理api时必须在这里描述，openapi_test.go会检查OreoAuthRouter注册的api与这里是否一致
+var adminAPIDocs = []apiDoc{
+	{method: "GET", path: "/route", summary: "路由列表，传入limit或cursor时分页返回", query: []string{"cursor", "limit", "prefix", "dataAuth", "sort", "total"}, result: []authoperate.RouteListView{}},
+	{method: "POST", path: "/route", summary: "添加路由", status: http.StatusCreated, body: []route.RouteData{}, guard: guardRouteEditor},
+	{method: "PUT", path: "/route", summary: "修改路由的描述", ifMatch: true, body: AuthUrlMethods{}, guard: guardRouteEditor},
+	{method: "DELETE", path: "/route", summary: "删除路由", query: []string{"url"}, guard: guardRouteEditor},
+	{method: "GET", path: "/route/method", summary: "查询拥有数据权限的路由和method", result: []authoperate.RouteListView{}},
+	{method: "PUT", path: "/route/method", summary: "启用路由method的数据权限", body: AuthUrlMethod{}, guard: guardRouteEditor},
+	{method: "POST", path: "/route/method", summary: "停用路由method的数据权限", body: AuthUrlMethod{}, guard: guardRouteEditor},
+	{method: "DELETE", path: "/route/method", summary: "删除路由下的某个Method", query: []string{"url", "method"}, guard: guardRouteEditor},
+	{method: "PUT", path: "/route/method/desc", summary: "修改路由下某个Method的描述", ifMatch: true, body: AuthUrlMethod{}, guard: guardRouteEditor},
+	{method: "GET", path: "/route/info", summary: "查询某个url的路由信息，支持模糊查询", query: []string{"url"}, etag: true, result: []authoperate.RouteListView{}},
+	{method: "GET", path: "/route/search", summary: "按uri或描述搜索路由，关键字按字面匹配，mode为contains或prefix", query: []string{"q", "mode", "limit"}, result: []authoperate.RouteListView{}},
+	{method: "POST", path: "/route/openapi", summary: "从OpenAPI文档导入路由，请求体为JSON或YAML文档", query: []string{"basePath", "dryRun"}, body: "", result: route.OpenAPIImport{}, guard: guardRouteEditor},
+
+	{method: "GET", path: "/role", summary: "角色拥有的路由和方法与全局路由和方法的diff", query: []string{"roleName"}, result: []authoperate.RouteListView{}},
+	{method: "POST", path: "/role", summary: "添加角色", status: http.StatusCreated, ifMatch: true, body: AuthRole{}, guard: guardSuperAdmin},
+	{method: "DELETE", path: "/role", summary: "删除角色", query: []string{"roleName"}, guard: guardSuperAdmin},
+	{method: "PUT", path: "/role/route", summary: "为角色增量添加路由和方法", body: AuthRoleRoute{}, guard: guardSuperAdmin},
+	{method: "POST", path: "/role/route", summary: "为角色增量删除路由和方法", body: AuthRoleRoute{}, guard: guardSuperAdmin},
+	{method: "GET", path: "/role/user", summary: "查询用户拥有的角色，仅返回角色名称", query: []string{"userId"}, result: []string{}},
+	{method: "POST", path: "/role/user", summary: "向角色添加用户", status: http.StatusCreated, ifMatch: true, body: AuthRoleUser{}, guard: guardRoleUserManager},
+	{method: "PUT", path: "/role/user", summary: "删除角色中的用户", ifMatch: true, body: AuthRoleUser{}, guard: guardRoleUserManager},
+	{method: "GET", path: "/role/info", summary: "查询角色信息，roleName为空且传入limit或cursor时分页返回", query: []string{"roleName", "cursor", "limit", "prefix", "tag", "sort", "total"}, etag: true, result: []authoperate.RoleListView{}},
+	{method: "PUT", path: "/role/info", summary: "设置默认角色", body: AuthRoleInfo{}, guard: guardSuperAdmin},
+	{method: "POST", path: "/role/info", summary: "更新角色的类型和角色的描述", ifMatch: true, body: AuthRoleInfo{}, guard: guardSuperAdmin},
+	{method: "PUT", path: "/role/tag", summary: "设置角色的标签，用于委托管理", ifMatch: true, body: AuthRoleTag{}, guard: guardSuperAdmin},
+
+	{method: "GET", path: "/user", summary: "查询用户信息", query: []string{"userId"}, result: []authoperate.UserInfo{}},
+	{method: "PUT", path: "/user", summary: "查询所有用户信息，仅返回userId和name，传入limit或cursor时分页返回", query: []string{"cursor", "limit", "prefix", "roleName", "sort", "total"}, result: []authoperate.UserDetail{}},
+	{method: "GET", path: "/user/search", summary: "按userId或name搜索用户，关键字按字面匹配，mode为contains或prefix", query: []string{"q", "mode", "limit"}, result: []authoperate.UserDetail{}},
+	{method: "GET", path: "/user/sign", summary: "查询用户拥有的signKey信息", query: []string{"userId"}, etag: true, result: authoperate.UserSignList{}},
+	{method: "POST", path: "/user/sign", summary: "用户添加自己signKey，返回新的signKey", status: http.StatusCreated, body: AuthUserSign{}, result: "", guard: guardSelf},
+	{method: "PUT", path: "/user/sign", summary: "用户修改自己signKey的描述", ifMatch: true, body: AuthUserSign{}, guard: guardSelf},
+	{method: "POST", path: "/user/sign/transfer", summary: "将signKey转给他人", body: AuthSignTransfer{}, guard: guardSignManager},
+	{method: "GET", path: "/user/role", summary: "查询用户拥有的角色信息", query: []string{"userId"}, result: []authoperate.RoleUserListView{}},
+	{method: "GET", path: "/user/event", summary: "以SSE推送当前登录用户的权限变更，支持Last-Event-ID断线重连", query: []string{"lastEventId"}, produce: "text/event-stream"},
+	{method: "GET", path: "/user/diff", summary: "比较两个用户的角色、路由权限和被授权的signKey", query: []string{"userId", "otherUserId"}, result: authoperate.UserAccessDiff{}},
+	{method: "POST", path: "/user/clone", summary: "让一个用户拥有与另一个用户相同的权限，支持dryRun", body: AuthUserClone{}, result: []oreo.CloneAction{}, guard: guardSuperAdmin},
+
+	{method: "GET", path: "/sign", summary: "查询signKey已授权给的用户和相关路由方法", query: []string{"signKey", "userId"}, etag: true, result: authoperate.SignListView{}},
+	{method: "POST", path: "/sign", summary: "授权signKey给他人", status: http.StatusCreated, ifMatch: true, body: AuthSign{}, guard: guardSignManager},
+	{method: "PUT", path: "/sign", summary: "复制sign给他人", body: AuthSignCopy{}, guard: guardSignManager},
+	{method: "DELETE", path: "/sign", summary: "删除已授权signKey的人", query: []string{"userId", "signKey"}, guard: guardSignManager},
+	{method: "GET", path: "/sign/users", summary: "某人拥有的signKey授权的路由与方法与所有开启数据权限路由和方法的diff", query: []string{"userId", "signKey"}, result: []authoperate.RouteListView{}},
+	{method: "PUT", path: "/sign/users", summary: "为批量用户追加signKey的Uri Method", body: AuthSignUri{}, guard: guardSignManager},
+	{method: "POST", path: "/sign/users", summary: "为批量用户删除signKey的Uri Method", body: AuthSignUri{}, guard: guardSignManager},
+
+	{method: "GET", path: "/scope", summary: "查询委托的管理范围", query: []string{"userId"}, result: []authoperate.AdminScope{}, guard: guardSuperAdmin},
+	{method: "POST", path: "/scope", summary: "委托用户管理某个标签的角色成员或某个前缀下的路由", status: http.StatusCreated, body: AuthScope{}, result: authoperate.AdminScope{}, guard: guardSuperAdmin},
+	{method: "DELETE", path: "/scope", summary: "收回委托的管理范围", query: []string{"id"}, guard: guardSuperAdmin},
+
+	{method: "POST", path: "/simulate", summary: "模拟权限变更，返回受影响的用户权限，不会写入数据库", body: AuthSimulate{}, result: simulateResult{}},
+	{method: "GET", path: "/access/route", summary: "查询哪些用户拥有某个路由方法的权限", query: []string{"url", "method"}, result: []authoperate.RouteAccessUser{}},
+	{method: "GET", path: "/access/sign", summary: "查询哪些用户能够访问某个signKey下的数据，以及通过哪些路由", query: []string{"signKey"}, result: []authoperate.SignAccessUser{}},
+	{method: "GET", path: "/export/matrix", summary: "下载所有用户的权限矩阵，支持csv和json格式", query: []string{"format"}, produce: "text/csv"},
+
+	{method: "GET", path: "/openapi.json", summary: "管理api的OpenAPI文档", produce: "application/json"},
+}
+
+// v2管理api的描述，path相对于{prefix}/oreo/auth/v2，:param为路径参数，status为204时没有响应体，
+// openapi_test.go会检查OreoAuthRouterV2注册的api与这里是否一致
+var adminAPIV2Docs = []apiDoc{
+	{method: "GET", path: "/routes", summary: "路由列表，分页返回", query: []string{"cursor", "limit", "prefix", "dataAuth", "sort", "total"}, result: authoperate.RoutePage{}},
+	{method: "POST", path: "/routes", summary: "添加路由，返回添加后的路由", status: http.StatusCreated, body: []route.RouteData{}, result: []authoperate.RouteListView{}, guard: guardRouteEditor},
+	{method: "POST", path: "/routes/openapi", summary: "从OpenAPI文档导入路由，请求体为JSON或YAML文档，dryRun为true时返回200和导入计划", query: []string{"basePath", "dryRun"}, status: http.StatusCreated, body: "", result: route.OpenAPIImport{}, guard: guardRouteEditor},
+	{method: "GET", path: "/route", summary: "查询路由，路由包含/，以url参数指定", query: []string{"url"}, etag: true, result: authoperate.RouteListView{}},
+	{method: "PATCH", path: "/route", summary: "修改路由和方法的描述", query: []string{"url"}, ifMatch: true, etag: true, body: v2RoutePatch{}, result: authoperate.RouteListView{}, guard: guardRouteEditor},
+	{method: "DELETE", path: "/route", summary: "删除路由", query: []string{"url"}, status: http.StatusNoContent, guard: guardRouteEditor},
+	{method: "PATCH", path: "/route/methods/:method", summary: "修改路由方法的描述，启用或停用数据权限", query: []string{"url"}, ifMatch: true, etag: true, body: v2MethodPatch{}, result: authoperate.RouteListView{}, guard: guardRouteEditor},
+	{method: "DELETE", path: "/route/methods/:method", summary: "删除路由下的某个方法", query: []string{"url"}, status: http.StatusNoContent, guard: guardRouteEditor},
+
+	{method: "GET", path: "/roles", summary: "角色列表，分页返回", query: []string{"cursor", "limit", "prefix", "tag", "sort", "total"}, result: authoperate.RolePage{}},
+	{method: "POST", path: "/roles", summary: "添加角色", status: http.StatusCreated, etag: true, conflict: true, body: v2Role{}, result: authoperate.RoleListView{}, guard: guardSuperAdmin},
+	{method: "GET", path: "/roles/:roleName", summary: "查询角色", etag: true, result: authoperate.RoleListView{}},
+	{method: "PUT", path: "/roles/:roleName", summary: "整体替换角色的描述、类型和路由，tags为null时保持不变", ifMatch: true, etag: true, body: v2Role{}, result: authoperate.RoleListView{}, guard: guardSuperAdmin},
+	{method: "PATCH", path: "/roles/:roleName", summary: "修改角色的描述、类型、标签或设为默认角色", ifMatch: true, etag: true, body: v2RolePatch{}, result: authoperate.RoleListView{}, guard: guardSuperAdmin},
+	{method: "DELETE", path: "/roles/:roleName", summary: "删除角色", status: http.StatusNoContent, guard: guardSuperAdmin},
+	{method: "PUT", path: "/roles/:roleName/default", summary: "设置默认角色", status: http.StatusNoContent, guard: guardSuperAdmin},
+	{method: "GET", path: "/roles/:roleName/routes", summary: "角色拥有的路由和方法与全局路由和方法的diff", result: []authoperate.RouteListView{}},
+	{method: "PATCH", path: "/roles/:roleName/routes", summary: "为角色增量添加和删除路由和方法", etag: true, body: v2RoleRoutesPatch{}, result: authoperate.RoleListView{}, guard: guardSuperAdmin},
+	{method: "GET", path: "/roles/:roleName/users", summary: "查询角色中的用户", result: []authoperate.UserDetail{}},
+	{method: "POST", path: "/roles/:roleName/users", summary: "向角色添加用户", status: http.StatusNoContent, ifMatch: true, body: v2UserIds{}, guard: guardRoleUserManager},
+	{method: "DELETE", path: "/roles/:roleName/users/:userId", summary: "删除角色中的用户", status: http.StatusNoContent, ifMatch: true, guard: guardRoleUserManager},
+
+	{method: "GET", path: "/users", summary: "用户列表，分页返回", query: []string{"cursor", "limit", "prefix", "roleName", "sort", "total"}, result: authoperate.UserPage{}},
+	{method: "POST", path: "/users", summary: "添加用户，noRole为false时加入默认角色", status: http.StatusCreated, etag: true, conflict: true, body: v2User{}, result: authoperate.UserInfo{}, guard: guardSuperAdmin},
+	{method: "GET", path: "/users/:userId", summary: "查询用户", etag: true, result: authoperate.UserInfo{}},
+	{method: "GET", path: "/users/:userId/diff", summary: "比较用户与with指定的用户的角色、路由权限和被授权的signKey", query: []string{"with"}, result: authoperate.UserAccessDiff{}},
+	{method: "GET", path: "/users/:userId/roles", summary: "查询用户拥有的角色", result: []authoperate.RoleUserListView{}},
+	{method: "GET", path: "/users/:userId/signs", summary: "查询用户拥有的signKey", etag: true, result: authoperate.UserSignList{}},
+	{method: "POST", path: "/users/:userId/signs", summary: "用户为自己创建signKey", status: http.StatusCreated, body: v2SignDesc{}, result: v2CreatedSign{}, guard: guardSelf},
+	{method: "PATCH", path: "/users/:userId/signs/:signKey", summary: "用户修改自己signKey的描述", status: http.StatusNoContent, ifMatch: true, body: v2SignDesc{}, guard: guardSelf},
+	{method: "POST", path: "/users/:userId/signs/:signKey/transfer", summary: "将signKey转给他人", status: http.StatusNoContent, body: v2SignTransfer{}, guard: guardSignManager},
+
+	{method: "GET", path: "/signs", summary: "signKey列表，分页返回", query: []string{"cursor", "limit", "prefix", "sort", "total"}, result: authoperate.SignPage{}},
+	{method: "GET", path: "/signs/:signKey", summary: "查询signKey已授权给的用户和相关路由方法", result: authoperate.SignListView{}},
+	{method: "PATCH", path: "/signs/:signKey/grants", summary: "为批量用户增量添加和删除signKey授权的路由和方法", status: http.StatusNoContent, body: v2SignGrantsPatch{}, guard: guardSignManager},
+	{method: "GET", path: "/signs/:signKey/grants/:userId/diff", summary: "授权给用户的路由和方法与所有开启数据权限的路由和方法的diff", result: []authoperate.RouteListView{}},
+	{method: "PUT", path: "/signs/:signKey/grants/:userId", summary: "整体替换授权给用户的路由和方法", status: http.StatusNoContent, ifMatch: true, body: v2SignGrant{}, guard: guardSignManager},
+	{method: "DELETE", path: "/signs/:signKey/grants/:userId", summary: "收回授权给用户的signKey", status: http.StatusNoContent, guard: guardSignManager},
+	{method: "POST", path: "/signs/:signKey/copies", summary: "将srcUserId被授权的路由和方法复制给其他用户", status: http.StatusNoContent, body: v2SignCopy{}, guard: guardSignManager},
+
+	{method: "GET", path: "/search/users", summary: "按userId或name搜索用户，mode为contains或prefix", query: []string{"q", "mode", "limit"}, result: []authoperate.UserDetail{}},
+	{method: "GET", path: "/search/routes", summary: "按uri或描述搜索路由，mode为contains或prefix", query: []string{"q", "mode", "limit"}, result: []authoperate.RouteListView{}},
+
+	{method: "GET", path: "/groups", summary: "查询所有组", result: []string{}, guard: guardSuperAdmin},
+	{method: "GET", path: "/check", summary: "解释用户使用signKey访问路由方法时是否有权限，以及权限来自哪些角色", query: []string{"url", "method", "userId", "signKey"}, result: oreo.CheckExplain{}},
+	{method: "GET", path: "/policy", summary: "导出组内的策略", result: oreo.Policy{}, guard: guardSuperAdmin},
+	{method: "POST", path: "/policy", summary: "导入策略", body: oreo.Policy{}, result: oreo.PolicyImportResult{}, guard: guardSuperAdmin},
+	{method: "POST", path: "/policy/plan", summary: "计算应用策略需要做的修改，不会写入数据库", body: v2PolicyPlan{}, result: oreo.PolicyPlan{}, guard: guardSuperAdmin},
+	{method: "POST", path: "/policy/apply", summary: "按策略修改组内的数据，返回执行的计划", body: v2PolicyPlan{}, result: oreo.PolicyPlan{}, guard: guardSuperAdmin},
+	{method: "POST", path: "/policy/diff", summary: "比较源组的策略与当前组", body: oreo.Policy{}, result: oreo.PolicyDiff{}, guard: guardSuperAdmin},
+	{method: "POST", path: "/policy/promote/plan", summary: "计算将源组选中的路由和角色提升到当前组需要做的修改，不会写入数据库", body: v2PolicyPromote{}, result: oreo.PolicyPlan{}, guard: guardSuperAdmin},
+	{method: "POST", path: "/policy/promote", summary: "按提升的计划修改当前组，返回执行的计划", body: v2PolicyPromote{}, result: oreo.PolicyPlan{}, guard: guardSuperAdmin},
+	{method: "POST", path: "/simulate", summary: "模拟权限变更，返回受影响的用户权限，不会写入数据库", body: AuthSimulate{}, result: simulateResult{}},
+
+	{method: "GET", path: "/snapshots", summary: "快照列表", result: []authoperate.SnapshotInfo{}, guard: guardSuperAdmin},
+	{method: "POST", path: "/snapshots", summary: "创建快照", status: http.StatusCreated, body: v2SnapshotCreate{}, result: authoperate.SnapshotInfo{}, guard: guardSuperAdmin},
+	{method: "GET", path: "/snapshots/:seq", summary: "查询快照的归档", result: authoperate.SnapshotArchive{}, guard: guardSuperAdmin},
+	{method: "DELETE", path: "/snapshots/:seq", summary: "删除快照", status: http.StatusNoContent, guard: guardSuperAdmin},
+	{method: "POST", path: "/snapshots/:seq/rollback", summary: "将组内的数据回滚到快照", status: http.StatusNoContent, guard: guardSuperAdmin},
+	{method: "GET", path: "/archive", summary: "导出组内全部数据的归档", result: authoperate.SnapshotArchive{}, guard: guardSuperAdmin},
+	{method: "POST", path: "/archive", summary: "用上传的归档替换组内的全部数据", status: http.StatusNoContent, body: authoperate.SnapshotArchive{}, guard: guardSuperAdmin},
+
+	{method: "GET", path: "/scopes", summary: "查询委托的管理范围", query: []string{"userId"}, result: []authoperate.AdminScope{}, guard: guardSuperAdmin},
+	{method: "POST", path: "/scopes", summary: "委托用户管理某个标签的角色成员或某个前缀下的路由", status: http.StatusCreated, body: AuthScope{}, result: authoperate.AdminScope{}, guard: guardSuperAdmin},
+	{method: "DELETE", path: "/scopes/:id", summary: "收回委托的管理范围", status: http.StatusNoContent, guard: guardSuperAdmin},
+}
+
+// 注册管理api的OpenAPI文档，GET {prefix}/oreo/auth/openapi.json，可选
+func OreoAuthOpenAPIRouter(router *gin.Engine, prefix string, mw ...gin.HandlerFunc) {
+	doc := AdminOpenAPI(prefix)
+	b, _ := json.Marshal(doc)
+
+	group := router.Group(fmt.Sprintf("%s/oreo/auth", prefix), mw...)
+	group.GET("/openapi.json", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", b)
+	})
+}
+
+// 生成管理api的OpenAPI 3文档，请求体和返回结果的schema由结构体的json tag反射得到
+func AdminOpenAPI(prefix string) map[string]interface{} {
+	g := &schemaGen{
+		schemas: make(map[string]interface{}),
+		names:   make(map[reflect.Type]string),
+	}
+
+	paths := make(map[string]map[string]interface{})
+	add := func(p string, d apiDoc, op map[string]interface{}) {
+		if _, ok := paths[p]; !ok {
+			paths[p] = make(map[string]interface{})
+		}
+		paths[p][strings.ToLower(d.method)] = op
+	}
+	for _, d := range adminAPIDocs {
+		add(path.Join(fmt.Sprintf("%s/oreo/auth", prefix), d.path), d, g.operation(d))
+	}
+	for _, d := range adminAPIV2Docs {
+		add(path.Join(fmt.Sprintf("%s/oreo/auth/v2", prefix), openAPIPath(d.path)), d, g.operationV2(d))
+	}
+
+	g.schemas["Response"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"code":   map[string]interface{}{"type": "integer", "description": "0表示成功"},
+			"msg":    map[string]interface{}{"type": "string"},
+			"result": map[string]interface{}{"type": "string", "description": "JSON序列化后的字符串，结构见x-oreo-result"},
+		},
+	}
+
+	g.schemas["ErrorResponse"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"error": g.schema(reflect.TypeOf(APIError{})),
+		},
+		"description": "v2接口的错误，客户端应根据error.code处理错误",
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.0",
+		"info": map[string]interface{}{
+			"title":   "oreo auth admin api",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.schemas,
+		},
+	}
+}
+
+type schemaGen struct {
+	schemas map[string]interface{}
+	names   map[reflect.Type]string
+}
+
+func (g *schemaGen) operation(d apiDoc) map[string]interface{} {
+	op := map[string]interface{}{
+		"summary": d.summary,
+	}
+
+	params := []interface{}{}
+	for _, q := range d.query {
+		params = append(params, map[string]interface{}{
+			"name":   q,
+			"in":     "query",
+			"schema": map[string]interface{}{"type": "string"},
+		})
+	}
+	if d.ifMatch {
+		params = append(params, map[string]interface{}{
+			"name":        "If-Match",
+			"in":          "header",
+			"description": "查询接口返回的ETag，与当前版本不一致时返回412",
+			"schema":      map[string]interface{}{"type": "string"},
+		})
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	if d.body != nil {
+		contentType := "application/json"
+		if s, ok := d.body.(string); ok && s == "" {
+			contentType = "application/octet-stream"
+		}
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				contentType: map[string]interface{}{"schema": g.schema(reflect.TypeOf(d.body))},
+			},
+		}
+	}
+
+	status := d.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	ok := map[string]interface{}{
+		"description": "OK",
+	}
+	if d.produce != "" {
+		ok["content"] = map[string]interface{}{
+			d.produce: map[string]interface{}{"schema": map[string]interface{}{}},
+		}
+	} else {
+		ok["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/Response"}},
+		}
+		if d.result != nil {
+			ok["x-oreo-result"] = g.schema(reflect.TypeOf(d.result))
+		}
+	}
+	if d.etag {
+		ok["headers"] = map[string]interface{}{
+			"ETag": map[string]interface{}{
+				"description": "查询结果为单个文档时返回其版本号",
+				"schema":      map[string]interface{}{"type": "string"},
+			},
+		}
+	}
+
+	errResp := map[string]interface{}{
+		"description": "请求参数或权限接口处理异常",
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/Response"}},
+		},
+	}
+
+	responses := map[string]interface{}{
+		fmt.Sprintf("%d", status): ok,
+		"400":                     errResp,
+	}
+	if d.ifMatch {
+		responses["412"] = map[string]interface{}{
+			"description": "数据已被他人修改",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/Response"}},
+			},
+		}
+	}
+	if d.guard != "" {
+		op["x-oreo-guard"] = d.guard
+		responses["401"] = map[string]interface{}{
+			"description": "未登录",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/Response"}},
+			},
+		}
+		responses["403"] = map[string]interface{}{
+			"description": "没有管理权限",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/Response"}},
+			},
+		}
+	}
+	op["responses"] = responses
+
+	return op
+}
+
+// gin的:param和*param转换为OpenAPI的{param}
+func openAPIPath(p string) string {
+	segs := strings.Split(p, "/")
+	for i, seg := range segs {
+		if strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*") {
+			segs[i] = "{" + seg[1:] + "}"
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+// v2接口的响应为原生JSON，错误为ErrorResponse，路径参数不存在时返回404
+func (g *schemaGen) operationV2(d apiDoc) map[string]interface{} {
+	op := map[string]interface{}{
+		"summary": d.summary,
+	}
+
+	params := []interface{}{}
+	for _, seg := range strings.Split(d.path, "/") {
+		if strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*") {
+			params = append(params, map[string]interface{}{
+				"name":     seg[1:],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+	}
+	hasPathParam := len(params) > 0
+	for _, q := range d.query {
+		params = append(params, map[string]interface{}{
+			"name":   q,
+			"in":     "query",
+			"schema": map[string]interface{}{"type": "string"},
+		})
+	}
+	if d.ifMatch {
+		params = append(params, map[string]interface{}{
+			"name":        "If-Match",
+			"in":          "header",
+			"required":    true,
+			"description": "查询接口返回的ETag，与当前版本不一致时返回412",
+			"schema":      map[string]interface{}{"type": "string"},
+		})
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	if d.body != nil {
+		contentType := "application/json"
+		if s, ok := d.body.(string); ok && s == "" {
+			contentType = "application/octet-stream"
+		}
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				contentType: map[string]interface{}{"schema": g.schema(reflect.TypeOf(d.body))},
+			},
+		}
+	}
+
+	status := d.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	ok := map[string]interface{}{
+		"description": http.StatusText(status),
+	}
+	if d.result != nil {
+		ok["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": g.schema(reflect.TypeOf(d.result))},
+		}
+	}
+	if d.etag {
+		ok["headers"] = map[string]interface{}{
+			"ETag": map[string]interface{}{
+				"description": "返回文档的版本号",
+				"schema":      map[string]interface{}{"type": "string"},
+			},
+		}
+	}
+
+	errResp := func(desc string) map[string]interface{} {
+		return map[string]interface{}{
+			"description": desc,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/ErrorResponse"}},
+			},
+		}
+	}
+
+	responses := map[string]interface{}{
+		fmt.Sprintf("%d", status): ok,
+		"400":                     errResp("请求体不是合法的JSON或权限接口处理异常"),
+		"422":                     errResp("请求参数校验失败"),
+	}
+	if hasPathParam || d.etag {
+		responses["404"] = errResp("资源不存在")
+	}
+	if d.ifMatch {
+		responses["412"] = errResp("数据已被他人修改")
+	}
+	if d.conflict {
+		responses["409"] = errResp("资源已存在")
+	}
+	if d.guard != "" {
+		op["x-oreo-guard"] = d.guard
+		responses["401"] = errResp("未登录")
+		responses["403"] = errResp("没有管理权限")
+	}
+	op["responses"] = responses
+
+	return op
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *schemaGen) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		return map[string]interface{}{"$ref": "#/components/schemas/" + g.structName(t)}
+	}
+
+	return map[string]interface{}{}
+}
+
+// 结构体只生成一次，名称冲突时加上包名
+func (g *schemaGen) structName(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+
+	name := t.Name()
+	if _, ok := g.schemas[name]; ok || name == "" {
+		name = path.Base(t.PkgPath()) + t.Name()
+	}
+	g.names[t] = name
+	g.schemas[name] = map[string]interface{}{}
+
+	props := make(map[string]interface{})
+	g.structFields(t, props)
+	g.schemas[name] = map[string]interface{}{
+		"type":       "object",
+		"properties": props,
+	}
+
+	return name
+}
+
+func (g *schemaGen) structFields(t reflect.Type, props map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.structFields(f.Type, props)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		props[name] = g.schema(f.Type)
+	}
+}
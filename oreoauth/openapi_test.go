@@ -0,0 +1,115 @@
+package oreoauth
+
+import (
+	"path"
+	"sort"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OreoAuthRouter、OreoAuthRouterV2和OreoAuthOpenAPIRouter注册的api必须与adminAPIDocs、adminAPIV2Docs一一对应
+func TestAdminAPIDescribed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	prefix := "/test"
+	base := prefix + "/oreo/auth"
+
+	router := gin.New()
+	OreoAuthRouter(router, prefix)
+	OreoAuthRouterV2(router, prefix)
+	OreoAuthOpenAPIRouter(router, prefix)
+
+	registered := make(map[string]struct{})
+	for _, r := range router.Routes() {
+		registered[r.Method+" "+r.Path] = struct{}{}
+	}
+
+	described := make(map[string]struct{})
+	describe := func(name, base string, docs []apiDoc) {
+		for _, d := range docs {
+			key := d.method + " " + path.Join(base, d.path)
+			if _, ok := described[key]; ok {
+				t.Errorf("%s describes %s more than once", name, key)
+			}
+			described[key] = struct{}{}
+		}
+	}
+	describe("adminAPIDocs", base, adminAPIDocs)
+	describe("adminAPIV2Docs", base+"/v2", adminAPIV2Docs)
+
+	missing := []string{}
+	for key := range registered {
+		if _, ok := described[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	for _, key := range missing {
+		t.Errorf("%s is registered but not described", key)
+	}
+
+	stale := []string{}
+	for key := range described {
+		if _, ok := registered[key]; !ok {
+			stale = append(stale, key)
+		}
+	}
+	sort.Strings(stale)
+	for _, key := range stale {
+		t.Errorf("%s is described but not registered", key)
+	}
+}
+
+func TestAdminOpenAPIV2(t *testing.T) {
+	paths := AdminOpenAPI("/test")["paths"].(map[string]map[string]interface{})
+
+	cases := []struct {
+		name      string
+		path      string
+		method    string
+		params    []string
+		responses []string
+	}{
+		{"path param", "/test/oreo/auth/v2/roles/{roleName}", "get", []string{"roleName"}, []string{"200", "404"}},
+		{"two path params", "/test/oreo/auth/v2/signs/{signKey}/grants/{userId}", "put", []string{"signKey", "userId", "If-Match"}, []string{"204", "401", "403", "412"}},
+		{"query", "/test/oreo/auth/v2/route", "get", []string{"url"}, []string{"200", "404"}},
+		{"conflict", "/test/oreo/auth/v2/users", "post", nil, []string{"201", "409", "422"}},
+	}
+
+	for _, c := range cases {
+		op, ok := paths[c.path][c.method].(map[string]interface{})
+		if !ok {
+			t.Errorf("%s: %s %s is not in the document", c.name, c.method, c.path)
+			continue
+		}
+
+		params := []string{}
+		if ps, ok := op["parameters"].([]interface{}); ok {
+			for _, p := range ps {
+				params = append(params, p.(map[string]interface{})["name"].(string))
+			}
+		}
+		for _, want := range c.params {
+			if !contains(params, want) {
+				t.Errorf("%s: parameters = %v, want %s", c.name, params, want)
+			}
+		}
+
+		responses := op["responses"].(map[string]interface{})
+		for _, want := range c.responses {
+			if _, ok := responses[want]; !ok {
+				t.Errorf("%s: no %s response", c.name, want)
+			}
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -24,6 +24,16 @@ func roleRouteDiff(c *gin.Context) {
 }
 
 func addRole(c *gin.Context) {
+	if _, ok := requireSuperAdmin(c); !ok {
+		return
+	}
+
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, HTTP_IF_MATCH_ERR, err.Error(), "", c)
+		return
+	}
+
 	bytes, err := ioutil.ReadAll(c.Request.Body)
 	if err != nil {
 		setStrResp(http.StatusBadRequest, HTTP_BODY_ERR, err.Error(), "", c)
@@ -50,9 +60,9 @@ func addRole(c *gin.Context) {
 		}
 	}
 
-	err = LibraOreoAuth.AddRole(role.RoleName, role.RoleDesc, role.RoleType, role.IsDefault, urlMethodVal)
+	err = LibraOreoAuth.AddRoleWithVersion(role.RoleName, role.RoleDesc, role.RoleType, role.IsDefault, urlMethodVal, version)
 	if err != nil {
-		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+		setOreoErrResp(err, c)
 		return
 	}
 
@@ -60,6 +70,10 @@ func addRole(c *gin.Context) {
 }
 
 func delRole(c *gin.Context) {
+	if _, ok := requireSuperAdmin(c); !ok {
+		return
+	}
+
 	roleName := strings.TrimSpace(c.Query("roleName"))
 
 	err := LibraOreoAuth.RemoveRole(roleName)
@@ -85,6 +99,12 @@ func queryUserRole(c *gin.Context) {
 }
 
 func addRoleUser(c *gin.Context) {
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, HTTP_IF_MATCH_ERR, err.Error(), "", c)
+		return
+	}
+
 	bytes, err := ioutil.ReadAll(c.Request.Body)
 	if err != nil {
 		setStrResp(http.StatusBadRequest, HTTP_BODY_ERR, err.Error(), "", c)
@@ -98,9 +118,13 @@ func addRoleUser(c *gin.Context) {
 		return
 	}
 
-	err = LibraOreoAuth.AddRoleUsers(roleUser.RoleName, roleUser.RoleUsers)
+	if _, ok := requireRoleUserManager(c, roleUser.RoleName); !ok {
+		return
+	}
+
+	err = LibraOreoAuth.AddRoleUsersWithVersion(roleUser.RoleName, roleUser.RoleUsers, version)
 	if err != nil {
-		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+		setOreoErrResp(err, c)
 		return
 	}
 
@@ -108,6 +132,12 @@ func addRoleUser(c *gin.Context) {
 }
 
 func delRoleUser(c *gin.Context) {
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, HTTP_IF_MATCH_ERR, err.Error(), "", c)
+		return
+	}
+
 	bytes, err := ioutil.ReadAll(c.Request.Body)
 	if err != nil {
 		setStrResp(http.StatusBadRequest, HTTP_BODY_ERR, err.Error(), "", c)
@@ -121,29 +151,60 @@ func delRoleUser(c *gin.Context) {
 		return
 	}
 
-	err = LibraOreoAuth.RemoveRoleUsers(roleUser.RoleName, roleUser.RoleUsers)
+	if _, ok := requireRoleUserManager(c, roleUser.RoleName); !ok {
+		return
+	}
+
+	err = LibraOreoAuth.RemoveRoleUsersWithVersion(roleUser.RoleName, roleUser.RoleUsers, version)
 	if err != nil {
-		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+		setOreoErrResp(err, c)
 		return
 	}
 
 	setStrResp(http.StatusOK, 0, "OK", "", c)
 }
 
+// roleName为空且传入limit或cursor时分页返回RolePage
 func queryRoleInfo(c *gin.Context) {
 	roleName := strings.TrimSpace(c.Query("roleName"))
 
+	if roleName == "" && paged(c) {
+		opts, err := listOptions(c)
+		if err != nil {
+			setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+			return
+		}
+
+		page, err := LibraOreoAuth.ListRoles(opts)
+		if err != nil {
+			setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+			return
+		}
+
+		res, _ := json.Marshal(page)
+		setStrResp(http.StatusOK, 0, "OK", string(res), c)
+		return
+	}
+
 	rl, err := LibraOreoAuth.GetRoleList(roleName)
 	if err != nil {
 		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
 		return
 	}
 
+	if roleName != "" && len(rl) == 1 {
+		setETag(rl[0].Version, c)
+	}
+
 	res, _ := json.Marshal(rl)
 	setStrResp(http.StatusOK, 0, "OK", string(res), c)
 }
 
 func setDefaultRole(c *gin.Context) {
+	if _, ok := requireSuperAdmin(c); !ok {
+		return
+	}
+
 	bytes, err := ioutil.ReadAll(c.Request.Body)
 	if err != nil {
 		setStrResp(http.StatusBadRequest, HTTP_BODY_ERR, err.Error(), "", c)
@@ -167,6 +228,16 @@ func setDefaultRole(c *gin.Context) {
 }
 
 func updateRoleTypeDesc(c *gin.Context) {
+	if _, ok := requireSuperAdmin(c); !ok {
+		return
+	}
+
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, HTTP_IF_MATCH_ERR, err.Error(), "", c)
+		return
+	}
+
 	bytes, err := ioutil.ReadAll(c.Request.Body)
 	if err != nil {
 		setStrResp(http.StatusBadRequest, HTTP_BODY_ERR, err.Error(), "", c)
@@ -180,7 +251,34 @@ func updateRoleTypeDesc(c *gin.Context) {
 		return
 	}
 
-	err = LibraOreoAuth.UpdateRoleTypeDesc(roleInfo.RoleName, roleInfo.RoleDesc, roleInfo.RoleType)
+	err = LibraOreoAuth.UpdateRoleTypeDescWithVersion(roleInfo.RoleName, roleInfo.RoleDesc, roleInfo.RoleType, version)
+	if err != nil {
+		setOreoErrResp(err, c)
+		return
+	}
+
+	setStrResp(http.StatusOK, 0, "OK", "", c)
+}
+
+func appendRoleRoute(c *gin.Context) {
+	if _, ok := requireSuperAdmin(c); !ok {
+		return
+	}
+
+	bytes, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, HTTP_BODY_ERR, err.Error(), "", c)
+		return
+	}
+
+	roleRoute := AuthRoleRoute{}
+	err = json.Unmarshal(bytes, &roleRoute)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, JSON_UNMARSHAL, err.Error(), "", c)
+		return
+	}
+
+	err = LibraOreoAuth.AppendRoleRoute(roleRoute.RoleName, urlMethodValues(roleRoute.UrlMethods))
 	if err != nil {
 		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
 		return
@@ -188,3 +286,63 @@ func updateRoleTypeDesc(c *gin.Context) {
 
 	setStrResp(http.StatusOK, 0, "OK", "", c)
 }
+
+func removeRoleRoute(c *gin.Context) {
+	if _, ok := requireSuperAdmin(c); !ok {
+		return
+	}
+
+	bytes, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, HTTP_BODY_ERR, err.Error(), "", c)
+		return
+	}
+
+	roleRoute := AuthRoleRoute{}
+	err = json.Unmarshal(bytes, &roleRoute)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, JSON_UNMARSHAL, err.Error(), "", c)
+		return
+	}
+
+	err = LibraOreoAuth.RemoveRoleRoute(roleRoute.RoleName, urlMethodValues(roleRoute.UrlMethods))
+	if err != nil {
+		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+		return
+	}
+
+	setStrResp(http.StatusOK, 0, "OK", "", c)
+}
+
+func setRoleTags(c *gin.Context) {
+	if _, ok := requireSuperAdmin(c); !ok {
+		return
+	}
+
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, HTTP_IF_MATCH_ERR, err.Error(), "", c)
+		return
+	}
+
+	bytes, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, HTTP_BODY_ERR, err.Error(), "", c)
+		return
+	}
+
+	roleTag := AuthRoleTag{}
+	err = json.Unmarshal(bytes, &roleTag)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, JSON_UNMARSHAL, err.Error(), "", c)
+		return
+	}
+
+	err = LibraOreoAuth.SetRoleTags(roleTag.RoleName, roleTag.Tags, version)
+	if err != nil {
+		setOreoErrResp(err, c)
+		return
+	}
+
+	setStrResp(http.StatusOK, 0, "OK", "", c)
+}
@@ -20,7 +20,26 @@ func printRoutes(c *gin.Context) {
 	setStrResp(http.StatusOK, 0, "OK", "", c)
 }
 
+// 传入limit或cursor时分页返回RoutePage
 func routeLists(c *gin.Context) {
+	if paged(c) {
+		opts, err := listOptions(c)
+		if err != nil {
+			setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+			return
+		}
+
+		page, err := LibraOreoAuth.ListRoutes(opts)
+		if err != nil {
+			setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+			return
+		}
+
+		res, _ := json.Marshal(page)
+		setStrResp(http.StatusOK, 0, "OK", string(res), c)
+		return
+	}
+
 	rs, err := LibraOreoAuth.GetRouteList()
 
 	if err != nil {
@@ -46,6 +65,15 @@ func addRoutes(c *gin.Context) {
 		return
 	}
 
+	urls := []string{}
+	for _, r := range routes {
+		urls = append(urls, r.Url)
+	}
+
+	if _, ok := requireRouteEditor(c, urls...); !ok {
+		return
+	}
+
 	err = LibraOreoAuth.AddRoute(routes)
 
 	if err != nil {
@@ -57,6 +85,12 @@ func addRoutes(c *gin.Context) {
 }
 
 func updateRouteDesc(c *gin.Context) {
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, HTTP_IF_MATCH_ERR, err.Error(), "", c)
+		return
+	}
+
 	bytes, err := ioutil.ReadAll(c.Request.Body)
 	if err != nil {
 		setStrResp(http.StatusBadRequest, HTTP_BODY_ERR, err.Error(), "", c)
@@ -70,12 +104,17 @@ func updateRouteDesc(c *gin.Context) {
 		return
 	}
 
-	err = LibraOreoAuth.UpdateRouteDesc(r.Url, r.Desc)
+	if _, ok := requireRouteEditor(c, r.Url); !ok {
+		return
+	}
+
+	err = LibraOreoAuth.UpdateRouteDescWithVersion(r.Url, r.Desc, version)
 	if err != nil {
-		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+		setOreoErrResp(err, c)
 		return
 	}
 
+	// 修改描述后版本号已经变化，方法描述的修改不再校验版本
 	for _, method := range r.Methods {
 		err = LibraOreoAuth.UpdateRouteMethodDesc(r.Url, method.Method, method.Desc)
 		if err != nil {
@@ -90,6 +129,10 @@ func updateRouteDesc(c *gin.Context) {
 func delRoute(c *gin.Context) {
 	url := strings.TrimSpace(c.Query("url"))
 
+	if _, ok := requireRouteEditor(c, url); !ok {
+		return
+	}
+
 	err := LibraOreoAuth.DeleteRoute(url)
 	if err != nil {
 		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
@@ -113,6 +156,10 @@ func enableDataAuth(c *gin.Context) {
 		return
 	}
 
+	if _, ok := requireRouteEditor(c, r.Url); !ok {
+		return
+	}
+
 	err = LibraOreoAuth.EnableRouteDataAuth(r.Url, r.Method)
 
 	if err != nil {
@@ -137,6 +184,10 @@ func disableDataAuth(c *gin.Context) {
 		return
 	}
 
+	if _, ok := requireRouteEditor(c, r.Url); !ok {
+		return
+	}
+
 	err = LibraOreoAuth.DisableRouteDataAuth(r.Url, r.Method)
 
 	if err != nil {
@@ -151,6 +202,10 @@ func delRouteMethod(c *gin.Context) {
 	url := c.Query("url")
 	method := c.Query("method")
 
+	if _, ok := requireRouteEditor(c, url); !ok {
+		return
+	}
+
 	err := LibraOreoAuth.DeleteRouteByMethod(url, method)
 
 	if err != nil {
@@ -162,6 +217,12 @@ func delRouteMethod(c *gin.Context) {
 }
 
 func updateRouteMethodDesc(c *gin.Context) {
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, HTTP_IF_MATCH_ERR, err.Error(), "", c)
+		return
+	}
+
 	bytes, err := ioutil.ReadAll(c.Request.Body)
 	if err != nil {
 		setStrResp(http.StatusBadRequest, HTTP_BODY_ERR, err.Error(), "", c)
@@ -175,10 +236,14 @@ func updateRouteMethodDesc(c *gin.Context) {
 		return
 	}
 
-	err = LibraOreoAuth.UpdateRouteMethodDesc(r.Url, r.Method, r.Desc)
+	if _, ok := requireRouteEditor(c, r.Url); !ok {
+		return
+	}
+
+	err = LibraOreoAuth.UpdateRouteMethodDescWithVersion(r.Url, r.Method, r.Desc, version)
 
 	if err != nil {
-		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+		setOreoErrResp(err, c)
 		return
 	}
 
@@ -207,6 +272,53 @@ func queryRouteInfo(c *gin.Context) {
 		return
 	}
 
+	if len(ris) == 1 && ris[0].Uri == strings.ToLower(strings.TrimSpace(url)) {
+		setETag(ris[0].Version, c)
+	}
+
 	res, _ := json.Marshal(ris)
 	setStrResp(http.StatusOK, 0, "OK", string(res), c)
 }
+
+// 请求体为OpenAPI的JSON或YAML文档，basePath会拼接在每个路由之前，dryRun=true时只返回解析结果
+func importOpenAPI(c *gin.Context) {
+	bytes, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, HTTP_BODY_ERR, err.Error(), "", c)
+		return
+	}
+
+	basePath := strings.TrimSpace(c.Query("basePath"))
+	dryRun := c.Query("dryRun") == "true"
+
+	// 先解析出需要导入的路由，再校验是否都在委托的范围内
+	plan, err := LibraOreoAuth.ImportOpenAPI(bytes, basePath, true)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+		return
+	}
+
+	urls := []string{}
+	for _, r := range plan.Routes {
+		urls = append(urls, r.Url)
+	}
+
+	if _, ok := requireRouteEditor(c, urls...); !ok {
+		return
+	}
+
+	if dryRun {
+		res, _ := json.Marshal(plan)
+		setStrResp(http.StatusOK, 0, "OK", string(res), c)
+		return
+	}
+
+	ir, err := LibraOreoAuth.ImportOpenAPI(bytes, basePath, dryRun)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+		return
+	}
+
+	res, _ := json.Marshal(ir)
+	setStrResp(http.StatusOK, 0, "OK", string(res), c)
+}
@@ -7,6 +7,8 @@ import (
 )
 
 func OreoAuthRouter(router *gin.Engine, prefix string, mw ...gin.HandlerFunc) {
+	adminBasePath = fmt.Sprintf("%s/oreo/auth", prefix)
+
 	group := router.Group(fmt.Sprintf("%s/oreo/auth", prefix), mw...)
 	{
 		//route相关api
@@ -23,13 +25,19 @@ func OreoAuthRouter(router *gin.Engine, prefix string, mw ...gin.HandlerFunc) {
 
 		group.PUT("/route/method/desc", updateRouteMethodDesc) //修改路由下某个Method的描述
 
-		group.GET("/route/info", queryRouteInfo) //查询某个url的路由信息，支持正则查询
+		group.GET("/route/info", queryRouteInfo) //查询某个url的路由信息，支持模糊查询
+		group.GET("/route/search", searchRoutes) //按uri或描述搜索路由，支持拼音
+
+		group.POST("/route/openapi", importOpenAPI) //从OpenAPI文档导入路由，支持dryRun
 
 		//role相关api
 		group.GET("/role", roleRouteDiff) //角色拥有的路由和方法与全局路由和方法的diff
 		group.POST("/role", addRole)      //添加角色
 		group.DELETE("/role", delRole)    //删除角色
 
+		group.PUT("/role/route", appendRoleRoute)  //为角色增量添加路由和方法
+		group.POST("/role/route", removeRoleRoute) //为角色增量删除路由和方法
+
 		group.GET("/role/user", queryUserRole) //查询用户拥有的角色，仅返回角色名称
 		group.POST("/role/user", addRoleUser)  //向角色添加用户
 		group.PUT("/role/user", delRoleUser)   //删除角色中的用户
@@ -38,22 +46,26 @@ func OreoAuthRouter(router *gin.Engine, prefix string, mw ...gin.HandlerFunc) {
 		group.PUT("/role/info", setDefaultRole)      //设置默认角色
 		group.POST("/role/info", updateRoleTypeDesc) //更新角色的类型和角色的描述
 
+		group.PUT("/role/tag", setRoleTags) //设置角色的标签，用于委托管理
+
 		//user相关api
 		group.GET("/user", queryUserInfo)       //查询用户信息
 		group.PUT("/user", queryUserInfoSimple) //查询所有用户信息，仅返回userId和name
+		group.GET("/user/search", searchUsers)  //按userId或name搜索用户，支持拼音
 		//group.POST("/user", addUser)      //添加用户
 
 		group.GET("/user/sign", userOwnSign)    //查询用户拥有的signKey信息
 		group.POST("/user/sign", addUserSign)   //用户添加自己signKey
 		group.PUT("/user/sign", updateUserSign) //用户修改自己signKey的描述
 
-		/*
-			此api放在sdk中有安全风险，原则上用户只能将自己的signKey转移给别人，当然超级管理员除外，
-			否则应该判断，系统的当前登录者与需要转移的signKey传参的所谓创建者是否是一致的，否则即会出现系统安全漏洞
-		*/
-		//group.POST("/user/sign/transfer", transferSign) // 将signKey转给他人
+		//只有signKey的创建者、被委托管理该signKey的用户和超管可以转让，创建者从数据库中查询
+		group.POST("/user/sign/transfer", transferSign) // 将signKey转给他人
 
 		group.GET("/user/role", userOwnRole) //查询用户拥有的角色信息
+		group.GET("/user/event", userEvent)  //以SSE推送当前登录用户的权限变更，支持Last-Event-ID断线重连
+
+		group.GET("/user/diff", compareUsers)      //比较两个用户的角色、路由权限和被授权的signKey
+		group.POST("/user/clone", cloneUserAccess) //让一个用户拥有与另一个用户相同的权限，支持dryRun
 
 		//sign相关api
 		group.GET("/sign", querySign)  //查询signKey已授权给的用户和相关路由方法
@@ -64,5 +76,18 @@ func OreoAuthRouter(router *gin.Engine, prefix string, mw ...gin.HandlerFunc) {
 		group.GET("/sign/users", signDiffGlobal) //某人拥有的signKey授权的路由与方法与所有开启数据权限路由和方法的diff
 		group.PUT("/sign/users", appendSignUri)  //为批量用户追加signKey的Uri Method
 		group.POST("/sign/users", removeSignUri) //为批量用户删除signKey的Uri Method
+
+		//委托管理相关api，仅超管可以操作
+		group.GET("/scope", queryAdminScope)  //查询委托的管理范围
+		group.POST("/scope", addAdminScope)   //委托用户管理某个标签的角色成员或某个前缀下的路由
+		group.DELETE("/scope", delAdminScope) //收回委托的管理范围
+
+		//权限分析相关api
+		group.POST("/simulate", simulatePolicy)      //模拟权限变更，返回受影响的用户权限，不会写入数据库
+		group.GET("/access/route", routeAccessUsers) //查询哪些用户拥有某个路由方法的权限
+		group.GET("/access/sign", signAccessUsers)   //查询哪些用户能够访问某个signKey下的数据，以及通过哪些路由
+
+		//导出相关api
+		group.GET("/export/matrix", exportPermissionMatrix) //下载所有用户的权限矩阵，支持csv和json格式
 	}
 }
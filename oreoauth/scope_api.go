@@ -0,0 +1,88 @@
+package oreoauth
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xkeyideal/oreo/authoperate"
+)
+
+func queryAdminScope(c *gin.Context) {
+	if _, ok := requireSuperAdmin(c); !ok {
+		return
+	}
+
+	userId := strings.TrimSpace(c.Query("userId"))
+
+	scopes, err := LibraOreoAuth.ListAdminScopes(userId)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+		return
+	}
+
+	res, _ := json.Marshal(scopes)
+	setStrResp(http.StatusOK, 0, "OK", string(res), c)
+}
+
+func addAdminScope(c *gin.Context) {
+	caller, ok := requireSuperAdmin(c)
+	if !ok {
+		return
+	}
+
+	bytes, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, HTTP_BODY_ERR, err.Error(), "", c)
+		return
+	}
+
+	as := AuthScope{}
+	err = json.Unmarshal(bytes, &as)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, JSON_UNMARSHAL, err.Error(), "", c)
+		return
+	}
+
+	as.UserId = strings.TrimSpace(as.UserId)
+	if as.UserId == "" {
+		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, "userId is empty", "", c)
+		return
+	}
+
+	var scope authoperate.AdminScope
+	switch as.Kind {
+	case authoperate.ScopeRoute:
+		scope, err = LibraOreoAuth.GrantRouteScope(as.UserId, as.Target, caller)
+	case authoperate.ScopeRoleUser:
+		scope, err = LibraOreoAuth.GrantRoleUserScope(as.UserId, as.Target, caller)
+	default:
+		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, "unsupported scope kind "+as.Kind, "", c)
+		return
+	}
+	if err != nil {
+		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+		return
+	}
+
+	res, _ := json.Marshal(scope)
+	setStrResp(http.StatusCreated, 0, "OK", string(res), c)
+}
+
+func delAdminScope(c *gin.Context) {
+	if _, ok := requireSuperAdmin(c); !ok {
+		return
+	}
+
+	id := strings.TrimSpace(c.Query("id"))
+
+	err := LibraOreoAuth.RevokeAdminScope(id)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+		return
+	}
+
+	setStrResp(http.StatusOK, 0, "OK", "", c)
+}
@@ -0,0 +1,64 @@
+package oreoauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xkeyideal/oreo/authoperate"
+)
+
+// 解析搜索参数，q为关键字，mode为contains或prefix
+func searchOptions(c *gin.Context) (authoperate.SearchOptions, error) {
+	opts := authoperate.SearchOptions{
+		Keyword: strings.TrimSpace(c.Query("q")),
+		Mode:    strings.TrimSpace(c.Query("mode")),
+	}
+
+	if limit := strings.TrimSpace(c.Query("limit")); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return opts, fmt.Errorf("invalid limit: %s", limit)
+		}
+		opts.Limit = n
+	}
+
+	return opts, nil
+}
+
+func searchUsers(c *gin.Context) {
+	opts, err := searchOptions(c)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+		return
+	}
+
+	ul, err := LibraOreoAuth.SearchUsers(opts)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+		return
+	}
+
+	res, _ := json.Marshal(ul)
+	setStrResp(http.StatusOK, 0, "OK", string(res), c)
+}
+
+func searchRoutes(c *gin.Context) {
+	opts, err := searchOptions(c)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+		return
+	}
+
+	rl, err := LibraOreoAuth.SearchRoutes(opts)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+		return
+	}
+
+	res, _ := json.Marshal(rl)
+	setStrResp(http.StatusOK, 0, "OK", string(res), c)
+}
@@ -11,6 +11,7 @@ import (
 
 func querySign(c *gin.Context) {
 	signKey := strings.TrimSpace(c.Query("signKey"))
+	userId := strings.TrimSpace(c.Query("userId"))
 
 	sl, err := LibraOreoAuth.GetSignByKey(signKey)
 	if err != nil {
@@ -18,11 +19,24 @@ func querySign(c *gin.Context) {
 		return
 	}
 
+	// 指定userId时返回该用户授权的版本号
+	for _, sv := range sl.SignViews {
+		if userId != "" && sv.UserId == userId {
+			setETag(sv.Version, c)
+		}
+	}
+
 	res, _ := json.Marshal(sl)
 	setStrResp(http.StatusOK, 0, "OK", string(res), c)
 }
 
 func addSign(c *gin.Context) {
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, HTTP_IF_MATCH_ERR, err.Error(), "", c)
+		return
+	}
+
 	bytes, err := ioutil.ReadAll(c.Request.Body)
 	if err != nil {
 		setStrResp(http.StatusBadRequest, HTTP_BODY_ERR, err.Error(), "", c)
@@ -36,6 +50,10 @@ func addSign(c *gin.Context) {
 		return
 	}
 
+	if _, ok := requireSignManager(c, sign.SignKey); !ok {
+		return
+	}
+
 	urlMethodVal := make(map[string]int)
 	for url, methods := range sign.UrlMethods {
 		methodVal := 0
@@ -49,9 +67,9 @@ func addSign(c *gin.Context) {
 		}
 	}
 
-	err = LibraOreoAuth.AddSign(sign.SignKey, sign.UserId, urlMethodVal)
+	err = LibraOreoAuth.AddSignWithVersion(sign.SignKey, sign.UserId, urlMethodVal, version)
 	if err != nil {
-		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+		setOreoErrResp(err, c)
 		return
 	}
 
@@ -72,6 +90,10 @@ func copySign(c *gin.Context) {
 		return
 	}
 
+	if _, ok := requireSignManager(c, sign.SignKey); !ok {
+		return
+	}
+
 	err = LibraOreoAuth.CopyUserSign(sign.SignKey, sign.SrcUserId, sign.DestUserIds)
 	if err != nil {
 		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
@@ -85,6 +107,10 @@ func delSign(c *gin.Context) {
 	userId := strings.TrimSpace(c.Query("userId"))
 	signKey := strings.TrimSpace(c.Query("signKey"))
 
+	if _, ok := requireSignManager(c, signKey); !ok {
+		return
+	}
+
 	err := LibraOreoAuth.RemoveSign(signKey, userId)
 	if err != nil {
 		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
@@ -122,6 +148,10 @@ func appendSignUri(c *gin.Context) {
 		return
 	}
 
+	if _, ok := requireSignManager(c, signUri.SignKey); !ok {
+		return
+	}
+
 	urlMethodVal := make(map[string]int)
 	for url, methods := range signUri.UrlMethods {
 		methodVal := 0
@@ -158,6 +188,10 @@ func removeSignUri(c *gin.Context) {
 		return
 	}
 
+	if _, ok := requireSignManager(c, signUri.SignKey); !ok {
+		return
+	}
+
 	urlMethodVal := make(map[string]int)
 	for url, methods := range signUri.UrlMethods {
 		methodVal := 0
@@ -0,0 +1,106 @@
+package oreoauth
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/xkeyideal/oreo"
+	"github.com/xkeyideal/oreo/authoperate"
+
+	"github.com/gin-gonic/gin"
+)
+
+type simulateResult struct {
+	Diffs []authoperate.PermissionDiff `json:"diffs"`
+	Flips []oreo.CheckFlip             `json:"flips"`
+}
+
+func policyChanges(authChanges []AuthPolicyChange) []authoperate.PolicyChange {
+	changes := []authoperate.PolicyChange{}
+
+	for _, ac := range authChanges {
+		change := authoperate.PolicyChange{
+			Type:     ac.Type,
+			RoleName: ac.RoleName,
+			RoleType: ac.RoleType,
+			UserIds:  ac.UserIds,
+			SignKey:  ac.SignKey,
+			Uri:      ac.Url,
+			Method:   ac.Method,
+		}
+
+		for url, methodVal := range urlMethodValues(ac.UrlMethods) {
+			if ac.Type == authoperate.ChangeSignRevoke {
+				// 收回授权时每个url单独作为一个变更
+				revoke := change
+				revoke.Uri = url
+				revoke.MethodValue = methodVal
+				changes = append(changes, revoke)
+				continue
+			}
+			change.AddrList = append(change.AddrList, authoperate.Address{
+				Uri:         url,
+				MethodValue: methodVal,
+			})
+		}
+
+		if ac.Type == authoperate.ChangeSignRevoke && len(ac.UrlMethods) > 0 {
+			continue
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes
+}
+
+// 模拟权限变更，返回受影响的用户权限和需要重放的校验记录中结果发生变化的记录，不会写入数据库
+func simulatePolicy(c *gin.Context) {
+	bytes, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, HTTP_BODY_ERR, err.Error(), "", c)
+		return
+	}
+
+	simulate := AuthSimulate{}
+	err = json.Unmarshal(bytes, &simulate)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, JSON_UNMARSHAL, err.Error(), "", c)
+		return
+	}
+
+	changes := policyChanges(simulate.Changes)
+
+	diffs, err := LibraOreoAuth.SimulatePolicy(changes)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+		return
+	}
+
+	result := simulateResult{
+		Diffs: diffs,
+		Flips: []oreo.CheckFlip{},
+	}
+
+	if len(simulate.Records) > 0 {
+		result.Flips, err = LibraOreoAuth.SimulateReplay(changes, recordLines(simulate.Records))
+		if err != nil {
+			setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+			return
+		}
+	}
+
+	res, _ := json.Marshal(result)
+	setStrResp(http.StatusOK, 0, "OK", string(res), c)
+}
+
+func recordLines(records []oreo.CheckRecord) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	for _, record := range records {
+		encoder.Encode(record)
+	}
+	return buf
+}
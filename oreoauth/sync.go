@@ -0,0 +1,218 @@
+package oreoauth
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xkeyideal/oreo/route"
+	"github.com/xkeyideal/oreo/vestigo"
+)
+
+type SyncOptions struct {
+	Add    bool     // 添加项目中有而数据库中没有的路由和方法
+	Delete bool     // 删除数据库中有而项目中没有的路由和方法
+	DryRun bool     // 只返回需要执行的操作，不写入数据库
+	Ignore []string // 不参与同步的路由前缀，例如 /oreo/auth
+}
+
+type SkipRoute struct {
+	Uri    string `json:"uri"`
+	Method string `json:"method"`
+	Reason string `json:"reason"`
+}
+
+type SyncResult struct {
+	DryRun  bool         `json:"dryRun"`
+	Diff    ProjectRoute `json:"diff"`
+	Added   []UrlMethod  `json:"added"`   //已添加或dryRun时将要添加的路由和方法
+	Deleted []UrlMethod  `json:"deleted"` //已删除或dryRun时将要删除的路由和方法，Exist为false表示删除整个路由
+	Skipped []SkipRoute  `json:"skipped"` //不支持的方法或不符合路由规则的路由
+}
+
+// 读取gin注册的所有路由，gin的 :param 和 *path 与oreo的路由规则一致
+func GinProjectRoutes(engine *gin.Engine) map[string][]string {
+	projectRoutes := make(map[string][]string)
+	for _, ri := range engine.Routes() {
+		projectRoutes[ri.Path] = append(projectRoutes[ri.Path], ri.Method)
+	}
+	return projectRoutes
+}
+
+// 读取vestigo注册的所有路由
+func VestigoProjectRoutes(router *vestigo.Router) map[string][]string {
+	projectRoutes := make(map[string][]string)
+	for _, r := range router.GetAllRoutes() {
+		projectRoutes[r.Path()] = append(projectRoutes[r.Path()], r.Method())
+	}
+	return projectRoutes
+}
+
+// 将项目的路由与数据库中的路由比较，按opts添加和删除路由，适合在服务启动时调用，
+// 项目路由可以由GinProjectRoutes或VestigoProjectRoutes得到
+func SyncOreoProjectRoutes(projectRoutes map[string][]string, opts SyncOptions) (SyncResult, error) {
+	result := SyncResult{
+		DryRun:  opts.DryRun,
+		Added:   []UrlMethod{},
+		Deleted: []UrlMethod{},
+	}
+
+	routes, skipped := normalizeProjectRoutes(projectRoutes, opts.Ignore)
+	result.Skipped = skipped
+
+	diff, err := DiffOreoProjectRoutes(routes)
+	if err != nil {
+		return result, err
+	}
+	result.Diff = diff
+
+	added, deleted := planSync(routes, diff, opts)
+	result.Added = added
+	if opts.DryRun {
+		result.Deleted = deleted
+		return result, nil
+	}
+
+	if len(added) > 0 {
+		addRoutes := []route.RouteData{}
+		for _, um := range added {
+			methods := []route.RouteMethodData{}
+			for _, method := range um.Methods {
+				methods = append(methods, route.RouteMethodData{Method: method})
+			}
+			addRoutes = append(addRoutes, route.RouteData{
+				Url:     um.Uri,
+				UrlDesc: um.Desc,
+				Methods: methods,
+			})
+		}
+
+		if err := LibraOreoAuth.AddRoute(addRoutes); err != nil {
+			return result, err
+		}
+	}
+
+	for _, um := range deleted {
+		result.Deleted = append(result.Deleted, um)
+
+		if !um.Exist {
+			if err := LibraOreoAuth.DeleteRoute(um.Uri); err != nil {
+				return result, err
+			}
+			continue
+		}
+
+		for _, method := range um.Methods {
+			if err := LibraOreoAuth.DeleteRouteByMethod(um.Uri, method); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// 按opts计算需要添加和删除的路由和方法，routes为规范化后的项目路由，
+// 项目中完全不存在的路由整个删除(Exist为false)，否则只删除多余的方法
+func planSync(routes map[string][]string, diff ProjectRoute, opts SyncOptions) ([]UrlMethod, []UrlMethod) {
+	added := []UrlMethod{}
+	if opts.Add {
+		added = append(added, diff.ExportRoutes...)
+	}
+
+	deleted := []UrlMethod{}
+	if !opts.Delete {
+		return added, deleted
+	}
+
+	for _, rl := range diff.IllegalRoutes {
+		if ignoreRoute(rl.Uri, opts.Ignore) {
+			continue
+		}
+
+		methods := []string{}
+		for _, m := range rl.Methods {
+			methods = append(methods, m.Method)
+		}
+		sort.Strings(methods)
+
+		_, exist := routes[rl.Uri]
+		deleted = append(deleted, UrlMethod{
+			Uri:     rl.Uri,
+			Exist:   exist,
+			Desc:    rl.Desc,
+			Methods: methods,
+		})
+	}
+
+	return added, deleted
+}
+
+// 统一为小写、去掉末尾的/，过滤掉oreo不支持的方法和不符合规则的路由
+func normalizeProjectRoutes(projectRoutes map[string][]string, ignore []string) (map[string][]string, []SkipRoute) {
+	routes := make(map[string][]string)
+	skipped := []SkipRoute{}
+
+	for uri, methods := range projectRoutes {
+		url := strings.ToLower(strings.TrimSpace(uri))
+		if len(url) > 1 {
+			url = strings.TrimRight(url, "/")
+		}
+
+		if ignoreRoute(url, ignore) {
+			continue
+		}
+
+		if err := route.RouteRuleCheck(url); err != nil {
+			for _, method := range methods {
+				skipped = append(skipped, SkipRoute{Uri: uri, Method: method, Reason: err.Error()})
+			}
+			continue
+		}
+
+		for _, method := range methods {
+			method = strings.ToUpper(strings.TrimSpace(method))
+			if methodString2Num(method) == 0 {
+				skipped = append(skipped, SkipRoute{Uri: uri, Method: method, Reason: "unsupported method"})
+				continue
+			}
+
+			exist := false
+			for _, m := range routes[url] {
+				if m == method {
+					exist = true
+					break
+				}
+			}
+			if !exist {
+				routes[url] = append(routes[url], method)
+			}
+		}
+	}
+
+	sort.Slice(skipped, func(i, j int) bool {
+		if skipped[i].Uri != skipped[j].Uri {
+			return skipped[i].Uri < skipped[j].Uri
+		}
+		return skipped[i].Method < skipped[j].Method
+	})
+
+	return routes, skipped
+}
+
+// 按路径分段匹配忽略的前缀，与ScopeCheckRoute一致，/oreo/auth 不包含 /oreo/authx
+func ignoreRoute(url string, ignore []string) bool {
+	for _, prefix := range ignore {
+		prefix = strings.ToLower(strings.TrimSpace(prefix))
+		if len(prefix) > 1 {
+			prefix = strings.TrimRight(prefix, "/")
+		}
+		if prefix == "" {
+			continue
+		}
+		if prefix == "/" || url == prefix || strings.HasPrefix(url, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package oreoauth
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/xkeyideal/oreo/authoperate"
+)
+
+func TestIgnoreRoute(t *testing.T) {
+	cases := []struct {
+		name   string
+		url    string
+		ignore []string
+		want   bool
+	}{
+		{"no ignore", "/oreo/auth", nil, false},
+		{"same route", "/oreo/auth", []string{"/oreo/auth"}, true},
+		{"sub route", "/oreo/auth/v2/roles", []string{"/oreo/auth"}, true},
+		{"sibling with the same prefix", "/oreo/authx", []string{"/oreo/auth"}, false},
+		{"trailing slash and case", "/oreo/auth/role", []string{" /OREO/Auth/ "}, true},
+		{"root", "/api/a", []string{"/"}, true},
+		{"blank prefix", "/api/a", []string{" "}, false},
+		{"param segment", "/api/users/:id", []string{"/api/users"}, true},
+	}
+
+	for _, c := range cases {
+		if got := ignoreRoute(c.url, c.ignore); got != c.want {
+			t.Errorf("%s: ignoreRoute(%s, %v) = %t, want %t", c.name, c.url, c.ignore, got, c.want)
+		}
+	}
+}
+
+func TestNormalizeProjectRoutes(t *testing.T) {
+	routes, skipped := normalizeProjectRoutes(map[string][]string{
+		"/API/Users/:id/":     {"get", "GET", "Patch"},
+		"/files/*path":        {"GET", " post "},
+		"/oreo/auth/v2/roles": {"GET"},
+		"/oreo/authx":         {"GET"},
+		"/a//b":               {"GET"},
+		"/":                   {"HEAD"},
+	}, []string{"/oreo/auth"})
+
+	wantRoutes := map[string][]string{
+		"/api/users/:id": {"GET"},
+		"/files/*path":   {"GET", "POST"},
+		"/oreo/authx":    {"GET"},
+	}
+	if !reflect.DeepEqual(routes, wantRoutes) {
+		t.Errorf("routes = %v, want %v", routes, wantRoutes)
+	}
+
+	got := []string{}
+	for _, s := range skipped {
+		got = append(got, fmt.Sprintf("%s %s: %s", s.Method, s.Uri, s.Reason))
+	}
+	want := []string{
+		"HEAD /: route can't be '/'",
+		"PATCH /API/Users/:id/: unsupported method",
+		"GET /a//b: route param is empty",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("skipped = %q, want %q", got, want)
+	}
+}
+
+func TestPlanSync(t *testing.T) {
+	routes := map[string][]string{
+		"/api/a": {"GET", "POST"},
+		"/api/c": {"GET"},
+	}
+	oreoRoutes := []authoperate.RouteListView{
+		{Uri: "/api/a", Methods: []authoperate.RouteMethod{{Method: "GET"}, {Method: "PUT"}, {Method: "DELETE"}}},
+		{Uri: "/api/b", Desc: "b", Methods: []authoperate.RouteMethod{{Method: "GET"}}},
+		{Uri: "/oreo/auth/route", Methods: []authoperate.RouteMethod{{Method: "GET"}}},
+		{Uri: "/oreo/authx", Methods: []authoperate.RouteMethod{{Method: "GET"}}},
+	}
+	diff := diffProjectRoutes(oreoRoutes, routes)
+
+	format := func(ums []UrlMethod) []string {
+		list := []string{}
+		for _, um := range ums {
+			methods := append([]string{}, um.Methods...)
+			sort.Strings(methods)
+			list = append(list, fmt.Sprintf("%s %v exist=%t", um.Uri, methods, um.Exist))
+		}
+		return list
+	}
+
+	cases := []struct {
+		name    string
+		opts    SyncOptions
+		added   []string
+		deleted []string
+	}{
+		{"diff only", SyncOptions{}, []string{}, []string{}},
+		{"add", SyncOptions{Add: true}, []string{
+			"/api/a [POST] exist=true",
+			"/api/c [GET] exist=false",
+		}, []string{}},
+		{"delete", SyncOptions{Delete: true}, []string{}, []string{
+			"/api/a [DELETE PUT] exist=true",
+			"/api/b [GET] exist=false",
+			"/oreo/auth/route [GET] exist=false",
+			"/oreo/authx [GET] exist=false",
+		}},
+		{"delete with ignore", SyncOptions{Add: true, Delete: true, Ignore: []string{"/oreo/auth/"}}, []string{
+			"/api/a [POST] exist=true",
+			"/api/c [GET] exist=false",
+		}, []string{
+			"/api/a [DELETE PUT] exist=true",
+			"/api/b [GET] exist=false",
+			"/oreo/authx [GET] exist=false",
+		}},
+	}
+
+	for _, c := range cases {
+		added, deleted := planSync(routes, diff, c.opts)
+		if got := format(added); !reflect.DeepEqual(got, c.added) {
+			t.Errorf("%s: added = %q, want %q", c.name, got, c.added)
+		}
+		if got := format(deleted); !reflect.DeepEqual(got, c.deleted) {
+			t.Errorf("%s: deleted = %q, want %q", c.name, got, c.deleted)
+		}
+	}
+}
@@ -22,7 +22,26 @@ func queryUserInfo(c *gin.Context) {
 	setStrResp(http.StatusOK, 0, "OK", string(res), c)
 }
 
+// 传入limit或cursor时分页返回UserPage
 func queryUserInfoSimple(c *gin.Context) {
+	if paged(c) {
+		opts, err := listOptions(c)
+		if err != nil {
+			setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+			return
+		}
+
+		page, err := LibraOreoAuth.ListUsers(opts)
+		if err != nil {
+			setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+			return
+		}
+
+		res, _ := json.Marshal(page)
+		setStrResp(http.StatusOK, 0, "OK", string(res), c)
+		return
+	}
+
 	ul, err := LibraOreoAuth.GetAllUsers()
 	if err != nil {
 		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
@@ -65,6 +84,8 @@ func userOwnSign(c *gin.Context) {
 		return
 	}
 
+	setETag(ul.Version, c)
+
 	res, _ := json.Marshal(ul)
 	setStrResp(http.StatusOK, 0, "OK", string(res), c)
 }
@@ -96,7 +117,12 @@ func addUserSign(c *gin.Context) {
 		return
 	}
 
-	signKey, err := LibraOreoAuth.CreateUserSignKey(userSign.UserId, userSign.SignDesc)
+	userId, ok := requireSelf(c, userSign.UserId)
+	if !ok {
+		return
+	}
+
+	signKey, err := LibraOreoAuth.CreateUserSignKey(userId, userSign.SignDesc)
 	if err != nil {
 		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
 		return
@@ -106,6 +132,12 @@ func addUserSign(c *gin.Context) {
 }
 
 func updateUserSign(c *gin.Context) {
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, HTTP_IF_MATCH_ERR, err.Error(), "", c)
+		return
+	}
+
 	bytes, err := ioutil.ReadAll(c.Request.Body)
 	if err != nil {
 		setStrResp(http.StatusBadRequest, HTTP_BODY_ERR, err.Error(), "", c)
@@ -119,7 +151,61 @@ func updateUserSign(c *gin.Context) {
 		return
 	}
 
-	err = LibraOreoAuth.UpdateUserSignKey(userSign.UserId, userSign.SignKey, userSign.SignDesc)
+	userId, ok := requireSelf(c, userSign.UserId)
+	if !ok {
+		return
+	}
+
+	err = LibraOreoAuth.UpdateUserSignKeyWithVersion(userId, userSign.SignKey, userSign.SignDesc, version)
+	if err != nil {
+		setOreoErrResp(err, c)
+		return
+	}
+
+	setStrResp(http.StatusOK, 0, "OK", "", c)
+}
+
+// signKey的原创建者从数据库中查询，不信任请求中的userId
+func transferSign(c *gin.Context) {
+	bytes, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, HTTP_BODY_ERR, err.Error(), "", c)
+		return
+	}
+
+	transfer := AuthSignTransfer{}
+	err = json.Unmarshal(bytes, &transfer)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, JSON_UNMARSHAL, err.Error(), "", c)
+		return
+	}
+
+	if _, ok := requireSignManager(c, transfer.SignKey); !ok {
+		return
+	}
+
+	ownerId, err := LibraOreoAuth.SignKeyOwner(transfer.SignKey)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+		return
+	}
+
+	// 未传描述时沿用原创建者的描述
+	signDesc := transfer.SignDesc
+	if signDesc == "" {
+		usl, err := LibraOreoAuth.UserOwnSigns(ownerId)
+		if err != nil {
+			setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+			return
+		}
+		for _, own := range usl.OwnSigns {
+			if own.SignKey == transfer.SignKey {
+				signDesc = own.Desc
+			}
+		}
+	}
+
+	err = LibraOreoAuth.UserTransferSignKey(transfer.SignKey, signDesc, ownerId, transfer.DestUserId)
 	if err != nil {
 		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
 		return
@@ -127,3 +213,45 @@ func updateUserSign(c *gin.Context) {
 
 	setStrResp(http.StatusOK, 0, "OK", "", c)
 }
+
+func compareUsers(c *gin.Context) {
+	userId := strings.TrimSpace(c.Query("userId"))
+	otherUserId := strings.TrimSpace(c.Query("otherUserId"))
+
+	diff, err := LibraOreoAuth.CompareUsers(userId, otherUserId)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+		return
+	}
+
+	res, _ := json.Marshal(diff)
+	setStrResp(http.StatusOK, 0, "OK", string(res), c)
+}
+
+func cloneUserAccess(c *gin.Context) {
+	if _, ok := requireSuperAdmin(c); !ok {
+		return
+	}
+
+	bytes, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, HTTP_BODY_ERR, err.Error(), "", c)
+		return
+	}
+
+	clone := AuthUserClone{}
+	err = json.Unmarshal(bytes, &clone)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, JSON_UNMARSHAL, err.Error(), "", c)
+		return
+	}
+
+	actions, err := LibraOreoAuth.CloneUserAccess(clone.SrcUserId, clone.DestUserId, clone.DryRun)
+	if err != nil {
+		setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+		return
+	}
+
+	res, _ := json.Marshal(actions)
+	setStrResp(http.StatusOK, 0, "OK", string(res), c)
+}
@@ -2,9 +2,12 @@ package oreoauth
 
 import (
 	"fmt"
+	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/xkeyideal/oreo/authoperate"
 )
 
 const (
@@ -12,6 +15,12 @@ const (
 	JSON_UNMARSHAL = 10001
 	HTTP_BODY_ERR  = 10002
 	OREO_AUTH_ERR  = 10003
+
+	OREO_VERSION_CONFLICT = 10004
+	HTTP_IF_MATCH_ERR     = 10005
+
+	OREO_UNAUTHENTICATED = 10006
+	OREO_FORBIDDEN       = 10007
 )
 
 var errCodeMsg = map[int]string{
@@ -20,6 +29,12 @@ var errCodeMsg = map[int]string{
 
 	HTTP_BODY_ERR: "[HTTP BODY读取异常]: ",
 	OREO_AUTH_ERR: "[权限接口处理异常]: ",
+
+	OREO_VERSION_CONFLICT: "[数据已被他人修改，请刷新后重试]: ",
+	HTTP_IF_MATCH_ERR:     "[If-Match请求头格式错误]: ",
+
+	OREO_UNAUTHENTICATED: "[未登录]: ",
+	OREO_FORBIDDEN:       "[没有管理权限]: ",
 }
 
 func setStrResp(httpCode, code int, msg, result string, c *gin.Context) {
@@ -37,6 +52,38 @@ func setStrResp(httpCode, code int, msg, result string, c *gin.Context) {
 	})
 }
 
+// 版本冲突返回412，其他错误与原来一致
+func setOreoErrResp(err error, c *gin.Context) {
+	if err == authoperate.ErrVersionConflict {
+		setStrResp(http.StatusPreconditionFailed, OREO_VERSION_CONFLICT, err.Error(), "", c)
+		return
+	}
+
+	setStrResp(http.StatusBadRequest, OREO_AUTH_ERR, err.Error(), "", c)
+}
+
+// 单个文档的查询结果以ETag返回其版本号
+func setETag(version int64, c *gin.Context) {
+	c.Header("ETag", fmt.Sprintf(`"%d"`, version))
+}
+
+// 解析If-Match请求头中的版本号，未传或为*时返回0，表示不校验版本。
+// 文档的版本号从1开始，If-Match为0时返回错误，不能用来关闭版本校验
+func ifMatchVersion(c *gin.Context) (int64, error) {
+	etag := strings.TrimSpace(c.GetHeader("If-Match"))
+	if etag == "" || etag == "*" {
+		return 0, nil
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	version, err := strconv.ParseInt(strings.Trim(etag, `"`), 10, 64)
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid If-Match: %s", etag)
+	}
+
+	return version, nil
+}
+
 func methodString2Num(method string) int {
 	val := 0
 	method = strings.ToUpper(strings.TrimSpace(method))
@@ -53,24 +100,50 @@ func methodString2Num(method string) int {
 	return val
 }
 
-func PermissionFilter(c *gin.Context) {
-	userId := c.Request.Header.Get("userId")
-	signKey := c.Request.Header.Get("signKey")
+// 将url对应的方法列表转换为url对应的方法整型值之和
+func urlMethodValues(urlMethods map[string][]string) map[string]int {
+	urlMethodVal := make(map[string]int)
+	for url, methods := range urlMethods {
+		methodVal := 0
+		for _, method := range methods {
+			methodVal |= methodString2Num(method)
+		}
+
+		if methodVal > 0 {
+			url = strings.ToLower(strings.TrimSpace(url))
+			urlMethodVal[url] = methodVal
+		}
+	}
+	return urlMethodVal
+}
 
-	uri := c.Request.URL.Path
-	//fmt.Println(uri, c.Request.Method)
+// 读取userId和signKey请求头校验权限，未登录返回401，没有权限返回403，需要其他方式获取登录用户时使用NewPermissionFilter
+var PermissionFilter = NewPermissionFilter(FilterOptions{})
 
-	_, ok, err := LibraOreoAuth.CheckUserAuth(uri, c.Request.Method, userId, signKey)
-	//fmt.Println(userId, isAdmin, ok)
+// 解析列表接口的分页、过滤和排序参数
+func listOptions(c *gin.Context) (authoperate.ListOptions, error) {
+	opts := authoperate.ListOptions{
+		Cursor:    strings.TrimSpace(c.Query("cursor")),
+		Prefix:    strings.TrimSpace(c.Query("prefix")),
+		RoleName:  strings.TrimSpace(c.Query("roleName")),
+		Tag:       strings.TrimSpace(c.Query("tag")),
+		Sort:      strings.TrimSpace(c.Query("sort")),
+		DataAuth:  c.Query("dataAuth") == "true",
+		WithTotal: c.Query("total") == "true",
+	}
 
-	if !ok {
-		c.JSON(0, gin.H{
-			"code": 401,
-			"msg":  err,
-		})
-		c.Abort()
-		return
+	if limit := strings.TrimSpace(c.Query("limit")); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return opts, fmt.Errorf("invalid limit: %s", limit)
+		}
+		opts.Limit = n
 	}
 
-	c.Next()
+	return opts, nil
+}
+
+// 传入limit或cursor时列表接口分页返回，否则保持原来的全量返回
+func paged(c *gin.Context) bool {
+	return c.Query("limit") != "" || c.Query("cursor") != ""
 }
@@ -0,0 +1,250 @@
+package oreoauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xkeyideal/oreo"
+	"github.com/xkeyideal/oreo/authoperate"
+)
+
+// v2接口的错误码，客户端应根据错误码而不是错误信息处理错误
+const (
+	ErrCodeInvalidJSON     = "invalid_json"      // 请求体不是合法的JSON或包含未知字段
+	ErrCodeValidation      = "validation_failed" // 请求参数校验失败，details中为具体的字段
+	ErrCodeInvalidIfMatch  = "invalid_if_match"  // If-Match请求头格式错误
+	ErrCodeUnauthenticated = "unauthenticated"   // 未登录
+	ErrCodeForbidden       = "forbidden"         // 没有管理权限
+	ErrCodeNotFound        = "not_found"         // 资源不存在
+	ErrCodeAlreadyExists   = "already_exists"    // 资源已存在
+	ErrCodeVersionConflict = "version_conflict"  // If-Match的版本号与当前版本不一致
+	ErrCodeOperationFailed = "operation_failed"  // 权限数据处理失败
+)
+
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+type APIError struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Details []FieldError `json:"details,omitempty"`
+}
+
+type apiErrorResp struct {
+	Error APIError `json:"error"`
+}
+
+func v2Error(c *gin.Context, status int, code, msg string, details ...FieldError) {
+	c.AbortWithStatusJSON(status, apiErrorResp{
+		Error: APIError{
+			Code:    code,
+			Message: msg,
+			Details: details,
+		},
+	})
+}
+
+// 将权限校验和Oreo返回的错误转换为对应的状态码和错误码
+func v2OreoError(c *gin.Context, err error) {
+	if ge, ok := err.(*guardError); ok {
+		code := ErrCodeForbidden
+		if ge.status == http.StatusUnauthorized {
+			code = ErrCodeUnauthenticated
+		}
+		v2Error(c, ge.status, code, ge.msg)
+		return
+	}
+
+	switch err {
+	case authoperate.ErrVersionConflict, oreo.ErrPlanStale:
+		v2Error(c, http.StatusPreconditionFailed, ErrCodeVersionConflict, err.Error())
+	case authoperate.ErrNotFound:
+		v2Error(c, http.StatusNotFound, ErrCodeNotFound, err.Error())
+	default:
+		v2Error(c, http.StatusBadRequest, ErrCodeOperationFailed, err.Error())
+	}
+}
+
+func v2NotFound(c *gin.Context, format string, args ...interface{}) {
+	v2Error(c, http.StatusNotFound, ErrCodeNotFound, fmt.Sprintf(format, args...))
+}
+
+// 解析JSON请求体，不允许未知字段
+func v2BindJSON(c *gin.Context, v interface{}) bool {
+	dec := json.NewDecoder(c.Request.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		v2Error(c, http.StatusBadRequest, ErrCodeInvalidJSON, err.Error())
+		return false
+	}
+	return true
+}
+
+func v2IfMatch(c *gin.Context) (int64, bool) {
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		v2Error(c, http.StatusBadRequest, ErrCodeInvalidIfMatch, err.Error())
+		return 0, false
+	}
+	return version, true
+}
+
+// If-Match的版本号与查询到的版本号不一致时返回412
+func v2CheckVersion(c *gin.Context, version, current int64) bool {
+	if version > 0 && version != current {
+		v2OreoError(c, authoperate.ErrVersionConflict)
+		return false
+	}
+	return true
+}
+
+// 解析列表接口的分页、过滤和排序参数，limit错误时返回422
+func v2ListOptions(c *gin.Context) (authoperate.ListOptions, bool) {
+	opts, err := listOptions(c)
+	if err != nil {
+		v := &validator{}
+		v.add("limit", "must be a positive integer")
+		v.check(c)
+		return opts, false
+	}
+	return opts, true
+}
+
+// 收集请求参数的校验错误
+type validator struct {
+	errs []FieldError
+}
+
+func (v *validator) add(field, format string, args ...interface{}) {
+	v.errs = append(v.errs, FieldError{Field: field, Reason: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) required(field, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.add(field, "is required")
+	}
+}
+
+func (v *validator) url(field, url string) {
+	url = strings.TrimSpace(url)
+	if url == "" {
+		v.add(field, "is required")
+	} else if !strings.HasPrefix(url, "/") {
+		v.add(field, "must start with /")
+	}
+}
+
+func (v *validator) method(field, method string) {
+	if methodString2Num(method) == 0 {
+		v.add(field, "must be one of GET, POST, PUT, DELETE")
+	}
+}
+
+func (v *validator) urlMethods(field string, urlMethods map[string][]string) {
+	urls := []string{}
+	for url := range urlMethods {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+
+	for _, url := range urls {
+		methods := urlMethods[url]
+		v.url(fmt.Sprintf("%s[%s]", field, url), url)
+		if len(methods) == 0 {
+			v.add(fmt.Sprintf("%s[%s]", field, url), "methods are required")
+		}
+		for i, method := range methods {
+			v.method(fmt.Sprintf("%s[%s][%d]", field, url, i), method)
+		}
+	}
+}
+
+// 有校验错误时返回422
+func (v *validator) check(c *gin.Context) bool {
+	if len(v.errs) == 0 {
+		return true
+	}
+	v2Error(c, http.StatusUnprocessableEntity, ErrCodeValidation, "request validation failed", v.errs...)
+	return false
+}
+
+// 注册v2管理api，{prefix}/oreo/auth/v2，资源化的路由、原生JSON请求和响应、标准的HTTP状态码和统一的错误格式，
+// 与v1接口可以同时注册
+func OreoAuthRouterV2(router *gin.Engine, prefix string, mw ...gin.HandlerFunc) {
+	adminBasePath = fmt.Sprintf("%s/oreo/auth", prefix)
+
+	group := router.Group(fmt.Sprintf("%s/oreo/auth/v2", prefix), mw...)
+	{
+		group.GET("/routes", v2ListRoutes)
+		group.POST("/routes", v2CreateRoutes)
+		group.POST("/routes/openapi", v2ImportOpenAPI)
+		group.GET("/route", v2GetRoute) //路由包含/，以url参数指定
+		group.PATCH("/route", v2PatchRoute)
+		group.DELETE("/route", v2DeleteRoute)
+		group.PATCH("/route/methods/:method", v2PatchRouteMethod)
+		group.DELETE("/route/methods/:method", v2DeleteRouteMethod)
+
+		group.GET("/roles", v2ListRoles)
+		group.POST("/roles", v2CreateRole)
+		group.GET("/roles/:roleName", v2GetRole)
+		group.PUT("/roles/:roleName", v2ReplaceRole)
+		group.PATCH("/roles/:roleName", v2PatchRole)
+		group.DELETE("/roles/:roleName", v2DeleteRole)
+		group.PUT("/roles/:roleName/default", v2SetDefaultRole)
+		group.GET("/roles/:roleName/routes", v2RoleRoutes)
+		group.PATCH("/roles/:roleName/routes", v2PatchRoleRoutes)
+		group.GET("/roles/:roleName/users", v2RoleUsers)
+		group.POST("/roles/:roleName/users", v2AddRoleUsers)
+		group.DELETE("/roles/:roleName/users/:userId", v2RemoveRoleUser)
+
+		group.GET("/users", v2ListUsers)
+		group.POST("/users", v2CreateUser)
+		group.GET("/users/:userId", v2GetUser)
+		group.GET("/users/:userId/diff", v2CompareUsers)
+		group.GET("/users/:userId/roles", v2UserRoles)
+		group.GET("/users/:userId/signs", v2UserSigns)
+		group.POST("/users/:userId/signs", v2CreateUserSign)
+		group.PATCH("/users/:userId/signs/:signKey", v2PatchUserSign)
+		group.POST("/users/:userId/signs/:signKey/transfer", v2TransferUserSign)
+
+		group.GET("/signs", v2ListSigns)
+		group.GET("/signs/:signKey", v2GetSign)
+		group.PATCH("/signs/:signKey/grants", v2PatchSignGrants)
+		group.GET("/signs/:signKey/grants/:userId/diff", v2SignGrantDiff)
+		group.PUT("/signs/:signKey/grants/:userId", v2PutSignGrant)
+		group.DELETE("/signs/:signKey/grants/:userId", v2DeleteSignGrant)
+		group.POST("/signs/:signKey/copies", v2CopySign)
+
+		group.GET("/search/users", v2SearchUsers)
+		group.GET("/search/routes", v2SearchRoutes)
+
+		group.GET("/groups", v2ListGroups)
+		group.GET("/check", v2ExplainCheck)
+		group.GET("/policy", v2ExportPolicy)
+		group.POST("/policy", v2ImportPolicy)
+		group.POST("/policy/plan", v2PlanPolicy)
+		group.POST("/policy/apply", v2ApplyPolicy)
+		group.POST("/policy/diff", v2DiffPolicy)
+		group.POST("/policy/promote/plan", v2PlanPromote)
+		group.POST("/policy/promote", v2PromotePolicy)
+		group.POST("/simulate", v2Simulate)
+
+		group.GET("/snapshots", v2ListSnapshots)
+		group.POST("/snapshots", v2CreateSnapshot)
+		group.GET("/snapshots/:seq", v2GetSnapshot)
+		group.DELETE("/snapshots/:seq", v2DeleteSnapshot)
+		group.POST("/snapshots/:seq/rollback", v2RollbackSnapshot)
+		group.GET("/archive", v2ExportArchive)
+		group.POST("/archive", v2RestoreArchive)
+
+		group.GET("/scopes", v2ListScopes)
+		group.POST("/scopes", v2CreateScope)
+		group.DELETE("/scopes/:id", v2DeleteScope)
+	}
+}
@@ -0,0 +1,250 @@
+package oreoauth
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xkeyideal/oreo"
+	"github.com/xkeyideal/oreo/authoperate"
+)
+
+func v2ListGroups(c *gin.Context) {
+	if _, err := checkSuperAdmin(c); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	groups, err := LibraOreoAuth.ListGroups()
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, groups)
+}
+
+// 解释userId使用signKey访问method url时是否有权限，以及权限来自哪些角色
+func v2ExplainCheck(c *gin.Context) {
+	url := c.Query("url")
+	method := c.Query("method")
+
+	v := &validator{}
+	v.url("url", url)
+	v.method("method", method)
+	v.required("userId", c.Query("userId"))
+	if !v.check(c) {
+		return
+	}
+
+	explain, err := LibraOreoAuth.ExplainCheck(url, method, c.Query("userId"), c.Query("signKey"))
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, explain)
+}
+
+func v2ExportPolicy(c *gin.Context) {
+	if _, err := checkSuperAdmin(c); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	policy, err := LibraOreoAuth.ExportPolicy()
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// 增量导入策略，只会新增和合并，不会删除数据
+func v2ImportPolicy(c *gin.Context) {
+	policy := oreo.Policy{}
+	if !v2BindJSON(c, &policy) {
+		return
+	}
+
+	if _, err := checkSuperAdmin(c); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	res, err := LibraOreoAuth.ImportPolicy(policy)
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+type v2PolicyPlan struct {
+	Policy      oreo.Policy `json:"policy"`
+	Prune       bool        `json:"prune"`
+	Fingerprint string      `json:"fingerprint"` //plan返回的指纹，apply时不为空则要求数据在plan之后没有被修改
+}
+
+// 计算将路由和角色修改为与策略一致需要做的修改，不会写入数据库
+func v2PlanPolicy(c *gin.Context) {
+	body := v2PolicyPlan{}
+	if !v2BindJSON(c, &body) {
+		return
+	}
+
+	if _, err := checkSuperAdmin(c); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	plan, err := LibraOreoAuth.PlanPolicy(body.Policy, oreo.PlanOptions{Prune: body.Prune})
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+// 按策略修改路由和角色，返回执行的计划
+func v2ApplyPolicy(c *gin.Context) {
+	body := v2PolicyPlan{}
+	if !v2BindJSON(c, &body) {
+		return
+	}
+
+	if _, err := checkSuperAdmin(c); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	plan, err := LibraOreoAuth.ApplyPolicy(body.Policy, oreo.PlanOptions{Prune: body.Prune, Fingerprint: body.Fingerprint})
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+// 比较请求中源组导出的策略与当前组的路由、角色和默认角色
+func v2DiffPolicy(c *gin.Context) {
+	source := oreo.Policy{}
+	if !v2BindJSON(c, &source) {
+		return
+	}
+
+	if _, err := checkSuperAdmin(c); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	diff, err := LibraOreoAuth.DiffPolicy(source)
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
+type v2PolicyPromote struct {
+	Source oreo.Policy `json:"source"` //源组导出的策略
+	oreo.PromoteOptions
+}
+
+// 计算将源组选中的路由和角色提升到当前组需要做的修改，不会写入数据库
+func v2PlanPromote(c *gin.Context) {
+	body := v2PolicyPromote{}
+	if !v2BindJSON(c, &body) {
+		return
+	}
+
+	if _, err := checkSuperAdmin(c); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	opts := body.PromoteOptions
+	opts.Fingerprint = ""
+	plan, err := LibraOreoAuth.PlanPromote(body.Source, opts)
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+// 按提升的计划修改当前组，返回执行的计划
+func v2PromotePolicy(c *gin.Context) {
+	body := v2PolicyPromote{}
+	if !v2BindJSON(c, &body) {
+		return
+	}
+
+	if _, err := checkSuperAdmin(c); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	plan, err := LibraOreoAuth.Promote(body.Source, body.PromoteOptions)
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+// 模拟权限变更，与v1的simulate一致，不会写入数据库
+func v2Simulate(c *gin.Context) {
+	simulate := AuthSimulate{}
+	if !v2BindJSON(c, &simulate) {
+		return
+	}
+
+	v := &validator{}
+	if len(simulate.Changes) == 0 {
+		v.add("changes", "is required")
+	}
+	for i, change := range simulate.Changes {
+		switch change.Type {
+		case authoperate.ChangeRoleUpsert, authoperate.ChangeRoleRemove, authoperate.ChangeRoleAddUser,
+			authoperate.ChangeRoleRemoveUser, authoperate.ChangeSignRevoke, authoperate.ChangeRouteDisable,
+			authoperate.ChangeDataAuthEnable, authoperate.ChangeDataAuthDisable:
+		default:
+			v.add(fmt.Sprintf("changes[%d].type", i), "unknown change type %s", change.Type)
+		}
+		v.urlMethods(fmt.Sprintf("changes[%d].urlMethods", i), change.UrlMethods)
+	}
+	if !v.check(c) {
+		return
+	}
+
+	changes := policyChanges(simulate.Changes)
+
+	diffs, err := LibraOreoAuth.SimulatePolicy(changes)
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	result := simulateResult{
+		Diffs: diffs,
+		Flips: []oreo.CheckFlip{},
+	}
+
+	if len(simulate.Records) > 0 {
+		result.Flips, err = LibraOreoAuth.SimulateReplay(changes, recordLines(simulate.Records))
+		if err != nil {
+			v2OreoError(c, err)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,423 @@
+package oreoauth
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xkeyideal/oreo/authoperate"
+)
+
+type v2Role struct {
+	RoleName   string              `json:"roleName"` //PUT时以路径中的roleName为准
+	Desc       string              `json:"desc"`
+	Type       int                 `json:"type"` //1表示超管
+	IsDefault  bool                `json:"isDefault"`
+	Tags       []string            `json:"tags"`
+	UrlMethods map[string][]string `json:"urlMethods"`
+}
+
+type v2RolePatch struct {
+	Desc      *string   `json:"desc"`
+	Type      *int      `json:"type"`
+	Tags      *[]string `json:"tags"`
+	IsDefault *bool     `json:"isDefault"` //只能设置为true，默认角色只能被其他角色替换
+}
+
+type v2RoleRoutesPatch struct {
+	Add    map[string][]string `json:"add"`
+	Remove map[string][]string `json:"remove"`
+}
+
+type v2UserIds struct {
+	UserIds []string `json:"userIds"`
+}
+
+func (r v2Role) validate(v *validator) {
+	v.required("roleName", r.RoleName)
+	if r.Type < 0 {
+		v.add("type", "must not be negative")
+	}
+	v.urlMethods("urlMethods", r.UrlMethods)
+}
+
+// 查询角色，不存在时返回404
+func v2FindRole(c *gin.Context, roleName string) (authoperate.RoleListView, bool) {
+	rl, err := LibraOreoAuth.GetRoleList(roleName)
+	if err != nil {
+		v2OreoError(c, err)
+		return authoperate.RoleListView{}, false
+	}
+	if len(rl) == 0 {
+		v2NotFound(c, "role %s not found", roleName)
+		return authoperate.RoleListView{}, false
+	}
+	return rl[0], true
+}
+
+func v2RespRole(c *gin.Context, status int, roleName string) {
+	role, ok := v2FindRole(c, roleName)
+	if !ok {
+		return
+	}
+
+	setETag(role.Version, c)
+	c.JSON(status, role)
+}
+
+func v2ListRoles(c *gin.Context) {
+	opts, ok := v2ListOptions(c)
+	if !ok {
+		return
+	}
+
+	page, err := LibraOreoAuth.ListRoles(opts)
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+func v2CreateRole(c *gin.Context) {
+	role := v2Role{}
+	if !v2BindJSON(c, &role) {
+		return
+	}
+
+	v := &validator{}
+	role.validate(v)
+	if !v.check(c) {
+		return
+	}
+
+	if _, err := checkSuperAdmin(c); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	rl, err := LibraOreoAuth.GetRoleList(role.RoleName)
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+	if len(rl) > 0 {
+		v2Error(c, http.StatusConflict, ErrCodeAlreadyExists, "role "+role.RoleName+" already exists")
+		return
+	}
+
+	err = LibraOreoAuth.AddRole(role.RoleName, role.Desc, role.Type, role.IsDefault, urlMethodValues(role.UrlMethods))
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	if len(role.Tags) > 0 {
+		if err := LibraOreoAuth.SetRoleTags(role.RoleName, role.Tags, 0); err != nil {
+			v2OreoError(c, err)
+			return
+		}
+	}
+
+	v2RespRole(c, http.StatusCreated, role.RoleName)
+}
+
+func v2GetRole(c *gin.Context) {
+	v2RespRole(c, http.StatusOK, c.Param("roleName"))
+}
+
+// 整体替换角色的描述、类型和路由，tags为nil时保持不变
+func v2ReplaceRole(c *gin.Context) {
+	roleName := c.Param("roleName")
+
+	version, ok := v2IfMatch(c)
+	if !ok {
+		return
+	}
+
+	role := v2Role{}
+	if !v2BindJSON(c, &role) {
+		return
+	}
+	role.RoleName = roleName
+
+	v := &validator{}
+	role.validate(v)
+	if !v.check(c) {
+		return
+	}
+
+	if _, err := checkSuperAdmin(c); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	current, ok := v2FindRole(c, roleName)
+	if !ok || !v2CheckVersion(c, version, current.Version) {
+		return
+	}
+
+	err := LibraOreoAuth.AddRoleWithVersion(roleName, role.Desc, role.Type, role.IsDefault, urlMethodValues(role.UrlMethods), current.Version)
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	if role.Tags != nil {
+		if err := LibraOreoAuth.SetRoleTags(roleName, role.Tags, 0); err != nil {
+			v2OreoError(c, err)
+			return
+		}
+	}
+
+	v2RespRole(c, http.StatusOK, roleName)
+}
+
+func v2PatchRole(c *gin.Context) {
+	roleName := c.Param("roleName")
+
+	version, ok := v2IfMatch(c)
+	if !ok {
+		return
+	}
+
+	patch := v2RolePatch{}
+	if !v2BindJSON(c, &patch) {
+		return
+	}
+
+	v := &validator{}
+	if patch.Type != nil && *patch.Type < 0 {
+		v.add("type", "must not be negative")
+	}
+	if patch.IsDefault != nil && !*patch.IsDefault {
+		v.add("isDefault", "can only be set to true")
+	}
+	if !v.check(c) {
+		return
+	}
+
+	if _, err := checkSuperAdmin(c); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	current, ok := v2FindRole(c, roleName)
+	if !ok || !v2CheckVersion(c, version, current.Version) {
+		return
+	}
+
+	// 只校验第一次修改的版本号，之后的修改基于刚刚写入的版本
+	version = current.Version
+
+	if patch.Desc != nil || patch.Type != nil {
+		desc, typ := current.Desc, current.Type
+		if patch.Desc != nil {
+			desc = *patch.Desc
+		}
+		if patch.Type != nil {
+			typ = *patch.Type
+		}
+		if err := LibraOreoAuth.UpdateRoleTypeDescWithVersion(roleName, desc, typ, version); err != nil {
+			v2OreoError(c, err)
+			return
+		}
+		version = 0
+	}
+
+	if patch.Tags != nil {
+		if err := LibraOreoAuth.SetRoleTags(roleName, *patch.Tags, version); err != nil {
+			v2OreoError(c, err)
+			return
+		}
+	}
+
+	if patch.IsDefault != nil {
+		if err := LibraOreoAuth.SetDefaultRole(roleName); err != nil {
+			v2OreoError(c, err)
+			return
+		}
+	}
+
+	v2RespRole(c, http.StatusOK, roleName)
+}
+
+func v2DeleteRole(c *gin.Context) {
+	roleName := c.Param("roleName")
+
+	if _, err := checkSuperAdmin(c); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	if _, ok := v2FindRole(c, roleName); !ok {
+		return
+	}
+
+	if err := LibraOreoAuth.RemoveRole(roleName); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func v2SetDefaultRole(c *gin.Context) {
+	roleName := c.Param("roleName")
+
+	if _, err := checkSuperAdmin(c); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	if _, ok := v2FindRole(c, roleName); !ok {
+		return
+	}
+
+	if err := LibraOreoAuth.SetDefaultRole(roleName); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func v2RoleRoutes(c *gin.Context) {
+	roleName := c.Param("roleName")
+
+	if _, ok := v2FindRole(c, roleName); !ok {
+		return
+	}
+
+	dr, err := LibraOreoAuth.RoleRouteDiff(roleName)
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dr)
+}
+
+// 增量添加和删除角色的路由和方法
+func v2PatchRoleRoutes(c *gin.Context) {
+	roleName := c.Param("roleName")
+
+	patch := v2RoleRoutesPatch{}
+	if !v2BindJSON(c, &patch) {
+		return
+	}
+
+	v := &validator{}
+	v.urlMethods("add", patch.Add)
+	v.urlMethods("remove", patch.Remove)
+	if len(patch.Add) == 0 && len(patch.Remove) == 0 {
+		v.add("", "add or remove is required")
+	}
+	if !v.check(c) {
+		return
+	}
+
+	if _, err := checkSuperAdmin(c); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	if _, ok := v2FindRole(c, roleName); !ok {
+		return
+	}
+
+	if len(patch.Add) > 0 {
+		if err := LibraOreoAuth.AppendRoleRoute(roleName, urlMethodValues(patch.Add)); err != nil {
+			v2OreoError(c, err)
+			return
+		}
+	}
+
+	if len(patch.Remove) > 0 {
+		if err := LibraOreoAuth.RemoveRoleRoute(roleName, urlMethodValues(patch.Remove)); err != nil {
+			v2OreoError(c, err)
+			return
+		}
+	}
+
+	v2RespRole(c, http.StatusOK, roleName)
+}
+
+func v2RoleUsers(c *gin.Context) {
+	role, ok := v2FindRole(c, c.Param("roleName"))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, role.Users)
+}
+
+func v2AddRoleUsers(c *gin.Context) {
+	roleName := c.Param("roleName")
+
+	version, ok := v2IfMatch(c)
+	if !ok {
+		return
+	}
+
+	body := v2UserIds{}
+	if !v2BindJSON(c, &body) {
+		return
+	}
+
+	v := &validator{}
+	if len(body.UserIds) == 0 {
+		v.add("userIds", "is required")
+	}
+	for i, userId := range body.UserIds {
+		if strings.TrimSpace(userId) == "" {
+			v.add("userIds", "item %d is empty", i)
+		}
+	}
+	if !v.check(c) {
+		return
+	}
+
+	if _, err := checkRoleUserManager(c, roleName); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	if _, ok := v2FindRole(c, roleName); !ok {
+		return
+	}
+
+	if err := LibraOreoAuth.AddRoleUsersWithVersion(roleName, body.UserIds, version); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func v2RemoveRoleUser(c *gin.Context) {
+	roleName := c.Param("roleName")
+	userId := c.Param("userId")
+
+	version, ok := v2IfMatch(c)
+	if !ok {
+		return
+	}
+
+	if _, err := checkRoleUserManager(c, roleName); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	if _, ok := v2FindRole(c, roleName); !ok {
+		return
+	}
+
+	if err := LibraOreoAuth.RemoveRoleUsersWithVersion(roleName, []string{userId}, version); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
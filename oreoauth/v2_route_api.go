@@ -0,0 +1,327 @@
+package oreoauth
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xkeyideal/oreo/authoperate"
+	"github.com/xkeyideal/oreo/route"
+)
+
+type v2RouteMethodPatch struct {
+	Method string `json:"method"`
+	Desc   string `json:"desc"`
+}
+
+type v2RoutePatch struct {
+	Desc    *string              `json:"desc"`
+	Methods []v2RouteMethodPatch `json:"methods"` //修改方法的描述
+}
+
+type v2MethodPatch struct {
+	Desc     *string `json:"desc"`
+	DataAuth *bool   `json:"dataAuth"` //启用或停用数据权限
+}
+
+func v2RouteUrl(c *gin.Context) string {
+	return strings.ToLower(strings.TrimSpace(c.Query("url")))
+}
+
+// 查询路由，不存在时返回404
+func v2FindRoute(c *gin.Context, url string) (authoperate.RouteListView, bool) {
+	rv, err := LibraOreoAuth.GetRouteByUrl(url)
+	if err == authoperate.ErrNotFound {
+		v2NotFound(c, "route %s not found", url)
+		return rv, false
+	}
+	if err != nil {
+		v2OreoError(c, err)
+		return rv, false
+	}
+	return rv, true
+}
+
+func v2ListRoutes(c *gin.Context) {
+	opts, ok := v2ListOptions(c)
+	if !ok {
+		return
+	}
+
+	page, err := LibraOreoAuth.ListRoutes(opts)
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+func v2CreateRoutes(c *gin.Context) {
+	routes := []route.RouteData{}
+	if !v2BindJSON(c, &routes) {
+		return
+	}
+
+	v := &validator{}
+	if len(routes) == 0 {
+		v.add("", "at least one route is required")
+	}
+	urls := []string{}
+	for i, r := range routes {
+		v.url(fmt.Sprintf("[%d].url", i), r.Url)
+		for j, m := range r.Methods {
+			v.method(fmt.Sprintf("[%d].methods[%d].method", i, j), m.Method)
+		}
+		urls = append(urls, strings.ToLower(strings.TrimSpace(r.Url)))
+	}
+	if !v.check(c) {
+		return
+	}
+
+	if _, err := checkRouteEditor(c, urls...); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	if err := LibraOreoAuth.AddRoute(routes); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	created := []authoperate.RouteListView{}
+	for _, url := range urls {
+		rv, err := LibraOreoAuth.GetRouteByUrl(url)
+		if err != nil {
+			v2OreoError(c, err)
+			return
+		}
+		created = append(created, rv)
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+func v2ImportOpenAPI(c *gin.Context) {
+	data, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		v2Error(c, http.StatusBadRequest, ErrCodeInvalidJSON, err.Error())
+		return
+	}
+
+	basePath := strings.TrimSpace(c.Query("basePath"))
+
+	plan, err := LibraOreoAuth.ImportOpenAPI(data, basePath, true)
+	if err != nil {
+		v2Error(c, http.StatusUnprocessableEntity, ErrCodeValidation, err.Error())
+		return
+	}
+
+	urls := []string{}
+	for _, r := range plan.Routes {
+		urls = append(urls, r.Url)
+	}
+	if _, err := checkRouteEditor(c, urls...); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	if c.Query("dryRun") == "true" {
+		c.JSON(http.StatusOK, plan)
+		return
+	}
+
+	ir, err := LibraOreoAuth.ImportOpenAPI(data, basePath, false)
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, ir)
+}
+
+func v2GetRoute(c *gin.Context) {
+	rv, ok := v2FindRoute(c, v2RouteUrl(c))
+	if !ok {
+		return
+	}
+
+	setETag(rv.Version, c)
+	c.JSON(http.StatusOK, rv)
+}
+
+func v2PatchRoute(c *gin.Context) {
+	url := v2RouteUrl(c)
+
+	version, ok := v2IfMatch(c)
+	if !ok {
+		return
+	}
+
+	patch := v2RoutePatch{}
+	if !v2BindJSON(c, &patch) {
+		return
+	}
+
+	v := &validator{}
+	v.url("url", url)
+	for i, m := range patch.Methods {
+		v.method(fmt.Sprintf("methods[%d].method", i), m.Method)
+	}
+	if !v.check(c) {
+		return
+	}
+
+	if _, err := checkRouteEditor(c, url); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	rv, ok := v2FindRoute(c, url)
+	if !ok || !v2CheckVersion(c, version, rv.Version) {
+		return
+	}
+
+	// 只校验第一次修改的版本号，之后的修改基于刚刚写入的版本
+	if patch.Desc != nil {
+		if err := LibraOreoAuth.UpdateRouteDescWithVersion(url, *patch.Desc, version); err != nil {
+			v2OreoError(c, err)
+			return
+		}
+		version = 0
+	}
+
+	for _, m := range patch.Methods {
+		if err := LibraOreoAuth.UpdateRouteMethodDescWithVersion(url, m.Method, m.Desc, version); err != nil {
+			v2OreoError(c, err)
+			return
+		}
+		version = 0
+	}
+
+	if rv, ok = v2FindRoute(c, url); !ok {
+		return
+	}
+
+	setETag(rv.Version, c)
+	c.JSON(http.StatusOK, rv)
+}
+
+func v2DeleteRoute(c *gin.Context) {
+	url := v2RouteUrl(c)
+
+	if _, err := checkRouteEditor(c, url); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	if _, ok := v2FindRoute(c, url); !ok {
+		return
+	}
+
+	if err := LibraOreoAuth.DeleteRoute(url); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// 查询路由下的方法，不存在时返回404
+func v2FindRouteMethod(c *gin.Context, url, method string) (authoperate.RouteListView, bool) {
+	rv, ok := v2FindRoute(c, url)
+	if !ok {
+		return rv, false
+	}
+
+	for _, m := range rv.Methods {
+		if m.Method == method {
+			return rv, true
+		}
+	}
+
+	v2NotFound(c, "route %s method %s not found", url, method)
+	return rv, false
+}
+
+func v2PatchRouteMethod(c *gin.Context) {
+	url := v2RouteUrl(c)
+	method := strings.ToUpper(c.Param("method"))
+
+	version, ok := v2IfMatch(c)
+	if !ok {
+		return
+	}
+
+	patch := v2MethodPatch{}
+	if !v2BindJSON(c, &patch) {
+		return
+	}
+
+	v := &validator{}
+	v.url("url", url)
+	v.method("method", method)
+	if !v.check(c) {
+		return
+	}
+
+	if _, err := checkRouteEditor(c, url); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	rv, ok := v2FindRouteMethod(c, url, method)
+	if !ok || !v2CheckVersion(c, version, rv.Version) {
+		return
+	}
+
+	if patch.Desc != nil {
+		if err := LibraOreoAuth.UpdateRouteMethodDescWithVersion(url, method, *patch.Desc, version); err != nil {
+			v2OreoError(c, err)
+			return
+		}
+	}
+
+	if patch.DataAuth != nil {
+		var err error
+		if *patch.DataAuth {
+			err = LibraOreoAuth.EnableRouteDataAuth(url, method)
+		} else {
+			err = LibraOreoAuth.DisableRouteDataAuth(url, method)
+		}
+		if err != nil {
+			v2OreoError(c, err)
+			return
+		}
+	}
+
+	if rv, ok = v2FindRoute(c, url); !ok {
+		return
+	}
+
+	setETag(rv.Version, c)
+	c.JSON(http.StatusOK, rv)
+}
+
+func v2DeleteRouteMethod(c *gin.Context) {
+	url := v2RouteUrl(c)
+	method := strings.ToUpper(c.Param("method"))
+
+	if _, err := checkRouteEditor(c, url); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	if _, ok := v2FindRouteMethod(c, url, method); !ok {
+		return
+	}
+
+	if err := LibraOreoAuth.DeleteRouteByMethod(url, method); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,77 @@
+package oreoauth
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xkeyideal/oreo/authoperate"
+)
+
+func v2ListScopes(c *gin.Context) {
+	if _, err := checkSuperAdmin(c); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	scopes, err := LibraOreoAuth.ListAdminScopes(strings.TrimSpace(c.Query("userId")))
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, scopes)
+}
+
+func v2CreateScope(c *gin.Context) {
+	as := AuthScope{}
+	if !v2BindJSON(c, &as) {
+		return
+	}
+
+	v := &validator{}
+	v.required("userId", as.UserId)
+	v.required("target", as.Target)
+	if as.Kind != authoperate.ScopeRoleUser && as.Kind != authoperate.ScopeRoute {
+		v.add("kind", "must be one of %s, %s", authoperate.ScopeRoleUser, authoperate.ScopeRoute)
+	}
+	if as.Kind == authoperate.ScopeRoute {
+		v.url("target", as.Target)
+	}
+	if !v.check(c) {
+		return
+	}
+
+	caller, err := checkSuperAdmin(c)
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	var scope authoperate.AdminScope
+	if as.Kind == authoperate.ScopeRoute {
+		scope, err = LibraOreoAuth.GrantRouteScope(as.UserId, as.Target, caller)
+	} else {
+		scope, err = LibraOreoAuth.GrantRoleUserScope(as.UserId, as.Target, caller)
+	}
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, scope)
+}
+
+func v2DeleteScope(c *gin.Context) {
+	if _, err := checkSuperAdmin(c); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	if err := LibraOreoAuth.RevokeAdminScope(c.Param("id")); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
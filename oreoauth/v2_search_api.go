@@ -0,0 +1,54 @@
+package oreoauth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xkeyideal/oreo/authoperate"
+)
+
+// 解析搜索参数，q为空或mode、limit错误时返回422
+func v2SearchOptions(c *gin.Context) (authoperate.SearchOptions, bool) {
+	opts, err := searchOptions(c)
+
+	v := &validator{}
+	if err != nil {
+		v.add("limit", "must be a positive integer")
+	}
+	v.required("q", opts.Keyword)
+	if opts.Mode != "" && opts.Mode != authoperate.SearchContains && opts.Mode != authoperate.SearchPrefix {
+		v.add("mode", "must be one of %s, %s", authoperate.SearchContains, authoperate.SearchPrefix)
+	}
+
+	return opts, v.check(c)
+}
+
+func v2SearchUsers(c *gin.Context) {
+	opts, ok := v2SearchOptions(c)
+	if !ok {
+		return
+	}
+
+	ul, err := LibraOreoAuth.SearchUsers(opts)
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ul)
+}
+
+func v2SearchRoutes(c *gin.Context) {
+	opts, ok := v2SearchOptions(c)
+	if !ok {
+		return
+	}
+
+	rl, err := LibraOreoAuth.SearchRoutes(opts)
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, rl)
+}
@@ -0,0 +1,162 @@
+package oreoauth
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xkeyideal/oreo/authoperate"
+)
+
+type v2SnapshotCreate struct {
+	Reason string `json:"reason"`
+}
+
+// 解析路径中的快照编号，不是正整数时返回422
+func v2SnapshotSeq(c *gin.Context) (int64, bool) {
+	seq, err := strconv.ParseInt(c.Param("seq"), 10, 64)
+	if err != nil || seq <= 0 {
+		v := &validator{}
+		v.add("seq", "must be a positive integer")
+		v.check(c)
+		return 0, false
+	}
+	return seq, true
+}
+
+func v2ListSnapshots(c *gin.Context) {
+	if _, err := checkSuperAdmin(c); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	infos, err := LibraOreoAuth.ListSnapshots()
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, infos)
+}
+
+func v2CreateSnapshot(c *gin.Context) {
+	body := v2SnapshotCreate{}
+	if !v2BindJSON(c, &body) {
+		return
+	}
+
+	if _, err := checkSuperAdmin(c); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	info, err := LibraOreoAuth.CreateSnapshot(body.Reason)
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, info)
+}
+
+// 返回快照的完整归档，可以通过POST /archive恢复到其他组
+func v2GetSnapshot(c *gin.Context) {
+	seq, ok := v2SnapshotSeq(c)
+	if !ok {
+		return
+	}
+
+	if _, err := checkSuperAdmin(c); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	archive, err := LibraOreoAuth.GetSnapshot(seq)
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, archive)
+}
+
+func v2DeleteSnapshot(c *gin.Context) {
+	seq, ok := v2SnapshotSeq(c)
+	if !ok {
+		return
+	}
+
+	if _, err := checkSuperAdmin(c); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	if err := LibraOreoAuth.DeleteSnapshot(seq); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func v2RollbackSnapshot(c *gin.Context) {
+	seq, ok := v2SnapshotSeq(c)
+	if !ok {
+		return
+	}
+
+	if _, err := checkSuperAdmin(c); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	if err := LibraOreoAuth.RollbackSnapshot(seq); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// 导出组内当前的完整归档，不保存为快照
+func v2ExportArchive(c *gin.Context) {
+	if _, err := checkSuperAdmin(c); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	archive, err := LibraOreoAuth.ExportSnapshot()
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, archive)
+}
+
+// 用上传的归档替换组内的全部数据，归档可以来自其他组
+func v2RestoreArchive(c *gin.Context) {
+	archive := authoperate.SnapshotArchive{}
+	if !v2BindJSON(c, &archive) {
+		return
+	}
+
+	if archive.Format < 1 || archive.Format > authoperate.SnapshotFormat {
+		v := &validator{}
+		v.add("format", "must be 1 to %d", authoperate.SnapshotFormat)
+		v.check(c)
+		return
+	}
+
+	if _, err := checkSuperAdmin(c); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	if err := LibraOreoAuth.RestoreSnapshot(&archive); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,456 @@
+package oreoauth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xkeyideal/oreo/authoperate"
+)
+
+type v2User struct {
+	UserId string `json:"userId"`
+	Name   string `json:"name"`
+	NoRole bool   `json:"noRole"` //为true时不加入默认角色
+}
+
+type v2SignDesc struct {
+	Desc string `json:"desc"`
+}
+
+type v2SignTransfer struct {
+	DestUserId string `json:"destUserId"`
+	Desc       string `json:"desc"` //为空时沿用原创建者的描述
+}
+
+type v2SignGrant struct {
+	UrlMethods map[string][]string `json:"urlMethods"`
+}
+
+type v2SignGrantsPatch struct {
+	UserIds []string            `json:"userIds"`
+	Add     map[string][]string `json:"add"`
+	Remove  map[string][]string `json:"remove"`
+}
+
+type v2SignCopy struct {
+	SrcUserId   string   `json:"srcUserId"`
+	DestUserIds []string `json:"destUserIds"`
+}
+
+type v2CreatedSign struct {
+	SignKey string `json:"signKey"`
+	Desc    string `json:"desc"`
+}
+
+// 查询用户，不存在时返回404
+func v2FindUser(c *gin.Context, userId string) (authoperate.UserInfo, bool) {
+	user, err := LibraOreoAuth.GetUser(userId)
+	if err == authoperate.ErrNotFound {
+		v2NotFound(c, "user %s not found", userId)
+		return user, false
+	}
+	if err != nil {
+		v2OreoError(c, err)
+		return user, false
+	}
+	return user, true
+}
+
+func v2ListUsers(c *gin.Context) {
+	opts, ok := v2ListOptions(c)
+	if !ok {
+		return
+	}
+
+	page, err := LibraOreoAuth.ListUsers(opts)
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+func v2CreateUser(c *gin.Context) {
+	user := v2User{}
+	if !v2BindJSON(c, &user) {
+		return
+	}
+
+	v := &validator{}
+	v.required("userId", user.UserId)
+	if !v.check(c) {
+		return
+	}
+
+	if _, err := checkSuperAdmin(c); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	if LibraOreoAuth.CheckUserExist(user.UserId) {
+		v2Error(c, http.StatusConflict, ErrCodeAlreadyExists, "user "+user.UserId+" already exists")
+		return
+	}
+
+	var err error
+	if user.NoRole {
+		err = LibraOreoAuth.AddUserNoRole(user.UserId, user.Name)
+	} else {
+		err = LibraOreoAuth.AddUser(user.UserId, user.Name)
+	}
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	created, ok := v2FindUser(c, user.UserId)
+	if !ok {
+		return
+	}
+
+	setETag(created.Version, c)
+	c.JSON(http.StatusCreated, created)
+}
+
+func v2GetUser(c *gin.Context) {
+	user, ok := v2FindUser(c, c.Param("userId"))
+	if !ok {
+		return
+	}
+
+	setETag(user.Version, c)
+	c.JSON(http.StatusOK, user)
+}
+
+func v2UserRoles(c *gin.Context) {
+	userId := c.Param("userId")
+	if _, ok := v2FindUser(c, userId); !ok {
+		return
+	}
+
+	rl, err := LibraOreoAuth.UserOwnRoles(userId)
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, rl)
+}
+
+func v2UserSigns(c *gin.Context) {
+	userId := c.Param("userId")
+	if _, ok := v2FindUser(c, userId); !ok {
+		return
+	}
+
+	usl, err := LibraOreoAuth.UserOwnSigns(userId)
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	setETag(usl.Version, c)
+	c.JSON(http.StatusOK, usl)
+}
+
+// 比较用户与with参数指定的用户的角色、路由权限和被授权的signKey
+func v2CompareUsers(c *gin.Context) {
+	userId := c.Param("userId")
+	otherUserId := c.Query("with")
+
+	v := &validator{}
+	v.required("with", otherUserId)
+	if !v.check(c) {
+		return
+	}
+
+	diff, err := LibraOreoAuth.CompareUsers(userId, otherUserId)
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
+// 用户只能为自己创建signKey
+func v2CreateUserSign(c *gin.Context) {
+	userId := c.Param("userId")
+
+	body := v2SignDesc{}
+	if !v2BindJSON(c, &body) {
+		return
+	}
+
+	if _, err := checkSelf(c, userId); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	if _, ok := v2FindUser(c, userId); !ok {
+		return
+	}
+
+	signKey, err := LibraOreoAuth.CreateUserSignKey(userId, body.Desc)
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, v2CreatedSign{SignKey: signKey, Desc: body.Desc})
+}
+
+// 查询用户创建的signKey，不存在时返回404
+func v2FindOwnSign(c *gin.Context, userId, signKey string) (authoperate.UserInfo, bool) {
+	user, ok := v2FindUser(c, userId)
+	if !ok {
+		return user, false
+	}
+
+	if _, exist := user.SignKey[signKey]; !exist {
+		v2NotFound(c, "user %s does not own signKey %s", userId, signKey)
+		return user, false
+	}
+
+	return user, true
+}
+
+// 用户只能修改自己signKey的描述
+func v2PatchUserSign(c *gin.Context) {
+	userId := c.Param("userId")
+	signKey := c.Param("signKey")
+
+	version, ok := v2IfMatch(c)
+	if !ok {
+		return
+	}
+
+	body := v2SignDesc{}
+	if !v2BindJSON(c, &body) {
+		return
+	}
+
+	if _, err := checkSelf(c, userId); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	if _, ok := v2FindOwnSign(c, userId, signKey); !ok {
+		return
+	}
+
+	if err := LibraOreoAuth.UpdateUserSignKeyWithVersion(userId, signKey, body.Desc, version); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func v2TransferUserSign(c *gin.Context) {
+	userId := c.Param("userId")
+	signKey := c.Param("signKey")
+
+	body := v2SignTransfer{}
+	if !v2BindJSON(c, &body) {
+		return
+	}
+
+	v := &validator{}
+	v.required("destUserId", body.DestUserId)
+	if body.DestUserId == userId {
+		v.add("destUserId", "must be different from the owner")
+	}
+	if !v.check(c) {
+		return
+	}
+
+	if _, err := checkSignManager(c, signKey); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	owner, ok := v2FindOwnSign(c, userId, signKey)
+	if !ok {
+		return
+	}
+
+	if _, ok := v2FindUser(c, body.DestUserId); !ok {
+		return
+	}
+
+	desc := body.Desc
+	if desc == "" {
+		desc = owner.SignKey[signKey]
+	}
+
+	if err := LibraOreoAuth.UserTransferSignKey(signKey, desc, userId, body.DestUserId); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func v2ListSigns(c *gin.Context) {
+	opts, ok := v2ListOptions(c)
+	if !ok {
+		return
+	}
+
+	page, err := LibraOreoAuth.ListSigns(opts)
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+func v2GetSign(c *gin.Context) {
+	sl, err := LibraOreoAuth.GetSignByKey(c.Param("signKey"))
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, sl)
+}
+
+// 授权给用户的路由和方法与所有开启数据权限的路由和方法的diff
+func v2SignGrantDiff(c *gin.Context) {
+	dr, err := LibraOreoAuth.UserSignDiffGlobal(c.Param("signKey"), c.Param("userId"))
+	if err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dr)
+}
+
+// 整体替换授权给用户的路由和方法
+func v2PutSignGrant(c *gin.Context) {
+	signKey := c.Param("signKey")
+	userId := c.Param("userId")
+
+	version, ok := v2IfMatch(c)
+	if !ok {
+		return
+	}
+
+	body := v2SignGrant{}
+	if !v2BindJSON(c, &body) {
+		return
+	}
+
+	v := &validator{}
+	v.urlMethods("urlMethods", body.UrlMethods)
+	if !v.check(c) {
+		return
+	}
+
+	if _, err := checkSignManager(c, signKey); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	if err := LibraOreoAuth.AddSignWithVersion(signKey, userId, urlMethodValues(body.UrlMethods), version); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func v2DeleteSignGrant(c *gin.Context) {
+	signKey := c.Param("signKey")
+	userId := c.Param("userId")
+
+	if _, err := checkSignManager(c, signKey); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	if err := LibraOreoAuth.RemoveSign(signKey, userId); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// 为批量用户增量添加和删除signKey授权的路由和方法
+func v2PatchSignGrants(c *gin.Context) {
+	signKey := c.Param("signKey")
+
+	body := v2SignGrantsPatch{}
+	if !v2BindJSON(c, &body) {
+		return
+	}
+
+	v := &validator{}
+	if len(body.UserIds) == 0 {
+		v.add("userIds", "is required")
+	}
+	v.urlMethods("add", body.Add)
+	v.urlMethods("remove", body.Remove)
+	if len(body.Add) == 0 && len(body.Remove) == 0 {
+		v.add("", "add or remove is required")
+	}
+	if !v.check(c) {
+		return
+	}
+
+	if _, err := checkSignManager(c, signKey); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	if len(body.Add) > 0 {
+		if err := LibraOreoAuth.AppendUserSign(signKey, body.UserIds, urlMethodValues(body.Add)); err != nil {
+			v2OreoError(c, err)
+			return
+		}
+	}
+
+	if len(body.Remove) > 0 {
+		if err := LibraOreoAuth.RemoveUserSign(signKey, body.UserIds, urlMethodValues(body.Remove)); err != nil {
+			v2OreoError(c, err)
+			return
+		}
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// 将srcUserId被授权的路由和方法复制给其他用户
+func v2CopySign(c *gin.Context) {
+	signKey := c.Param("signKey")
+
+	body := v2SignCopy{}
+	if !v2BindJSON(c, &body) {
+		return
+	}
+
+	v := &validator{}
+	v.required("srcUserId", body.SrcUserId)
+	if len(body.DestUserIds) == 0 {
+		v.add("destUserIds", "is required")
+	}
+	if !v.check(c) {
+		return
+	}
+
+	if _, err := checkSignManager(c, signKey); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	if err := LibraOreoAuth.CopyUserSign(signKey, body.SrcUserId, body.DestUserIds); err != nil {
+		v2OreoError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
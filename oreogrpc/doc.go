@@ -0,0 +1,2 @@
+// Package oreogrpc 提供gRPC服务端的权限拦截器，权限校验使用oreo.AuthorizeRPC
+package oreogrpc
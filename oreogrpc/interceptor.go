@@ -0,0 +1,65 @@
+package oreogrpc
+
+import (
+	"context"
+
+	"github.com/xkeyideal/oreo"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// 校验RPC调用的权限，*oreo.Oreo实现了该接口
+type Authorizer interface {
+	AuthorizeRPC(fullMethod string, md map[string][]string, opts oreo.RPCOptions) (string, bool, error)
+}
+
+// 未登录返回Unauthenticated，没有权限返回PermissionDenied，校验通过后登录用户放入ctx
+func authorize(ctx context.Context, o Authorizer, fullMethod string, opts oreo.RPCOptions) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	userId, isAdmin, err := o.AuthorizeRPC(fullMethod, md, opts)
+	if err != nil {
+		if err == oreo.ErrUnauthenticated {
+			return ctx, status.Error(codes.Unauthenticated, err.Error())
+		}
+		return ctx, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	if userId != "" {
+		ctx = oreo.ContextWithUser(ctx, userId, isAdmin)
+	}
+	return ctx, nil
+}
+
+// 一元调用的权限拦截器，校验通过后可以通过oreo.UserIdFromContext获取登录用户
+func UnaryServerInterceptor(o Authorizer, opts oreo.RPCOptions) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authorize(ctx, o, info.FullMethod, opts)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authStream) Context() context.Context {
+	return s.ctx
+}
+
+// 流式调用的权限拦截器，只在建立流时校验一次
+func StreamServerInterceptor(o Authorizer, opts oreo.RPCOptions) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authorize(ss.Context(), o, info.FullMethod, opts)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authStream{ServerStream: ss, ctx: ctx})
+	}
+}
@@ -0,0 +1,178 @@
+package oreogrpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/xkeyideal/oreo"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// 测试用的编解码，消息为*string，不依赖protobuf生成的代码
+type stringCodec struct{}
+
+func (stringCodec) Marshal(v interface{}) ([]byte, error) {
+	return []byte(*v.(*string)), nil
+}
+
+func (stringCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*string) = string(data)
+	return nil
+}
+
+func (stringCodec) Name() string {
+	return "oreotest"
+}
+
+// alice有权限且为超管，bob没有权限，没有userId时未登录，记录最后一次校验的方法和signKey
+type fakeAuthorizer struct {
+	method  string
+	signKey string
+}
+
+func (a *fakeAuthorizer) AuthorizeRPC(fullMethod string, md map[string][]string, opts oreo.RPCOptions) (string, bool, error) {
+	a.method = fullMethod
+	a.signKey = ""
+	if vs := md["signkey"]; len(vs) > 0 {
+		a.signKey = vs[0]
+	}
+
+	userId := ""
+	if vs := md["userid"]; len(vs) > 0 {
+		userId = vs[0]
+	}
+	switch userId {
+	case "":
+		return "", false, oreo.ErrUnauthenticated
+	case "alice":
+		return userId, true, nil
+	}
+	return userId, false, &oreo.PermissionDeniedError{Reason: "no route auth"}
+}
+
+// handler返回拦截器放入ctx的登录用户
+var testServiceDesc = grpc.ServiceDesc{
+	ServiceName: "oreo.Test",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Who",
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := new(string)
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				who := fmt.Sprintf("%s %t", oreo.UserIdFromContext(ctx), oreo.IsAdminFromContext(ctx))
+				return &who, nil
+			}
+			if interceptor == nil {
+				return handler(ctx, req)
+			}
+			return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/oreo.Test/Who"}, handler)
+		},
+	}},
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Watch",
+		ServerStreams: true,
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			who := fmt.Sprintf("%s %t", oreo.UserIdFromContext(stream.Context()), oreo.IsAdminFromContext(stream.Context()))
+			return stream.SendMsg(&who)
+		},
+	}},
+}
+
+func startTestServer(t *testing.T, auth Authorizer) *grpc.ClientConn {
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(
+		grpc.ForceServerCodec(stringCodec{}),
+		grpc.UnaryInterceptor(UnaryServerInterceptor(auth, oreo.RPCOptions{})),
+		grpc.StreamInterceptor(StreamServerInterceptor(auth, oreo.RPCOptions{})),
+	)
+	srv.RegisterService(&testServiceDesc, struct{}{})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(stringCodec{})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+var interceptorCases = []struct {
+	name   string
+	md     []string
+	code   codes.Code
+	who    string
+	signed string
+}{
+	{"unauthenticated", nil, codes.Unauthenticated, "", ""},
+	{"permission denied", []string{"userId", "bob"}, codes.PermissionDenied, "", ""},
+	{"allowed", []string{"userId", "alice", "signKey", "k1"}, codes.OK, "alice true", "k1"},
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	auth := &fakeAuthorizer{}
+	conn := startTestServer(t, auth)
+
+	for _, c := range interceptorCases {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), c.md...)
+		req, resp := "hi", ""
+		err := conn.Invoke(ctx, "/oreo.Test/Who", &req, &resp)
+		if code := status.Code(err); code != c.code {
+			t.Errorf("%s: code = %s, want %s (%v)", c.name, code, c.code, err)
+			continue
+		}
+		if resp != c.who {
+			t.Errorf("%s: user = %q, want %q", c.name, resp, c.who)
+		}
+		if auth.method != "/oreo.Test/Who" || auth.signKey != c.signed {
+			t.Errorf("%s: authorized %s with signKey %q", c.name, auth.method, auth.signKey)
+		}
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	auth := &fakeAuthorizer{}
+	conn := startTestServer(t, auth)
+	desc := &grpc.StreamDesc{StreamName: "Watch", ServerStreams: true}
+
+	for _, c := range interceptorCases {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), c.md...)
+		stream, err := conn.NewStream(ctx, desc, "/oreo.Test/Watch")
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		req, resp := "hi", ""
+		if err := stream.SendMsg(&req); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if err := stream.CloseSend(); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+
+		err = stream.RecvMsg(&resp)
+		if code := status.Code(err); code != c.code {
+			t.Errorf("%s: code = %s, want %s (%v)", c.name, code, c.code, err)
+			continue
+		}
+		if resp != c.who {
+			t.Errorf("%s: user = %q, want %q", c.name, resp, c.who)
+		}
+		if auth.method != "/oreo.Test/Watch" {
+			t.Errorf("%s: authorized %s", c.name, auth.method)
+		}
+	}
+}
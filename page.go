@@ -0,0 +1,23 @@
+package oreo
+
+import "github.com/xkeyideal/oreo/authoperate"
+
+// 分页查询用户，可按userId或name前缀、所属角色过滤，按userId或name排序
+func (oreo *Oreo) ListUsers(opts authoperate.ListOptions) (authoperate.UserPage, error) {
+	return oreo.auth.UserPageList(opts)
+}
+
+// 分页查询路由，可按uri前缀、是否开启数据权限过滤，按uri排序
+func (oreo *Oreo) ListRoutes(opts authoperate.ListOptions) (authoperate.RoutePage, error) {
+	return oreo.auth.RoutePageList(opts)
+}
+
+// 分页查询角色，可按roleName前缀、标签过滤，按roleName排序
+func (oreo *Oreo) ListRoles(opts authoperate.ListOptions) (authoperate.RolePage, error) {
+	return oreo.auth.RolePageList(opts)
+}
+
+// 分页查询所有用户创建的signKey，可按signKey或创建者前缀过滤，按signKey排序
+func (oreo *Oreo) ListSigns(opts authoperate.ListOptions) (authoperate.SignPage, error) {
+	return oreo.auth.SignPageList(opts)
+}
@@ -0,0 +1,748 @@
+package oreo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xkeyideal/oreo/authoperate"
+	"github.com/xkeyideal/oreo/route"
+)
+
+// 计划中的操作
+const (
+	PlanCreate = "create"
+	PlanUpdate = "update"
+	PlanDelete = "delete"
+)
+
+// 计划中的数据类型
+const (
+	PlanKindRoute = "route"
+	PlanKindRole  = "role"
+	PlanKindUser  = "user" //只在提升时出现，用户和创建的signKey
+	PlanKindSign  = "sign" //只在提升时出现，signKey对用户的授权
+)
+
+var ErrPlanStale = errors.New("policy plan is stale, routes or roles have been modified since the plan was made")
+
+type PlanOptions struct {
+	Prune       bool   `json:"prune"`       //删除策略文件中没有列出的路由、方法、角色，以及角色中没有列出的路由和用户
+	Fingerprint string `json:"fingerprint"` //apply时不为空则要求与当前数据的指纹一致，即计划之后数据没有被修改
+}
+
+// 某个路由或角色需要做的修改
+type PlanChange struct {
+	Action  string   `json:"action"`
+	Kind    string   `json:"kind"`
+	Name    string   `json:"name"`              //路由的url或角色名
+	Details []string `json:"details,omitempty"` //会执行的修改
+	Skipped []string `json:"skipped,omitempty"` //需要删除但没有开启Prune，不会执行的修改
+}
+
+type PolicyPlan struct {
+	Group       string       `json:"group"`
+	Fingerprint string       `json:"fingerprint"` //计算计划时路由和角色的指纹
+	Changes     []PlanChange `json:"changes"`
+
+	steps []authoperate.TxnStep
+}
+
+// 是否有需要执行的修改，每个执行的步骤都会在Details中列出
+func (plan PolicyPlan) HasChanges() bool {
+	for _, change := range plan.Changes {
+		if len(change.Details) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// 路由和角色的指纹，与导出的结果一致时指纹一致
+func (oreo *Oreo) policyFingerprint(state *authoperate.PolicyState) string {
+	policy := oreo.policyFromState(state)
+	data, _ := json.Marshal(struct {
+		Routes []PolicyRoute `json:"routes"`
+		Roles  []PolicyRole  `json:"roles"`
+	}{policy.Routes, policy.Roles})
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// 计算将组内的路由、角色、角色成员和默认角色修改为与策略文件一致需要做的修改，不会写入数据库。
+// 策略文件中的users和signs属于运行时的数据，不在计划的范围内，会被忽略
+func (oreo *Oreo) PlanPolicy(policy Policy, opts PlanOptions) (PolicyPlan, error) {
+	state, err := oreo.auth.PolicyStateLoad()
+	if err != nil {
+		return PolicyPlan{}, err
+	}
+
+	return oreo.policyPlan(state, policy, opts)
+}
+
+// 按计划修改数据，依次执行路由的新增和修改、角色的新增和修改、默认角色、角色的删除、路由的删除，
+// 某一步失败时会撤销已经执行的修改并返回*authoperate.TxnError，撤销也失败时需要人工处理。
+// opts.Fingerprint不为空且与当前数据不一致时返回ErrPlanStale，不做任何修改
+func (oreo *Oreo) ApplyPolicy(policy Policy, opts PlanOptions) (PolicyPlan, error) {
+	state, err := oreo.auth.PolicyStateLoad()
+	if err != nil {
+		return PolicyPlan{}, err
+	}
+
+	plan, err := oreo.policyPlan(state, policy, opts)
+	if err != nil {
+		return plan, err
+	}
+
+	if opts.Fingerprint != "" && opts.Fingerprint != plan.Fingerprint {
+		return plan, ErrPlanStale
+	}
+
+	if len(plan.steps) > 0 {
+		if err := oreo.autoSnapshot("before apply policy"); err != nil {
+			return plan, err
+		}
+	}
+
+	return plan, plan.run()
+}
+
+// 依次执行计划的步骤，某一步失败时撤销已经执行的步骤并返回*authoperate.TxnError
+func (plan PolicyPlan) run() error {
+	return authoperate.RunTxnSteps(plan.steps)
+}
+
+// 策略文件中路由的方法，key为方法的整型值
+type planRoute struct {
+	url     string
+	desc    string
+	methods map[int]PolicyMethod
+}
+
+type planRole struct {
+	PolicyRole
+	urlMethod map[string]int
+}
+
+func (oreo *Oreo) methodNum(method string) (int, error) {
+	num, err := oreo.auth.MethodToNumString(strings.ToUpper(strings.TrimSpace(method)))
+	if err != nil {
+		return 0, err
+	}
+	return oreo.auth.NumStringToNum(num), nil
+}
+
+func (oreo *Oreo) methodName(value int) string {
+	return oreo.auth.NumStringToMethod(fmt.Sprint(value))
+}
+
+// 方法的整型值之和转换为GET,POST格式
+func (oreo *Oreo) methodNames(value int) string {
+	names := []string{}
+	for _, num := range oreo.auth.MethodValueToMethods(value) {
+		names = append(names, oreo.auth.NumStringToMethod(num))
+	}
+	sort.Slice(names, func(i, j int) bool { return methodOrder(names[i]) < methodOrder(names[j]) })
+	return strings.Join(names, ",")
+}
+
+func sortedUrls(m map[string]int) []string {
+	urls := []string{}
+	for url := range m {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// 校验策略文件并转换为按url和角色名索引的数据
+func (oreo *Oreo) planDesired(policy Policy) (map[string]*planRoute, map[string]*planRole, error) {
+	if policy.Group != "" && policy.Group != oreo.groupName {
+		return nil, nil, fmt.Errorf("policy group %s does not match %s", policy.Group, oreo.groupName)
+	}
+
+	routes := make(map[string]*planRoute)
+	for _, pr := range policy.Routes {
+		url := strings.ToLower(strings.TrimSpace(pr.Url))
+		if err := route.RouteRuleCheck(url); err != nil {
+			return nil, nil, fmt.Errorf("route %s: %s", pr.Url, err.Error())
+		}
+		if _, ok := routes[url]; ok {
+			return nil, nil, fmt.Errorf("route %s is listed more than once", url)
+		}
+		if len(pr.Methods) == 0 {
+			return nil, nil, fmt.Errorf("route %s has no methods", url)
+		}
+
+		r := &planRoute{url: url, desc: pr.Desc, methods: make(map[int]PolicyMethod)}
+		for _, pm := range pr.Methods {
+			num, err := oreo.methodNum(pm.Method)
+			if err != nil {
+				return nil, nil, fmt.Errorf("route %s: %s", url, err.Error())
+			}
+			if _, ok := r.methods[num]; ok {
+				return nil, nil, fmt.Errorf("route %s: method %s is listed more than once", url, pm.Method)
+			}
+			r.methods[num] = pm
+		}
+		routes[url] = r
+	}
+
+	roles := make(map[string]*planRole)
+	defaultRole := ""
+	for _, pr := range policy.Roles {
+		if strings.TrimSpace(pr.Name) == "" {
+			return nil, nil, errors.New("role name is empty")
+		}
+		if _, ok := roles[pr.Name]; ok {
+			return nil, nil, fmt.Errorf("role %s is listed more than once", pr.Name)
+		}
+		if pr.IsDefault {
+			if defaultRole != "" {
+				return nil, nil, fmt.Errorf("both %s and %s are default roles", defaultRole, pr.Name)
+			}
+			if pr.Type == authoperate.SuperAdminRoleType {
+				return nil, nil, fmt.Errorf("superadmin role %s can not be the default role", pr.Name)
+			}
+			defaultRole = pr.Name
+		}
+
+		if pr.Type == authoperate.SuperAdminRoleType && len(pr.Tags) > 0 {
+			return nil, nil, fmt.Errorf("superadmin role %s can not have tags", pr.Name)
+		}
+
+		urlMethod, err := oreo.policyUrlMethods(pr.Routes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("role %s: %s", pr.Name, err.Error())
+		}
+
+		pr.Tags = mergeStrings(nil, pr.Tags)
+		pr.Users = mergeStrings(nil, pr.Users)
+		roles[pr.Name] = &planRole{PolicyRole: pr, urlMethod: urlMethod}
+	}
+
+	return routes, roles, nil
+}
+
+func (oreo *Oreo) policyPlan(state *authoperate.PolicyState, policy Policy, opts PlanOptions) (PolicyPlan, error) {
+	plan := PolicyPlan{
+		Group:       oreo.groupName,
+		Fingerprint: oreo.policyFingerprint(state),
+		Changes:     []PlanChange{},
+	}
+
+	desiredRoutes, desiredRoles, err := oreo.planDesired(policy)
+	if err != nil {
+		return plan, err
+	}
+
+	currentRoutes := make(map[string]authoperate.RouterInfo)
+	for _, router := range state.Routers {
+		currentRoutes[router.Uri] = router
+	}
+
+	currentRoles := make(map[string]authoperate.RoleInfo)
+	for _, role := range state.Roles {
+		currentRoles[role.RoleName] = role
+	}
+
+	users := make(map[string]bool)
+	for _, user := range state.Users {
+		users[user.UserId] = true
+	}
+
+	finalRoutes := oreo.planFinalRoutes(state, desiredRoutes, opts.Prune)
+
+	roleNames := []string{}
+	for name, role := range desiredRoles {
+		roleNames = append(roleNames, name)
+		for _, url := range sortedUrls(role.urlMethod) {
+			if missing := role.urlMethod[url] &^ finalRoutes[url]; missing != 0 {
+				return plan, fmt.Errorf("role %s: route %s %s does not exist", name, url, oreo.methodNames(missing))
+			}
+		}
+		for _, userId := range role.Users {
+			if !users[userId] {
+				return plan, fmt.Errorf("role %s: user %s does not exist", name, userId)
+			}
+		}
+	}
+	sort.Strings(roleNames)
+
+	urls := []string{}
+	for url := range desiredRoutes {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+
+	// 路由的新增和修改
+	deleteSteps := []authoperate.TxnStep{}
+	for _, url := range urls {
+		change, steps, deletes := oreo.planRoute(desiredRoutes[url], currentRoutes, opts.Prune)
+		if change.Action != "" {
+			plan.Changes = append(plan.Changes, change)
+		}
+		plan.steps = append(plan.steps, steps...)
+		deleteSteps = append(deleteSteps, deletes...)
+	}
+
+	// 角色的新增和修改
+	for _, name := range roleNames {
+		change, steps := oreo.planRole(desiredRoles[name], currentRoles, opts.Prune)
+		if change.Action != "" {
+			plan.Changes = append(plan.Changes, change)
+		}
+		plan.steps = append(plan.steps, steps...)
+	}
+
+	// 默认角色
+	oldDefault := ""
+	for _, role := range state.Roles {
+		if role.IsDefault {
+			oldDefault = role.RoleName
+		}
+	}
+	for _, name := range roleNames {
+		if !desiredRoles[name].IsDefault || name == oldDefault {
+			continue
+		}
+
+		roleName := name
+		step := authoperate.TxnStep{
+			Name: fmt.Sprintf("set default role %s", roleName),
+			Do:   func() error { return oreo.SetDefaultRole(roleName) },
+		}
+		if oldDefault != "" {
+			step.Undo = func() error { return oreo.SetDefaultRole(oldDefault) }
+		}
+		plan.steps = append(plan.steps, step)
+		planDetail(&plan, PlanKindRole, roleName, fmt.Sprintf("default: %s -> %s", orNone(oldDefault), roleName))
+	}
+
+	// 角色的删除
+	currentNames := []string{}
+	for name := range currentRoles {
+		currentNames = append(currentNames, name)
+	}
+	sort.Strings(currentNames)
+
+	for _, name := range currentNames {
+		if _, ok := desiredRoles[name]; ok {
+			continue
+		}
+
+		role := currentRoles[name]
+		change := PlanChange{Action: PlanDelete, Kind: PlanKindRole, Name: name}
+		detail := fmt.Sprintf("-role with %d routes and %d users", len(role.Address), len(role.UserIds))
+		if !opts.Prune {
+			change.Skipped = []string{detail}
+			plan.Changes = append(plan.Changes, change)
+			continue
+		}
+
+		change.Details = []string{detail}
+		plan.Changes = append(plan.Changes, change)
+		plan.steps = append(plan.steps, authoperate.TxnStep{
+			Name: fmt.Sprintf("delete role %s", name),
+			Do:   func() error { return oreo.RemoveRole(role.RoleName) },
+			Undo: func() error { return oreo.restoreRole(role) },
+		})
+	}
+
+	// 路由和方法的删除，放在最后，角色先不再引用这些路由
+	plan.steps = append(plan.steps, deleteSteps...)
+
+	currentUrls := []string{}
+	for url := range currentRoutes {
+		currentUrls = append(currentUrls, url)
+	}
+	sort.Strings(currentUrls)
+
+	for _, url := range currentUrls {
+		if _, ok := desiredRoutes[url]; ok {
+			continue
+		}
+
+		router := currentRoutes[url]
+		change := PlanChange{Action: PlanDelete, Kind: PlanKindRoute, Name: url}
+		detail := fmt.Sprintf("-route %s", oreo.routerMethodNames(router))
+		if !opts.Prune {
+			change.Skipped = []string{detail}
+			plan.Changes = append(plan.Changes, change)
+			continue
+		}
+
+		change.Details = []string{detail}
+		plan.Changes = append(plan.Changes, change)
+		plan.steps = append(plan.steps, authoperate.TxnStep{
+			Name: fmt.Sprintf("delete route %s", url),
+			Do:   func() error { return oreo.DeleteRoute(router.Uri) },
+			Undo: func() error { return oreo.AddRoute([]route.RouteData{oreo.routeData(router)}) },
+		})
+	}
+
+	return plan, nil
+}
+
+// 执行计划后存在的路由方法，用于校验角色和授权引用的路由
+func (oreo *Oreo) planFinalRoutes(state *authoperate.PolicyState, desiredRoutes map[string]*planRoute, prune bool) map[string]int {
+	finalRoutes := make(map[string]int)
+	for url, r := range desiredRoutes {
+		for num := range r.methods {
+			finalRoutes[url] |= num
+		}
+	}
+	if !prune {
+		for _, router := range state.Routers {
+			for num := range router.MethodMap {
+				finalRoutes[router.Uri] |= oreo.auth.NumStringToNum(num)
+			}
+		}
+	}
+	return finalRoutes
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// 将修改合并到已有的change中，没有时新建一个update
+func planDetail(plan *PolicyPlan, kind, name, detail string) {
+	for i := range plan.Changes {
+		if plan.Changes[i].Kind == kind && plan.Changes[i].Name == name && plan.Changes[i].Action != PlanDelete {
+			plan.Changes[i].Details = append(plan.Changes[i].Details, detail)
+			return
+		}
+	}
+	plan.Changes = append(plan.Changes, PlanChange{Action: PlanUpdate, Kind: kind, Name: name, Details: []string{detail}})
+}
+
+func (oreo *Oreo) routerMethodNames(router authoperate.RouterInfo) string {
+	value := 0
+	for num := range router.MethodMap {
+		value |= oreo.auth.NumStringToNum(num)
+	}
+	return oreo.methodNames(value)
+}
+
+func (oreo *Oreo) routeData(router authoperate.RouterInfo) route.RouteData {
+	rd := route.RouteData{Url: router.Uri, UrlDesc: router.Desc}
+	for num, vd := range router.MethodMap {
+		rd.Methods = append(rd.Methods, route.RouteMethodData{
+			Method:     oreo.auth.NumStringToMethod(num),
+			MethodDesc: vd.MethodDesc,
+			Enable:     vd.Enable,
+		})
+	}
+	return rd
+}
+
+func dataAuthDesc(pm PolicyMethod) string {
+	s := ""
+	if pm.DataAuth {
+		s = " dataAuth"
+	}
+	if pm.Desc != "" {
+		s += fmt.Sprintf(" %q", pm.Desc)
+	}
+	return s
+}
+
+// 返回路由的修改、新增和修改的步骤、删除方法的步骤
+func (oreo *Oreo) planRoute(r *planRoute, currentRoutes map[string]authoperate.RouterInfo, prune bool) (PlanChange, []authoperate.TxnStep, []authoperate.TxnStep) {
+	change := PlanChange{Kind: PlanKindRoute, Name: r.url}
+	steps := []authoperate.TxnStep{}
+	deletes := []authoperate.TxnStep{}
+
+	nums := []int{}
+	for num := range r.methods {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+
+	current, exist := currentRoutes[r.url]
+	if !exist {
+		rd := route.RouteData{Url: r.url, UrlDesc: r.desc}
+		for _, num := range nums {
+			pm := r.methods[num]
+			rd.Methods = append(rd.Methods, route.RouteMethodData{
+				Method:     oreo.methodName(num),
+				MethodDesc: pm.Desc,
+				Enable:     pm.DataAuth,
+			})
+			change.Details = append(change.Details, fmt.Sprintf("+%s%s", oreo.methodName(num), dataAuthDesc(pm)))
+		}
+		if r.desc != "" {
+			change.Details = append([]string{fmt.Sprintf("desc: %q", r.desc)}, change.Details...)
+		}
+
+		change.Action = PlanCreate
+		steps = append(steps, authoperate.TxnStep{
+			Name: fmt.Sprintf("create route %s", r.url),
+			Do:   func() error { return oreo.AddRoute([]route.RouteData{rd}) },
+			Undo: func() error { return oreo.DeleteRoute(rd.Url) },
+		})
+		return change, steps, deletes
+	}
+
+	if current.Desc != r.desc {
+		oldDesc, newDesc := current.Desc, r.desc
+		change.Details = append(change.Details, fmt.Sprintf("desc: %q -> %q", oldDesc, newDesc))
+		steps = append(steps, authoperate.TxnStep{
+			Name: fmt.Sprintf("update route %s desc", r.url),
+			Do:   func() error { return oreo.UpdateRouteDesc(r.url, newDesc) },
+			Undo: func() error { return oreo.UpdateRouteDesc(r.url, oldDesc) },
+		})
+	}
+
+	for _, num := range nums {
+		pm := r.methods[num]
+		method := oreo.methodName(num)
+		vd, ok := current.MethodMap[fmt.Sprint(num)]
+		if !ok {
+			change.Details = append(change.Details, fmt.Sprintf("+%s%s", method, dataAuthDesc(pm)))
+			rd := route.RouteData{Url: r.url, UrlDesc: current.Desc, Methods: []route.RouteMethodData{{
+				Method:     method,
+				MethodDesc: pm.Desc,
+				Enable:     pm.DataAuth,
+			}}}
+			steps = append(steps, authoperate.TxnStep{
+				Name: fmt.Sprintf("add route %s %s", r.url, method),
+				Do:   func() error { return oreo.AddRoute([]route.RouteData{rd}) },
+				Undo: func() error { return oreo.DeleteRouteByMethod(r.url, method) },
+			})
+			continue
+		}
+
+		if vd.MethodDesc != pm.Desc {
+			oldDesc, newDesc := vd.MethodDesc, pm.Desc
+			change.Details = append(change.Details, fmt.Sprintf("%s desc: %q -> %q", method, oldDesc, newDesc))
+			steps = append(steps, authoperate.TxnStep{
+				Name: fmt.Sprintf("update route %s %s desc", r.url, method),
+				Do:   func() error { return oreo.UpdateRouteMethodDesc(r.url, method, newDesc) },
+				Undo: func() error { return oreo.UpdateRouteMethodDesc(r.url, method, oldDesc) },
+			})
+		}
+
+		if vd.Enable != pm.DataAuth {
+			enable, disable := oreo.EnableRouteDataAuth, oreo.DisableRouteDataAuth
+			if !pm.DataAuth {
+				enable, disable = disable, enable
+			}
+			change.Details = append(change.Details, fmt.Sprintf("%s dataAuth: %t -> %t", method, vd.Enable, pm.DataAuth))
+			steps = append(steps, authoperate.TxnStep{
+				Name: fmt.Sprintf("update route %s %s dataAuth", r.url, method),
+				Do:   func() error { return enable(r.url, method) },
+				Undo: func() error { return disable(r.url, method) },
+			})
+		}
+	}
+
+	removed := []int{}
+	for num := range current.MethodMap {
+		n := oreo.auth.NumStringToNum(num)
+		if _, ok := r.methods[n]; !ok {
+			removed = append(removed, n)
+		}
+	}
+	sort.Ints(removed)
+
+	for _, num := range removed {
+		method := oreo.methodName(num)
+		vd := current.MethodMap[fmt.Sprint(num)]
+		detail := fmt.Sprintf("-%s", method)
+		if !prune {
+			change.Skipped = append(change.Skipped, detail)
+			continue
+		}
+
+		change.Details = append(change.Details, detail)
+		rd := route.RouteData{Url: r.url, UrlDesc: current.Desc, Methods: []route.RouteMethodData{{
+			Method:     method,
+			MethodDesc: vd.MethodDesc,
+			Enable:     vd.Enable,
+		}}}
+		deletes = append(deletes, authoperate.TxnStep{
+			Name: fmt.Sprintf("delete route %s %s", r.url, method),
+			Do:   func() error { return oreo.DeleteRouteByMethod(r.url, method) },
+			Undo: func() error { return oreo.AddRoute([]route.RouteData{rd}) },
+		})
+	}
+
+	if len(change.Details) > 0 || len(change.Skipped) > 0 {
+		change.Action = PlanUpdate
+	}
+	return change, steps, deletes
+}
+
+// 角色当前的路由，key为url
+func roleUrlMethod(role authoperate.RoleInfo) map[string]int {
+	urlMethod := make(map[string]int)
+	for _, addr := range role.Address {
+		urlMethod[addr.Uri] |= addr.MethodValue
+	}
+	return urlMethod
+}
+
+// 按url分别计算a中有但b中没有的方法
+func urlMethodMinus(a, b map[string]int) map[string]int {
+	diff := make(map[string]int)
+	for url, value := range a {
+		if v := value &^ b[url]; v != 0 {
+			diff[url] = v
+		}
+	}
+	return diff
+}
+
+func stringsMinus(a, b []string) []string {
+	set := make(map[string]bool)
+	for _, s := range b {
+		set[s] = true
+	}
+	diff := []string{}
+	for _, s := range a {
+		if !set[s] {
+			diff = append(diff, s)
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+func (oreo *Oreo) routeDetails(sign string, urlMethod map[string]int) []string {
+	details := []string{}
+	for _, url := range sortedUrls(urlMethod) {
+		details = append(details, fmt.Sprintf("%sroute %s %s", sign, url, oreo.methodNames(urlMethod[url])))
+	}
+	return details
+}
+
+// 删除角色的撤销，重建角色、成员和标签
+func (oreo *Oreo) restoreRole(role authoperate.RoleInfo) error {
+	if err := oreo.AddRoleWithVersion(role.RoleName, role.Desc, role.Type, role.IsDefault, roleUrlMethod(role), 0); err != nil {
+		return err
+	}
+	if len(role.UserIds) > 0 {
+		if err := oreo.AddRoleUsers(role.RoleName, role.UserIds); err != nil {
+			return err
+		}
+	}
+	if len(role.Tags) > 0 {
+		return oreo.SetRoleTags(role.RoleName, role.Tags, 0)
+	}
+	return nil
+}
+
+func (oreo *Oreo) planRole(r *planRole, currentRoles map[string]authoperate.RoleInfo, prune bool) (PlanChange, []authoperate.TxnStep) {
+	change := PlanChange{Kind: PlanKindRole, Name: r.Name}
+	steps := []authoperate.TxnStep{}
+	name := r.Name
+
+	current, exist := currentRoles[name]
+	if !exist {
+		change.Action = PlanCreate
+		if r.Desc != "" {
+			change.Details = append(change.Details, fmt.Sprintf("desc: %q", r.Desc))
+		}
+		if r.Type != 0 {
+			change.Details = append(change.Details, fmt.Sprintf("type: %d", r.Type))
+		}
+		change.Details = append(change.Details, oreo.routeDetails("+", r.urlMethod)...)
+
+		// 默认角色统一在角色都创建之后设置
+		steps = append(steps, authoperate.TxnStep{
+			Name: fmt.Sprintf("create role %s", name),
+			Do:   func() error { return oreo.AddRoleWithVersion(name, r.Desc, r.Type, false, r.urlMethod, 0) },
+			Undo: func() error { return oreo.RemoveRole(name) },
+		})
+	} else {
+		if current.Desc != r.Desc || current.Type != r.Type {
+			if current.Desc != r.Desc {
+				change.Details = append(change.Details, fmt.Sprintf("desc: %q -> %q", current.Desc, r.Desc))
+			}
+			if current.Type != r.Type {
+				change.Details = append(change.Details, fmt.Sprintf("type: %d -> %d", current.Type, r.Type))
+			}
+			steps = append(steps, authoperate.TxnStep{
+				Name: fmt.Sprintf("update role %s desc and type", name),
+				Do:   func() error { return oreo.UpdateRoleTypeDesc(name, r.Desc, r.Type) },
+				Undo: func() error { return oreo.UpdateRoleTypeDesc(name, current.Desc, current.Type) },
+			})
+		}
+
+		currentUrlMethod := roleUrlMethod(current)
+		if add := urlMethodMinus(r.urlMethod, currentUrlMethod); len(add) > 0 {
+			change.Details = append(change.Details, oreo.routeDetails("+", add)...)
+			steps = append(steps, authoperate.TxnStep{
+				Name: fmt.Sprintf("add role %s routes", name),
+				Do:   func() error { return oreo.AppendRoleRoute(name, add) },
+				Undo: func() error { return oreo.RemoveRoleRoute(name, add) },
+			})
+		}
+
+		if remove := urlMethodMinus(currentUrlMethod, r.urlMethod); len(remove) > 0 {
+			if prune {
+				change.Details = append(change.Details, oreo.routeDetails("-", remove)...)
+				steps = append(steps, authoperate.TxnStep{
+					Name: fmt.Sprintf("remove role %s routes", name),
+					Do:   func() error { return oreo.RemoveRoleRoute(name, remove) },
+					Undo: func() error { return oreo.AppendRoleRoute(name, remove) },
+				})
+			} else {
+				change.Skipped = append(change.Skipped, oreo.routeDetails("-", remove)...)
+			}
+		}
+	}
+
+	if add := stringsMinus(r.Users, current.UserIds); len(add) > 0 {
+		for _, userId := range add {
+			change.Details = append(change.Details, "+user "+userId)
+		}
+		steps = append(steps, authoperate.TxnStep{
+			Name: fmt.Sprintf("add role %s users", name),
+			Do:   func() error { return oreo.AddRoleUsers(name, add) },
+			Undo: func() error { return oreo.RemoveRoleUsers(name, add) },
+		})
+	}
+
+	if remove := stringsMinus(current.UserIds, r.Users); len(remove) > 0 {
+		for _, userId := range remove {
+			if prune {
+				change.Details = append(change.Details, "-user "+userId)
+			} else {
+				change.Skipped = append(change.Skipped, "-user "+userId)
+			}
+		}
+		if prune {
+			steps = append(steps, authoperate.TxnStep{
+				Name: fmt.Sprintf("remove role %s users", name),
+				Do:   func() error { return oreo.RemoveRoleUsers(name, remove) },
+				Undo: func() error { return oreo.AddRoleUsers(name, remove) },
+			})
+		}
+	}
+
+	// 标签作为角色的属性整体替换
+	if oldTags := mergeStrings(nil, current.Tags); strings.Join(oldTags, ",") != strings.Join(r.Tags, ",") {
+		change.Details = append(change.Details, fmt.Sprintf("tags: [%s] -> [%s]", strings.Join(oldTags, ","), strings.Join(r.Tags, ",")))
+		steps = append(steps, authoperate.TxnStep{
+			Name: fmt.Sprintf("set role %s tags", name),
+			Do:   func() error { return oreo.SetRoleTags(name, r.Tags, 0) },
+			Undo: func() error { return oreo.SetRoleTags(name, current.Tags, 0) },
+		})
+	}
+
+	if change.Action == "" && (len(change.Details) > 0 || len(change.Skipped) > 0) {
+		change.Action = PlanUpdate
+	}
+	return change, steps
+}
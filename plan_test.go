@@ -0,0 +1,222 @@
+package oreo
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xkeyideal/oreo/authoperate"
+)
+
+// 只用于计算计划的Oreo，不连接数据库
+func planTestOreo() *Oreo {
+	return &Oreo{auth: &authoperate.Authorization{}, groupName: "g"}
+}
+
+// /api/a有GET和POST，/api/b有GET，admin为超管，viewer为默认角色
+func planTestState() *authoperate.PolicyState {
+	return &authoperate.PolicyState{
+		Routers: []authoperate.RouterInfo{
+			{Uri: "/api/a", Desc: "a", MethodMap: map[string]authoperate.VerifyData{
+				"1": {MethodDesc: "get a"},
+				"2": {MethodDesc: "post a", Enable: true},
+			}},
+			{Uri: "/api/b", MethodMap: map[string]authoperate.VerifyData{
+				"1": {},
+			}},
+		},
+		Roles: []authoperate.RoleInfo{
+			{RoleName: "admin", Type: 1, UserIds: []string{"u1"}, Address: []authoperate.Address{{Uri: "/api/a", MethodValue: 3}}},
+			{RoleName: "viewer", IsDefault: true, UserIds: []string{"u2"}, Address: []authoperate.Address{{Uri: "/api/b", MethodValue: 1}}},
+		},
+		Users: []authoperate.UserInfo{{UserId: "u1"}, {UserId: "u2"}, {UserId: "u3"}},
+	}
+}
+
+func TestPlanDesired(t *testing.T) {
+	oreo := planTestOreo()
+	get := []PolicyMethod{{Method: "GET"}}
+
+	cases := []struct {
+		name   string
+		policy Policy
+		routes map[string]int
+		roles  map[string]map[string]int
+		err    string
+	}{
+		{"empty", Policy{}, map[string]int{}, map[string]map[string]int{}, ""},
+		{"normalized", Policy{
+			Group:  "g",
+			Routes: []PolicyRoute{{Url: " /API/A ", Methods: []PolicyMethod{{Method: "get"}, {Method: " Post "}}}},
+			Roles:  []PolicyRole{{Name: "r", Routes: map[string][]string{"/API/A": {"get", "POST"}}}},
+		}, map[string]int{"/api/a": 3}, map[string]map[string]int{"r": {"/api/a": 3}}, ""},
+		{"other group", Policy{Group: "other"}, nil, nil, "does not match"},
+		{"duplicate route", Policy{Routes: []PolicyRoute{{Url: "/api/a", Methods: get}, {Url: "/API/a", Methods: get}}}, nil, nil, "listed more than once"},
+		{"no methods", Policy{Routes: []PolicyRoute{{Url: "/api/a"}}}, nil, nil, "has no methods"},
+		{"invalid method", Policy{Routes: []PolicyRoute{{Url: "/api/a", Methods: []PolicyMethod{{Method: "PATCH"}}}}}, nil, nil, "invlid method"},
+		{"duplicate method", Policy{Routes: []PolicyRoute{{Url: "/api/a", Methods: []PolicyMethod{{Method: "GET"}, {Method: "get"}}}}}, nil, nil, "method get is listed more than once"},
+		{"empty role name", Policy{Roles: []PolicyRole{{Name: " "}}}, nil, nil, "role name is empty"},
+		{"duplicate role", Policy{Roles: []PolicyRole{{Name: "r"}, {Name: "r"}}}, nil, nil, "role r is listed more than once"},
+		{"two defaults", Policy{Roles: []PolicyRole{{Name: "r1", IsDefault: true}, {Name: "r2", IsDefault: true}}}, nil, nil, "both r1 and r2"},
+		{"superadmin default", Policy{Roles: []PolicyRole{{Name: "r", Type: 1, IsDefault: true}}}, nil, nil, "can not be the default role"},
+		{"superadmin tags", Policy{Roles: []PolicyRole{{Name: "r", Type: 1, Tags: []string{"team-b"}}}}, nil, nil, "can not have tags"},
+		{"role invalid method", Policy{Roles: []PolicyRole{{Name: "r", Routes: map[string][]string{"/api/a": {"HEAD"}}}}}, nil, nil, "role r:"},
+	}
+
+	for _, c := range cases {
+		routes, roles, err := oreo.planDesired(c.policy)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: planDesired error = %v, want %q", c.name, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+			continue
+		}
+
+		gotRoutes := make(map[string]int)
+		for url, r := range routes {
+			for num := range r.methods {
+				gotRoutes[url] |= num
+			}
+		}
+		gotRoles := make(map[string]map[string]int)
+		for name, r := range roles {
+			gotRoles[name] = r.urlMethod
+		}
+		if !reflect.DeepEqual(gotRoutes, c.routes) {
+			t.Errorf("%s: routes = %v, want %v", c.name, gotRoutes, c.routes)
+		}
+		if !reflect.DeepEqual(gotRoles, c.roles) {
+			t.Errorf("%s: roles = %v, want %v", c.name, gotRoles, c.roles)
+		}
+	}
+}
+
+func TestPolicyPlan(t *testing.T) {
+	oreo := planTestOreo()
+	current := oreo.policyFromState(planTestState())
+
+	// 在当前策略的基础上修改
+	modify := func(fn func(p *Policy)) Policy {
+		p := oreo.policyFromState(planTestState())
+		fn(&p)
+		return p
+	}
+	role := func(p *Policy, name string) *PolicyRole {
+		for i := range p.Roles {
+			if p.Roles[i].Name == name {
+				return &p.Roles[i]
+			}
+		}
+		t.Fatalf("role %s not found", name)
+		return nil
+	}
+
+	cases := []struct {
+		name    string
+		policy  Policy
+		prune   bool
+		changes []string
+		steps   int
+		err     string
+	}{
+		{"unchanged", current, true, nil, 0, ""},
+		{"create route and role", modify(func(p *Policy) {
+			p.Routes = append(p.Routes, PolicyRoute{Url: "/api/c", Methods: []PolicyMethod{{Method: "PUT", DataAuth: true}}})
+			p.Roles = append(p.Roles, PolicyRole{Name: "editor", Routes: map[string][]string{"/api/c": {"PUT"}}, Users: []string{"u3"}})
+		}), false, []string{
+			"create route /api/c [+PUT dataAuth] []",
+			"create role editor [+route /api/c PUT +user u3] []",
+		}, 3, ""},
+		{"update route methods", modify(func(p *Policy) {
+			p.Routes[0] = PolicyRoute{Url: "/api/a", Desc: "A", Methods: []PolicyMethod{{Method: "GET", Desc: "get a", DataAuth: true}, {Method: "DELETE"}}}
+			role(p, "admin").Routes = map[string][]string{"/api/a": {"GET"}}
+		}), false, []string{
+			`update route /api/a [desc: "a" -> "A" GET dataAuth: false -> true +DELETE] [-POST]`,
+			"update role admin [] [-route /api/a POST]",
+		}, 3, ""},
+		{"prune route method", modify(func(p *Policy) {
+			p.Routes[0].Methods = p.Routes[0].Methods[:1]
+			role(p, "admin").Routes = map[string][]string{"/api/a": {"GET"}}
+		}), true, []string{
+			"update route /api/a [-POST] []",
+			"update role admin [-route /api/a POST] []",
+		}, 2, ""},
+		{"skip deletes without prune", modify(func(p *Policy) {
+			p.Routes = p.Routes[:1]
+			p.Roles = p.Roles[:1]
+		}), false, []string{
+			"delete role viewer [] [-role with 1 routes and 1 users]",
+			"delete route /api/b [] [-route GET]",
+		}, 0, ""},
+		{"prune role and route", modify(func(p *Policy) {
+			p.Routes = p.Routes[:1]
+			p.Roles = p.Roles[:1]
+		}), true, []string{
+			"delete role viewer [-role with 1 routes and 1 users] []",
+			"delete route /api/b [-route GET] []",
+		}, 2, ""},
+		{"members and tags", modify(func(p *Policy) {
+			r := role(p, "viewer")
+			r.Users = []string{"u3"}
+			r.Tags = []string{"ops"}
+		}), false, []string{
+			"update role viewer [+user u3 tags: [] -> [ops]] [-user u2]",
+		}, 2, ""},
+		{"change default role", modify(func(p *Policy) {
+			role(p, "viewer").IsDefault = false
+			p.Roles = append(p.Roles, PolicyRole{Name: "guest", IsDefault: true})
+		}), false, []string{
+			"create role guest [default: viewer -> guest] []",
+		}, 2, ""},
+		{"route still used after prune", modify(func(p *Policy) {
+			p.Routes = p.Routes[:1]
+		}), true, nil, 0, "role viewer: route /api/b GET does not exist"},
+		{"route kept without prune", modify(func(p *Policy) {
+			p.Routes = p.Routes[:1]
+		}), false, []string{"delete route /api/b [] [-route GET]"}, 0, ""},
+		{"unknown user", modify(func(p *Policy) {
+			role(p, "viewer").Users = []string{"u9"}
+		}), false, nil, 0, "role viewer: user u9 does not exist"},
+	}
+
+	for _, c := range cases {
+		state := planTestState()
+		plan, err := oreo.policyPlan(state, c.policy, PlanOptions{Prune: c.prune})
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: policyPlan error = %v, want %q", c.name, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+			continue
+		}
+
+		changes := []string{}
+		for _, change := range plan.Changes {
+			changes = append(changes, fmt.Sprintf("%s %s %s [%s] [%s]", change.Action, change.Kind, change.Name,
+				strings.Join(change.Details, " "), strings.Join(change.Skipped, " ")))
+		}
+		if len(changes) == 0 {
+			changes = nil
+		}
+		if !reflect.DeepEqual(changes, c.changes) {
+			t.Errorf("%s: changes = %q, want %q", c.name, changes, c.changes)
+		}
+		if len(plan.steps) != c.steps {
+			t.Errorf("%s: steps = %d, want %d", c.name, len(plan.steps), c.steps)
+		}
+		if plan.HasChanges() != (c.steps > 0) {
+			t.Errorf("%s: HasChanges = %t, want %t", c.name, plan.HasChanges(), c.steps > 0)
+		}
+		if plan.Fingerprint != oreo.policyFingerprint(state) {
+			t.Errorf("%s: fingerprint = %s, want the fingerprint of the state", c.name, plan.Fingerprint)
+		}
+	}
+}
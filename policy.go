@@ -0,0 +1,294 @@
+package oreo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xkeyideal/oreo/authoperate"
+	"github.com/xkeyideal/oreo/route"
+)
+
+// 组内完整的权限策略，路由方法使用GET、POST、PUT、DELETE表示，用于导出、导入和备份
+type Policy struct {
+	Group  string        `json:"group" yaml:"group"`
+	Routes []PolicyRoute `json:"routes" yaml:"routes"`
+	Users  []PolicyUser  `json:"users" yaml:"users"`
+	Roles  []PolicyRole  `json:"roles" yaml:"roles"`
+	Signs  []PolicySign  `json:"signs" yaml:"signs"`
+}
+
+type PolicyRoute struct {
+	Url     string         `json:"url" yaml:"url"`
+	Desc    string         `json:"desc,omitempty" yaml:"desc,omitempty"`
+	Methods []PolicyMethod `json:"methods" yaml:"methods"`
+}
+
+type PolicyMethod struct {
+	Method   string `json:"method" yaml:"method"`
+	Desc     string `json:"desc,omitempty" yaml:"desc,omitempty"`
+	DataAuth bool   `json:"dataAuth,omitempty" yaml:"dataAuth,omitempty"` //是否开启数据权限
+}
+
+type PolicyUser struct {
+	UserId   string            `json:"userId" yaml:"userId"`
+	Name     string            `json:"name,omitempty" yaml:"name,omitempty"`
+	SignKeys map[string]string `json:"signKeys,omitempty" yaml:"signKeys,omitempty"` //用户创建的signKey和描述
+}
+
+type PolicyRole struct {
+	Name      string              `json:"name" yaml:"name"`
+	Desc      string              `json:"desc,omitempty" yaml:"desc,omitempty"`
+	Type      int                 `json:"type,omitempty" yaml:"type,omitempty"` //1表示超管
+	IsDefault bool                `json:"isDefault,omitempty" yaml:"isDefault,omitempty"`
+	Tags      []string            `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Routes    map[string][]string `json:"routes,omitempty" yaml:"routes,omitempty"` //url对应的方法列表
+	Users     []string            `json:"users,omitempty" yaml:"users,omitempty"`
+}
+
+// signKey授权给某个用户的路由和方法
+type PolicySign struct {
+	SignKey string              `json:"signKey" yaml:"signKey"`
+	UserId  string              `json:"userId" yaml:"userId"`
+	Routes  map[string][]string `json:"routes" yaml:"routes"`
+}
+
+// 导入时新增和合并的数量
+type PolicyImportResult struct {
+	Routes int `json:"routes"`
+	Users  int `json:"users"`
+	Roles  int `json:"roles"`
+	Signs  int `json:"signs"`
+}
+
+// 导出组内的路由、用户、角色和sign授权，结果按名称排序，相同的数据导出的结果相同
+func (oreo *Oreo) ExportPolicy() (Policy, error) {
+	state, err := oreo.auth.PolicyStateLoad()
+	if err != nil {
+		return Policy{}, err
+	}
+
+	return oreo.policyFromState(state), nil
+}
+
+func (oreo *Oreo) policyFromState(state *authoperate.PolicyState) Policy {
+	policy := Policy{
+		Group:  oreo.groupName,
+		Routes: []PolicyRoute{},
+		Users:  []PolicyUser{},
+		Roles:  []PolicyRole{},
+		Signs:  []PolicySign{},
+	}
+
+	routeExist := make(map[string]int)
+	for _, router := range state.Routers {
+		pr := PolicyRoute{Url: router.Uri, Desc: router.Desc, Methods: []PolicyMethod{}}
+		for num, vd := range router.MethodMap {
+			pr.Methods = append(pr.Methods, PolicyMethod{
+				Method:   oreo.auth.NumStringToMethod(num),
+				Desc:     vd.MethodDesc,
+				DataAuth: vd.Enable,
+			})
+			routeExist[router.Uri] |= oreo.auth.NumStringToNum(num)
+		}
+		sort.Slice(pr.Methods, func(i, j int) bool { return methodOrder(pr.Methods[i].Method) < methodOrder(pr.Methods[j].Method) })
+		policy.Routes = append(policy.Routes, pr)
+	}
+	sort.Slice(policy.Routes, func(i, j int) bool { return policy.Routes[i].Url < policy.Routes[j].Url })
+
+	// 已被删除的路由即使还残留在角色和授权中也不导出
+	urlMethods := func(uri string, value int) ([]string, bool) {
+		value &= routeExist[uri]
+		if value == 0 {
+			return nil, false
+		}
+		methods := []string{}
+		for _, num := range oreo.auth.MethodValueToMethods(value) {
+			methods = append(methods, oreo.auth.NumStringToMethod(num))
+		}
+		return methods, true
+	}
+
+	for _, user := range state.Users {
+		pu := PolicyUser{UserId: user.UserId, Name: user.Name}
+		if len(user.SignKey) > 0 {
+			pu.SignKeys = user.SignKey
+		}
+		policy.Users = append(policy.Users, pu)
+	}
+	sort.Slice(policy.Users, func(i, j int) bool { return policy.Users[i].UserId < policy.Users[j].UserId })
+
+	for _, role := range state.Roles {
+		pr := PolicyRole{
+			Name:      role.RoleName,
+			Desc:      role.Desc,
+			Type:      role.Type,
+			IsDefault: role.IsDefault,
+			Tags:      role.Tags,
+			Routes:    map[string][]string{},
+			Users:     append([]string{}, role.UserIds...),
+		}
+		for _, addr := range role.Address {
+			if methods, ok := urlMethods(addr.Uri, addr.MethodValue); ok {
+				pr.Routes[addr.Uri] = methods
+			}
+		}
+		sort.Strings(pr.Users)
+		policy.Roles = append(policy.Roles, pr)
+	}
+	sort.Slice(policy.Roles, func(i, j int) bool { return policy.Roles[i].Name < policy.Roles[j].Name })
+
+	for _, sign := range state.Signs {
+		ps := PolicySign{SignKey: sign.SignKey, UserId: sign.UserId, Routes: map[string][]string{}}
+		for uri, value := range sign.VerifyDataUri {
+			if methods, ok := urlMethods(uri, value); ok {
+				ps.Routes[uri] = methods
+			}
+		}
+		if len(ps.Routes) > 0 {
+			policy.Signs = append(policy.Signs, ps)
+		}
+	}
+	sort.Slice(policy.Signs, func(i, j int) bool {
+		if policy.Signs[i].SignKey == policy.Signs[j].SignKey {
+			return policy.Signs[i].UserId < policy.Signs[j].UserId
+		}
+		return policy.Signs[i].SignKey < policy.Signs[j].SignKey
+	})
+
+	return policy
+}
+
+// 将方法列表转换为方法的整型值之和，url转换为小写
+func (oreo *Oreo) policyUrlMethods(routes map[string][]string) (map[string]int, error) {
+	urlMethod := make(map[string]int)
+	for url, methods := range routes {
+		url = strings.ToLower(strings.TrimSpace(url))
+		for _, method := range methods {
+			num, err := oreo.auth.MethodToNumString(strings.ToUpper(strings.TrimSpace(method)))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", url, err.Error())
+			}
+			urlMethod[url] |= oreo.auth.NumStringToNum(num)
+		}
+	}
+	return urlMethod, nil
+}
+
+// 增量导入策略，不存在的路由、用户、角色和授权会被创建，已存在的会合并路由方法、用户和标签，
+// 不会删除任何数据，也不会修改已存在数据的描述，导入的signKey保持不变
+func (oreo *Oreo) ImportPolicy(policy Policy) (PolicyImportResult, error) {
+	res := PolicyImportResult{}
+
+	state, err := oreo.auth.PolicyStateLoad()
+	if err != nil {
+		return res, err
+	}
+
+	if err := oreo.autoSnapshot("before import policy"); err != nil {
+		return res, err
+	}
+
+	routes := []route.RouteData{}
+	for _, pr := range policy.Routes {
+		rd := route.RouteData{Url: pr.Url, UrlDesc: pr.Desc}
+		for _, pm := range pr.Methods {
+			rd.Methods = append(rd.Methods, route.RouteMethodData{
+				Method:     pm.Method,
+				MethodDesc: pm.Desc,
+				Enable:     pm.DataAuth,
+			})
+		}
+		routes = append(routes, rd)
+	}
+	if len(routes) > 0 {
+		if err := oreo.AddRoute(routes); err != nil {
+			return res, err
+		}
+		res.Routes = len(routes)
+	}
+
+	for _, pu := range policy.Users {
+		if err := oreo.auth.UserUpsertSignKeys(pu.UserId, pu.Name, pu.SignKeys); err != nil {
+			return res, err
+		}
+		res.Users++
+	}
+
+	roles := make(map[string]authoperate.RoleInfo)
+	for _, role := range state.Roles {
+		roles[role.RoleName] = role
+	}
+
+	for _, pr := range policy.Roles {
+		urlMethod, err := oreo.policyUrlMethods(pr.Routes)
+		if err != nil {
+			return res, err
+		}
+
+		role, exist := roles[pr.Name]
+		if !exist {
+			if err := oreo.AddRoleWithVersion(pr.Name, pr.Desc, pr.Type, pr.IsDefault, urlMethod, 0); err != nil {
+				return res, err
+			}
+		} else if len(urlMethod) > 0 {
+			if err := oreo.AppendRoleRoute(pr.Name, urlMethod); err != nil {
+				return res, err
+			}
+		}
+
+		if len(pr.Users) > 0 {
+			if err := oreo.AddRoleUsers(pr.Name, pr.Users); err != nil {
+				return res, err
+			}
+		}
+
+		if tags := mergeStrings(role.Tags, pr.Tags); len(tags) > len(role.Tags) {
+			if err := oreo.SetRoleTags(pr.Name, tags, 0); err != nil {
+				return res, err
+			}
+		}
+		res.Roles++
+	}
+
+	grants := make(map[string]bool)
+	for _, sign := range state.Signs {
+		grants[sign.SignKey+"\x00"+sign.UserId] = true
+	}
+
+	for _, ps := range policy.Signs {
+		urlMethod, err := oreo.policyUrlMethods(ps.Routes)
+		if err != nil {
+			return res, err
+		}
+		if len(urlMethod) == 0 {
+			continue
+		}
+
+		if grants[ps.SignKey+"\x00"+ps.UserId] {
+			err = oreo.AppendUserSign(ps.SignKey, []string{ps.UserId}, urlMethod)
+		} else {
+			err = oreo.AddSign(ps.SignKey, ps.UserId, urlMethod)
+		}
+		if err != nil {
+			return res, err
+		}
+		res.Signs++
+	}
+
+	return res, nil
+}
+
+// 合并去重并排序
+func mergeStrings(a, b []string) []string {
+	set := make(map[string]bool)
+	merged := []string{}
+	for _, s := range append(append([]string{}, a...), b...) {
+		if !set[s] {
+			set[s] = true
+			merged = append(merged, s)
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
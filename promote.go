@@ -0,0 +1,418 @@
+package oreo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xkeyideal/oreo/authoperate"
+)
+
+// 两个组的路由、角色和默认角色的差异，source可以来自其他组或其他存储导出的策略
+type PolicyDiff struct {
+	Source        string       `json:"source"`
+	Target        string       `json:"target"`
+	SourceDefault string       `json:"sourceDefault"` //源组的默认角色
+	TargetDefault string       `json:"targetDefault"` //目标组的默认角色
+	Changes       []PlanChange `json:"changes"`       //将目标组修改为与源组一致需要做的修改，delete表示只在目标组存在
+}
+
+// 路由、角色或默认角色是否有差异
+func (diff PolicyDiff) HasDiff() bool {
+	return len(diff.Changes) > 0 || diff.SourceDefault != diff.TargetDefault
+}
+
+// 提升的选项，Routes和Roles都为空时提升源组的全部路由和角色。
+// 默认只同步路由和角色的定义，目标组的角色成员和sign授权保持不变
+type PromoteOptions struct {
+	Routes      []string `json:"routes,omitempty"` //提升的路由url
+	Roles       []string `json:"roles,omitempty"`  //提升的角色名
+	DefaultRole bool     `json:"defaultRole"`      //同步源组的默认角色
+	Users       bool     `json:"users"`            //同步提升角色的成员，目标组不存在的用户会被创建
+	Signs       bool     `json:"signs"`            //同步源组的signKey归属和sign授权，目标组不存在的用户会被创建
+	Prune       bool     `json:"prune"`            //删除提升的路由、角色和授权中源组没有的方法、路由和成员
+	Fingerprint string   `json:"fingerprint"`      //不为空则要求与目标组当前数据的指纹一致
+}
+
+func defaultRoleName(policy Policy) string {
+	for _, pr := range policy.Roles {
+		if pr.IsDefault {
+			return pr.Name
+		}
+	}
+	return ""
+}
+
+// 比较源组与当前组的路由、角色和默认角色，不比较角色成员、用户和sign授权
+func (oreo *Oreo) DiffPolicy(source Policy) (PolicyDiff, error) {
+	diff := PolicyDiff{Source: source.Group, Target: oreo.groupName, Changes: []PlanChange{}}
+
+	state, err := oreo.auth.PolicyStateLoad()
+	if err != nil {
+		return diff, err
+	}
+
+	target := oreo.policyFromState(state)
+	members := make(map[string][]string)
+	for _, pr := range target.Roles {
+		members[pr.Name] = pr.Users
+	}
+
+	desired := Policy{Group: oreo.groupName, Routes: source.Routes}
+	for _, pr := range source.Roles {
+		pr.Users = members[pr.Name]
+		desired.Roles = append(desired.Roles, pr)
+	}
+
+	plan, err := oreo.policyPlan(state, desired, PlanOptions{Prune: true})
+	if err != nil {
+		return diff, fmt.Errorf("source group %s: %s", source.Group, err.Error())
+	}
+
+	diff.SourceDefault = defaultRoleName(source)
+	diff.TargetDefault = defaultRoleName(target)
+	diff.Changes = plan.Changes
+	return diff, nil
+}
+
+// 计算将源组中选中的路由和角色提升到当前组需要做的修改，不会写入数据库。
+// 没有选中的路由和角色不会被修改或删除
+func (oreo *Oreo) PlanPromote(source Policy, opts PromoteOptions) (PolicyPlan, error) {
+	state, err := oreo.auth.PolicyStateLoad()
+	if err != nil {
+		return PolicyPlan{}, err
+	}
+
+	return oreo.promotePlan(state, source, opts)
+}
+
+// 按提升的计划修改当前组，失败时撤销已经执行的修改并返回*authoperate.TxnError。
+// 用户的创建和signKey归属的修改不会撤销，执行之前会自动创建快照
+func (oreo *Oreo) Promote(source Policy, opts PromoteOptions) (PolicyPlan, error) {
+	state, err := oreo.auth.PolicyStateLoad()
+	if err != nil {
+		return PolicyPlan{}, err
+	}
+
+	plan, err := oreo.promotePlan(state, source, opts)
+	if err != nil {
+		return plan, err
+	}
+
+	if opts.Fingerprint != "" && opts.Fingerprint != plan.Fingerprint {
+		return plan, ErrPlanStale
+	}
+
+	if len(plan.steps) > 0 {
+		if err := oreo.autoSnapshot(fmt.Sprintf("before promote from %s", source.Group)); err != nil {
+			return plan, err
+		}
+	}
+
+	return plan, plan.run()
+}
+
+// 选中的路由和角色，都为空时选中源组的全部路由和角色
+func promoteSelection(source Policy, opts PromoteOptions) (map[string]PolicyRoute, map[string]PolicyRole, error) {
+	sourceRoutes := make(map[string]PolicyRoute)
+	for _, pr := range source.Routes {
+		sourceRoutes[strings.ToLower(strings.TrimSpace(pr.Url))] = pr
+	}
+
+	sourceRoles := make(map[string]PolicyRole)
+	for _, pr := range source.Roles {
+		sourceRoles[pr.Name] = pr
+	}
+
+	if len(opts.Routes) == 0 && len(opts.Roles) == 0 {
+		return sourceRoutes, sourceRoles, nil
+	}
+
+	routes := make(map[string]PolicyRoute)
+	for _, url := range opts.Routes {
+		url = strings.ToLower(strings.TrimSpace(url))
+		pr, ok := sourceRoutes[url]
+		if !ok {
+			return nil, nil, fmt.Errorf("route %s does not exist in group %s", url, source.Group)
+		}
+		routes[url] = pr
+	}
+
+	roles := make(map[string]PolicyRole)
+	for _, name := range opts.Roles {
+		pr, ok := sourceRoles[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("role %s does not exist in group %s", name, source.Group)
+		}
+		roles[name] = pr
+	}
+
+	return routes, roles, nil
+}
+
+func (oreo *Oreo) promotePlan(state *authoperate.PolicyState, source Policy, opts PromoteOptions) (PolicyPlan, error) {
+	routes, roles, err := promoteSelection(source, opts)
+	if err != nil {
+		return PolicyPlan{}, err
+	}
+
+	// 以当前组的数据为基础，替换选中的路由和角色，没有选中的数据与当前一致，不会产生修改
+	target := oreo.policyFromState(state)
+	desired := Policy{Group: oreo.groupName}
+
+	for _, pr := range target.Routes {
+		if _, ok := routes[pr.Url]; !ok {
+			desired.Routes = append(desired.Routes, pr)
+		}
+	}
+	urls := []string{}
+	for url := range routes {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	for _, url := range urls {
+		desired.Routes = append(desired.Routes, routes[url])
+	}
+
+	sourceDefault := defaultRoleName(source)
+	syncDefault := opts.DefaultRole && sourceDefault != ""
+
+	targetRoles := make(map[string]PolicyRole)
+	for _, pr := range target.Roles {
+		targetRoles[pr.Name] = pr
+		if _, ok := roles[pr.Name]; ok {
+			continue
+		}
+		if syncDefault {
+			pr.IsDefault = pr.Name == sourceDefault
+		}
+		desired.Roles = append(desired.Roles, pr)
+	}
+
+	names := []string{}
+	for name := range roles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		pr := roles[name]
+		current, exist := targetRoles[name]
+		if !opts.Users {
+			pr.Users = current.Users
+		}
+		if syncDefault {
+			pr.IsDefault = name == sourceDefault
+		} else {
+			pr.IsDefault = exist && current.IsDefault
+		}
+		desired.Roles = append(desired.Roles, pr)
+	}
+
+	if syncDefault {
+		if _, ok := roles[sourceDefault]; !ok {
+			if _, ok := targetRoles[sourceDefault]; !ok {
+				return PolicyPlan{}, fmt.Errorf("default role %s is neither promoted nor exists in group %s", sourceDefault, oreo.groupName)
+			}
+		}
+	}
+
+	// 需要创建的用户和修改的signKey归属，在其他修改之前执行
+	userSteps, userChanges, created := oreo.promoteUsers(target, source, roles, opts)
+
+	st := *state
+	st.Users = append(append([]authoperate.UserInfo{}, state.Users...), created...)
+
+	plan, err := oreo.policyPlan(&st, desired, PlanOptions{Prune: opts.Prune})
+	if err != nil {
+		return plan, err
+	}
+
+	plan.Changes = append(userChanges, plan.Changes...)
+	plan.steps = append(userSteps, plan.steps...)
+
+	if opts.Signs {
+		desiredRoutes, _, err := oreo.planDesired(desired)
+		if err != nil {
+			return plan, err
+		}
+
+		finalRoutes := oreo.planFinalRoutes(state, desiredRoutes, opts.Prune)
+		if err := oreo.promoteSigns(&plan, state, source, finalRoutes, opts.Prune); err != nil {
+			return plan, err
+		}
+	}
+
+	return plan, nil
+}
+
+// 计算需要创建的用户和需要写入的signKey，返回步骤、修改和创建的用户
+func (oreo *Oreo) promoteUsers(target, source Policy, roles map[string]PolicyRole, opts PromoteOptions) ([]authoperate.TxnStep, []PlanChange, []authoperate.UserInfo) {
+	targetUsers := make(map[string]PolicyUser)
+	for _, pu := range target.Users {
+		targetUsers[pu.UserId] = pu
+	}
+	sourceUsers := make(map[string]PolicyUser)
+	for _, pu := range source.Users {
+		sourceUsers[pu.UserId] = pu
+	}
+
+	upserts := make(map[string]PolicyUser)
+	need := func(userId string) {
+		if _, ok := targetUsers[userId]; ok {
+			return
+		}
+		if _, ok := upserts[userId]; ok {
+			return
+		}
+		pu, ok := sourceUsers[userId]
+		if !ok {
+			pu = PolicyUser{UserId: userId}
+		}
+		upserts[userId] = PolicyUser{UserId: userId, Name: pu.Name}
+	}
+
+	if opts.Users {
+		for _, pr := range roles {
+			for _, userId := range pr.Users {
+				need(userId)
+			}
+		}
+	}
+
+	if opts.Signs {
+		for _, pu := range source.Users {
+			current := targetUsers[pu.UserId]
+			changed := false
+			for signKey, desc := range pu.SignKeys {
+				if d, ok := current.SignKeys[signKey]; !ok || d != desc {
+					changed = true
+				}
+			}
+			if changed {
+				need(pu.UserId)
+				u := upserts[pu.UserId]
+				u.UserId, u.SignKeys = pu.UserId, pu.SignKeys
+				upserts[pu.UserId] = u
+			}
+		}
+		for _, ps := range source.Signs {
+			need(ps.UserId)
+		}
+	}
+
+	userIds := []string{}
+	for userId := range upserts {
+		userIds = append(userIds, userId)
+	}
+	sort.Strings(userIds)
+
+	steps := []authoperate.TxnStep{}
+	changes := []PlanChange{}
+	created := []authoperate.UserInfo{}
+	for _, userId := range userIds {
+		pu := upserts[userId]
+		current, exist := targetUsers[userId]
+
+		change := PlanChange{Action: PlanUpdate, Kind: PlanKindUser, Name: userId}
+		if !exist {
+			change.Action = PlanCreate
+			if pu.Name != "" {
+				change.Details = append(change.Details, fmt.Sprintf("name: %q", pu.Name))
+			}
+			created = append(created, authoperate.UserInfo{UserId: userId, Name: pu.Name, GroupName: oreo.groupName})
+		}
+
+		signKeys := []string{}
+		for signKey := range pu.SignKeys {
+			signKeys = append(signKeys, signKey)
+		}
+		sort.Strings(signKeys)
+		for _, signKey := range signKeys {
+			if d, ok := current.SignKeys[signKey]; !ok {
+				change.Details = append(change.Details, fmt.Sprintf("+signKey %s %q", signKey, pu.SignKeys[signKey]))
+			} else if d != pu.SignKeys[signKey] {
+				change.Details = append(change.Details, fmt.Sprintf("signKey %s desc: %q -> %q", signKey, d, pu.SignKeys[signKey]))
+			}
+		}
+		if len(change.Details) == 0 {
+			change.Details = []string{"+user"}
+		}
+
+		changes = append(changes, change)
+		steps = append(steps, authoperate.TxnStep{
+			Name: fmt.Sprintf("upsert user %s", userId),
+			Do:   func() error { return oreo.auth.UserUpsertSignKeys(pu.UserId, pu.Name, pu.SignKeys) },
+		})
+	}
+
+	return steps, changes, created
+}
+
+// 将源组的sign授权加入计划，目标组中源组没有的授权不会被修改
+func (oreo *Oreo) promoteSigns(plan *PolicyPlan, state *authoperate.PolicyState, source Policy, finalRoutes map[string]int, prune bool) error {
+	currentGrants := make(map[string]map[string]int)
+	for _, sign := range state.Signs {
+		currentGrants[sign.SignKey+"\x00"+sign.UserId] = sign.VerifyDataUri
+	}
+
+	for _, ps := range source.Signs {
+		urlMethod, err := oreo.policyUrlMethods(ps.Routes)
+		if err != nil {
+			return fmt.Errorf("sign %s of %s: %s", ps.SignKey, ps.UserId, err.Error())
+		}
+		for _, url := range sortedUrls(urlMethod) {
+			if missing := urlMethod[url] &^ finalRoutes[url]; missing != 0 {
+				return fmt.Errorf("sign %s of %s: route %s %s does not exist", ps.SignKey, ps.UserId, url, oreo.methodNames(missing))
+			}
+		}
+
+		signKey, userId := ps.SignKey, ps.UserId
+		change := PlanChange{Kind: PlanKindSign, Name: fmt.Sprintf("%s %s", signKey, userId)}
+
+		current, exist := currentGrants[signKey+"\x00"+userId]
+		if !exist {
+			if len(urlMethod) == 0 {
+				continue
+			}
+			change.Action = PlanCreate
+			change.Details = oreo.routeDetails("+", urlMethod)
+			plan.Changes = append(plan.Changes, change)
+			plan.steps = append(plan.steps, authoperate.TxnStep{
+				Name: fmt.Sprintf("grant sign %s to %s", signKey, userId),
+				Do:   func() error { return oreo.AddSign(signKey, userId, urlMethod) },
+				Undo: func() error { return oreo.RemoveSign(signKey, userId) },
+			})
+			continue
+		}
+
+		if add := urlMethodMinus(urlMethod, current); len(add) > 0 {
+			change.Details = append(change.Details, oreo.routeDetails("+", add)...)
+			plan.steps = append(plan.steps, authoperate.TxnStep{
+				Name: fmt.Sprintf("add sign %s routes of %s", signKey, userId),
+				Do:   func() error { return oreo.AppendUserSign(signKey, []string{userId}, add) },
+				Undo: func() error { return oreo.RemoveUserSign(signKey, []string{userId}, add) },
+			})
+		}
+
+		if remove := urlMethodMinus(current, urlMethod); len(remove) > 0 {
+			if prune {
+				change.Details = append(change.Details, oreo.routeDetails("-", remove)...)
+				plan.steps = append(plan.steps, authoperate.TxnStep{
+					Name: fmt.Sprintf("remove sign %s routes of %s", signKey, userId),
+					Do:   func() error { return oreo.RemoveUserSign(signKey, []string{userId}, remove) },
+					Undo: func() error { return oreo.AppendUserSign(signKey, []string{userId}, remove) },
+				})
+			} else {
+				change.Skipped = append(change.Skipped, oreo.routeDetails("-", remove)...)
+			}
+		}
+
+		if len(change.Details) > 0 || len(change.Skipped) > 0 {
+			change.Action = PlanUpdate
+			plan.Changes = append(plan.Changes, change)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package oreo
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestPromoteSelection(t *testing.T) {
+	source := Policy{
+		Group: "dev",
+		Routes: []PolicyRoute{
+			{Url: "/api/a", Methods: []PolicyMethod{{Method: "GET"}}},
+			{Url: "/API/B ", Methods: []PolicyMethod{{Method: "POST"}}},
+		},
+		Roles: []PolicyRole{{Name: "admin", Type: 1}, {Name: "viewer"}},
+	}
+
+	cases := []struct {
+		name   string
+		opts   PromoteOptions
+		routes []string
+		roles  []string
+		err    string
+	}{
+		{"all", PromoteOptions{}, []string{"/api/a", "/api/b"}, []string{"admin", "viewer"}, ""},
+		{"routes only", PromoteOptions{Routes: []string{" /API/B"}}, []string{"/api/b"}, []string{}, ""},
+		{"roles only", PromoteOptions{Roles: []string{"viewer"}}, []string{}, []string{"viewer"}, ""},
+		{"routes and roles", PromoteOptions{Routes: []string{"/api/a"}, Roles: []string{"admin"}}, []string{"/api/a"}, []string{"admin"}, ""},
+		{"missing route", PromoteOptions{Routes: []string{"/api/c"}}, nil, nil, "route /api/c does not exist in group dev"},
+		{"missing role", PromoteOptions{Roles: []string{"Viewer"}}, nil, nil, "role Viewer does not exist in group dev"},
+	}
+
+	for _, c := range cases {
+		routes, roles, err := promoteSelection(source, c.opts)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: promoteSelection error = %v, want %q", c.name, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+			continue
+		}
+
+		urls := []string{}
+		for url := range routes {
+			urls = append(urls, url)
+		}
+		sort.Strings(urls)
+		names := []string{}
+		for name, pr := range roles {
+			if pr.Name != name {
+				t.Errorf("%s: role %s selected as %s", c.name, pr.Name, name)
+			}
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		if !reflect.DeepEqual(urls, c.routes) {
+			t.Errorf("%s: routes = %v, want %v", c.name, urls, c.routes)
+		}
+		if !reflect.DeepEqual(names, c.roles) {
+			t.Errorf("%s: roles = %v, want %v", c.name, names, c.roles)
+		}
+	}
+}
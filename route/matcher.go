@@ -0,0 +1,60 @@
+package route
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/xkeyideal/oreo/authoperate"
+	"github.com/xkeyideal/oreo/vestigo"
+)
+
+// 不依赖内存中路由缓存的匹配器，用于对模拟或导入的路由表进行匹配
+type RouteMatcher struct {
+	router *vestigo.Router
+}
+
+func NewRouteMatcher(routers []authoperate.RouterInfo) *RouteMatcher {
+	router := vestigo.NewRouter()
+
+	for _, info := range routers {
+		for num := range info.MethodMap {
+			method := methodNumToString(num)
+			if !isValidMethod(method) {
+				continue
+			}
+			router.Add(method, info.Uri, func(w http.ResponseWriter, req *http.Request) {})
+		}
+	}
+
+	return &RouteMatcher{router: router}
+}
+
+func (m *RouteMatcher) Match(method, url string) (string, bool) {
+	method = strings.TrimSpace(strings.ToUpper(method))
+	if !isValidMethod(method) {
+		return "", false
+	}
+
+	url = strings.TrimSpace(strings.ToLower(url))
+
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return "", false
+	}
+
+	return m.router.Match(req)
+}
+
+func methodNumToString(num string) string {
+	switch num {
+	case "1":
+		return "GET"
+	case "2":
+		return "POST"
+	case "4":
+		return "PUT"
+	case "8":
+		return "DELETE"
+	}
+	return ""
+}
@@ -0,0 +1,183 @@
+package route
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// 在operation上标记该路由方法需要数据权限，例如 x-oreo-data-auth: true
+const OpenAPIDataAuthExtension = "x-oreo-data-auth"
+
+type openAPIDoc struct {
+	OpenAPI string                     `json:"openapi" yaml:"openapi"`
+	Swagger string                     `json:"swagger" yaml:"swagger"`
+	Paths   map[string]openAPIPathItem `json:"paths" yaml:"paths"`
+}
+
+type openAPIPathItem struct {
+	Summary     string            `json:"summary" yaml:"summary"`
+	Description string            `json:"description" yaml:"description"`
+	Get         *openAPIOperation `json:"get" yaml:"get"`
+	Put         *openAPIOperation `json:"put" yaml:"put"`
+	Post        *openAPIOperation `json:"post" yaml:"post"`
+	Delete      *openAPIOperation `json:"delete" yaml:"delete"`
+	Options     *openAPIOperation `json:"options" yaml:"options"`
+	Head        *openAPIOperation `json:"head" yaml:"head"`
+	Patch       *openAPIOperation `json:"patch" yaml:"patch"`
+	Trace       *openAPIOperation `json:"trace" yaml:"trace"`
+}
+
+type openAPIOperation struct {
+	Summary     string `json:"summary" yaml:"summary"`
+	Description string `json:"description" yaml:"description"`
+	OperationId string `json:"operationId" yaml:"operationId"`
+	DataAuth    bool   `json:"x-oreo-data-auth" yaml:"x-oreo-data-auth"`
+}
+
+// 文档中无法导入的路由方法
+type OpenAPISkip struct {
+	Path   string `json:"path"`
+	Method string `json:"method"`
+	Reason string `json:"reason"`
+}
+
+// 导入的路由与已有路由或文档中其他路由冲突
+type RouteConflict struct {
+	Url         string `json:"url"`
+	ConflictUrl string `json:"conflictUrl"`
+}
+
+type OpenAPIImport struct {
+	Routes    []RouteData     `json:"routes"`
+	Skipped   []OpenAPISkip   `json:"skipped"`
+	Conflicts []RouteConflict `json:"conflicts"`
+}
+
+// 将OpenAPI 3(兼容Swagger 2)的JSON或YAML文档转换为路由，{id}转换为:id，basePath会拼接在每个路由之前，
+// existUrls为数据库中已有的路由，用于冲突检测
+func ParseOpenAPI(data []byte, basePath string, existUrls []string) (OpenAPIImport, error) {
+	res := OpenAPIImport{
+		Routes:    []RouteData{},
+		Skipped:   []OpenAPISkip{},
+		Conflicts: []RouteConflict{},
+	}
+
+	doc := openAPIDoc{}
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return res, fmt.Errorf("parse openapi json exception %s", err.Error())
+		}
+	} else {
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return res, fmt.Errorf("parse openapi yaml exception %s", err.Error())
+		}
+	}
+
+	if doc.OpenAPI == "" && doc.Swagger == "" {
+		return res, fmt.Errorf("not an openapi document")
+	}
+
+	paths := []string{}
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	basePath = strings.TrimRight(strings.TrimSpace(basePath), "/")
+	oldUrls := append([]string{}, existUrls...)
+	exist := make(map[string]struct{})
+	for _, url := range existUrls {
+		exist[url] = struct{}{}
+	}
+
+	for _, path := range paths {
+		item := doc.Paths[path]
+		url := strings.ToLower(openAPIPathToRoute(basePath + path))
+
+		if err := routeRuleCheck(url); err != nil {
+			res.Skipped = append(res.Skipped, OpenAPISkip{Path: path, Reason: err.Error()})
+			continue
+		}
+
+		ops := []struct {
+			method string
+			op     *openAPIOperation
+		}{
+			{"GET", item.Get}, {"POST", item.Post}, {"PUT", item.Put}, {"DELETE", item.Delete},
+			{"OPTIONS", item.Options}, {"HEAD", item.Head}, {"PATCH", item.Patch}, {"TRACE", item.Trace},
+		}
+
+		methods := []RouteMethodData{}
+		for _, o := range ops {
+			if o.op == nil {
+				continue
+			}
+			if !isOreoMethod(o.method) {
+				res.Skipped = append(res.Skipped, OpenAPISkip{Path: path, Method: o.method, Reason: "unsupported method"})
+				continue
+			}
+			methods = append(methods, RouteMethodData{
+				Enable:     o.op.DataAuth,
+				Method:     o.method,
+				MethodDesc: firstNotEmpty(o.op.Summary, o.op.Description, o.op.OperationId),
+			})
+		}
+
+		if len(methods) == 0 {
+			continue
+		}
+
+		// 已存在的路由会与方法合并，只需要检测新增的路由
+		if _, ok := exist[url]; !ok {
+			if conflictUrl, ok := routeConflictCheck(oldUrls, url); !ok {
+				res.Conflicts = append(res.Conflicts, RouteConflict{Url: url, ConflictUrl: conflictUrl})
+				continue
+			}
+			oldUrls = append(oldUrls, url)
+			exist[url] = struct{}{}
+		}
+
+		res.Routes = append(res.Routes, RouteData{
+			Url:     url,
+			UrlDesc: firstNotEmpty(item.Summary, item.Description),
+			Methods: methods,
+		})
+	}
+
+	return res, nil
+}
+
+// /users/{id}/comments => /users/:id/comments
+func openAPIPathToRoute(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if len(part) > 2 && part[0] == '{' && part[len(part)-1] == '}' {
+			parts[i] = ":" + part[1:len(part)-1]
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// 目前仅支持 [GET|PUT|POST|DELETE]
+func isOreoMethod(method string) bool {
+	switch method {
+	case "GET", "POST", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+func firstNotEmpty(ss ...string) string {
+	for _, s := range ss {
+		if s = strings.TrimSpace(s); s != "" {
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,158 @@
+package route
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPIPathToRoute(t *testing.T) {
+	cases := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"static", "/users", "/users"},
+		{"param", "/users/{id}", "/users/:id"},
+		{"params", "/users/{userId}/comments/{id}", "/users/:userId/comments/:id"},
+		{"empty braces", "/users/{}", "/users/{}"},
+		{"partial braces", "/files/{name}.json", "/files/{name}.json"},
+	}
+
+	for _, c := range cases {
+		if got := openAPIPathToRoute(c.path); got != c.want {
+			t.Errorf("%s: openAPIPathToRoute(%s) = %s, want %s", c.name, c.path, got, c.want)
+		}
+	}
+}
+
+const openAPITestJSON = `{
+  "openapi": "3.0.0",
+  "paths": {
+    "/users/{id}": {
+      "summary": "user",
+      "get": {"summary": "get user"},
+      "post": {"operationId": "updateUser", "x-oreo-data-auth": true},
+      "patch": {"summary": "patch user"}
+    },
+    "/users": {
+      "get": {"description": " list users "}
+    },
+    "/health": {
+      "head": {}
+    },
+    "/bad path": {
+      "get": {}
+    }
+  }
+}`
+
+const openAPITestYAML = `
+swagger: "2.0"
+paths:
+  /Orders/{orderId}:
+    description: order
+    delete:
+      summary: delete order
+      x-oreo-data-auth: true
+`
+
+// 路由格式为 "POST /api/users/:id(data) updateUser"
+func formatOpenAPIImport(res OpenAPIImport) ([]string, []string, []string) {
+	routes := []string{}
+	for _, r := range res.Routes {
+		for _, m := range r.Methods {
+			s := m.Method + " " + r.Url
+			if m.Enable {
+				s += "(data)"
+			}
+			routes = append(routes, strings.TrimSpace(s+" "+m.MethodDesc))
+		}
+	}
+	skipped := []string{}
+	for _, s := range res.Skipped {
+		skipped = append(skipped, strings.TrimSpace(fmt.Sprintf("%s %s: %s", s.Method, s.Path, s.Reason)))
+	}
+	conflicts := []string{}
+	for _, c := range res.Conflicts {
+		conflicts = append(conflicts, c.Url+" -> "+c.ConflictUrl)
+	}
+	return routes, skipped, conflicts
+}
+
+func TestParseOpenAPI(t *testing.T) {
+	cases := []struct {
+		name      string
+		data      string
+		basePath  string
+		existUrls []string
+		routes    []string
+		skipped   []string
+		conflicts []string
+		err       string
+	}{
+		{"json", openAPITestJSON, "/api/", nil, []string{
+			"GET /api/users list users",
+			"GET /api/users/:id get user",
+			"POST /api/users/:id(data) updateUser",
+		}, []string{
+			"/bad path: route [/api/bad path] just support [a-zA-Z0-9-/_*:]",
+			"HEAD /health: unsupported method",
+			"PATCH /users/{id}: unsupported method",
+		}, []string{}, ""},
+		{"yaml", openAPITestYAML, "", nil, []string{
+			"DELETE /orders/:orderid(data) delete order",
+		}, []string{}, []string{}, ""},
+		{"merge exist route", openAPITestJSON, "/api", []string{"/api/users/:id"}, []string{
+			"GET /api/users list users",
+			"GET /api/users/:id get user",
+			"POST /api/users/:id(data) updateUser",
+		}, []string{
+			"/bad path: route [/api/bad path] just support [a-zA-Z0-9-/_*:]",
+			"HEAD /health: unsupported method",
+			"PATCH /users/{id}: unsupported method",
+		}, []string{}, ""},
+		{"conflict with exist route", openAPITestJSON, "/api", []string{"/api/users/me"}, []string{
+			"GET /api/users list users",
+		}, []string{
+			"/bad path: route [/api/bad path] just support [a-zA-Z0-9-/_*:]",
+			"HEAD /health: unsupported method",
+			"PATCH /users/{id}: unsupported method",
+		}, []string{"/api/users/:id -> /api/users/me"}, ""},
+		{"conflict in document", `{"openapi": "3.0.0", "paths": {
+			"/files/{name}": {"get": {}},
+			"/files/*path": {"get": {}}
+		}}`, "", nil, []string{
+			"GET /files/*path",
+		}, []string{}, []string{"/files/:name -> /files/*path"}, ""},
+		{"not openapi", `{"paths": {}}`, "", nil, nil, nil, nil, "not an openapi document"},
+		{"invalid json", `{"openapi": `, "", nil, nil, nil, nil, "parse openapi json exception"},
+		{"invalid yaml", "openapi: [3", "", nil, nil, nil, nil, "parse openapi yaml exception"},
+	}
+
+	for _, c := range cases {
+		res, err := ParseOpenAPI([]byte(c.data), c.basePath, c.existUrls)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: ParseOpenAPI error = %v, want %q", c.name, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+			continue
+		}
+
+		routes, skipped, conflicts := formatOpenAPIImport(res)
+		if !reflect.DeepEqual(routes, c.routes) {
+			t.Errorf("%s: routes = %q, want %q", c.name, routes, c.routes)
+		}
+		if !reflect.DeepEqual(skipped, c.skipped) {
+			t.Errorf("%s: skipped = %q, want %q", c.name, skipped, c.skipped)
+		}
+		if !reflect.DeepEqual(conflicts, c.conflicts) {
+			t.Errorf("%s: conflicts = %q, want %q", c.name, conflicts, c.conflicts)
+		}
+	}
+}
@@ -317,3 +317,8 @@ func routeConflictCheck(oldRoutes []string, newRoute string) (string, bool) {
 
 	return "", true
 }
+
+// 校验路由是否符合oreo的路由规则
+func RouteRuleCheck(url string) error {
+	return routeRuleCheck(strings.TrimSpace(strings.ToLower(url)))
+}
@@ -0,0 +1,91 @@
+package oreo
+
+import (
+	"strings"
+)
+
+// 将RPC的完整方法名映射为oreo中注册的路由和method，ok为false表示该方法不需要校验权限
+type RPCMethodMapper func(fullMethod string) (url, method string, ok bool)
+
+type RPCOptions struct {
+	Mapper     RPCMethodMapper // 默认使用DefaultRPCMethodMapper
+	UserIdKey  string          // metadata中userId的key，默认为userid
+	SignKeyKey string          // metadata中signKey的key，默认为signkey
+}
+
+// 没有路由或数据权限，Reason为CheckUserAuth返回的原因
+type PermissionDeniedError struct {
+	Reason string
+}
+
+func (e *PermissionDeniedError) Error() string {
+	return e.Reason
+}
+
+// /helloworld.Greeter/SayHello => POST /helloworld/greeter/sayhello，oreo的路由不支持'.'
+func DefaultRPCMethodMapper(fullMethod string) (string, string, bool) {
+	url := strings.ToLower(strings.Replace(fullMethod, ".", "/", -1))
+	return url, "POST", true
+}
+
+// 按配置的映射表将RPC方法映射为路由，key为完整方法名，不在映射表中的方法使用fallback，fallback为nil时不校验
+func MapRPCMethods(routes map[string]RouteMethod, fallback RPCMethodMapper) RPCMethodMapper {
+	return func(fullMethod string) (string, string, bool) {
+		if rm, ok := routes[fullMethod]; ok {
+			return rm.Url, rm.Method, true
+		}
+		if fallback != nil {
+			return fallback(fullMethod)
+		}
+		return "", "", false
+	}
+}
+
+type RouteMethod struct {
+	Url    string
+	Method string
+}
+
+func (opts RPCOptions) withDefault() RPCOptions {
+	if opts.Mapper == nil {
+		opts.Mapper = DefaultRPCMethodMapper
+	}
+	if opts.UserIdKey == "" {
+		opts.UserIdKey = "userid"
+	}
+	if opts.SignKeyKey == "" {
+		opts.SignKeyKey = "signkey"
+	}
+	return opts
+}
+
+// 校验RPC调用的权限，md为请求的metadata(key为小写)，与具体的RPC框架无关，
+// 未登录返回ErrUnauthenticated，没有权限返回*PermissionDeniedError
+func (oreo *Oreo) AuthorizeRPC(fullMethod string, md map[string][]string, opts RPCOptions) (string, bool, error) {
+	opts = opts.withDefault()
+
+	url, method, ok := opts.Mapper(fullMethod)
+	if !ok {
+		return "", false, nil
+	}
+
+	userId := firstMetadata(md, opts.UserIdKey)
+	if userId == "" {
+		return "", false, ErrUnauthenticated
+	}
+
+	isAdmin, ok, reason := oreo.CheckUserAuth(url, method, userId, firstMetadata(md, opts.SignKeyKey))
+	if !ok {
+		return userId, isAdmin, &PermissionDeniedError{Reason: reason}
+	}
+
+	return userId, isAdmin, nil
+}
+
+func firstMetadata(md map[string][]string, key string) string {
+	vs := md[strings.ToLower(key)]
+	if len(vs) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(vs[0])
+}
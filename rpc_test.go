@@ -0,0 +1,60 @@
+package oreo
+
+import (
+	"testing"
+)
+
+func TestRPCMethodMappers(t *testing.T) {
+	mapped := MapRPCMethods(map[string]RouteMethod{
+		"/user.Service/Get": {Url: "/api/user", Method: "GET"},
+	}, nil)
+	fallback := MapRPCMethods(map[string]RouteMethod{
+		"/user.Service/Get": {Url: "/api/user", Method: "GET"},
+	}, DefaultRPCMethodMapper)
+
+	cases := []struct {
+		name       string
+		mapper     RPCMethodMapper
+		fullMethod string
+		url        string
+		method     string
+		ok         bool
+	}{
+		{"default", DefaultRPCMethodMapper, "/helloworld.Greeter/SayHello", "/helloworld/greeter/sayhello", "POST", true},
+		{"mapped", mapped, "/user.Service/Get", "/api/user", "GET", true},
+		{"not mapped", mapped, "/user.Service/List", "", "", false},
+		{"fallback", fallback, "/user.Service/List", "/user/service/list", "POST", true},
+	}
+
+	for _, c := range cases {
+		url, method, ok := c.mapper(c.fullMethod)
+		if url != c.url || method != c.method || ok != c.ok {
+			t.Errorf("%s: mapper = %s %s %t, want %s %s %t", c.name, url, method, ok, c.url, c.method, c.ok)
+		}
+	}
+}
+
+// 不需要校验的方法和未登录的调用不会查询权限
+func TestAuthorizeRPCWithoutUser(t *testing.T) {
+	oreo := planTestOreo()
+	skip := RPCOptions{Mapper: MapRPCMethods(nil, nil)}
+
+	cases := []struct {
+		name string
+		md   map[string][]string
+		opts RPCOptions
+		err  error
+	}{
+		{"not mapped", nil, skip, nil},
+		{"no metadata", nil, RPCOptions{}, ErrUnauthenticated},
+		{"blank userId", map[string][]string{"userid": {" "}}, RPCOptions{}, ErrUnauthenticated},
+		{"custom key", map[string][]string{"userid": {"u1"}}, RPCOptions{UserIdKey: "x-user"}, ErrUnauthenticated},
+	}
+
+	for _, c := range cases {
+		userId, _, err := oreo.AuthorizeRPC("/user.Service/Get", c.md, c.opts)
+		if err != c.err || userId != "" {
+			t.Errorf("%s: AuthorizeRPC = %q, %v, want %v", c.name, userId, err, c.err)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package oreo
+
+import "github.com/xkeyideal/oreo/authoperate"
+
+// 委托userId管理带有标签tag的角色的成员
+func (oreo *Oreo) GrantRoleUserScope(userId, tag, createUserId string) (authoperate.AdminScope, error) {
+	return oreo.auth.ScopeAdd(userId, authoperate.ScopeRoleUser, tag, createUserId)
+}
+
+// 委托userId修改uriPrefix下的路由
+func (oreo *Oreo) GrantRouteScope(userId, uriPrefix, createUserId string) (authoperate.AdminScope, error) {
+	return oreo.auth.ScopeAdd(userId, authoperate.ScopeRoute, uriPrefix, createUserId)
+}
+
+// 查询委托的管理范围，userId为空时返回所有
+func (oreo *Oreo) ListAdminScopes(userId string) ([]authoperate.AdminScope, error) {
+	return oreo.auth.ScopeList(userId)
+}
+
+// 收回委托的管理范围
+func (oreo *Oreo) RevokeAdminScope(id string) error {
+	return oreo.auth.ScopeRemove(id)
+}
+
+// userId是否被委托管理角色的成员，不包含超管的判断
+func (oreo *Oreo) CanManageRoleUsers(userId, roleName string) (bool, error) {
+	return oreo.auth.ScopeCheckRoleUser(userId, roleName)
+}
+
+// userId是否被委托修改路由，不包含超管的判断
+func (oreo *Oreo) CanEditRoute(userId, uri string) (bool, error) {
+	return oreo.auth.ScopeCheckRoute(userId, uri)
+}
@@ -0,0 +1,19 @@
+package oreo
+
+import "github.com/xkeyideal/oreo/authoperate"
+
+// 设置搜索时使用的拼音转换，设置后纯字母的关键字还会匹配中文用户名和路由描述的全拼或首字母，
+// 需要在提供服务之前设置。拼音在写入时计算，设置时会为已有的用户和路由补算拼音
+func (oreo *Oreo) SetPinyinConverter(fn authoperate.PinyinFunc) error {
+	return oreo.auth.SetPinyin(fn)
+}
+
+// 按userId或name搜索用户，关键字按字面匹配且不区分大小写
+func (oreo *Oreo) SearchUsers(opts authoperate.SearchOptions) ([]authoperate.UserDetail, error) {
+	return oreo.auth.UserSearch(opts)
+}
+
+// 按uri或描述搜索路由，关键字按字面匹配且不区分大小写
+func (oreo *Oreo) SearchRoutes(opts authoperate.SearchOptions) ([]authoperate.RouteListView, error) {
+	return oreo.auth.RouteSearch(opts)
+}
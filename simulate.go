@@ -0,0 +1,136 @@
+package oreo
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/xkeyideal/oreo/authoperate"
+	"github.com/xkeyideal/oreo/route"
+)
+
+// 一次权限校验的记录，每行一个JSON，Allow为空时用当前的权限数据重新计算
+type CheckRecord struct {
+	Url     string `json:"url"`
+	Method  string `json:"method"`
+	UserId  string `json:"userId"`
+	SignKey string `json:"signKey"`
+	Allow   *bool  `json:"allow,omitempty"`
+}
+
+// 重放时判断结果发生变化的校验记录
+type CheckFlip struct {
+	Line   int         `json:"line"`
+	Record CheckRecord `json:"record"`
+	Before bool        `json:"before"`
+	After  bool        `json:"after"`
+	Reason string      `json:"reason"` //变更后拒绝的原因
+}
+
+// 模拟变更，返回哪些用户获得或失去哪些路由和数据权限，不会写入数据库
+func (oreo *Oreo) SimulatePolicy(changes []authoperate.PolicyChange) ([]authoperate.PermissionDiff, error) {
+	before, after, err := oreo.simulateState(changes)
+	if err != nil {
+		return nil, err
+	}
+
+	return authoperate.DiffPermissions(before, after), nil
+}
+
+// 用模拟变更后的权限重放历史的校验记录，返回判断结果会发生变化的记录
+func (oreo *Oreo) SimulateReplay(changes []authoperate.PolicyChange, records io.Reader) ([]CheckFlip, error) {
+	before, after, err := oreo.simulateState(changes)
+	if err != nil {
+		return nil, err
+	}
+
+	return replayRecords(before, after, records)
+}
+
+// 分别用变更前后的权限重放校验记录，记录中带有allow时以其作为变更前的结果
+func replayRecords(before, after *authoperate.PolicyState, records io.Reader) ([]CheckFlip, error) {
+	beforeMatcher := route.NewRouteMatcher(before.Routers)
+	afterMatcher := route.NewRouteMatcher(after.Routers)
+
+	flips := []CheckFlip{}
+
+	scanner := bufio.NewScanner(records)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		record := CheckRecord{}
+		if err := json.Unmarshal([]byte(text), &record); err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+
+		var allowBefore bool
+		if record.Allow != nil {
+			allowBefore = *record.Allow
+		} else {
+			allowBefore, _ = replayCheck(before, beforeMatcher, record)
+		}
+
+		allowAfter, reason := replayCheck(after, afterMatcher, record)
+
+		if allowBefore != allowAfter {
+			flips = append(flips, CheckFlip{
+				Line:   line,
+				Record: record,
+				Before: allowBefore,
+				After:  allowAfter,
+				Reason: reason,
+			})
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return flips, nil
+}
+
+func (oreo *Oreo) simulateState(changes []authoperate.PolicyChange) (*authoperate.PolicyState, *authoperate.PolicyState, error) {
+	before, err := oreo.auth.PolicyStateLoad()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	after := before.Clone()
+	for _, change := range changes {
+		change.Uri = strings.ToLower(strings.TrimSpace(change.Uri))
+		change.Method = strings.ToUpper(strings.TrimSpace(change.Method))
+		// 复制一份再规范化，不修改调用方传入的AddrList
+		addrs := make([]authoperate.Address, len(change.AddrList))
+		for i, addr := range change.AddrList {
+			addr.Uri = strings.ToLower(strings.TrimSpace(addr.Uri))
+			addrs[i] = addr
+		}
+		change.AddrList = addrs
+
+		if err := after.Apply(change); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return before, after, nil
+}
+
+func replayCheck(state *authoperate.PolicyState, matcher *route.RouteMatcher, record CheckRecord) (bool, string) {
+	method := strings.TrimSpace(strings.ToUpper(record.Method))
+
+	rawurl, ok := matcher.Match(method, record.Url)
+	if !ok {
+		return false, fmt.Sprintf("[%s %s] - 路由未匹配成功", method, record.Url)
+	}
+
+	_, allow, reason := state.CheckAuth(rawurl, method, record.UserId, record.SignKey)
+	return allow, reason
+}
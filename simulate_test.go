@@ -0,0 +1,100 @@
+package oreo
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xkeyideal/oreo/authoperate"
+)
+
+// /api/a的POST开启了数据权限，editor拥有/api/a和/api/users/:id，u2创建了k2，viewer拥有/api/b
+func replayTestState() *authoperate.PolicyState {
+	key := func(num, uri string) string {
+		return num + "_/oreo/_" + uri
+	}
+
+	return &authoperate.PolicyState{
+		Routers: []authoperate.RouterInfo{
+			{Uri: "/api/a", MethodMap: map[string]authoperate.VerifyData{"1": {}, "2": {Enable: true}}},
+			{Uri: "/api/b", MethodMap: map[string]authoperate.VerifyData{"1": {}}},
+			{Uri: "/api/users/:id", MethodMap: map[string]authoperate.VerifyData{"1": {}}},
+		},
+		Roles: []authoperate.RoleInfo{
+			{RoleName: "editor", UserIds: []string{"u2"}, RouterMap: map[string]bool{
+				key("1", "/api/a"): false, key("2", "/api/a"): true, key("1", "/api/users/:id"): false,
+			}},
+			{RoleName: "viewer", UserIds: []string{"u3"}, RouterMap: map[string]bool{key("1", "/api/b"): false}},
+		},
+		Users: []authoperate.UserInfo{{UserId: "u2", SignKey: map[string]string{"k2": ""}}, {UserId: "u3"}},
+	}
+}
+
+func TestReplayRecords(t *testing.T) {
+	removeU2 := []authoperate.PolicyChange{{Type: authoperate.ChangeRoleRemoveUser, RoleName: "editor", UserIds: []string{"u2"}}}
+	disablePost := []authoperate.PolicyChange{{Type: authoperate.ChangeRouteDisable, Uri: "/api/a", Method: "POST"}}
+
+	cases := []struct {
+		name    string
+		changes []authoperate.PolicyChange
+		records string
+		flips   []string
+		err     string
+	}{
+		{"no changes", nil, `{"url":"/api/a","method":"GET","userId":"u2"}`, []string{}, ""},
+		{"lose role", removeU2, strings.Join([]string{
+			`{"url":"/api/a","method":"get","userId":"u2"}`,
+			``,
+			`{"url":"/api/b","method":"GET","userId":"u3"}`,
+			`{"url":"/api/users/7","method":"GET","userId":"u2"}`,
+			`{"url":"/api/a","method":"POST","userId":"u2","signKey":"k2"}`,
+		}, "\n"), []string{
+			"1 true->false [u2]没有路由[GET /api/a]的角色权限",
+			"4 true->false [u2]没有路由[GET /api/users/:id]的角色权限",
+			"5 true->false [u2]没有路由[POST /api/a]的角色权限",
+		}, ""},
+		{"recorded allow", disablePost, strings.Join([]string{
+			`{"url":"/api/a","method":"POST","userId":"u2","signKey":"k2","allow":true}`,
+			`{"url":"/api/a","method":"POST","userId":"u3","allow":false}`,
+			`{"url":"/api/b","method":"GET","userId":"u2","allow":true}`,
+		}, "\n"), []string{
+			"1 true->false [POST /api/a] - 路由未匹配成功",
+			"3 true->false [u2]没有路由[GET /api/b]的角色权限",
+		}, ""},
+		{"data auth", nil, `{"url":"/api/a","method":"POST","userId":"u2","signKey":"k9","allow":true}`, []string{
+			"1 true->false [u2 k9]没有[POST /api/a]数据权限",
+		}, ""},
+		{"invalid record", nil, "{\"url\":\"/api/a\"}\nnot json", nil, "line 2:"},
+	}
+
+	for _, c := range cases {
+		before := replayTestState()
+		after := before.Clone()
+		for _, change := range c.changes {
+			if err := after.Apply(change); err != nil {
+				t.Fatalf("%s: %v", c.name, err)
+			}
+		}
+
+		flips, err := replayRecords(before, after, strings.NewReader(c.records))
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: replayRecords error = %v, want %q", c.name, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+			continue
+		}
+
+		got := []string{}
+		for _, f := range flips {
+			got = append(got, fmt.Sprintf("%d %t->%t %s", f.Line, f.Before, f.After, f.Reason))
+		}
+		if !reflect.DeepEqual(got, c.flips) {
+			t.Errorf("%s: flips = %q, want %q", c.name, got, c.flips)
+		}
+	}
+}
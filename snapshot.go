@@ -0,0 +1,175 @@
+package oreo
+
+import (
+	"reflect"
+
+	"github.com/xkeyideal/oreo/authoperate"
+)
+
+// 默认保留的自动快照数量
+const defaultSnapshotKeep = 20
+
+// 设置批量修改之前的自动快照，keep为保留的自动快照数量，为0时关闭自动快照。
+// 只有导入、应用策略、提升和恢复快照会自动创建快照，单个角色或路由的修改不会
+func (oreo *Oreo) SetAutoSnapshot(keep int) {
+	if keep < 0 {
+		keep = 0
+	}
+	oreo.snapshotKeep = keep
+}
+
+// 批量修改之前创建快照，并清理超出保留数量的自动快照
+func (oreo *Oreo) autoSnapshot(reason string) error {
+	if oreo.snapshotKeep == 0 {
+		return nil
+	}
+
+	archive, err := oreo.auth.SnapshotLoad()
+	if err != nil {
+		return err
+	}
+
+	if _, err := oreo.auth.SnapshotSave(archive, reason, true); err != nil {
+		return err
+	}
+
+	return oreo.auth.SnapshotPruneAuto(oreo.snapshotKeep)
+}
+
+// 导出组内当前的路由、角色、用户和sign授权，不保存为快照
+func (oreo *Oreo) ExportSnapshot() (*authoperate.SnapshotArchive, error) {
+	return oreo.auth.SnapshotLoad()
+}
+
+// 手动创建快照，手动创建的快照不会被自动清理
+func (oreo *Oreo) CreateSnapshot(reason string) (authoperate.SnapshotInfo, error) {
+	archive, err := oreo.auth.SnapshotLoad()
+	if err != nil {
+		return authoperate.SnapshotInfo{}, err
+	}
+
+	return oreo.auth.SnapshotSave(archive, reason, false)
+}
+
+// 按编号倒序列出组内的快照
+func (oreo *Oreo) ListSnapshots() ([]authoperate.SnapshotInfo, error) {
+	return oreo.auth.SnapshotList()
+}
+
+// 查询快照的全部数据，快照不存在时返回authoperate.ErrNotFound
+func (oreo *Oreo) GetSnapshot(seq int64) (*authoperate.SnapshotArchive, error) {
+	return oreo.auth.SnapshotGet(seq)
+}
+
+// 删除快照，快照不存在时返回authoperate.ErrNotFound
+func (oreo *Oreo) DeleteSnapshot(seq int64) error {
+	return oreo.auth.SnapshotDelete(seq)
+}
+
+// 用归档替换组内的全部数据，归档可以来自其他组。恢复之前会自动创建快照，
+// 恢复失败时返回*authoperate.TxnError，恢复后按角色成员、角色路由和sign授权的变化发布权限变更事件
+func (oreo *Oreo) RestoreSnapshot(archive *authoperate.SnapshotArchive) error {
+	current, err := oreo.auth.SnapshotLoad()
+	if err != nil {
+		return err
+	}
+
+	if err := oreo.autoSnapshot("before restore snapshot"); err != nil {
+		return err
+	}
+
+	if err := oreo.auth.SnapshotRestore(archive); err != nil {
+		return err
+	}
+
+	if err := oreo.route.LoadRoutesFromDb(oreo.groupName); err != nil {
+		return err
+	}
+
+	for _, event := range restoreEvents(current, archive) {
+		oreo.auth.EventPublish(event)
+	}
+	return nil
+}
+
+// 恢复前后角色成员、角色路由、sign授权和默认角色的变化对应的事件，路由可能整体变化，总是通知所有用户
+func restoreEvents(current, archive *authoperate.SnapshotArchive) []authoperate.PermissionEvent {
+	events := []authoperate.PermissionEvent{
+		{Type: authoperate.EventRouteUpdate, UserIds: []string{authoperate.EventAllUsers}},
+	}
+
+	roles := func(a *authoperate.SnapshotArchive) (map[string]authoperate.RoleInfo, []string, string) {
+		m := make(map[string]authoperate.RoleInfo)
+		names := []string{}
+		defaultRole := ""
+		for _, role := range a.Roles {
+			m[role.RoleName] = role
+			names = append(names, role.RoleName)
+			if role.IsDefault {
+				defaultRole = role.RoleName
+			}
+		}
+		return m, names, defaultRole
+	}
+	oldRoles, oldNames, oldDefault := roles(current)
+	newRoles, newNames, newDefault := roles(archive)
+
+	for _, name := range mergeStrings(oldNames, newNames) {
+		oldRole, newRole := oldRoles[name], newRoles[name]
+		granted := stringsMinus(newRole.UserIds, oldRole.UserIds)
+		if len(granted) > 0 {
+			events = append(events, authoperate.PermissionEvent{Type: authoperate.EventRoleGrant, UserIds: granted, RoleName: name})
+		}
+		if revoked := stringsMinus(oldRole.UserIds, newRole.UserIds); len(revoked) > 0 {
+			events = append(events, authoperate.PermissionEvent{Type: authoperate.EventRoleRevoke, UserIds: revoked, RoleName: name})
+		}
+		// 恢复前后都在角色中的用户，角色的路由或类型变化时通知
+		kept := stringsMinus(newRole.UserIds, granted)
+		if len(kept) > 0 && (oldRole.Type != newRole.Type || !reflect.DeepEqual(roleUrlMethod(oldRole), roleUrlMethod(newRole))) {
+			events = append(events, authoperate.PermissionEvent{Type: authoperate.EventRoleUpdate, UserIds: kept, RoleName: name})
+		}
+	}
+
+	if oldDefault != newDefault {
+		events = append(events, authoperate.PermissionEvent{Type: authoperate.EventDefaultRole, UserIds: []string{authoperate.EventAllUsers}, RoleName: newDefault})
+	}
+
+	signs := func(a *authoperate.SnapshotArchive) (map[string]authoperate.SignInfo, []string) {
+		m := make(map[string]authoperate.SignInfo)
+		keys := []string{}
+		for _, sign := range a.Signs {
+			key := sign.SignKey + "\x00" + sign.UserId
+			m[key] = sign
+			keys = append(keys, key)
+		}
+		return m, keys
+	}
+	oldSigns, oldKeys := signs(current)
+	newSigns, newKeys := signs(archive)
+
+	for _, key := range mergeStrings(oldKeys, newKeys) {
+		oldSign, oldOk := oldSigns[key]
+		newSign, newOk := newSigns[key]
+		switch {
+		case !newOk:
+			events = append(events, authoperate.PermissionEvent{Type: authoperate.EventSignRevoke, UserIds: []string{oldSign.UserId}, SignKey: oldSign.SignKey})
+		case !oldOk:
+			events = append(events, authoperate.PermissionEvent{Type: authoperate.EventSignGrant, UserIds: []string{newSign.UserId}, SignKey: newSign.SignKey})
+		case !reflect.DeepEqual(oldSign.VerifyDataUri, newSign.VerifyDataUri):
+			// 授权的路由可能同时增加和减少，按撤销通知，前端会重新查询授权
+			events = append(events, authoperate.PermissionEvent{Type: authoperate.EventSignRevoke, UserIds: []string{newSign.UserId}, SignKey: newSign.SignKey})
+		}
+	}
+
+	return events
+}
+
+// 回滚到组内编号为seq的快照，快照不存在时返回authoperate.ErrNotFound
+func (oreo *Oreo) RollbackSnapshot(seq int64) error {
+	archive, err := oreo.auth.SnapshotGet(seq)
+	if err != nil {
+		return err
+	}
+
+	return oreo.RestoreSnapshot(archive)
+}
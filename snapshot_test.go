@@ -0,0 +1,69 @@
+package oreo
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xkeyideal/oreo/authoperate"
+)
+
+func TestRestoreEvents(t *testing.T) {
+	addr := func(value int) []authoperate.Address {
+		return []authoperate.Address{{Uri: "/api/a", MethodValue: value}}
+	}
+	current := &authoperate.SnapshotArchive{
+		Roles: []authoperate.RoleInfo{
+			{RoleName: "admin", Type: 1, UserIds: []string{"u1"}, Address: addr(1)},
+			{RoleName: "viewer", IsDefault: true, UserIds: []string{"u2", "u3"}, Address: addr(1)},
+			{RoleName: "old", UserIds: []string{"u4"}},
+		},
+		Signs: []authoperate.SignInfo{
+			{SignKey: "k1", UserId: "u2", VerifyDataUri: map[string]int{"/api/a": 1}},
+			{SignKey: "k2", UserId: "u3", VerifyDataUri: map[string]int{"/api/a": 1}},
+			{SignKey: "k3", UserId: "u1", VerifyDataUri: map[string]int{"/api/a": 1}},
+		},
+	}
+
+	cases := []struct {
+		name    string
+		archive *authoperate.SnapshotArchive
+		want    []string
+	}{
+		{"unchanged", current, []string{"route_update [*]"}},
+		{"members, routes, default and signs", &authoperate.SnapshotArchive{
+			Roles: []authoperate.RoleInfo{
+				{RoleName: "admin", Type: 1, UserIds: []string{"u1"}, Address: addr(1)},
+				{RoleName: "viewer", UserIds: []string{"u3", "u5"}, Address: addr(3)},
+				{RoleName: "new", IsDefault: true, UserIds: []string{"u4"}},
+			},
+			Signs: []authoperate.SignInfo{
+				{SignKey: "k1", UserId: "u2", VerifyDataUri: map[string]int{"/api/a": 1}},
+				{SignKey: "k2", UserId: "u3", VerifyDataUri: map[string]int{"/api/a": 3}},
+				{SignKey: "k4", UserId: "u5", VerifyDataUri: map[string]int{"/api/a": 1}},
+			},
+		}, []string{
+			"route_update [*]",
+			"role_grant [u4] new",
+			"role_revoke [u4] old",
+			"role_grant [u5] viewer",
+			"role_revoke [u2] viewer",
+			"role_update [u3] viewer",
+			"default_role [*] new",
+			"sign_revoke [u3] k2",
+			"sign_revoke [u1] k3",
+			"sign_grant [u5] k4",
+		}},
+	}
+
+	for _, c := range cases {
+		got := []string{}
+		for _, event := range restoreEvents(current, c.archive) {
+			got = append(got, strings.TrimSpace(fmt.Sprintf("%s %v %s%s", event.Type, event.UserIds, event.RoleName, event.SignKey)))
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: events = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
@@ -11,3 +11,13 @@ type route struct {
 func (r *route) String() string {
 	return r.method + "  " + r.path
 }
+
+// Method - the http method of the route
+func (r *route) Method() string {
+	return r.method
+}
+
+// Path - the path template of the route
+func (r *route) Path() string {
+	return r.path
+}